@@ -0,0 +1,158 @@
+// account-service/chart_templates.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "sort"
+    "time"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// templateAccount is an account in a chart template. Parents come before their children.
+type templateAccount struct {
+    Code       string
+    Name       string
+    Type       string
+    ParentCode string
+}
+
+// defaultChartTemplate is seeded when no template is named
+const defaultChartTemplate = "standard"
+
+// standardAccounts is the chart for trading businesses, following the codes of the seeded
+// demo company: 1xxx assets, 2xxx liabilities, 3xxx equity, 4xxx revenue, 5xxx expenses
+var standardAccounts = []templateAccount{
+    {"1000", "Kas dan Setara Kas", "Asset", ""},
+    {"1010", "Kas", "Asset", "1000"},
+    {"1020", "Kas Kecil", "Asset", "1000"},
+    {"1030", "Bank", "Asset", "1000"},
+    {"1100", "Piutang Usaha", "Asset", ""},
+    {"1200", "Persediaan", "Asset", ""},
+    {"1300", "Biaya Dibayar Dimuka", "Asset", ""},
+    {"1310", "PPN Masukan", "Asset", "1300"},
+    {"1320", "PPh Dibayar Dimuka", "Asset", "1300"},
+    {"1400", "Aset Tetap", "Asset", ""},
+    {"1500", "Akumulasi Penyusutan", "Asset", ""},
+    {"2000", "Utang Usaha", "Liability", ""},
+    {"2100", "Biaya Yang Masih Harus Dibayar", "Liability", ""},
+    {"2200", "Utang Jangka Pendek", "Liability", ""},
+    {"2300", "Utang Jangka Panjang", "Liability", ""},
+    {"2400", "Utang PPN", "Liability", ""},
+    {"2410", "Utang PPh 21", "Liability", "2400"},
+    {"2420", "Utang PPh 23", "Liability", "2400"},
+    {"3000", "Modal Saham", "Equity", ""},
+    {"3100", "Laba Ditahan", "Equity", ""},
+    {"3200", "Laba Tahun Berjalan", "Equity", ""},
+    {"4000", "Pendapatan Penjualan", "Revenue", ""},
+    {"4100", "Pendapatan Jasa", "Revenue", ""},
+    {"4200", "Pendapatan Lain-lain", "Revenue", ""},
+    {"5000", "Harga Pokok Penjualan", "Expense", ""},
+    {"5100", "Biaya Operasional", "Expense", ""},
+    {"5110", "Beban Gaji", "Expense", "5100"},
+    {"5120", "Beban Sewa", "Expense", "5100"},
+    {"5130", "Beban Listrik, Air dan Telepon", "Expense", "5100"},
+    {"5200", "Biaya Penyusutan", "Expense", ""},
+    {"5300", "Biaya Bunga", "Expense", ""},
+    {"5400", "Biaya Pajak", "Expense", ""},
+}
+
+// chartTemplates are the charts a company can start from. Service businesses hold no stock,
+// so theirs leaves out inventory and cost of goods sold.
+var chartTemplates = map[string][]templateAccount{
+    "standard": standardAccounts,
+    "services": withoutAccounts(standardAccounts, "1200", "5000"),
+}
+
+func withoutAccounts(accounts []templateAccount, codes ...string) []templateAccount {
+    excluded := make(map[string]bool, len(codes))
+    for _, code := range codes {
+        excluded[code] = true
+    }
+    var kept []templateAccount
+    for _, account := range accounts {
+        if !excluded[account.Code] {
+            kept = append(kept, account)
+        }
+    }
+    return kept
+}
+
+func chartTemplateNames() []string {
+    names := make([]string, 0, len(chartTemplates))
+    for name := range chartTemplates {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func (s *AccountService) getChartTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+    templates := make(map[string]int, len(chartTemplates))
+    for name, accounts := range chartTemplates {
+        templates[name] = len(accounts)
+    }
+    s.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+        "default":   defaultChartTemplate,
+        "templates": templates,
+    })
+}
+
+// seedAccountsHandler creates the accounts of a chart template for the caller's company.
+// Accounts whose code the company already uses are left as they are, so seeding can be
+// retried after a partial failure without creating duplicates.
+func (s *AccountService) seedAccountsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+    
+    var req struct {
+        Template string `json:"template"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    if req.Template == "" {
+        req.Template = defaultChartTemplate
+    }
+    
+    validator := validation.New()
+    validator.OneOf("template", req.Template, chartTemplateNames())
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    created := 0
+    
+    err := s.WithTransaction(ctx, func(tx *sql.Tx) error {
+        for _, account := range chartTemplates[req.Template] {
+            result, err := tx.ExecContext(ctx, `
+                INSERT INTO chart_of_accounts (company_id, account_code, account_name, account_type, parent_id)
+                VALUES ($1, $2, $3, $4,
+                        (SELECT id FROM chart_of_accounts WHERE company_id = $1 AND account_code = NULLIF($5, '')))
+                ON CONFLICT (company_id, account_code) DO NOTHING`,
+                companyID, account.Code, account.Name, account.Type, account.ParentCode)
+            if err != nil {
+                return err
+            }
+            if rows, _ := result.RowsAffected(); rows > 0 {
+                created++
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        s.HandleDBError(w, err, "Error seeding chart of accounts")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+        "template": req.Template,
+        "created":  created,
+    })
+}
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
     "context"
     "database/sql"
     "encoding/json"
+    "fmt"
     "net/http"
     "strconv"
     "time"
@@ -13,6 +14,7 @@ import (
     _ "github.com/lib/pq"
     
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/database"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
@@ -41,20 +43,23 @@ type GeneralLedger struct {
     ID              int       `json:"id"`
     CompanyID       int       `json:"company_id"`
     AccountID       int       `json:"account_id"`
-    TransactionDate time.Time `json:"transaction_date"`
-    Description     string    `json:"description"`
-    DebitAmount     float64   `json:"debit_amount"`
-    CreditAmount    float64   `json:"credit_amount"`
+    TransactionDate service.JakartaTime `json:"transaction_date"`
+    Description     string              `json:"description"`
+    DebitAmount     service.Rupiah      `json:"debit_amount"`
+    CreditAmount    service.Rupiah      `json:"credit_amount"`
     ReferenceID     string    `json:"reference_id"`
     CreatedAt       time.Time `json:"created_at"`
 }
 
 func main() {
+    logger.Init("account-service")
+    
     cfg := config.Load()
     cfg.Database.Name = "account_db"
     
     db := database.InitDatabase(cfg.Database)
     defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
     
     accountService := &AccountService{
         BaseService: &service.BaseService{DB: db},
@@ -63,14 +68,22 @@ func main() {
     r := mux.NewRouter()
     
     r.Handle("/health", middleware.HealthCheck(db, "account-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "account-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+    })).Methods("GET")
     
     authMiddleware := middleware.NewAuthMiddleware(cfg.JWT.Secret)
+    accountantMiddleware := middleware.Chain(authMiddleware, middleware.RequireRole("accountant"))
     r.Handle("/accounts", authMiddleware(accountService.getAccountsHandler)).Methods("GET")
-    r.Handle("/accounts", authMiddleware(accountService.createAccountHandler)).Methods("POST")
+    r.Handle("/accounts", accountantMiddleware(accountService.createAccountHandler)).Methods("POST")
+    r.Handle("/accounts/templates", authMiddleware(accountService.getChartTemplatesHandler)).Methods("GET")
+    r.Handle("/accounts/seed", accountantMiddleware(accountService.seedAccountsHandler)).Methods("POST")
     r.Handle("/accounts/{id}", authMiddleware(accountService.getAccountHandler)).Methods("GET")
-    r.Handle("/accounts/{id}", authMiddleware(accountService.updateAccountHandler)).Methods("PUT")
+    r.Handle("/accounts/{id}", accountantMiddleware(accountService.updateAccountHandler)).Methods("PUT")
     r.Handle("/ledger", authMiddleware(accountService.getLedgerHandler)).Methods("GET")
-    r.Handle("/ledger", authMiddleware(accountService.createLedgerEntryHandler)).Methods("POST")
+    r.Handle("/ledger", accountantMiddleware(accountService.createLedgerEntryHandler)).Methods("POST")
 
     server.SetupServer(r, cfg)
 }
@@ -84,10 +97,35 @@ func (s *AccountService) getAccountsHandler(w http.ResponseWriter, r *http.Reque
     
     accountType := r.URL.Query().Get("type")
     activeOnly := r.URL.Query().Get("active_only") == "true"
+    startDate := r.URL.Query().Get("start_date")
+    endDate := r.URL.Query().Get("end_date")
+
+    for _, date := range []string{startDate, endDate} {
+        if date == "" {
+            continue
+        }
+        if _, err := time.Parse("2006-01-02", date); err != nil {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_DATE", "Dates must use YYYY-MM-DD format")
+            return
+        }
+    }
 
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
+    args := []interface{}{companyID}
+
+    // Date bounds belong in the join so accounts without activity in the period still appear
+    ledgerJoin := "LEFT JOIN general_ledger gl ON a.id = gl.account_id"
+    if startDate != "" {
+        args = append(args, startDate)
+        ledgerJoin += fmt.Sprintf(" AND gl.transaction_date >= $%d", len(args))
+    }
+    if endDate != "" {
+        args = append(args, endDate)
+        ledgerJoin += fmt.Sprintf(" AND gl.transaction_date <= $%d", len(args))
+    }
+
     query := `SELECT a.id, a.company_id, a.account_code, a.account_name, a.account_type, 
                      a.parent_id, a.is_active, a.created_at, a.updated_at,
                      COALESCE(SUM(
@@ -97,14 +135,12 @@ func (s *AccountService) getAccountsHandler(w http.ResponseWriter, r *http.Reque
                          END
                      ), 0) as balance
               FROM chart_of_accounts a
-              LEFT JOIN general_ledger gl ON a.id = gl.account_id
+              ` + ledgerJoin + `
               WHERE a.company_id = $1`
     
-    args := []interface{}{companyID}
-    
     if accountType != "" {
-        query += " AND a.account_type = $2"
         args = append(args, accountType)
+        query += fmt.Sprintf(" AND a.account_type = $%d", len(args))
     }
     
     if activeOnly {
@@ -146,8 +182,8 @@ func (s *AccountService) getAccountsHandler(w http.ResponseWriter, r *http.Reque
 
 func (s *AccountService) createAccountHandler(w http.ResponseWriter, r *http.Request) {
     var account Account
-    if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
-        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+    if err := service.DecodeJSONBody(w, r, &account, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
         return
     }
 
@@ -353,8 +389,8 @@ func (s *AccountService) getLedgerHandler(w http.ResponseWriter, r *http.Request
 
 func (s *AccountService) createLedgerEntryHandler(w http.ResponseWriter, r *http.Request) {
     var entry GeneralLedger
-    if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
-        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+    if err := service.DecodeJSONBody(w, r, &entry, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
         return
     }
     
@@ -384,7 +420,7 @@ func (s *AccountService) createLedgerEntryHandler(w http.ResponseWriter, r *http
     entry.CompanyID = s.GetCompanyIDFromRequest(r)
     
     if entry.TransactionDate.IsZero() {
-        entry.TransactionDate = time.Now()
+        entry.TransactionDate = service.NewJakartaTime(time.Now())
     }
 
     err := s.WithTransaction(r.Context(), func(tx *sql.Tx) error {
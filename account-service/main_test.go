@@ -0,0 +1,88 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "flag"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/massehanto/accounting-system-go/shared/database/dbtest"
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+var update = flag.Bool("update", false, "rewrite the contract fixtures from the handlers")
+
+// contractFixture is where a response other services' tests serve in place of this service
+func contractFixture(name string) string {
+    return filepath.Join("..", "shared", "testdata", "contracts", "account-service", name)
+}
+
+// GET /accounts as report-service calls it, for a company with accounts and for one without.
+// The fixtures are the handler's responses less their timestamp; after changing the response,
+// refresh them with go test -update and rerun the tests of the services that read them.
+func TestGetAccountsContract(t *testing.T) {
+    created := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+    columns := []string{"id", "company_id", "account_code", "account_name", "account_type",
+        "parent_id", "is_active", "created_at", "updated_at", "balance"}
+    cases := map[string][][]driver.Value{
+        "accounts.json": {
+            {int64(1), int64(1), "1-1000", "Kas", "Asset", nil, true, created, created, 600000.0},
+            {int64(2), int64(1), "4-1000", "Pendapatan", "Revenue", nil, true, created, created, 1000000.0},
+            {int64(3), int64(1), "5-1000", "Beban Gaji", "Expense", nil, true, created, created, 400000.0},
+        },
+        "accounts_empty.json": nil,
+    }
+    for name, rows := range cases {
+        db := dbtest.Open(&dbtest.Driver{
+            Query: func(_ *dbtest.Tx, query string, _ []driver.Value) (driver.Rows, error) {
+                if !strings.Contains(query, "FROM chart_of_accounts") {
+                    return nil, errors.New("unexpected query: " + query)
+                }
+                return dbtest.Rows(columns, rows...), nil
+            },
+        })
+        s := &AccountService{BaseService: &service.BaseService{DB: db}}
+
+        req := httptest.NewRequest("GET", "/accounts?active_only=true&start_date=2026-01-01&end_date=2026-03-31", nil)
+        req = req.WithContext(context.WithValue(req.Context(), "company_id", 1))
+        rec := httptest.NewRecorder()
+        s.getAccountsHandler(rec, req)
+        db.Close()
+        if rec.Code != 200 {
+            t.Fatalf("%s: status = %d, body = %s", name, rec.Code, rec.Body.String())
+        }
+
+        var response map[string]json.RawMessage
+        if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+            t.Fatalf("%s: decode: %v", name, err)
+        }
+        delete(response, "timestamp")
+        got, err := json.MarshalIndent(response, "", "  ")
+        if err != nil {
+            t.Fatal(err)
+        }
+        got = append(got, '\n')
+
+        if *update {
+            if err := os.WriteFile(contractFixture(name), got, 0644); err != nil {
+                t.Fatal(err)
+            }
+            continue
+        }
+        want, err := os.ReadFile(contractFixture(name))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(got, want) {
+            t.Errorf("%s no longer matches GET /accounts; refresh it with go test -update:\n%s", name, got)
+        }
+    }
+}
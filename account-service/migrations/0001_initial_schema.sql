@@ -0,0 +1,52 @@
+-- account-service/migrations/0001_initial_schema.sql
+-- Baseline schema, as database/init-db.sql creates it. Later schema changes are the numbered
+-- migrations that follow; each is also safe to run on a database that already has it.
+
+CREATE TABLE IF NOT EXISTS chart_of_accounts (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    account_code VARCHAR(20) NOT NULL,
+    account_name VARCHAR(255) NOT NULL,
+    account_type VARCHAR(50) NOT NULL CHECK (account_type IN ('Asset', 'Liability', 'Equity', 'Revenue', 'Expense')),
+    parent_id INTEGER REFERENCES chart_of_accounts(id),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, account_code),
+    CONSTRAINT check_account_code_format CHECK (account_code ~ '^\d{4}$')
+);
+
+CREATE TABLE IF NOT EXISTS general_ledger (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    account_id INTEGER REFERENCES chart_of_accounts(id),
+    transaction_date DATE NOT NULL,
+    description TEXT NOT NULL,
+    debit_amount DECIMAL(15,0) DEFAULT 0 CHECK (debit_amount >= 0),
+    credit_amount DECIMAL(15,0) DEFAULT 0 CHECK (credit_amount >= 0),
+    reference_id VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_debit_or_credit CHECK (
+        (debit_amount > 0 AND credit_amount = 0) OR 
+        (debit_amount = 0 AND credit_amount > 0)
+    ),
+    CONSTRAINT check_idr_amounts CHECK (
+        debit_amount = ROUND(debit_amount) AND credit_amount = ROUND(credit_amount)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_accounts_company_type ON chart_of_accounts(company_id, account_type);
+CREATE INDEX IF NOT EXISTS idx_accounts_active ON chart_of_accounts(company_id, is_active) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_ledger_account_date ON general_ledger(account_id, transaction_date);
+CREATE INDEX IF NOT EXISTS idx_ledger_company_date ON general_ledger(company_id, transaction_date);
+CREATE INDEX IF NOT EXISTS idx_ledger_reference ON general_ledger(reference_id) WHERE reference_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER update_accounts_updated_at BEFORE UPDATE ON chart_of_accounts FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
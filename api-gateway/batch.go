@@ -0,0 +1,142 @@
+// api-gateway/batch.go
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+
+    "github.com/massehanto/accounting-system-go/shared/middleware"
+)
+
+// Headers copied from the batch request onto every sub-request
+var batchForwardHeaders = []string{"Authorization", "Accept", "Accept-Language", "X-Forwarded-For", "X-Trace-ID"}
+
+type BatchSubRequest struct {
+    Method string          `json:"method"`
+    Path   string          `json:"path"`
+    Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type BatchSubResponse struct {
+    Status int             `json:"status"`
+    Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchResponseWriter buffers a sub-request's response in memory
+type batchResponseWriter struct {
+    header http.Header
+    status int
+    body   bytes.Buffer
+}
+
+func (bw *batchResponseWriter) Header() http.Header {
+    return bw.header
+}
+
+func (bw *batchResponseWriter) WriteHeader(status int) {
+    if bw.status == 0 {
+        bw.status = status
+    }
+}
+
+func (bw *batchResponseWriter) Write(b []byte) (int, error) {
+    if bw.status == 0 {
+        bw.status = http.StatusOK
+    }
+    return bw.body.Write(b)
+}
+
+// batchHandler runs up to maxRequests API calls concurrently through the gateway's own router,
+// so each one gets the same routing, identity headers and circuit breaking as a direct call.
+// Every sub-request carries the caller's credentials and reports its own status; one failing
+// does not fail the batch. Responses are returned in request order.
+func batchHandler(router http.Handler, maxRequests int) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        var req struct {
+            Requests []BatchSubRequest `json:"requests"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            var tooLarge *http.MaxBytesError
+            if errors.As(err, &tooLarge) {
+                middleware.RespondPayloadTooLarge(w, tooLarge.Limit)
+                return
+            }
+            writeGatewayError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+            return
+        }
+        if len(req.Requests) == 0 {
+            writeGatewayError(w, http.StatusBadRequest, "EMPTY_BATCH", "Batch must contain at least one request")
+            return
+        }
+        if len(req.Requests) > maxRequests {
+            writeGatewayError(w, http.StatusBadRequest, "BATCH_TOO_LARGE",
+                fmt.Sprintf("Batch may contain at most %d requests", maxRequests))
+            return
+        }
+
+        responses := make([]BatchSubResponse, len(req.Requests))
+        var wg sync.WaitGroup
+        for i, sub := range req.Requests {
+            wg.Add(1)
+            go func(i int, sub BatchSubRequest) {
+                defer wg.Done()
+                responses[i] = runBatchSubRequest(router, r, sub)
+            }(i, sub)
+        }
+        wg.Wait()
+
+        writeGatewayJSON(w, http.StatusOK, map[string]interface{}{"responses": responses})
+    }
+}
+
+func runBatchSubRequest(router http.Handler, parent *http.Request, sub BatchSubRequest) BatchSubResponse {
+    method := strings.ToUpper(sub.Method)
+    switch method {
+    case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete:
+    default:
+        return batchError(http.StatusBadRequest, "INVALID_METHOD", "Method must be GET, POST, PUT or DELETE")
+    }
+    if !strings.HasPrefix(sub.Path, "/api/") || strings.HasPrefix(sub.Path, "/api/batch") {
+        return batchError(http.StatusBadRequest, "INVALID_PATH", "Path must be an API path other than /api/batch")
+    }
+
+    subReq, err := http.NewRequestWithContext(parent.Context(), method, sub.Path, bytes.NewReader(sub.Body))
+    if err != nil {
+        return batchError(http.StatusBadRequest, "INVALID_PATH", "Invalid path")
+    }
+    for _, header := range batchForwardHeaders {
+        if value := parent.Header.Get(header); value != "" {
+            subReq.Header.Set(header, value)
+        }
+    }
+    if len(sub.Body) > 0 {
+        subReq.Header.Set("Content-Type", "application/json")
+    }
+    subReq.RemoteAddr = parent.RemoteAddr
+
+    rec := &batchResponseWriter{header: make(http.Header)}
+    router.ServeHTTP(rec, subReq)
+
+    if rec.status == 0 {
+        rec.status = http.StatusOK
+    }
+    response := BatchSubResponse{Status: rec.status}
+    if body := bytes.TrimSpace(rec.body.Bytes()); len(body) > 0 {
+        if json.Valid(body) {
+            response.Body = body
+        } else {
+            response.Body, _ = json.Marshal(string(body))
+        }
+    }
+    return response
+}
+
+func batchError(status int, code, message string) BatchSubResponse {
+    body, _ := json.Marshal(map[string]string{"error": message, "code": code})
+    return BatchSubResponse{Status: status, Body: body}
+}
\ No newline at end of file
@@ -0,0 +1,192 @@
+// api-gateway/circuit_breaker.go
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+type CircuitState string
+
+const (
+    CircuitClosed   CircuitState = "closed"
+    CircuitOpen     CircuitState = "open"
+    CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreaker stops proxying to a service after threshold consecutive failures. Once
+// cooldown has passed a single probe request is let through; its outcome closes the breaker
+// again or reopens it for another cooldown.
+type CircuitBreaker struct {
+    mu          sync.Mutex
+    state       CircuitState
+    failures    int
+    lastFailure time.Time
+    openedAt    time.Time
+    probing     bool
+    threshold   int
+    cooldown    time.Duration
+}
+
+type CircuitBreakerStatus struct {
+    State       CircuitState `json:"state"`
+    Failures    int          `json:"failure_count"`
+    LastFailure *time.Time   `json:"last_failure,omitempty"`
+    OpenedAt    *time.Time   `json:"opened_at,omitempty"`
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+    return &CircuitBreaker{state: CircuitClosed, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a request may be sent. Once the cooldown has passed it moves an open
+// breaker to half-open itself, so the first request after it becomes the probe. Every allowed
+// request must be followed by OnSuccess, OnFailure or Abandon so a half-open probe is released.
+func (cb *CircuitBreaker) Allow() bool {
+    cb.mu.Lock()
+    defer cb.mu.Unlock()
+
+    switch cb.state {
+    case CircuitOpen:
+        if time.Since(cb.openedAt) < cb.cooldown {
+            return false
+        }
+        cb.state = CircuitHalfOpen
+        cb.probing = true
+        return true
+    case CircuitHalfOpen:
+        if cb.probing {
+            return false
+        }
+        cb.probing = true
+        return true
+    default:
+        return true
+    }
+}
+
+func (cb *CircuitBreaker) OnSuccess() {
+    cb.mu.Lock()
+    defer cb.mu.Unlock()
+
+    cb.state = CircuitClosed
+    cb.failures = 0
+    cb.probing = false
+}
+
+func (cb *CircuitBreaker) OnFailure() {
+    cb.mu.Lock()
+    defer cb.mu.Unlock()
+
+    cb.failures++
+    cb.lastFailure = time.Now()
+    cb.probing = false
+    if cb.state == CircuitHalfOpen || cb.failures >= cb.threshold {
+        cb.state = CircuitOpen
+        cb.openedAt = cb.lastFailure
+    }
+}
+
+// Abandon releases an allowed request whose outcome is unknown, such as one cut short by the
+// client, without counting it either way; a half-open breaker lets the next request probe
+func (cb *CircuitBreaker) Abandon() {
+    cb.mu.Lock()
+    defer cb.mu.Unlock()
+
+    cb.probing = false
+}
+
+// Reset forces the breaker closed, for operators who know the service has recovered
+func (cb *CircuitBreaker) Reset() {
+    cb.OnSuccess()
+}
+
+// RetryAfter is how long until an open breaker lets a probe through
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+    cb.mu.Lock()
+    defer cb.mu.Unlock()
+
+    if wait := cb.cooldown - time.Since(cb.openedAt); wait > 0 {
+        return wait
+    }
+    return 0
+}
+
+func (cb *CircuitBreaker) Status() CircuitBreakerStatus {
+    cb.mu.Lock()
+    defer cb.mu.Unlock()
+
+    status := CircuitBreakerStatus{State: cb.state, Failures: cb.failures}
+    if !cb.lastFailure.IsZero() {
+        lastFailure := cb.lastFailure
+        status.LastFailure = &lastFailure
+    }
+    if cb.state != CircuitClosed {
+        openedAt := cb.openedAt
+        status.OpenedAt = &openedAt
+    }
+    return status
+}
+
+// statusRecorder captures the status the upstream answered with
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+    rec.status = status
+    rec.ResponseWriter.WriteHeader(status)
+}
+
+func circuitBreakersHandler(services map[string]ServiceConfig) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        statuses := make(map[string]CircuitBreakerStatus, len(services))
+        for name, service := range services {
+            statuses[name] = service.CircuitBreaker.Status()
+        }
+        writeGatewayJSON(w, http.StatusOK, statuses)
+    }
+}
+
+func resetCircuitBreakerHandler(services map[string]ServiceConfig) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        name := mux.Vars(r)["service"]
+        service, ok := services[name]
+        if !ok {
+            writeGatewayError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("Unknown service %s", name))
+            return
+        }
+        service.CircuitBreaker.Reset()
+        log.Printf("Circuit breaker for %s service reset by user %v", name, r.Context().Value("user_id"))
+        writeGatewayJSON(w, http.StatusOK, map[string]interface{}{
+            "service": name,
+            "status":  service.CircuitBreaker.Status(),
+        })
+    }
+}
+
+func writeGatewayJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(statusCode)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "data":      data,
+        "timestamp": time.Now(),
+    })
+}
+
+func writeGatewayError(w http.ResponseWriter, statusCode int, code, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(statusCode)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error":     message,
+        "code":      code,
+        "timestamp": time.Now(),
+    })
+}
\ No newline at end of file
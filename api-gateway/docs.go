@@ -0,0 +1,40 @@
+// api-gateway/docs.go
+package main
+
+import (
+    _ "embed"
+    "net/http"
+)
+
+//go:embed docs/openapi.yaml
+var openAPISpec []byte
+
+const openAPISpecPath = "/api-docs/openapi.yaml"
+
+// The docs page is Swagger UI from a CDN pointed at the embedded spec
+const apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>Indonesian Accounting System API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+    <script>
+        window.ui = SwaggerUIBundle({ url: "` + openAPISpecPath + `", dom_id: "#swagger-ui" });
+    </script>
+</body>
+</html>`
+
+func openAPISpecHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+    w.Header().Set("Cache-Control", "public, max-age=300")
+    w.Write(openAPISpec)
+}
+
+func apiDocsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.Write([]byte(apiDocsPage))
+}
\ No newline at end of file
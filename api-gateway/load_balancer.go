@@ -0,0 +1,216 @@
+// api-gateway/load_balancer.go
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/http/httputil"
+    "net/url"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/massehanto/accounting-system-go/shared/middleware"
+)
+
+// Upstream is one instance of a service behind the gateway
+type Upstream struct {
+    URL   *url.URL
+    Proxy *httputil.ReverseProxy
+
+    mu          sync.Mutex
+    healthy     bool
+    lastChecked time.Time
+    lastError   string
+}
+
+type UpstreamStatus struct {
+    URL         string     `json:"url"`
+    Healthy     bool       `json:"healthy"`
+    LastChecked *time.Time `json:"last_checked,omitempty"`
+    LastError   string     `json:"last_error,omitempty"`
+}
+
+// LoadBalancer spreads requests for a service round-robin across its healthy instances
+type LoadBalancer struct {
+    upstreams []*Upstream
+    next      uint64
+}
+
+// NewLoadBalancer builds a balancer from a comma-separated list of instance URLs, so a
+// single URL keeps working as before. Instances start out healthy until a check says otherwise.
+func NewLoadBalancer(name, urls string) (*LoadBalancer, error) {
+    lb := &LoadBalancer{}
+    for _, raw := range strings.Split(urls, ",") {
+        raw = strings.TrimSpace(raw)
+        if raw == "" {
+            continue
+        }
+        target, err := url.Parse(raw)
+        if err != nil || target.Scheme == "" || target.Host == "" {
+            return nil, fmt.Errorf("invalid URL %q", raw)
+        }
+
+        upstream := &Upstream{URL: target, healthy: true}
+        upstream.Proxy = httputil.NewSingleHostReverseProxy(target)
+        upstream.Proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+            // A body cut off by MaxBodySize is the client's fault, not the instance's
+            var tooLarge *http.MaxBytesError
+            if errors.As(err, &tooLarge) {
+                middleware.RespondPayloadTooLarge(w, tooLarge.Limit)
+                return
+            }
+            log.Printf("Proxy to %s service at %s failed: %v", name, upstream.URL, err)
+            upstream.setHealth(false, err.Error())
+            writeGatewayError(w, http.StatusBadGateway, "UPSTREAM_UNAVAILABLE", fmt.Sprintf("%s service is unavailable", name))
+        }
+        lb.upstreams = append(lb.upstreams, upstream)
+    }
+    if len(lb.upstreams) == 0 {
+        return nil, fmt.Errorf("no URLs configured")
+    }
+    return lb, nil
+}
+
+// SetTransport sets the transport every instance's proxy sends requests through
+func (lb *LoadBalancer) SetTransport(transport http.RoundTripper) {
+    for _, upstream := range lb.upstreams {
+        upstream.Proxy.Transport = transport
+    }
+}
+
+// Next picks the next healthy instance. When every instance is failing its health check the
+// rotation falls back to all of them, leaving the circuit breaker to decide whether to send
+// traffic at all.
+func (lb *LoadBalancer) Next() *Upstream {
+    n := uint64(len(lb.upstreams))
+    start := atomic.AddUint64(&lb.next, 1) - 1
+    for i := uint64(0); i < n; i++ {
+        upstream := lb.upstreams[(start+i)%n]
+        if upstream.Healthy() {
+            return upstream
+        }
+    }
+    return lb.upstreams[start%n]
+}
+
+// HasHealthy reports whether at least one instance is passing its health check
+func (lb *LoadBalancer) HasHealthy() bool {
+    for _, upstream := range lb.upstreams {
+        if upstream.Healthy() {
+            return true
+        }
+    }
+    return false
+}
+
+func (lb *LoadBalancer) Status() []UpstreamStatus {
+    statuses := make([]UpstreamStatus, 0, len(lb.upstreams))
+    for _, upstream := range lb.upstreams {
+        statuses = append(statuses, upstream.Status())
+    }
+    return statuses
+}
+
+// CheckHealth probes every instance's /health endpoint, which answers 503 when the service
+// cannot reach its database
+func (lb *LoadBalancer) CheckHealth(ctx context.Context, client *http.Client) {
+    for _, upstream := range lb.upstreams {
+        req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL.String()+"/health", nil)
+        if err != nil {
+            upstream.setHealth(false, err.Error())
+            continue
+        }
+        resp, err := client.Do(req)
+        if err != nil {
+            upstream.setHealth(false, err.Error())
+            continue
+        }
+        resp.Body.Close()
+        if resp.StatusCode >= 300 {
+            upstream.setHealth(false, fmt.Sprintf("health check returned %d", resp.StatusCode))
+            continue
+        }
+        upstream.setHealth(true, "")
+    }
+}
+
+func (u *Upstream) Healthy() bool {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+
+    return u.healthy
+}
+
+func (u *Upstream) setHealth(healthy bool, lastError string) {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+
+    if u.healthy != healthy {
+        if healthy {
+            log.Printf("Upstream %s is healthy again", u.URL)
+        } else {
+            log.Printf("Upstream %s marked unhealthy: %s", u.URL, lastError)
+        }
+    }
+    u.healthy = healthy
+    u.lastChecked = time.Now()
+    u.lastError = lastError
+}
+
+func (u *Upstream) Status() UpstreamStatus {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+
+    status := UpstreamStatus{URL: u.URL.String(), Healthy: u.healthy, LastError: u.lastError}
+    if !u.lastChecked.IsZero() {
+        lastChecked := u.lastChecked
+        status.LastChecked = &lastChecked
+    }
+    return status
+}
+
+// runHealthChecks probes every service's instances on each interval until the process exits
+func runHealthChecks(services map[string]ServiceConfig, interval time.Duration) {
+    client := &http.Client{Timeout: 5 * time.Second}
+    check := func() {
+        for _, service := range services {
+            ctx, cancel := context.WithTimeout(context.Background(), interval)
+            service.Upstreams.CheckHealth(ctx, client)
+            cancel()
+        }
+    }
+
+    check()
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for range ticker.C {
+        check()
+    }
+}
+
+func healthHandler(services map[string]ServiceConfig) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        status := "healthy"
+        instances := make(map[string][]UpstreamStatus, len(services))
+        for name, service := range services {
+            instances[name] = service.Upstreams.Status()
+            if !service.Upstreams.HasHealthy() {
+                status = "degraded"
+            }
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status":    status,
+            "gateway":   "api-gateway",
+            "services":  instances,
+            "timestamp": time.Now().Format(time.RFC3339),
+        })
+    }
+}
\ No newline at end of file
@@ -2,114 +2,273 @@
 package main
 
 import (
-    "encoding/json"
     "fmt"
     "log"
+    "math"
     "net/http"
-    "net/http/httputil"
-    "net/url"
     "os"
+    "strconv"
     "strings"
     "time"
     
     "github.com/gorilla/mux"
-    "github.com/rs/cors"
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/middleware"
+    "github.com/massehanto/accounting-system-go/shared/server"
 )
 
 type ServiceConfig struct {
-    URL string
+    Upstreams      *LoadBalancer
+    CircuitBreaker *CircuitBreaker
+    Metrics        *ServiceMetrics
+    // Retries is how many more times a GET or HEAD is tried after a transport error
+    Retries        int
 }
 
 func main() {
+    logger.Init("api-gateway")
+    
     cfg := config.Load()
     
-    services := map[string]ServiceConfig{
-        "user":         {getEnv("USER_SERVICE_URL", "http://localhost:8001")},
-        "company":      {getEnv("COMPANY_SERVICE_URL", "http://localhost:8011")},
-        "account":      {getEnv("ACCOUNT_SERVICE_URL", "http://localhost:8002")},
-        "transaction":  {getEnv("TRANSACTION_SERVICE_URL", "http://localhost:8003")},
-        "invoice":      {getEnv("INVOICE_SERVICE_URL", "http://localhost:8004")},
-        "vendor":       {getEnv("VENDOR_SERVICE_URL", "http://localhost:8005")},
-        "inventory":    {getEnv("INVENTORY_SERVICE_URL", "http://localhost:8006")},
-        "report":       {getEnv("REPORT_SERVICE_URL", "http://localhost:8007")},
-        "tax":          {getEnv("TAX_SERVICE_URL", "http://localhost:8008")},
-        "currency":     {getEnv("CURRENCY_SERVICE_URL", "http://localhost:8009")},
-        "notification": {getEnv("NOTIFICATION_SERVICE_URL", "http://localhost:8010")},
+    breakerThreshold, err := strconv.Atoi(getEnv("CIRCUIT_BREAKER_THRESHOLD", "5"))
+    if err != nil || breakerThreshold < 1 {
+        log.Fatalf("Invalid CIRCUIT_BREAKER_THRESHOLD: %q", os.Getenv("CIRCUIT_BREAKER_THRESHOLD"))
+    }
+    breakerCooldown, err := time.ParseDuration(getEnv("CIRCUIT_BREAKER_COOLDOWN", "30s"))
+    if err != nil || breakerCooldown <= 0 {
+        log.Fatalf("Invalid CIRCUIT_BREAKER_COOLDOWN: %q", os.Getenv("CIRCUIT_BREAKER_COOLDOWN"))
+    }
+    healthCheckInterval, err := time.ParseDuration(getEnv("HEALTH_CHECK_INTERVAL", "10s"))
+    if err != nil || healthCheckInterval <= 0 {
+        log.Fatalf("Invalid HEALTH_CHECK_INTERVAL: %q", os.Getenv("HEALTH_CHECK_INTERVAL"))
+    }
+    maxBatchRequests, err := strconv.Atoi(getEnv("BATCH_MAX_REQUESTS", "20"))
+    if err != nil || maxBatchRequests < 1 {
+        log.Fatalf("Invalid BATCH_MAX_REQUESTS: %q", os.Getenv("BATCH_MAX_REQUESTS"))
+    }
+    gzipMinSize, err := strconv.Atoi(getEnv("GZIP_MIN_SIZE", "1024"))
+    if err != nil || gzipMinSize < 0 {
+        log.Fatalf("Invalid GZIP_MIN_SIZE: %q", os.Getenv("GZIP_MIN_SIZE"))
+    }
+    proxyRetries, err := strconv.Atoi(getEnv("PROXY_RETRIES", "2"))
+    if err != nil || proxyRetries < 0 {
+        log.Fatalf("Invalid PROXY_RETRIES: %q", os.Getenv("PROXY_RETRIES"))
+    }
+    proxyRetryBackoff, err := time.ParseDuration(getEnv("PROXY_RETRY_BACKOFF", "100ms"))
+    if err != nil || proxyRetryBackoff <= 0 {
+        log.Fatalf("Invalid PROXY_RETRY_BACKOFF: %q", os.Getenv("PROXY_RETRY_BACKOFF"))
+    }
+    maxBodyBytes, err := strconv.ParseInt(getEnv("MAX_REQUEST_BODY_BYTES", "4194304"), 10, 64)
+    if err != nil || maxBodyBytes < 1 {
+        log.Fatalf("Invalid MAX_REQUEST_BODY_BYTES: %q", os.Getenv("MAX_REQUEST_BODY_BYTES"))
+    }
+    routeBodyLimits, err := parseRouteBodyLimits(os.Getenv("ROUTE_BODY_LIMITS"))
+    if err != nil {
+        log.Fatalf("Invalid ROUTE_BODY_LIMITS: %v", err)
+    }
+    gatewayRateLimitPerMinute, err := strconv.Atoi(getEnv("GATEWAY_RATE_LIMIT", "300"))
+    if err != nil || gatewayRateLimitPerMinute < 0 {
+        log.Fatalf("Invalid GATEWAY_RATE_LIMIT: %q", os.Getenv("GATEWAY_RATE_LIMIT"))
+    }
+    
+    // Each variable may list several instances separated by commas
+    
+    serviceURLs := map[string]string{
+        "user":         getEnv("USER_SERVICE_URL", "http://localhost:8001"),
+        "company":      getEnv("COMPANY_SERVICE_URL", "http://localhost:8011"),
+        "account":      getEnv("ACCOUNT_SERVICE_URL", "http://localhost:8002"),
+        "transaction":  getEnv("TRANSACTION_SERVICE_URL", "http://localhost:8003"),
+        "invoice":      getEnv("INVOICE_SERVICE_URL", "http://localhost:8004"),
+        "vendor":       getEnv("VENDOR_SERVICE_URL", "http://localhost:8005"),
+        "inventory":    getEnv("INVENTORY_SERVICE_URL", "http://localhost:8006"),
+        "report":       getEnv("REPORT_SERVICE_URL", "http://localhost:8007"),
+        "tax":          getEnv("TAX_SERVICE_URL", "http://localhost:8008"),
+        "currency":     getEnv("CURRENCY_SERVICE_URL", "http://localhost:8009"),
+        "notification": getEnv("NOTIFICATION_SERVICE_URL", "http://localhost:8010"),
     }
     
+    services := make(map[string]ServiceConfig, len(serviceURLs))
+    for name, urls := range serviceURLs {
+        upstreams, err := NewLoadBalancer(name, urls)
+        if err != nil {
+            log.Fatalf("Invalid URL for %s service: %v", name, err)
+        }
+        // e.g. REPORT_SERVICE_RETRIES overrides PROXY_RETRIES for report-service
+        retriesKey := strings.ToUpper(name) + "_SERVICE_RETRIES"
+        retries, err := strconv.Atoi(getEnv(retriesKey, strconv.Itoa(proxyRetries)))
+        if err != nil || retries < 0 {
+            log.Fatalf("Invalid %s: %q", retriesKey, os.Getenv(retriesKey))
+        }
+        serviceConfig := ServiceConfig{
+            Upstreams:      upstreams,
+            CircuitBreaker: NewCircuitBreaker(breakerThreshold, breakerCooldown),
+            Metrics:        &ServiceMetrics{},
+            Retries:        retries,
+        }
+        serviceConfig.Upstreams.SetTransport(newRetryTransport(serviceConfig.Retries, proxyRetryBackoff))
+        services[name] = serviceConfig
+    }
+    go runHealthChecks(services, healthCheckInterval)
+    
     r := mux.NewRouter()
     
-    // Health check
-    r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(map[string]interface{}{
-            "status":    "healthy",
-            "gateway":   "api-gateway",
-            "timestamp": time.Now().Format(time.RFC3339),
-        })
-    }).Methods("GET")
+    // Health check, including the health of every service instance
+    r.HandleFunc("/health", healthHandler(services)).Methods("GET")
+    
+    // API documentation
+    r.HandleFunc(openAPISpecPath, openAPISpecHandler).Methods("GET")
+    r.HandleFunc("/api/docs", apiDocsHandler).Methods("GET")
+    
+    // Circuit breaker administration
+    admin := middleware.Chain(
+        middleware.NewAuthMiddleware(cfg.JWT.Secret),
+        middleware.RequireRole("admin"),
+    )
+    r.Handle("/admin/circuit-breakers", admin(circuitBreakersHandler(services))).Methods("GET")
+    r.Handle("/admin/circuit-breakers/{service}/reset", admin(resetCircuitBreakerHandler(services))).Methods("POST")
+    r.Handle("/admin/metrics", admin(metricsHandler(services))).Methods("GET")
     
     // Route mapping
     routes := map[string]string{
-        "/api/auth/":           "user",
-        "/api/users":           "user",
-        "/api/profile":         "user",
-        "/api/companies":       "company",
-        "/api/accounts":        "account",
-        "/api/ledger":          "account",
-        "/api/transactions":    "transaction",
-        "/api/invoices":        "invoice",
-        "/api/customers":       "invoice",
-        "/api/vendors":         "vendor",
-        "/api/purchase-orders": "vendor",
-        "/api/products":        "inventory",
-        "/api/stock-movements": "inventory",
-        "/api/tax-rates":       "tax",
-        "/api/calculate-tax":   "tax",
-        "/api/convert":         "currency",
-        "/api/rates":           "currency",
-        "/api/reports":         "report",
-        "/api/send-email":      "notification",
+        "/api/auth/":                  "user",
+        "/api/users":                  "user",
+        "/api/profile":                "user",
+        "/api/csrf-token":             "user",
+        "/api/companies":              "company",
+        "/api/accounts":               "account",
+        "/api/ledger":                 "account",
+        "/api/transactions":           "transaction",
+        "/api/invoices":               "invoice",
+        "/api/customers":              "invoice",
+        "/api/vendors":                "vendor",
+        "/api/purchase-orders":        "vendor",
+        "/api/vendor-bills":           "vendor",
+        "/api/products":               "inventory",
+        "/api/stock-movements":        "inventory",
+        "/api/warehouses":             "inventory",
+        "/api/inventory":              "inventory",
+        "/api/reorder-suggestions":    "inventory",
+        "/api/tax-rates":              "tax",
+        "/api/calculate-tax":          "tax",
+        "/api/faktur-pajak":           "tax",
+        "/api/calculate-withholding":  "tax",
+        "/api/withholding-categories": "tax",
+        "/api/convert":                "currency",
+        "/api/rates":                  "currency",
+        "/api/reports":                "report",
+        "/api/send-email":             "notification",
+        "/api/notify":                 "notification",
+        "/api/notifications":          "notification",
+        "/api/subscriptions":          "notification",
+        "/api/deliveries":             "notification",
+        "/api/email-templates":        "notification",
+        "/api/templates":              "notification",
+        "/api/branding":               "notification",
     }
 
+    // Several API calls in one round-trip, each dispatched through this router
+    r.HandleFunc("/api/batch", middleware.MaxBodySize(maxBodyBytes)(batchHandler(r, maxBatchRequests))).Methods("POST")
+    
     // Setup routes
+    jwtKey := []byte(cfg.JWT.Secret)
+    limited := gatewayRateLimit(jwtKey, gatewayRateLimitPerMinute)
     for path, serviceName := range routes {
         service := services[serviceName]
-        r.PathPrefix(path).HandlerFunc(createProxyHandler(service.URL))
+        bodyLimit := maxBodyBytes
+        if limit, ok := routeBodyLimits[path]; ok {
+            bodyLimit = limit
+        }
+        guarded := middleware.Chain(middleware.MaxBodySize(bodyLimit), limited)
+        r.PathPrefix(path).HandlerFunc(guarded(createProxyHandlerWithCircuitBreaker(serviceName, service, jwtKey)))
     }
     
-    // CORS
-    c := cors.New(cors.Options{
-        AllowedOrigins:   cfg.CORS.AllowedOrigins,
-        AllowedMethods:   cfg.CORS.AllowedMethods,
-        AllowedHeaders:   cfg.CORS.AllowedHeaders,
-        AllowCredentials: true,
-    })
-    
-    handler := c.Handler(r)
+    // CORS wraps the router so preflight requests are answered before any proxying
+    // Compression sits inside logging, which records the status it passes through
+    logged := middleware.Chain(
+        middleware.LoggingMiddleware,
+        middleware.Gzip(gzipMinSize),
+    )(r.ServeHTTP)
+    handler := server.NewCORS(cfg.CORS).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        // Every trace starts here; client-supplied trace IDs are not trusted
+        r.Header.Del("X-Trace-ID")
+        logged(w, r)
+    }))
     
     addr := fmt.Sprintf(":%s", cfg.Server.Port)
     log.Printf("🚀 API Gateway starting on %s", addr)
     log.Fatal(http.ListenAndServe(addr, handler))
 }
 
-func createProxyHandler(serviceURL string) http.HandlerFunc {
+func createProxyHandlerWithCircuitBreaker(name string, service ServiceConfig, jwtKey []byte) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        targetURL, err := url.Parse(serviceURL)
-        if err != nil {
-            http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+        breaker := service.CircuitBreaker
+        if !breaker.Allow() {
+            service.Metrics.recordRejected()
+            w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(breaker.RetryAfter().Seconds()))))
+            writeGatewayError(w, http.StatusServiceUnavailable, "CIRCUIT_OPEN",
+                fmt.Sprintf("%s service is temporarily unavailable", name))
             return
         }
         
-        proxy := httputil.NewSingleHostReverseProxy(targetURL)
+        // Identity headers from the client are never forwarded; they are only set from a
+        // verified token. Services still validate the token themselves.
+        for _, header := range middleware.IdentityHeaders {
+            r.Header.Del(header)
+        }
+        if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+            if claims, err := middleware.ParseToken(strings.TrimPrefix(authHeader, "Bearer "), jwtKey); err == nil {
+                middleware.SetIdentityHeaders(r.Header, claims)
+            }
+        }
         
         // Strip /api prefix
         r.URL.Path = strings.TrimPrefix(r.URL.Path, "/api")
         
-        proxy.ServeHTTP(w, r)
+        // Transport errors surface as the 502 written by ErrorHandler, so the recorded status
+        // covers them as well as 5xx answers from the service itself
+        start := time.Now()
+        rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+        defer func() {
+            // ReverseProxy panics with http.ErrAbortHandler when the client goes away mid-response;
+            // without this a half-open probe would never be released and the breaker would stay shut
+            if p := recover(); p != nil {
+                breaker.Abandon()
+                panic(p)
+            }
+        }()
+        service.Upstreams.Next().Proxy.ServeHTTP(rec, r)
+        
+        failed := isUpstreamFailure(rec.status)
+        service.Metrics.recordMetric(time.Since(start), !failed)
+        if failed {
+            breaker.OnFailure()
+        } else {
+            breaker.OnSuccess()
+        }
+    }
+}
+
+// parseRouteBodyLimits reads per-route overrides of the body size limit, such as
+// "/api/companies=10485760", separated by commas; routes accepting uploads raise it here
+func parseRouteBodyLimits(value string) (map[string]int64, error) {
+    limits := make(map[string]int64)
+    for _, entry := range strings.Split(value, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        path, size, ok := strings.Cut(entry, "=")
+        if !ok {
+            return nil, fmt.Errorf("%q is not path=bytes", entry)
+        }
+        limit, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+        if err != nil || limit < 1 {
+            return nil, fmt.Errorf("invalid size in %q", entry)
+        }
+        limits[strings.TrimSpace(path)] = limit
     }
+    return limits, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -0,0 +1,131 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/massehanto/accounting-system-go/shared/middleware"
+)
+
+var testJWTKey = []byte("test-secret-that-is-at-least-32-characters")
+
+// newTestService proxies to upstream the way main wires a service, minus retries
+func newTestService(t *testing.T, upstream http.Handler) ServiceConfig {
+    t.Helper()
+    server := httptest.NewServer(upstream)
+    t.Cleanup(server.Close)
+
+    upstreams, err := NewLoadBalancer("test", server.URL)
+    if err != nil {
+        t.Fatalf("NewLoadBalancer: %v", err)
+    }
+    return ServiceConfig{
+        Upstreams:      upstreams,
+        CircuitBreaker: NewCircuitBreaker(2, time.Minute),
+        Metrics:        &ServiceMetrics{},
+    }
+}
+
+func TestProxyIgnoresSpoofedIdentityHeaders(t *testing.T) {
+    var received http.Header
+    service := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        received = r.Header.Clone()
+    }))
+    proxy := createProxyHandlerWithCircuitBreaker("test", service, testJWTKey)
+
+    token, err := middleware.SignToken(&middleware.Claims{UserID: 7, CompanyID: 3, Role: "user"}, testJWTKey)
+    if err != nil {
+        t.Fatalf("SignToken: %v", err)
+    }
+    forged, err := middleware.SignToken(&middleware.Claims{UserID: 1, CompanyID: 99, Role: "admin"}, []byte("some-other-secret-of-at-least-32-chars"))
+    if err != nil {
+        t.Fatalf("SignToken: %v", err)
+    }
+
+    cases := []struct {
+        name          string
+        authorization string
+        want          map[string]string
+    }{
+        {"no token", "", map[string]string{"User-ID": "", "Company-ID": "", "User-Role": ""}},
+        {"token signed elsewhere", "Bearer " + forged, map[string]string{"User-ID": "", "Company-ID": "", "User-Role": ""}},
+        {"valid token", "Bearer " + token, map[string]string{"User-ID": "7", "Company-ID": "3", "User-Role": "user"}},
+    }
+    for _, tc := range cases {
+        received = nil
+        req := httptest.NewRequest("GET", "/api/accounts", nil)
+        req.Header.Set("User-ID", "1")
+        req.Header.Set("Company-ID", "99")
+        req.Header.Set("User-Role", "admin")
+        if tc.authorization != "" {
+            req.Header.Set("Authorization", tc.authorization)
+        }
+        proxy(httptest.NewRecorder(), req)
+
+        if received == nil {
+            t.Fatalf("%s: request did not reach the service", tc.name)
+        }
+        for header, want := range tc.want {
+            if got := received.Get(header); got != want {
+                t.Errorf("%s: %s = %q, want %q", tc.name, header, got, want)
+            }
+        }
+    }
+}
+
+func TestProxyCountsUpstream5xxAsBreakerFailures(t *testing.T) {
+    calls := 0
+    service := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls++
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }))
+    proxy := createProxyHandlerWithCircuitBreaker("test", service, testJWTKey)
+
+    // The breaker threshold is 2: both answers reach the client, then the breaker opens
+    for i := 0; i < 2; i++ {
+        rec := httptest.NewRecorder()
+        proxy(rec, httptest.NewRequest("GET", "/api/accounts", nil))
+        if rec.Code != http.StatusServiceUnavailable {
+            t.Fatalf("request %d: status = %d, want the upstream's 503", i+1, rec.Code)
+        }
+    }
+    if state := service.CircuitBreaker.Status().State; state != CircuitOpen {
+        t.Fatalf("breaker state = %s after two 503s, want open", state)
+    }
+
+    rec := httptest.NewRecorder()
+    proxy(rec, httptest.NewRequest("GET", "/api/accounts", nil))
+    if rec.Code != http.StatusServiceUnavailable || calls != 2 {
+        t.Errorf("open breaker: status = %d after %d upstream calls, want 503 without a third call", rec.Code, calls)
+    }
+    if rec.Header().Get("Retry-After") == "" {
+        t.Error("open breaker response has no Retry-After")
+    }
+
+    metrics := service.Metrics.Snapshot()
+    if metrics.Requests != 2 || metrics.Failures != 2 || metrics.Rejected != 1 {
+        t.Errorf("metrics = %+v, want 2 requests, 2 failures and 1 rejected", metrics)
+    }
+}
+
+func TestProxyDoesNotCountClientErrorsAgainstService(t *testing.T) {
+    statuses := []int{http.StatusTooManyRequests, http.StatusNotFound, http.StatusBadRequest}
+    next := 0
+    service := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(statuses[next])
+        next++
+    }))
+    proxy := createProxyHandlerWithCircuitBreaker("test", service, testJWTKey)
+
+    for range statuses {
+        proxy(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/accounts", nil))
+    }
+    if state := service.CircuitBreaker.Status().State; state != CircuitClosed {
+        t.Errorf("breaker state = %s, want closed", state)
+    }
+    if metrics := service.Metrics.Snapshot(); metrics.Failures != 0 {
+        t.Errorf("failures = %d, want 0", metrics.Failures)
+    }
+}
@@ -0,0 +1,72 @@
+// api-gateway/metrics.go
+package main
+
+import (
+    "net/http"
+    "sync"
+    "time"
+)
+
+// ServiceMetrics counts proxied requests per upstream service
+type ServiceMetrics struct {
+    mu           sync.Mutex
+    requests     int64
+    failures     int64
+    rejected     int64
+    totalLatency time.Duration
+}
+
+type ServiceMetricsSnapshot struct {
+    Requests     int64   `json:"requests"`
+    Failures     int64   `json:"failures"`
+    Rejected     int64   `json:"rejected"`
+    AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// recordMetric counts one proxied request and whether the upstream handled it successfully
+func (m *ServiceMetrics) recordMetric(latency time.Duration, success bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    m.requests++
+    m.totalLatency += latency
+    if !success {
+        m.failures++
+    }
+}
+
+// recordRejected counts a request turned away because the circuit breaker was open
+func (m *ServiceMetrics) recordRejected() {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    m.rejected++
+}
+
+func (m *ServiceMetrics) Snapshot() ServiceMetricsSnapshot {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    snapshot := ServiceMetricsSnapshot{Requests: m.requests, Failures: m.failures, Rejected: m.rejected}
+    if m.requests > 0 {
+        snapshot.AvgLatencyMs = float64(m.totalLatency.Microseconds()) / float64(m.requests) / 1000
+    }
+    return snapshot
+}
+
+// isUpstreamFailure reports whether a response means the service itself is unhealthy. A 429
+// is the service protecting itself from one client, so it does not count against the
+// service as a whole.
+func isUpstreamFailure(status int) bool {
+    return status >= 500
+}
+
+func metricsHandler(services map[string]ServiceConfig) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        metrics := make(map[string]ServiceMetricsSnapshot, len(services))
+        for name, service := range services {
+            metrics[name] = service.Metrics.Snapshot()
+        }
+        writeGatewayJSON(w, http.StatusOK, metrics)
+    }
+}
@@ -0,0 +1,78 @@
+// api-gateway/rate_limit.go
+package main
+
+import (
+    "context"
+    "net/http"
+    "strings"
+
+    "github.com/massehanto/accounting-system-go/shared/middleware"
+)
+
+var rateLimitHeaders = []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+
+// gatewayRateLimit limits proxied traffic per route with the shared limiter, which counts
+// authenticated callers per user and company and anonymous ones, such as the public auth
+// routes, per client IP. With REDIS_URL set the counters are shared by every gateway replica.
+// A non-positive limit disables it.
+func gatewayRateLimit(jwtKey []byte, requestsPerMinute int) middleware.Middleware {
+    if requestsPerMinute <= 0 {
+        return func(next http.HandlerFunc) http.HandlerFunc { return next }
+    }
+    return middleware.Chain(
+        gatewayIdentity(jwtKey),
+        middleware.RateLimit(requestsPerMinute),
+        keepRateLimitHeaders,
+    )
+}
+
+// gatewayIdentity stores the identity from a valid bearer token in the request context, where
+// the rate limiter looks for it. Requests without one pass through anonymously; the services
+// decide whether they need authentication.
+func gatewayIdentity(jwtKey []byte) middleware.Middleware {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            authHeader := r.Header.Get("Authorization")
+            if !strings.HasPrefix(authHeader, "Bearer ") {
+                next(w, r)
+                return
+            }
+            claims, err := middleware.ParseToken(strings.TrimPrefix(authHeader, "Bearer "), jwtKey)
+            if err != nil {
+                next(w, r)
+                return
+            }
+
+            ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+            ctx = context.WithValue(ctx, "company_id", claims.CompanyID)
+            ctx = context.WithValue(ctx, "role", claims.Role)
+            next(w, r.WithContext(ctx))
+        }
+    }
+}
+
+// keepRateLimitHeaders makes the gateway's X-RateLimit-* values win over the ones the service
+// adds to its response, so clients are not sent both
+func keepRateLimitHeaders(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        gateway := make(http.Header)
+        for _, header := range rateLimitHeaders {
+            if value := w.Header().Get(header); value != "" {
+                gateway.Set(header, value)
+            }
+        }
+        next(&rateLimitHeaderWriter{ResponseWriter: w, gateway: gateway}, r)
+    }
+}
+
+type rateLimitHeaderWriter struct {
+    http.ResponseWriter
+    gateway http.Header
+}
+
+func (rw *rateLimitHeaderWriter) WriteHeader(status int) {
+    for header, values := range rw.gateway {
+        rw.Header()[header] = values
+    }
+    rw.ResponseWriter.WriteHeader(status)
+}
\ No newline at end of file
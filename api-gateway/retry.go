@@ -0,0 +1,53 @@
+// api-gateway/retry.go
+package main
+
+import (
+    "context"
+    "errors"
+    "log"
+    "math/rand"
+    "net/http"
+    "time"
+)
+
+// retryTransport retries idempotent requests that failed before any response arrived, such
+// as a refused or reset connection while an instance restarts. Anything the service answered,
+// including a 5xx, is returned as is, and POST, PUT and DELETE are never retried since the
+// service may already have acted on them.
+type retryTransport struct {
+    base    http.RoundTripper
+    retries int
+    backoff time.Duration
+}
+
+func newRetryTransport(retries int, backoff time.Duration) http.RoundTripper {
+    return &retryTransport{base: http.DefaultTransport, retries: retries, backoff: backoff}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    resp, err := t.base.RoundTrip(req)
+    for attempt := 1; err != nil && attempt <= t.retries && isRetryable(req, err); attempt++ {
+        // Full jitter on an exponential backoff keeps retries from many clients from lining up
+        delay := time.Duration(rand.Int63n(int64(t.backoff<<(attempt-1)) + 1))
+        select {
+        case <-req.Context().Done():
+            return nil, err
+        case <-time.After(delay):
+        }
+        log.Printf("Retrying %s %s after transport error (attempt %d of %d): %v",
+            req.Method, req.URL.Path, attempt, t.retries, err)
+        resp, err = t.base.RoundTrip(req)
+    }
+    return resp, err
+}
+
+func isRetryable(req *http.Request, err error) bool {
+    if req.Method != http.MethodGet && req.Method != http.MethodHead {
+        return false
+    }
+    // A body cannot be replayed once the first attempt has consumed it
+    if req.Body != nil && req.Body != http.NoBody {
+        return false
+    }
+    return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
\ No newline at end of file
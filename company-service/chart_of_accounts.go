@@ -0,0 +1,161 @@
+// company-service/chart_of_accounts.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+    "net/http"
+    "time"
+    
+    "github.com/dgrijalva/jwt-go"
+    
+    "github.com/massehanto/accounting-system-go/shared/client"
+    "github.com/massehanto/accounting-system-go/shared/middleware"
+)
+
+// chartTemplates mirrors the templates account-service can seed; "none" skips seeding
+var chartTemplates = []string{"standard", "services", "none"}
+
+const (
+    defaultChartTemplate = "standard"
+    noChartTemplate      = "none"
+    seedTokenLifetime    = time.Minute
+    
+    // chartSeedLease is how long a retry may take before another instance may pick it up
+    chartSeedLease        = 2 * time.Minute
+    chartSeedRetryBackoff = 30 * time.Second
+    chartSeedMaxBackoff   = time.Hour
+    chartSeedPollInterval = 15 * time.Second
+)
+
+// ChartSeedResult reports what happened to the chart of accounts of a new company
+type ChartSeedResult struct {
+    Template string `json:"template"`
+    Created  int    `json:"created,omitempty"`
+    Warning  string `json:"warning,omitempty"`
+}
+
+// seedChartOfAccounts asks account-service to create the accounts of template for a company the
+// caller has just created. The caller's token is for their current company, so the request
+// carries a short-lived token for the same user and role scoped to the new one. A failed seed
+// is queued and retried in the background the same way.
+func (s *CompanyService) seedChartOfAccounts(ctx context.Context, r *http.Request, companyID int, template string) *ChartSeedResult {
+    result := &ChartSeedResult{Template: template}
+    userID, role := s.GetUserIDFromRequest(r), s.GetUserRoleFromRequest(r)
+    
+    err := s.requestChartSeed(ctx, client.ForwardHeaders(r), userID, companyID, role, template, result)
+    if err == nil {
+        return result
+    }
+    log.Printf("Seeding chart of accounts for company %d failed: %v", companyID, err)
+    
+    _, err = s.DB.ExecContext(ctx, `
+        INSERT INTO chart_seed_retries (company_id, template, user_id, role, next_attempt_at)
+        VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second')
+        ON CONFLICT (company_id) DO NOTHING`,
+        companyID, template, userID, role, int(chartSeedRetryBackoff.Seconds()))
+    if err != nil {
+        log.Printf("Queueing chart of accounts seed for company %d failed: %v", companyID, err)
+        result.Warning = fmt.Sprintf("Chart of accounts was not created; an admin of the new company can seed it with POST /api/accounts/seed and template %q", template)
+        return result
+    }
+    result.Warning = "Chart of accounts was not created yet; it is being retried in the background"
+    return result
+}
+
+// requestChartSeed calls account-service's seed endpoint as userID with role in companyID
+func (s *CompanyService) requestChartSeed(ctx context.Context, headers http.Header, userID, companyID int, role, template string, result *ChartSeedResult) error {
+    token, err := middleware.SignToken(&middleware.Claims{
+        UserID:    userID,
+        CompanyID: companyID,
+        Role:      role,
+        StandardClaims: jwt.StandardClaims{
+            ExpiresAt: time.Now().Add(seedTokenLifetime).Unix(),
+        },
+    }, s.jwtKey)
+    if err != nil {
+        return err
+    }
+    headers.Set("Authorization", "Bearer "+token)
+    return s.accountClient.Do(ctx, http.MethodPost, "/accounts/seed", headers,
+        map[string]string{"template": template}, result)
+}
+
+// retryChartSeeds retries queued chart seeds until ctx is cancelled
+func (s *CompanyService) retryChartSeeds(ctx context.Context) {
+    ticker := time.NewTicker(chartSeedPollInterval)
+    defer ticker.Stop()
+    
+    for {
+        // Work through everything that is due before waiting again
+        for {
+            retried, err := s.retryNextChartSeed(ctx)
+            if err != nil {
+                log.Printf("Chart seed retry error: %v", err)
+            }
+            if !retried || err != nil {
+                break
+            }
+        }
+        
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// retryNextChartSeed claims the next due seed and tries it again. It reports false when nothing
+// was due.
+func (s *CompanyService) retryNextChartSeed(ctx context.Context) (bool, error) {
+    var companyID, userID, attempts int
+    var template, role string
+    err := s.DB.QueryRowContext(ctx, `
+        UPDATE chart_seed_retries
+        SET attempts = attempts + 1,
+            next_attempt_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+        WHERE company_id = (
+            SELECT company_id FROM chart_seed_retries
+            WHERE next_attempt_at <= CURRENT_TIMESTAMP
+            ORDER BY next_attempt_at
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING company_id, template, user_id, role, attempts`,
+        int(chartSeedLease.Seconds())).Scan(&companyID, &template, &userID, &role, &attempts)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    
+    var result ChartSeedResult
+    seedErr := s.requestChartSeed(ctx, http.Header{}, userID, companyID, role, template, &result)
+    if seedErr == nil {
+        log.Printf("Seeded chart of accounts for company %d after %d retries (%d accounts)", companyID, attempts, result.Created)
+        _, err = s.DB.ExecContext(ctx, "DELETE FROM chart_seed_retries WHERE company_id = $1", companyID)
+        return true, err
+    }
+    
+    _, err = s.DB.ExecContext(ctx, `
+        UPDATE chart_seed_retries
+        SET last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second'
+        WHERE company_id = $1`, companyID, seedErr.Error(), int(chartSeedBackoff(attempts).Seconds()))
+    return true, err
+}
+
+// chartSeedBackoff doubles the wait after each failed retry, up to chartSeedMaxBackoff
+func chartSeedBackoff(attempts int) time.Duration {
+    backoff := chartSeedRetryBackoff
+    for i := 1; i < attempts && backoff < chartSeedMaxBackoff; i++ {
+        backoff *= 2
+    }
+    if backoff > chartSeedMaxBackoff {
+        backoff = chartSeedMaxBackoff
+    }
+    return backoff
+}
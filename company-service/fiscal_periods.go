@@ -0,0 +1,450 @@
+// company-service/fiscal_periods.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+    
+    "github.com/gorilla/mux"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// defaultFiscalYearStart is used for companies with neither a fiscal_year_start setting nor a
+// fiscal_year_end
+const defaultFiscalYearStart = "01-01"
+
+// FiscalPeriod is one month of a company's fiscal year. Dates are DATE columns, given as
+// YYYY-MM-DD.
+type FiscalPeriod struct {
+    ID           int        `json:"id"`
+    CompanyID    int        `json:"company_id"`
+    FiscalYear   int        `json:"fiscal_year"`
+    PeriodNumber int        `json:"period_number"`
+    StartDate    string     `json:"start_date"`
+    EndDate      string     `json:"end_date"`
+    Status       string     `json:"status"`
+    ClosedAt     *time.Time `json:"closed_at,omitempty"`
+    ClosedBy     *int       `json:"closed_by,omitempty"`
+}
+
+// parseFiscalYearStart reads a MM-DD fiscal year start. Days past the 28th are rejected so
+// every month of the year can start on the same day.
+func parseFiscalYearStart(value string) (time.Month, int, error) {
+    start, err := time.Parse("01-02", value)
+    if err != nil || len(value) != 5 {
+        return 0, 0, fmt.Errorf("fiscal year start %q is not in MM-DD form", value)
+    }
+    if start.Day() > 28 {
+        return 0, 0, fmt.Errorf("fiscal year start %q must be on or before the 28th", value)
+    }
+    return start.Month(), start.Day(), nil
+}
+
+// fiscalYearStart returns the company's fiscal_year_start setting. Without one the fiscal
+// year starts the day after the company's fiscal_year_end, and on the default without either.
+func (s *CompanyService) fiscalYearStart(ctx context.Context, companyID int) (string, error) {
+    var value string
+    err := s.DB.QueryRowContext(ctx,
+        "SELECT setting_value FROM company_settings WHERE company_id = $1 AND setting_key = 'fiscal_year_start'",
+        companyID).Scan(&value)
+    if err == nil && value != "" {
+        return value, nil
+    }
+    if err != nil && err != sql.ErrNoRows {
+        return "", err
+    }
+    
+    var fiscalYearEnd sql.NullTime
+    err = s.DB.QueryRowContext(ctx, "SELECT fiscal_year_end FROM companies WHERE id = $1", companyID).Scan(&fiscalYearEnd)
+    if err == sql.ErrNoRows || (err == nil && !fiscalYearEnd.Valid) {
+        return defaultFiscalYearStart, nil
+    }
+    if err != nil {
+        return "", err
+    }
+    return fiscalYearStartAfter(fiscalYearEnd.Time), nil
+}
+
+// validateFiscalYearEnd checks a company's fiscal_year_end, a YYYY-MM-DD date of which only
+// the month and day matter. It is not valid when left out.
+func validateFiscalYearEnd(validator *validation.Validator, value string) sql.NullTime {
+    if value == "" {
+        return sql.NullTime{}
+    }
+    end, err := time.Parse("2006-01-02", value)
+    if err != nil {
+        validator.AddError("fiscal_year_end", "Fiscal year end must be a date in YYYY-MM-DD form")
+        return sql.NullTime{}
+    }
+    return sql.NullTime{Time: end, Valid: true}
+}
+
+// fiscalYearStartAfter gives the MM-DD start of a fiscal year ending on end's month and day,
+// e.g. "04-01" for a year ending 31 March
+func fiscalYearStartAfter(end time.Time) string {
+    return end.AddDate(0, 0, 1).Format("01-02")
+}
+
+// monthlyPeriods splits the fiscal year starting on month/day of year into twelve periods
+func monthlyPeriods(year int, month time.Month, day int) []FiscalPeriod {
+    start := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+    periods := make([]FiscalPeriod, 12)
+    for i := range periods {
+        periodStart := start.AddDate(0, i, 0)
+        periods[i] = FiscalPeriod{
+            FiscalYear:   year,
+            PeriodNumber: i + 1,
+            StartDate:    periodStart.Format("2006-01-02"),
+            EndDate:      periodStart.AddDate(0, 1, -1).Format("2006-01-02"),
+            Status:       "open",
+        }
+    }
+    return periods
+}
+
+func scanFiscalPeriod(scanner interface{ Scan(...interface{}) error }, period *FiscalPeriod) error {
+    var startDate, endDate time.Time
+    var closedAt sql.NullTime
+    var closedBy sql.NullInt64
+    if err := scanner.Scan(&period.ID, &period.CompanyID, &period.FiscalYear, &period.PeriodNumber,
+        &startDate, &endDate, &period.Status, &closedAt, &closedBy); err != nil {
+        return err
+    }
+    period.StartDate = startDate.Format("2006-01-02")
+    period.EndDate = endDate.Format("2006-01-02")
+    if closedAt.Valid {
+        period.ClosedAt = &closedAt.Time
+    }
+    if closedBy.Valid {
+        closedByID := int(closedBy.Int64)
+        period.ClosedBy = &closedByID
+    }
+    return nil
+}
+
+// getFiscalPeriodsHandler lists the company's periods, filtered to a fiscal year with ?year=
+// or to the period containing a date with ?date=YYYY-MM-DD, which is how posting services
+// check whether a date is still open
+func (s *CompanyService) getFiscalPeriodsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    companyID, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
+        return
+    }
+    if !s.ValidateCompanyAccess(w, r, companyID) {
+        return
+    }
+    
+    query := `SELECT id, company_id, fiscal_year, period_number, start_date, end_date, status, closed_at, closed_by
+              FROM fiscal_periods WHERE company_id = $1`
+    args := []interface{}{companyID}
+    
+    validator := validation.New()
+    if year := r.URL.Query().Get("year"); year != "" {
+        fiscalYear, err := strconv.Atoi(year)
+        if err != nil {
+            validator.AddError("year", "Year must be a number")
+        }
+        args = append(args, fiscalYear)
+        query += fmt.Sprintf(" AND fiscal_year = $%d", len(args))
+    }
+    if date := r.URL.Query().Get("date"); date != "" {
+        if _, err := time.Parse("2006-01-02", date); err != nil {
+            validator.AddError("date", "Date must be in YYYY-MM-DD format")
+        }
+        args = append(args, date)
+        query += fmt.Sprintf(" AND $%d::date BETWEEN start_date AND end_date", len(args))
+    }
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    query += " ORDER BY start_date"
+    
+    rows, err := s.DB.QueryContext(ctx, query, args...)
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching fiscal periods")
+        return
+    }
+    defer rows.Close()
+    
+    periods := []FiscalPeriod{}
+    for rows.Next() {
+        var period FiscalPeriod
+        if err := scanFiscalPeriod(rows, &period); err != nil {
+            s.HandleDBError(w, err, "Error fetching fiscal periods")
+            return
+        }
+        periods = append(periods, period)
+    }
+    if err := rows.Err(); err != nil {
+        s.HandleDBError(w, err, "Error fetching fiscal periods")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, periods)
+}
+
+// generateFiscalPeriodsHandler creates the twelve monthly periods of a fiscal year from the
+// company's fiscal_year_start setting. Periods may not overlap ones already generated, e.g.
+// after the fiscal year start changed.
+func (s *CompanyService) generateFiscalPeriodsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    companyID, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
+        return
+    }
+    if !s.ValidateCompanyAccess(w, r, companyID) {
+        return
+    }
+    
+    var req struct {
+        FiscalYear int `json:"fiscal_year"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    if req.FiscalYear < 1900 || req.FiscalYear > 9999 {
+        validator.AddError("fiscal_year", "Fiscal year must be between 1900 and 9999")
+    }
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.HandleDBError(w, err, "Error generating fiscal periods")
+        return
+    }
+    defer tx.Rollback()
+    
+    // Locking the company serialises generation, so concurrent requests cannot both pass the
+    // overlap check
+    var locked int
+    err = tx.QueryRowContext(ctx, "SELECT id FROM companies WHERE id = $1 FOR UPDATE", companyID).Scan(&locked)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "COMPANY_NOT_FOUND", "Company not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error generating fiscal periods")
+        return
+    }
+    
+    start, err := s.fiscalYearStart(ctx, companyID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error generating fiscal periods")
+        return
+    }
+    month, day, err := parseFiscalYearStart(start)
+    if err != nil {
+        s.RespondWithError(w, http.StatusUnprocessableEntity, "INVALID_FISCAL_YEAR_START", err.Error())
+        return
+    }
+    periods := monthlyPeriods(req.FiscalYear, month, day)
+    
+    var overlaps bool
+    err = tx.QueryRowContext(ctx, `
+        SELECT EXISTS(
+            SELECT 1 FROM fiscal_periods
+            WHERE company_id = $1 AND (fiscal_year = $2 OR (start_date <= $4 AND end_date >= $3))
+        )`, companyID, req.FiscalYear, periods[0].StartDate, periods[len(periods)-1].EndDate).Scan(&overlaps)
+    if err != nil {
+        s.HandleDBError(w, err, "Error generating fiscal periods")
+        return
+    }
+    if overlaps {
+        s.RespondWithError(w, http.StatusConflict, "FISCAL_PERIODS_EXIST",
+            fmt.Sprintf("Fiscal year %d overlaps periods already generated", req.FiscalYear))
+        return
+    }
+    
+    for i := range periods {
+        periods[i].CompanyID = companyID
+        err := tx.QueryRowContext(ctx, `
+            INSERT INTO fiscal_periods (company_id, fiscal_year, period_number, start_date, end_date)
+            VALUES ($1, $2, $3, $4, $5)
+            RETURNING id`, companyID, req.FiscalYear, periods[i].PeriodNumber,
+            periods[i].StartDate, periods[i].EndDate).Scan(&periods[i].ID)
+        if err != nil {
+            s.HandleDBError(w, err, "Error generating fiscal periods")
+            return
+        }
+    }
+    
+    if err := tx.Commit(); err != nil {
+        s.HandleDBError(w, err, "Error generating fiscal periods")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusCreated, periods)
+}
+
+// updateFiscalPeriodHandler closes a period, or reopens it to correct postings
+func (s *CompanyService) updateFiscalPeriodHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    vars := mux.Vars(r)
+    companyID, err := strconv.Atoi(vars["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
+        return
+    }
+    if !s.ValidateCompanyAccess(w, r, companyID) {
+        return
+    }
+    periodID, err := strconv.Atoi(vars["periodId"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid fiscal period ID")
+        return
+    }
+    
+    var req struct {
+        Status string `json:"status"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validator.Required("status", req.Status)
+    validator.OneOf("status", req.Status, []string{"open", "closed"})
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    var period FiscalPeriod
+    err = scanFiscalPeriod(s.DB.QueryRowContext(ctx, `
+        UPDATE fiscal_periods
+        SET status = $3,
+            closed_at = CASE WHEN $3 = 'closed' THEN CURRENT_TIMESTAMP END,
+            closed_by = CASE WHEN $3 = 'closed' THEN $4::integer END
+        WHERE id = $1 AND company_id = $2
+        RETURNING id, company_id, fiscal_year, period_number, start_date, end_date, status, closed_at, closed_by`,
+        periodID, companyID, req.Status, s.GetUserIDFromRequest(r)), &period)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "FISCAL_PERIOD_NOT_FOUND", "Fiscal period not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating fiscal period")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, period)
+}
+
+// PeriodRange is a derived reporting period. Unlike FiscalPeriod it is not stored, so every
+// service asking for the same fiscal year gets the same boundaries whether or not periods
+// have been generated.
+type PeriodRange struct {
+    Number    int    `json:"number"`
+    StartDate string `json:"start_date"`
+    EndDate   string `json:"end_date"`
+}
+
+// FiscalYearPeriods are the months and quarters of one fiscal year
+type FiscalYearPeriods struct {
+    FiscalYear      int           `json:"fiscal_year"`
+    FiscalYearStart string        `json:"fiscal_year_start"`
+    StartDate       string        `json:"start_date"`
+    EndDate         string        `json:"end_date"`
+    Months          []PeriodRange `json:"months"`
+    Quarters        []PeriodRange `json:"quarters"`
+}
+
+// fiscalYearPeriods derives the twelve months and four quarters of a fiscal year. Quarters
+// follow the fiscal year, so with an April start Q1 is April to June.
+func fiscalYearPeriods(year int, month time.Month, day int) FiscalYearPeriods {
+    monthly := monthlyPeriods(year, month, day)
+    periods := FiscalYearPeriods{
+        FiscalYear: year,
+        StartDate:  monthly[0].StartDate,
+        EndDate:    monthly[len(monthly)-1].EndDate,
+        Months:     make([]PeriodRange, len(monthly)),
+        Quarters:   make([]PeriodRange, 4),
+    }
+    for i, period := range monthly {
+        periods.Months[i] = PeriodRange{Number: period.PeriodNumber, StartDate: period.StartDate, EndDate: period.EndDate}
+    }
+    for q := range periods.Quarters {
+        periods.Quarters[q] = PeriodRange{
+            Number:    q + 1,
+            StartDate: monthly[q*3].StartDate,
+            EndDate:   monthly[q*3+2].EndDate,
+        }
+    }
+    return periods
+}
+
+// fiscalYearOf returns the fiscal year containing date. A fiscal year is numbered by the
+// year it starts in.
+func fiscalYearOf(date time.Time, month time.Month, day int) int {
+    start := time.Date(date.Year(), month, day, 0, 0, 0, 0, date.Location())
+    if date.Before(start) {
+        return date.Year() - 1
+    }
+    return date.Year()
+}
+
+// getPeriodsHandler derives a fiscal year's monthly and quarterly periods from the company's
+// fiscal year start, see fiscalYearStart. ?year= picks the fiscal year and defaults to the
+// current one.
+func (s *CompanyService) getPeriodsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    companyID, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
+        return
+    }
+    if !s.ValidateCompanyAccess(w, r, companyID) {
+        return
+    }
+    
+    start, err := s.fiscalYearStart(ctx, companyID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching fiscal year start")
+        return
+    }
+    month, day, err := parseFiscalYearStart(start)
+    if err != nil {
+        s.RespondWithError(w, http.StatusUnprocessableEntity, "INVALID_FISCAL_YEAR_START", err.Error())
+        return
+    }
+    
+    fiscalYear := fiscalYearOf(service.NewJakartaTime(time.Now()).Time(), month, day)
+    if year := r.URL.Query().Get("year"); year != "" {
+        validator := validation.New()
+        fiscalYear, err = strconv.Atoi(year)
+        if err != nil || fiscalYear < 1900 || fiscalYear > 9999 {
+            validator.AddError("year", "Year must be between 1900 and 9999")
+            s.RespondValidationError(w, validator.Errors())
+            return
+        }
+    }
+    
+    periods := fiscalYearPeriods(fiscalYear, month, day)
+    periods.FiscalYearStart = start
+    s.RespondWithJSON(w, http.StatusOK, periods)
+}
\ No newline at end of file
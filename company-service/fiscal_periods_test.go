@@ -0,0 +1,121 @@
+package main
+
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/mux"
+
+    "github.com/massehanto/accounting-system-go/shared/database/dbtest"
+    "github.com/massehanto/accounting-system-go/shared/middleware"
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// fiscalDB answers the two lookups behind a company's fiscal year start: its
+// fiscal_year_start setting and its fiscal_year_end. Empty values have no row.
+type fiscalDB struct {
+    setting string
+    end     *time.Time
+}
+
+func (d *fiscalDB) query(_ *dbtest.Tx, query string, _ []driver.Value) (driver.Rows, error) {
+    switch {
+    case strings.Contains(query, "FROM company_settings"):
+        if d.setting == "" {
+            return dbtest.Rows([]string{"setting_value"}), nil
+        }
+        return dbtest.Rows([]string{"setting_value"}, []driver.Value{d.setting}), nil
+    case strings.Contains(query, "SELECT fiscal_year_end FROM companies"):
+        if d.end == nil {
+            return dbtest.Rows([]string{"fiscal_year_end"}, []driver.Value{nil}), nil
+        }
+        return dbtest.Rows([]string{"fiscal_year_end"}, []driver.Value{*d.end}), nil
+    }
+    return nil, errors.New("unexpected query: " + query)
+}
+
+func TestGetPeriodsDerivesStartFromFiscalYearEnd(t *testing.T) {
+    fiscal := &fiscalDB{}
+    db := dbtest.Open(&dbtest.Driver{Query: fiscal.query})
+    defer db.Close()
+    s := &CompanyService{BaseService: &service.BaseService{DB: db}}
+    r := mux.NewRouter()
+    r.Handle("/companies/{id}/periods", middleware.NewAuthMiddleware(testJWTSecret)(s.getPeriodsHandler)).Methods("GET")
+    token := testToken(t, 1, "user")
+
+    march31 := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+    june30 := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+    cases := []struct {
+        name              string
+        setting           string
+        end               *time.Time
+        start, startDate  string
+        endDate, q1Ending string
+    }{
+        {"setting wins", "07-01", &march31, "07-01", "2025-07-01", "2026-06-30", "2025-09-30"},
+        {"derived from fiscal_year_end", "", &march31, "04-01", "2025-04-01", "2026-03-31", "2025-06-30"},
+        {"mid-year end", "", &june30, "07-01", "2025-07-01", "2026-06-30", "2025-09-30"},
+        {"neither set", "", nil, "01-01", "2025-01-01", "2025-12-31", "2025-03-31"},
+    }
+    for _, tc := range cases {
+        fiscal.setting, fiscal.end = tc.setting, tc.end
+
+        req := httptest.NewRequest("GET", "/companies/1/periods?year=2025", nil)
+        req.Header.Set("Authorization", "Bearer "+token)
+        rec := httptest.NewRecorder()
+        r.ServeHTTP(rec, req)
+        if rec.Code != 200 {
+            t.Errorf("%s: status = %d, body = %s", tc.name, rec.Code, rec.Body.String())
+            continue
+        }
+
+        var response struct {
+            Data FiscalYearPeriods `json:"data"`
+        }
+        if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+            t.Fatalf("%s: decode: %v", tc.name, err)
+        }
+        periods := response.Data
+        if periods.FiscalYearStart != tc.start || periods.StartDate != tc.startDate || periods.EndDate != tc.endDate {
+            t.Errorf("%s: start %s, %s to %s; want %s, %s to %s", tc.name,
+                periods.FiscalYearStart, periods.StartDate, periods.EndDate, tc.start, tc.startDate, tc.endDate)
+        }
+        if len(periods.Quarters) != 4 || periods.Quarters[0].EndDate != tc.q1Ending {
+            t.Errorf("%s: quarters = %+v, want Q1 ending %s", tc.name, periods.Quarters, tc.q1Ending)
+        }
+    }
+}
+
+func TestFiscalYearStartAfter(t *testing.T) {
+    cases := map[string]string{
+        "2024-12-31": "01-01",
+        "2024-03-31": "04-01",
+        "2023-02-28": "03-01",
+        "2024-02-29": "03-01",
+    }
+    for end, want := range cases {
+        date, _ := time.Parse("2006-01-02", end)
+        if got := fiscalYearStartAfter(date); got != want {
+            t.Errorf("fiscalYearStartAfter(%s) = %s, want %s", end, got, want)
+        }
+    }
+}
+
+func TestValidateFiscalYearEnd(t *testing.T) {
+    validator := validation.New()
+    if end := validateFiscalYearEnd(validator, ""); end.Valid || !validator.IsValid() {
+        t.Errorf("empty fiscal_year_end: got %v, errors %v; want unset and no error", end, validator.Errors())
+    }
+    if end := validateFiscalYearEnd(validator, "2025-03-31"); !end.Valid || end.Time.Month() != time.March || end.Time.Day() != 31 {
+        t.Errorf("2025-03-31: got %v", end)
+    }
+    if validateFiscalYearEnd(validator, "03-31"); validator.IsValid() {
+        t.Error("03-31 was accepted, want a YYYY-MM-DD error")
+    }
+}
@@ -4,6 +4,7 @@ module github.com/massehanto/accounting-system-go/company-service
 go 1.21
 
 require (
+    github.com/dgrijalva/jwt-go v3.2.0+incompatible
     github.com/gorilla/mux v1.8.0
     github.com/lib/pq v1.10.9
     github.com/massehanto/accounting-system-go/shared v0.0.0
@@ -6,13 +6,17 @@ import (
     "database/sql"
     "encoding/json"
     "net/http"
+    "os"
     "strconv"
+    "strings"
     "time"
     
     "github.com/gorilla/mux"
     _ "github.com/lib/pq"
     
+    "github.com/massehanto/accounting-system-go/shared/client"
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/database"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
@@ -22,6 +26,8 @@ import (
 
 type CompanyService struct {
     *service.BaseService
+    accountClient *client.Client
+    jwtKey        []byte
 }
 
 type Company struct {
@@ -48,42 +54,68 @@ type CompanySetting struct {
 }
 
 func main() {
+    logger.Init("company-service")
+    
     cfg := config.ValidateAndLoad()
     cfg.Database.Name = "company_db"
     
     db := database.InitDatabase(cfg.Database)
     defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
     
     companyService := &CompanyService{
-        BaseService: &service.BaseService{DB: db},
+        BaseService:   &service.BaseService{DB: db},
+        accountClient: client.New(getEnv("ACCOUNT_SERVICE_URL", "http://localhost:8002")),
+        jwtKey:        []byte(cfg.JWT.Secret),
     }
     
+    // Charts of accounts that failed to seed when their company was created
+    workerCtx, stopWorkers := context.WithCancel(context.Background())
+    defer stopWorkers()
+    go companyService.retryChartSeeds(workerCtx)
+    
     r := mux.NewRouter()
     
     r.Handle("/health", middleware.HealthCheck(db, "company-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "company-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+    })).Methods("GET")
     
     authMiddleware := middleware.APIMiddleware(cfg.JWT.Secret)
+    adminMiddleware := middleware.RoleMiddleware(cfg.JWT.Secret, "admin")
     
     // Company endpoints
     r.Handle("/companies", authMiddleware(companyService.getCompaniesHandler)).Methods("GET")
-    r.Handle("/companies", authMiddleware(companyService.createCompanyHandler)).Methods("POST")
+    r.Handle("/companies", adminMiddleware(companyService.createCompanyHandler)).Methods("POST")
     r.Handle("/companies/{id}", authMiddleware(companyService.getCompanyHandler)).Methods("GET")
-    r.Handle("/companies/{id}", authMiddleware(companyService.updateCompanyHandler)).Methods("PUT")
+    r.Handle("/companies/{id}", adminMiddleware(companyService.updateCompanyHandler)).Methods("PUT")
     
     // Settings endpoints
     r.Handle("/companies/{id}/settings", authMiddleware(companyService.getCompanySettingsHandler)).Methods("GET")
-    r.Handle("/companies/{id}/settings", authMiddleware(companyService.updateCompanySettingsHandler)).Methods("PUT")
+    r.Handle("/companies/{id}/settings", adminMiddleware(companyService.updateCompanySettingsHandler)).Methods("PUT")
+    r.Handle("/companies/{id}/settings/schema", authMiddleware(companyService.getSettingsSchemaHandler)).Methods("GET")
+    r.Handle("/companies/{id}/settings/{key}", authMiddleware(companyService.getCompanySettingHandler)).Methods("GET")
+    
+    // Fiscal period endpoints
+    r.Handle("/companies/{id}/fiscal-periods", authMiddleware(companyService.getFiscalPeriodsHandler)).Methods("GET")
+    r.Handle("/companies/{id}/fiscal-periods", adminMiddleware(companyService.generateFiscalPeriodsHandler)).Methods("POST")
+    r.Handle("/companies/{id}/fiscal-periods/{periodId}", adminMiddleware(companyService.updateFiscalPeriodHandler)).Methods("PUT")
+    r.Handle("/companies/{id}/periods", authMiddleware(companyService.getPeriodsHandler)).Methods("GET")
 
     server.SetupServer(r, cfg)
 }
 
+// getCompaniesHandler lists the companies the caller can access, which is only the company
+// their token is for
 func (s *CompanyService) getCompaniesHandler(w http.ResponseWriter, r *http.Request) {
     err := s.ExecuteWithTimeout(10*time.Second, func(ctx context.Context) error {
         query := `SELECT id, name, tax_id, address, phone, email, business_type, 
                          registration_date, fiscal_year_end, created_at, updated_at
-                  FROM companies ORDER BY name`
+                  FROM companies WHERE id = $1 ORDER BY name`
         
-        rows, err := s.DB.QueryContext(ctx, query)
+        rows, err := s.DB.QueryContext(ctx, query, s.GetCompanyIDFromRequest(r))
         if err != nil {
             s.HandleDBError(w, err, "Error fetching companies")
             return nil
@@ -125,6 +157,21 @@ func (s *CompanyService) getCompanyHandler(w http.ResponseWriter, r *http.Reques
         s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
         return
     }
+    if !s.ValidateCompanyAccess(w, r, id) {
+        return
+    }
+    
+    // ?include=settings embeds the settings map; without it the response is the bare company
+    includeSettings := false
+    if include := r.URL.Query().Get("include"); include != "" {
+        for _, part := range strings.Split(include, ",") {
+            if strings.TrimSpace(part) != "settings" {
+                s.RespondWithError(w, http.StatusBadRequest, "INVALID_PARAMETER", "include supports only settings")
+                return
+            }
+            includeSettings = true
+        }
+    }
 
     err = s.ExecuteWithTimeout(10*time.Second, func(ctx context.Context) error {
         var company Company
@@ -152,7 +199,19 @@ func (s *CompanyService) getCompanyHandler(w http.ResponseWriter, r *http.Reques
             company.RegistrationDate = registrationDate.Time
         }
         
-        s.RespondWithJSON(w, http.StatusOK, company)
+        if !includeSettings {
+            s.RespondWithJSON(w, http.StatusOK, company)
+            return nil
+        }
+        settings, err := s.settingValues(ctx, id)
+        if err != nil {
+            s.HandleDBError(w, err, "Error fetching company settings")
+            return nil
+        }
+        s.RespondWithJSON(w, http.StatusOK, struct {
+            Company
+            Settings map[string]interface{} `json:"settings"`
+        }{company, settings})
         return nil
     })
 
@@ -162,26 +221,36 @@ func (s *CompanyService) getCompanyHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *CompanyService) createCompanyHandler(w http.ResponseWriter, r *http.Request) {
-    var company Company
-    if err := json.NewDecoder(r.Body).Decode(&company); err != nil {
+    var req struct {
+        Company
+        ChartTemplate string `json:"chart_template"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
         s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
         return
     }
+    company := req.Company
+    if req.ChartTemplate == "" {
+        req.ChartTemplate = defaultChartTemplate
+    }
 
     validator := validation.New()
     validator.Required("name", company.Name)
     validator.MinLength("name", company.Name, 2)
     validator.MaxLength("name", company.Name, 255)
     validator.Required("tax_id", company.TaxID)
-    validator.IndonesianTaxID("tax_id", company.TaxID)
+    validator.NPWP("tax_id", company.TaxID)
     validator.Email("email", company.Email)
     validator.IndonesianPhone("phone", company.Phone)
+    validator.OneOf("chart_template", req.ChartTemplate, chartTemplates)
+    fiscalYearEnd := validateFiscalYearEnd(validator, company.FiscalYearEnd)
 
     if !validator.IsValid() {
         s.RespondValidationError(w, validator.Errors())
         return
     }
 
+    created := false
     err := s.WithTransaction(r.Context(), func(tx *sql.Tx) error {
         // Check if tax ID already exists
         var exists bool
@@ -194,9 +263,10 @@ func (s *CompanyService) createCompanyHandler(w http.ResponseWriter, r *http.Req
             return nil
         }
 
-        query := `INSERT INTO companies (name, tax_id, address, phone, email, business_type, registration_date) 
-                  VALUES ($1, $2, $3, $4, $5, $6, $7) 
-                  RETURNING id, created_at, updated_at`
+        query := `INSERT INTO companies (name, tax_id, address, phone, email, business_type, registration_date,
+                                         fiscal_year_end) 
+                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
+                  RETURNING id, fiscal_year_end, created_at, updated_at`
         
         var registrationDate interface{}
         if !company.RegistrationDate.IsZero() {
@@ -204,40 +274,54 @@ func (s *CompanyService) createCompanyHandler(w http.ResponseWriter, r *http.Req
         } else {
             registrationDate = time.Now()
         }
+        // Without a fiscal_year_end the fiscal year follows the calendar year
+        if !fiscalYearEnd.Valid {
+            fiscalYearEnd = sql.NullTime{Time: time.Date(time.Now().Year(), time.December, 31, 0, 0, 0, 0, time.UTC), Valid: true}
+        }
         
         err = tx.QueryRow(query, company.Name, company.TaxID, company.Address,
-                         company.Phone, company.Email, company.BusinessType, registrationDate).Scan(
-                         &company.ID, &company.CreatedAt, &company.UpdatedAt)
+                         company.Phone, company.Email, company.BusinessType, registrationDate, fiscalYearEnd).Scan(
+                         &company.ID, &company.FiscalYearEnd, &company.CreatedAt, &company.UpdatedAt)
         if err != nil {
             s.HandleDBError(w, err, "Error creating company")
             return nil
         }
 
-        // Create default Indonesian settings
-        defaultSettings := map[string]string{
-            "default_currency":     "IDR",
-            "default_timezone":     "Asia/Jakarta",
-            "tax_rate_ppn":        "11.00",
-            "fiscal_year_start":   "01-01",
-            "reporting_language":  "id-ID",
-        }
-        
-        for key, value := range defaultSettings {
+        // Create default Indonesian settings. fiscal_year_start is left unset so the fiscal
+        // year follows fiscal_year_end until the company sets one.
+        for key, definition := range knownSettings {
+            if key == "fiscal_year_start" {
+                continue
+            }
             _, err = tx.Exec(
                 "INSERT INTO company_settings (company_id, setting_key, setting_value) VALUES ($1, $2, $3)",
-                company.ID, key, value)
+                company.ID, key, definition.Default)
             if err != nil {
                 return err
             }
         }
 
-        s.RespondWithJSON(w, http.StatusCreated, company)
+        created = true
         return nil
     })
 
     if err != nil {
         s.RespondWithError(w, http.StatusInternalServerError, "CREATE_ERROR", "Company creation failed")
+        return
+    }
+    if !created {
+        return
+    }
+    
+    // The company exists from here on; a failed seed is reported rather than undoing it
+    response := struct {
+        Company
+        ChartOfAccounts *ChartSeedResult `json:"chart_of_accounts,omitempty"`
+    }{Company: company}
+    if req.ChartTemplate != noChartTemplate {
+        response.ChartOfAccounts = s.seedChartOfAccounts(r.Context(), r, company.ID, req.ChartTemplate)
     }
+    s.RespondWithJSON(w, http.StatusCreated, response)
 }
 
 func (s *CompanyService) updateCompanyHandler(w http.ResponseWriter, r *http.Request) {
@@ -247,6 +331,9 @@ func (s *CompanyService) updateCompanyHandler(w http.ResponseWriter, r *http.Req
         s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
         return
     }
+    if !s.ValidateCompanyAccess(w, r, id) {
+        return
+    }
     
     var company Company
     if err := json.NewDecoder(r.Body).Decode(&company); err != nil {
@@ -258,6 +345,7 @@ func (s *CompanyService) updateCompanyHandler(w http.ResponseWriter, r *http.Req
     validator.Required("name", company.Name)
     validator.Email("email", company.Email)
     validator.IndonesianPhone("phone", company.Phone)
+    fiscalYearEnd := validateFiscalYearEnd(validator, company.FiscalYearEnd)
 
     if !validator.IsValid() {
         s.RespondValidationError(w, validator.Errors())
@@ -265,13 +353,15 @@ func (s *CompanyService) updateCompanyHandler(w http.ResponseWriter, r *http.Req
     }
 
     err = s.WithTransaction(r.Context(), func(tx *sql.Tx) error {
+        // fiscal_year_end is kept when the request leaves it out
         query := `UPDATE companies 
-                  SET name = $1, address = $2, phone = $3, email = $4, business_type = $5, updated_at = CURRENT_TIMESTAMP
-                  WHERE id = $6 
-                  RETURNING updated_at`
+                  SET name = $1, address = $2, phone = $3, email = $4, business_type = $5,
+                      fiscal_year_end = COALESCE($6, fiscal_year_end), updated_at = CURRENT_TIMESTAMP
+                  WHERE id = $7 
+                  RETURNING fiscal_year_end, updated_at`
         
         err = tx.QueryRow(query, company.Name, company.Address, company.Phone, 
-                         company.Email, company.BusinessType, id).Scan(&company.UpdatedAt)
+                         company.Email, company.BusinessType, fiscalYearEnd, id).Scan(&company.FiscalYearEnd, &company.UpdatedAt)
         if err == sql.ErrNoRows {
             s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Company not found")
             return nil
@@ -298,6 +388,9 @@ func (s *CompanyService) getCompanySettingsHandler(w http.ResponseWriter, r *htt
         s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
         return
     }
+    if !s.ValidateCompanyAccess(w, r, companyID) {
+        return
+    }
 
     err = s.ExecuteWithTimeout(10*time.Second, func(ctx context.Context) error {
         query := `SELECT id, company_id, setting_key, setting_value, created_at, updated_at
@@ -337,12 +430,32 @@ func (s *CompanyService) updateCompanySettingsHandler(w http.ResponseWriter, r *
         s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
         return
     }
+    if !s.ValidateCompanyAccess(w, r, companyID) {
+        return
+    }
     
-    var settings map[string]string
-    if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+    var updates map[string]interface{}
+    if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
         s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
         return
     }
+    
+    // Unknown keys are usually typos of a known one, so they need an explicit opt-in
+    allowCustom := r.URL.Query().Get("allow_custom") == "true"
+    settings := make(map[string]string, len(updates))
+    validator := validation.New()
+    for key, raw := range updates {
+        value, err := normalizeSetting(key, raw, allowCustom)
+        if err != nil {
+            validator.AddError(key, err.Error())
+            continue
+        }
+        settings[key] = value
+    }
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
 
     err = s.WithTransaction(r.Context(), func(tx *sql.Tx) error {
         // Verify company exists
@@ -383,4 +496,11 @@ func (s *CompanyService) updateCompanySettingsHandler(w http.ResponseWriter, r *
     if err != nil {
         s.RespondWithError(w, http.StatusInternalServerError, "UPDATE_ERROR", "Settings update failed")
     }
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
 }
\ No newline at end of file
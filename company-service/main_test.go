@@ -0,0 +1,80 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gorilla/mux"
+
+    "github.com/massehanto/accounting-system-go/shared/middleware"
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+const testJWTSecret = "test-secret-that-is-at-least-32-characters"
+
+func testToken(t *testing.T, companyID int, role string) string {
+    t.Helper()
+    token, err := middleware.SignToken(&middleware.Claims{UserID: 1, CompanyID: companyID, Role: role}, []byte(testJWTSecret))
+    if err != nil {
+        t.Fatalf("SignToken: %v", err)
+    }
+    return token
+}
+
+// A token for company 1 must not reach company 2's data, whatever the caller's role. The
+// service has no database here, so any handler that got past the access check would panic.
+func TestCompanyHandlersRejectOtherCompanies(t *testing.T) {
+    s := &CompanyService{BaseService: &service.BaseService{}}
+    auth := middleware.NewAuthMiddleware(testJWTSecret)
+
+    r := mux.NewRouter()
+    r.Handle("/companies/{id}", auth(s.getCompanyHandler)).Methods("GET")
+    r.Handle("/companies/{id}", auth(s.updateCompanyHandler)).Methods("PUT")
+    r.Handle("/companies/{id}/settings", auth(s.getCompanySettingsHandler)).Methods("GET")
+    r.Handle("/companies/{id}/settings", auth(s.updateCompanySettingsHandler)).Methods("PUT")
+    r.Handle("/companies/{id}/settings/{key}", auth(s.getCompanySettingHandler)).Methods("GET")
+    r.Handle("/companies/{id}/fiscal-periods", auth(s.getFiscalPeriodsHandler)).Methods("GET")
+    r.Handle("/companies/{id}/fiscal-periods", auth(s.generateFiscalPeriodsHandler)).Methods("POST")
+    r.Handle("/companies/{id}/fiscal-periods/{periodId}", auth(s.updateFiscalPeriodHandler)).Methods("PUT")
+    r.Handle("/companies/{id}/periods", auth(s.getPeriodsHandler)).Methods("GET")
+
+    requests := []struct {
+        method, path, body string
+    }{
+        {"GET", "/companies/2", ""},
+        {"PUT", "/companies/2", `{"name":"Other"}`},
+        {"GET", "/companies/2/settings", ""},
+        {"PUT", "/companies/2/settings", `{"currency":"IDR"}`},
+        {"GET", "/companies/2/settings/currency", ""},
+        {"GET", "/companies/2/fiscal-periods", ""},
+        {"POST", "/companies/2/fiscal-periods", `{"fiscal_year":2026}`},
+        {"PUT", "/companies/2/fiscal-periods/1", `{"status":"closed"}`},
+        {"GET", "/companies/2/periods", ""},
+    }
+    for _, role := range []string{"user", "admin"} {
+        token := testToken(t, 1, role)
+        for _, tc := range requests {
+            req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+            req.Header.Set("Authorization", "Bearer "+token)
+            // A forged header must not widen access either
+            req.Header.Set("Company-ID", "2")
+            rec := httptest.NewRecorder()
+            r.ServeHTTP(rec, req)
+
+            if rec.Code != http.StatusForbidden {
+                t.Errorf("%s %s as %s: status = %d, want 403", tc.method, tc.path, role, rec.Code)
+                continue
+            }
+            var body service.ErrorResponse
+            if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+                t.Fatalf("decode error response: %v", err)
+            }
+            if body.Code != "COMPANY_ACCESS_DENIED" {
+                t.Errorf("%s %s as %s: code = %q, want COMPANY_ACCESS_DENIED", tc.method, tc.path, role, body.Code)
+            }
+        }
+    }
+}
@@ -0,0 +1,44 @@
+-- company-service/migrations/0001_initial_schema.sql
+-- Baseline schema, as database/init-db.sql creates it. Later schema changes are the numbered
+-- migrations that follow; each is also safe to run on a database that already has it.
+
+CREATE TABLE IF NOT EXISTS companies (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    tax_id VARCHAR(50) UNIQUE NOT NULL,
+    address TEXT,
+    phone VARCHAR(20),
+    email VARCHAR(255),
+    business_type VARCHAR(100),
+    registration_date DATE,
+    fiscal_year_end DATE DEFAULT '12-31',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_tax_id_format CHECK (tax_id ~ '^\d{2}\.\d{3}\.\d{3}\.\d{1}-\d{3}\.\d{3}$'),
+    CONSTRAINT check_email_format CHECK (email ~ '^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$')
+);
+
+-- Company settings for Indonesian compliance
+CREATE TABLE IF NOT EXISTS company_settings (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER REFERENCES companies(id) ON DELETE CASCADE,
+    setting_key VARCHAR(100) NOT NULL,
+    setting_value TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, setting_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_companies_tax_id ON companies(tax_id);
+CREATE INDEX IF NOT EXISTS idx_company_settings_key ON company_settings(company_id, setting_key);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER update_companies_updated_at BEFORE UPDATE ON companies FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE OR REPLACE TRIGGER update_company_settings_updated_at BEFORE UPDATE ON company_settings FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
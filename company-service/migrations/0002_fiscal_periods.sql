@@ -0,0 +1,23 @@
+-- company-service/migrations/0002_fiscal_periods.sql
+-- Monthly accounting periods, generated a fiscal year at a time from the fiscal_year_start
+-- setting. A fiscal year is numbered by the calendar year it starts in. Closed periods accept
+-- no further postings.
+CREATE TABLE IF NOT EXISTS fiscal_periods (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    fiscal_year INTEGER NOT NULL,
+    period_number INTEGER NOT NULL CHECK (period_number BETWEEN 1 AND 12),
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    closed_at TIMESTAMP,
+    closed_by INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, fiscal_year, period_number),
+    CONSTRAINT check_period_dates CHECK (start_date <= end_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fiscal_periods_company_dates ON fiscal_periods(company_id, start_date, end_date);
+
+CREATE OR REPLACE TRIGGER update_fiscal_periods_updated_at BEFORE UPDATE ON fiscal_periods FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
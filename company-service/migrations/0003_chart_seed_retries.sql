@@ -0,0 +1,15 @@
+-- company-service/migrations/0003_chart_seed_retries.sql
+-- Charts of accounts that could not be seeded when their company was created. A worker
+-- retries each with a token for the creating user scoped to the company, until it succeeds.
+CREATE TABLE IF NOT EXISTS chart_seed_retries (
+    company_id INTEGER PRIMARY KEY REFERENCES companies(id) ON DELETE CASCADE,
+    template VARCHAR(50) NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_chart_seed_retries_due ON chart_seed_retries(next_attempt_at);
@@ -0,0 +1,285 @@
+// company-service/settings.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "net/http"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/gorilla/mux"
+    
+    "github.com/massehanto/accounting-system-go/shared/i18n"
+)
+
+// settingDefinition describes a setting other services read. Values must be one of Options
+// when it is set; otherwise Parse checks a stored string and returns the typed value. Type
+// names that value's JSON type.
+type settingDefinition struct {
+    Type        string
+    Default     string
+    Description string
+    Options     []string
+    Parse       func(value string) (interface{}, error)
+}
+
+func (d settingDefinition) parse(value string) (interface{}, error) {
+    if len(d.Options) > 0 {
+        for _, option := range d.Options {
+            if value == option {
+                return value, nil
+            }
+        }
+        return nil, fmt.Errorf("must be one of %s", strings.Join(d.Options, ", "))
+    }
+    return d.Parse(value)
+}
+
+var (
+    currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+    numberSequence      = regexp.MustCompile(`\{SEQ(:\d+)?\}`)
+    customSettingKey    = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// indonesianTimezones are the zones a company can report in. Services run without tzdata,
+// so other zones could not be resolved anyway.
+var indonesianTimezones = []string{"Asia/Jakarta", "Asia/Makassar", "Asia/Jayapura"}
+
+// knownSettings are the settings services rely on, with the defaults given to new companies
+var knownSettings = map[string]settingDefinition{
+    "default_currency": {
+        Type: "string", Default: "IDR", Description: "ISO 4217 code of the company's base currency",
+        Parse: func(value string) (interface{}, error) {
+            if !currencyCodePattern.MatchString(value) {
+                return nil, fmt.Errorf("must be a three-letter ISO 4217 currency code")
+            }
+            return value, nil
+        },
+    },
+    "default_timezone": {
+        Type: "string", Default: "Asia/Jakarta", Description: "Time zone used for dates and reports",
+        Options: indonesianTimezones,
+    },
+    "tax_rate_ppn": {
+        Type: "number", Default: "11.00", Description: "PPN rate in percent charged on invoices",
+        Parse: func(value string) (interface{}, error) {
+            rate, err := strconv.ParseFloat(value, 64)
+            if err != nil || rate < 0 || rate > 100 {
+                return nil, fmt.Errorf("must be a number from 0 to 100")
+            }
+            return rate, nil
+        },
+    },
+    "fiscal_year_start": {
+        Type: "string", Default: defaultFiscalYearStart, Description: "First day of the fiscal year as MM-DD",
+        Parse: func(value string) (interface{}, error) {
+            if _, _, err := parseFiscalYearStart(value); err != nil {
+                return nil, err
+            }
+            return value, nil
+        },
+    },
+    "reporting_language": {
+        Type: "string", Default: i18n.Indonesian, Description: "Language of reports and messages",
+        Options: []string{i18n.Indonesian, i18n.English},
+    },
+    "require_separate_approver": {
+        Type: "boolean", Default: "false", Description: "Whether purchase orders must be approved by someone other than their creator",
+        Parse: func(value string) (interface{}, error) {
+            required, err := strconv.ParseBool(value)
+            if err != nil {
+                return nil, fmt.Errorf("must be true or false")
+            }
+            return required, nil
+        },
+    },
+    "inventory_valuation_method": {
+        Type: "string", Default: "average", Description: "Inventory costing method",
+        Options: []string{"average", "fifo"},
+    },
+    "invoice_number_format": {
+        Type: "string", Default: "INV/{YYYY}/{SEQ:6}", Description: "Invoice numbering with {YYYY}, {YY}, {MM} and {SEQ} or {SEQ:width}; {SEQ} never restarts",
+        Parse: func(value string) (interface{}, error) {
+            if !numberSequence.MatchString(value) {
+                return nil, fmt.Errorf("must contain a {SEQ} or {SEQ:width} placeholder")
+            }
+            if len(value) > 50 {
+                return nil, fmt.Errorf("must be at most 50 characters")
+            }
+            return value, nil
+        },
+    },
+}
+
+// normalizeSetting checks a setting sent by a client and returns the string to store. JSON
+// numbers and booleans are accepted for any key, and known settings are stored in the
+// canonical form of their type, so "TRUE" and true are both stored as "true". Custom keys are
+// only accepted when allowCustom is set and are kept as given.
+func normalizeSetting(key string, raw interface{}, allowCustom bool) (string, error) {
+    var value string
+    switch v := raw.(type) {
+    case string:
+        value = strings.TrimSpace(v)
+    case float64:
+        value = strconv.FormatFloat(v, 'f', -1, 64)
+    case bool:
+        value = strconv.FormatBool(v)
+    default:
+        return "", fmt.Errorf("must be a string, number or boolean")
+    }
+    
+    definition, known := knownSettings[key]
+    if !known {
+        if !allowCustom {
+            return "", fmt.Errorf("unknown setting; pass allow_custom=true to store a custom one")
+        }
+        if !customSettingKey.MatchString(key) || len(key) > 100 {
+            return "", fmt.Errorf("custom setting keys must be lowercase snake_case of at most 100 characters")
+        }
+        return value, nil
+    }
+    
+    typed, err := definition.parse(value)
+    if err != nil {
+        return "", err
+    }
+    switch typed := typed.(type) {
+    case float64:
+        return strconv.FormatFloat(typed, 'f', -1, 64), nil
+    case bool:
+        return strconv.FormatBool(typed), nil
+    }
+    return value, nil
+}
+
+// parseSetting returns the typed value of a stored setting. Values stored before settings
+// were validated may not parse; they are returned as strings rather than hidden.
+func parseSetting(key, value string) (interface{}, string) {
+    definition, known := knownSettings[key]
+    if !known {
+        return value, "string"
+    }
+    typed, err := definition.parse(value)
+    if err != nil {
+        return value, "string"
+    }
+    return typed, definition.Type
+}
+
+// settingValues returns all of a company's settings parsed to their types, with defaults for
+// known settings it has not stored. An unset fiscal_year_start follows fiscal_year_end.
+func (s *CompanyService) settingValues(ctx context.Context, companyID int) (map[string]interface{}, error) {
+    fiscalYearStart, err := s.fiscalYearStart(ctx, companyID)
+    if err != nil {
+        return nil, err
+    }
+    
+    rows, err := s.DB.QueryContext(ctx,
+        "SELECT setting_key, setting_value FROM company_settings WHERE company_id = $1", companyID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    values := make(map[string]interface{})
+    for key, definition := range knownSettings {
+        values[key], _ = parseSetting(key, definition.Default)
+    }
+    values["fiscal_year_start"] = fiscalYearStart
+    for rows.Next() {
+        var key string
+        var value sql.NullString
+        if err := rows.Scan(&key, &value); err != nil {
+            return nil, err
+        }
+        values[key], _ = parseSetting(key, value.String)
+    }
+    return values, rows.Err()
+}
+
+// SettingSchema describes one known setting for clients building a settings form
+type SettingSchema struct {
+    Key         string   `json:"key"`
+    Type        string   `json:"type"`
+    Default     string   `json:"default"`
+    Description string   `json:"description"`
+    Options     []string `json:"options,omitempty"`
+}
+
+// getSettingsSchemaHandler lists the known settings. The schema is the same for every
+// company; it sits under a company so clients can fetch it next to the values.
+func (s *CompanyService) getSettingsSchemaHandler(w http.ResponseWriter, r *http.Request) {
+    schema := make([]SettingSchema, 0, len(knownSettings))
+    for key, definition := range knownSettings {
+        schema = append(schema, SettingSchema{
+            Key:         key,
+            Type:        definition.Type,
+            Default:     definition.Default,
+            Description: definition.Description,
+            Options:     definition.Options,
+        })
+    }
+    sort.Slice(schema, func(i, j int) bool { return schema[i].Key < schema[j].Key })
+    
+    s.RespondWithJSON(w, http.StatusOK, schema)
+}
+
+// getCompanySettingHandler returns one setting parsed to its type. Known settings the company
+// has not stored fall back to their default.
+func (s *CompanyService) getCompanySettingHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    vars := mux.Vars(r)
+    companyID, err := strconv.Atoi(vars["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid company ID")
+        return
+    }
+    if !s.ValidateCompanyAccess(w, r, companyID) {
+        return
+    }
+    key := vars["key"]
+    
+    var value string
+    var updatedAt *time.Time
+    var storedAt time.Time
+    err = s.DB.QueryRowContext(ctx,
+        "SELECT setting_value, updated_at FROM company_settings WHERE company_id = $1 AND setting_key = $2",
+        companyID, key).Scan(&value, &storedAt)
+    switch {
+    case err == sql.ErrNoRows:
+        definition, known := knownSettings[key]
+        if !known {
+            s.RespondWithError(w, http.StatusNotFound, "SETTING_NOT_FOUND", "Setting not found")
+            return
+        }
+        value = definition.Default
+        if key == "fiscal_year_start" {
+            if value, err = s.fiscalYearStart(ctx, companyID); err != nil {
+                s.HandleDBError(w, err, "Error fetching company setting")
+                return
+            }
+        }
+    case err != nil:
+        s.HandleDBError(w, err, "Error fetching company setting")
+        return
+    default:
+        updatedAt = &storedAt
+    }
+    
+    typed, settingType := parseSetting(key, value)
+    s.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+        "company_id": companyID,
+        "key":        key,
+        "value":      typed,
+        "type":       settingType,
+        "is_default": updatedAt == nil,
+        "updated_at": updatedAt,
+    })
+}
\ No newline at end of file
@@ -0,0 +1,49 @@
+// currency-service/audit.go
+package main
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "time"
+)
+
+// recordConversions keeps the conversions a company's users made in conversion_audit.
+// Anonymous conversions are not recorded, and a failed write is logged rather than failing a
+// conversion that has already been computed.
+func (cs *CurrencyService) recordConversions(r *http.Request, requests []ConversionRequest, conversions []ConversionResponse) {
+    companyID := cs.GetCompanyIDFromRequest(r)
+    if companyID == 0 || len(conversions) == 0 {
+        return
+    }
+    var userID interface{}
+    if id := cs.GetUserIDFromRequest(r); id != 0 {
+        userID = id
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := cs.DB.BeginTx(ctx, nil)
+    if err != nil {
+        log.Printf("Failed to record conversions for company %d: %v", companyID, err)
+        return
+    }
+    defer tx.Rollback()
+
+    for i, conversion := range conversions {
+        if _, err := tx.ExecContext(ctx, `
+            INSERT INTO conversion_audit (company_id, user_id, amount, from_currency, to_currency,
+                converted_amount, exchange_rate, as_of, rate_date, converted_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::DATE, NULLIF($9, '')::DATE, $10)`,
+            companyID, userID, conversion.OriginalAmount, conversion.FromCurrency, conversion.ToCurrency,
+            conversion.ConvertedAmount, conversion.ExchangeRate, requests[i].Date, conversion.RateDate,
+            conversion.ConvertedAt); err != nil {
+            log.Printf("Failed to record conversions for company %d: %v", companyID, err)
+            return
+        }
+    }
+    if err := tx.Commit(); err != nil {
+        log.Printf("Failed to record conversions for company %d: %v", companyID, err)
+    }
+}
\ No newline at end of file
@@ -2,29 +2,69 @@
 package main
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
-    "io"
+    "log"
     "net/http"
     "os"
+    "sort"
+    "strconv"
+    "strings"
     "sync"
     "time"
     
     "github.com/gorilla/mux"
     
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/database"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
     "github.com/massehanto/accounting-system-go/shared/service"
     "github.com/massehanto/accounting-system-go/shared/validation"
 )
 
+// Rates are held as units of each currency per IDR, the base they are fetched against
+const baseCurrency = "IDR"
+
+const providerRetryBackoff = 2 * time.Second
+
+// seedSource marks a built-in rate no provider has replaced yet
+const seedSource = "seed"
+
+var errUnknownCurrency = errors.New("unknown currency code")
+
+// errRateStale rejects a conversion at rates older than RATE_MAX_AGE under RATE_STALE_POLICY=reject
+var errRateStale = errors.New("exchange rates are stale")
+
+// unknownCurrencyError names the currency code that is not supported
+type unknownCurrencyError string
+
+func (e unknownCurrencyError) Error() string {
+    return "unknown currency code " + string(e)
+}
+
+func (e unknownCurrencyError) Is(target error) bool {
+    return target == errUnknownCurrency
+}
+
+// maxBatchConversions caps POST /convert/batch
+const maxBatchConversions = 500
+
 type CurrencyService struct {
     *service.BaseService
     rates       map[string]Currency
     mutex       sync.RWMutex
     lastUpdated time.Time
-    apiKey      string
+    providers   []RateProvider
+    // providerRetries is how many times a failing provider is retried before the next is tried
+    providerRetries int
+    // Current rates older than maxRateAge, or still seeded, are stale: conversions at them
+    // are flagged, or refused when rejectStaleRates is set. Zero turns the check off.
+    maxRateAge       time.Duration
+    rejectStaleRates bool
 }
 
 type Currency struct {
@@ -32,12 +72,18 @@ type Currency struct {
     Name        string    `json:"name"`
     Rate        float64   `json:"rate"`
     LastUpdated time.Time `json:"last_updated"`
+    // LastSource is the provider the rate came from, or "seed" for a built-in default
+    LastSource  string    `json:"last_source"`
+    // RateDate is the date a historical rate applies from; empty for the current rate
+    RateDate    string    `json:"rate_date,omitempty"`
 }
 
 type ConversionRequest struct {
     Amount float64 `json:"amount"`
     From   string  `json:"from"`
     To     string  `json:"to"`
+    // Date, as YYYY-MM-DD, converts at the rate in effect that day instead of the current one
+    Date   string  `json:"date,omitempty"`
 }
 
 type ConversionResponse struct {
@@ -46,66 +92,125 @@ type ConversionResponse struct {
     FromCurrency    string    `json:"from_currency"`
     ToCurrency      string    `json:"to_currency"`
     ExchangeRate    float64   `json:"exchange_rate"`
+    RateDate        string    `json:"rate_date,omitempty"`
+    // Stale warns that a current rate used is older than RATE_MAX_AGE or still a seed rate
+    Stale           bool      `json:"stale,omitempty"`
     ConvertedAt     time.Time `json:"converted_at"`
 }
 
-type ExchangeAPIResponse struct {
-    Success bool               `json:"success"`
-    Base    string             `json:"base"`
-    Date    string             `json:"date"`
-    Rates   map[string]float64 `json:"rates"`
-}
-
 func main() {
+    logger.Init("currency-service")
+    
     cfg := config.Load()
+    cfg.Database.Name = "currency_db"
+    
+    db := database.InitDatabase(cfg.Database)
+    defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
     
     currencyService := &CurrencyService{
-        BaseService: &service.BaseService{DB: nil},
-        rates: map[string]Currency{
-            "IDR": {Code: "IDR", Name: "Indonesian Rupiah", Rate: 1.0, LastUpdated: time.Now()},
-            "USD": {Code: "USD", Name: "US Dollar", Rate: 15000.0, LastUpdated: time.Now()},
-            "EUR": {Code: "EUR", Name: "Euro", Rate: 16500.0, LastUpdated: time.Now()},
-            "SGD": {Code: "SGD", Name: "Singapore Dollar", Rate: 11000.0, LastUpdated: time.Now()},
-            "MYR": {Code: "MYR", Name: "Malaysian Ringgit", Rate: 3500.0, LastUpdated: time.Now()},
-        },
+        BaseService: &service.BaseService{DB: db},
+        rates:       seedRates(),
         lastUpdated: time.Now(),
-        apiKey:      getEnv("EXCHANGE_API_KEY", ""),
+        providers:   newRateProviders(getEnv("RATE_PROVIDER", "exchangeratesapi")),
+    }
+    if retries, err := strconv.Atoi(getEnv("RATE_PROVIDER_RETRIES", "2")); err == nil && retries >= 0 {
+        currencyService.providerRetries = retries
+    } else {
+        log.Fatalf("Invalid RATE_PROVIDER_RETRIES: %q", os.Getenv("RATE_PROVIDER_RETRIES"))
+    }
+    if maxAge, err := time.ParseDuration(getEnv("RATE_MAX_AGE", "24h")); err == nil && maxAge >= 0 {
+        currencyService.maxRateAge = maxAge
+    } else {
+        log.Fatalf("Invalid RATE_MAX_AGE: %q", os.Getenv("RATE_MAX_AGE"))
+    }
+    switch policy := getEnv("RATE_STALE_POLICY", "warn"); policy {
+    case "warn":
+    case "reject":
+        currencyService.rejectStaleRates = true
+    default:
+        log.Fatalf("Invalid RATE_STALE_POLICY: %q", policy)
+    }
+    if err := currencyService.loadRates(); err != nil {
+        log.Printf("Failed to load saved exchange rates, using seed rates: %v", err)
     }
     
-    if currencyService.apiKey != "" {
+    if len(currencyService.providers) > 0 {
         go currencyService.startRateUpdates()
     }
     
     r := mux.NewRouter()
     
-    r.Handle("/health", middleware.HealthCheck(nil, "currency-service")).Methods("GET")
+    r.Handle("/health", middleware.HealthCheck(db, "currency-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "currency-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+    })).Methods("GET")
     
     r.Handle("/convert", middleware.Chain(
         middleware.SecurityHeaders,
+        middleware.OptionalAuth(cfg.JWT.Secret),
         middleware.RateLimit(100),
         middleware.LoggingMiddleware,
     )(currencyService.convertCurrencyHandler)).Methods("POST")
     
+    r.Handle("/convert/batch", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.OptionalAuth(cfg.JWT.Secret),
+        middleware.RateLimit(100),
+        middleware.LoggingMiddleware,
+    )(currencyService.convertBatchHandler)).Methods("POST")
+    
     r.Handle("/rates", middleware.Chain(
         middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
         middleware.RateLimit(200),
         middleware.LoggingMiddleware,
     )(currencyService.getRatesHandler)).Methods("GET")
     
+    // Registered before /rates/{code}, which would otherwise take "history" for a code
+    r.Handle("/rates/history", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
+        middleware.RateLimit(200),
+        middleware.LoggingMiddleware,
+    )(currencyService.getRateHistoryHandler)).Methods("GET")
+    
     r.Handle("/rates/{code}", middleware.Chain(
         middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
         middleware.LoggingMiddleware,
     )(currencyService.getRateHandler)).Methods("GET")
     
+    // Manual rate overrides affect every company's conversions
     r.Handle("/rates/update", middleware.Chain(
         middleware.SecurityHeaders,
-        middleware.RateLimit(10),
         middleware.LoggingMiddleware,
+        middleware.NewAuthMiddleware(cfg.JWT.Secret),
+        middleware.RequireRole("admin"),
+        middleware.RateLimit(10),
     )(currencyService.updateRatesHandler)).Methods("POST")
 
     server.SetupServer(r, cfg)
 }
 
+// seedRates are the supported currencies with rough rates, used until a provider has been
+// reached. The figures are IDR per unit, inverted to the units per IDR rates are held in.
+func seedRates() map[string]Currency {
+    now := time.Now()
+    seed := func(code, name string, idrPerUnit float64) Currency {
+        return Currency{Code: code, Name: name, Rate: 1 / idrPerUnit, LastUpdated: now, LastSource: seedSource}
+    }
+    return map[string]Currency{
+        "IDR": seed("IDR", "Indonesian Rupiah", 1.0),
+        "USD": seed("USD", "US Dollar", 15000.0),
+        "EUR": seed("EUR", "Euro", 16500.0),
+        "SGD": seed("SGD", "Singapore Dollar", 11000.0),
+        "MYR": seed("MYR", "Malaysian Ringgit", 3500.0),
+    }
+}
+
 func (cs *CurrencyService) startRateUpdates() {
     ticker := time.NewTicker(1 * time.Hour)
     defer ticker.Stop()
@@ -117,44 +222,82 @@ func (cs *CurrencyService) startRateUpdates() {
     }
 }
 
+// fetchExchangeRates asks the providers in priority order and applies the first set of rates
+// it gets. Currencies that provider has no rate for, and every currency when all providers
+// fail, keep their last good rate.
 func (cs *CurrencyService) fetchExchangeRates() error {
-    url := fmt.Sprintf("https://api.exchangeratesapi.io/v1/latest?access_key=%s&base=IDR&symbols=USD,EUR,SGD,MYR", cs.apiKey)
-    
-    resp, err := http.Get(url)
-    if err != nil {
-        return err
-    }
-    defer resp.Body.Close()
-    
-    body, err := io.ReadAll(resp.Body)
-    if err != nil {
-        return err
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+    defer cancel()
+
+    cs.mutex.RLock()
+    codes := make([]string, 0, len(cs.rates))
+    for code := range cs.rates {
+        if code != baseCurrency {
+            codes = append(codes, code)
+        }
     }
-    
-    var apiResp ExchangeAPIResponse
-    if err := json.Unmarshal(body, &apiResp); err != nil {
-        return err
+    cs.mutex.RUnlock()
+    sort.Strings(codes)
+
+    var failures []string
+    for _, provider := range cs.providers {
+        set, err := cs.fetchWithRetries(ctx, provider, codes)
+        if err != nil {
+            log.Printf("Rate provider %s failed: %v", provider.Name(), err)
+            failures = append(failures, fmt.Sprintf("%s: %v", provider.Name(), err))
+            continue
+        }
+        cs.applyRates(ctx, provider.Name(), set)
+        return nil
     }
-    
-    if !apiResp.Success {
-        return fmt.Errorf("API request failed")
+    return fmt.Errorf("all rate providers failed (%s)", strings.Join(failures, "; "))
+}
+
+// fetchWithRetries gives a provider providerRetries more tries after a failure, waiting a
+// little longer before each, before the next provider is tried
+func (cs *CurrencyService) fetchWithRetries(ctx context.Context, provider RateProvider, codes []string) (RateSet, error) {
+    var err error
+    for attempt := 0; attempt <= cs.providerRetries; attempt++ {
+        if attempt > 0 {
+            select {
+            case <-ctx.Done():
+                return RateSet{}, err
+            case <-time.After(time.Duration(attempt) * providerRetryBackoff):
+            }
+        }
+        var set RateSet
+        if set, err = provider.FetchRates(ctx, codes); err == nil {
+            return set, nil
+        }
     }
-    
+    return RateSet{}, err
+}
+
+// applyRates makes set the current rates and saves it for historical conversions. The rates
+// are live before the save, so a failed save is only logged.
+func (cs *CurrencyService) applyRates(ctx context.Context, source string, set RateSet) {
     cs.mutex.Lock()
-    defer cs.mutex.Unlock()
-    
     now := time.Now()
-    
-    for code, rate := range apiResp.Rates {
-        if currency, exists := cs.rates[code]; exists {
+    updated := make(map[string]float64, len(set.Rates))
+    for code, rate := range set.Rates {
+        if currency, exists := cs.rates[code]; exists && code != baseCurrency && rate > 0 {
             currency.Rate = rate
+            currency.LastSource = source
             currency.LastUpdated = now
             cs.rates[code] = currency
+            updated[code] = rate
         }
     }
-    
     cs.lastUpdated = now
-    return nil
+    cs.mutex.Unlock()
+
+    rateDate := set.Date
+    if _, err := time.Parse(rateDateLayout, rateDate); err != nil {
+        rateDate = service.NewJakartaTime(now).Time().Format(rateDateLayout)
+    }
+    if err := cs.saveRates(ctx, rateDate, source, updated); err != nil {
+        log.Printf("Failed to save exchange rates for %s: %v", rateDate, err)
+    }
 }
 
 func (cs *CurrencyService) convertCurrencyHandler(w http.ResponseWriter, r *http.Request) {
@@ -165,33 +308,169 @@ func (cs *CurrencyService) convertCurrencyHandler(w http.ResponseWriter, r *http
     }
 
     validator := validation.New()
-    if req.Amount <= 0 {
-        validator.AddError("amount", "Amount must be positive")
+    applyAsOf(validator, "", &req, r.URL.Query().Get("as_of"))
+    date := validateConversion(validator, "", req)
+    if !validator.IsValid() {
+        cs.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    response, err := cs.convert(r.Context(), req, date)
+    if err != nil {
+        cs.respondWithRateError(w, err)
+        return
     }
-    validator.Required("from", req.From)
-    validator.Required("to", req.To)
     
+    cs.recordConversions(r, []ConversionRequest{req}, []ConversionResponse{response})
+    cs.RespondWithJSON(w, http.StatusOK, response)
+}
+
+// convertBatchHandler converts many amounts in one call, answering in request order. Every
+// element is checked before any is converted, and one bad element fails the whole batch.
+func (cs *CurrencyService) convertBatchHandler(w http.ResponseWriter, r *http.Request) {
+    var reqs []ConversionRequest
+    if err := service.DecodeJSONBody(w, r, &reqs, service.DefaultMaxBodyBytes); err != nil {
+        cs.RespondWithBodyError(w, err)
+        return
+    }
+    if len(reqs) == 0 {
+        cs.RespondWithError(w, http.StatusBadRequest, "EMPTY_BATCH", "At least one conversion is required")
+        return
+    }
+    if len(reqs) > maxBatchConversions {
+        cs.RespondWithError(w, http.StatusBadRequest, "BATCH_TOO_LARGE",
+            fmt.Sprintf("A batch can hold at most %d conversions", maxBatchConversions))
+        return
+    }
+
+    validator := validation.New()
+    asOf := r.URL.Query().Get("as_of")
+    dates := make([]time.Time, len(reqs))
+    cs.mutex.RLock()
+    for i := range reqs {
+        prefix := fmt.Sprintf("[%d].", i)
+        applyAsOf(validator, prefix, &reqs[i], asOf)
+        req := reqs[i]
+        dates[i] = validateConversion(validator, prefix, req)
+        for _, field := range [][2]string{{"from", req.From}, {"to", req.To}} {
+            if _, exists := cs.rates[field[1]]; field[1] != "" && !exists {
+                validator.AddError(prefix+field[0], fmt.Sprintf("Unknown currency code %s", field[1]))
+            }
+        }
+    }
+    cs.mutex.RUnlock()
     if !validator.IsValid() {
         cs.RespondValidationError(w, validator.Errors())
         return
     }
 
-    converted, exchangeRate, ok := cs.convertAmount(req.Amount, req.From, req.To)
-    if !ok {
-        cs.RespondWithError(w, http.StatusBadRequest, "INVALID_CURRENCY", "Invalid currency codes")
+    responses := make([]ConversionResponse, len(reqs))
+    for i, req := range reqs {
+        response, err := cs.convert(r.Context(), req, dates[i])
+        if err != nil {
+            cs.respondWithRateError(w, err)
+            return
+        }
+        responses[i] = response
+    }
+    
+    cs.recordConversions(r, reqs, responses)
+    cs.RespondWithJSON(w, http.StatusOK, responses)
+}
+
+// applyAsOf makes the as_of query parameter the date of a request that has none; one that
+// names a different date is an error rather than a silent choice between the two
+func applyAsOf(validator *validation.Validator, prefix string, req *ConversionRequest, asOf string) {
+    if asOf == "" {
         return
     }
+    if req.Date != "" && req.Date != asOf {
+        validator.AddError(prefix+"date", "Date conflicts with the as_of parameter")
+        return
+    }
+    req.Date = asOf
+}
+
+// validateConversion checks one conversion request, naming fields with prefix, and returns
+// the parsed date it asks for, zero for the current rate
+func validateConversion(validator *validation.Validator, prefix string, req ConversionRequest) time.Time {
+    if req.Amount <= 0 {
+        validator.AddError(prefix+"amount", "Amount must be positive")
+    }
+    validator.Required(prefix+"from", req.From)
+    validator.Required(prefix+"to", req.To)
     
+    if req.Date == "" {
+        return time.Time{}
+    }
+    date, err := time.Parse(rateDateLayout, req.Date)
+    if err != nil {
+        validator.AddError(prefix+"date", "Date must use YYYY-MM-DD format")
+    }
+    return date
+}
+
+// convert converts at the current rate, or at the rate in effect on date when it is set
+func (cs *CurrencyService) convert(ctx context.Context, req ConversionRequest, date time.Time) (ConversionResponse, error) {
     response := ConversionResponse{
-        OriginalAmount:  req.Amount,
-        ConvertedAmount: converted,
-        FromCurrency:    req.From,
-        ToCurrency:      req.To,
-        ExchangeRate:    exchangeRate,
-        ConvertedAt:     time.Now(),
+        OriginalAmount: req.Amount,
+        FromCurrency:   req.From,
+        ToCurrency:     req.To,
+        ConvertedAt:    time.Now(),
     }
-    
-    cs.RespondWithJSON(w, http.StatusOK, response)
+    for _, code := range []string{req.From, req.To} {
+        if !cs.supported(code) {
+            return ConversionResponse{}, unknownCurrencyError(code)
+        }
+    }
+
+    if date.IsZero() {
+        if cs.ratesStale(req.From, req.To) {
+            if cs.rejectStaleRates {
+                return ConversionResponse{}, errRateStale
+            }
+            response.Stale = true
+        }
+        converted, exchangeRate, ok := cs.convertAmount(req.Amount, req.From, req.To)
+        if !ok {
+            return ConversionResponse{}, errUnknownCurrency
+        }
+        response.ConvertedAmount, response.ExchangeRate = converted, exchangeRate
+        return response, nil
+    }
+
+    converted, exchangeRate, rateDate, err := cs.convertAmountOn(ctx, req.Amount, req.From, req.To, date)
+    if err != nil {
+        return ConversionResponse{}, err
+    }
+    response.ConvertedAmount, response.ExchangeRate, response.RateDate = converted, exchangeRate, rateDate
+    return response, nil
+}
+
+func (cs *CurrencyService) supported(code string) bool {
+    cs.mutex.RLock()
+    defer cs.mutex.RUnlock()
+    _, exists := cs.rates[code]
+    return exists
+}
+
+// ratesStale reports whether the current rate of any of codes is stale. Historical
+// conversions are not checked; their rates are as old as the date asked for.
+func (cs *CurrencyService) ratesStale(codes ...string) bool {
+    if cs.maxRateAge <= 0 {
+        return false
+    }
+    cs.mutex.RLock()
+    defer cs.mutex.RUnlock()
+    for _, code := range codes {
+        if code == baseCurrency {
+            continue
+        }
+        if currency := cs.rates[code]; currency.LastSource == seedSource || time.Since(currency.LastUpdated) > cs.maxRateAge {
+            return true
+        }
+    }
+    return false
 }
 
 func (cs *CurrencyService) convertAmount(amount float64, from, to string) (float64, float64, bool) {
@@ -238,6 +517,25 @@ func (cs *CurrencyService) getRateHandler(w http.ResponseWriter, r *http.Request
     vars := mux.Vars(r)
     code := vars["code"]
     
+    if dateParam := r.URL.Query().Get("date"); dateParam != "" {
+        date, err := time.Parse(rateDateLayout, dateParam)
+        if err != nil {
+            cs.RespondWithError(w, http.StatusBadRequest, "INVALID_DATE", "Date must use YYYY-MM-DD format")
+            return
+        }
+        currency, err := cs.rateOn(r.Context(), code, date)
+        if errors.Is(err, errUnknownCurrency) {
+            cs.RespondWithError(w, http.StatusNotFound, "CURRENCY_NOT_FOUND", "Currency not found")
+            return
+        }
+        if err != nil {
+            cs.respondWithRateError(w, err)
+            return
+        }
+        cs.RespondWithJSON(w, http.StatusOK, currency)
+        return
+    }
+    
     cs.mutex.RLock()
     defer cs.mutex.RUnlock()
     
@@ -251,8 +549,8 @@ func (cs *CurrencyService) getRateHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (cs *CurrencyService) updateRatesHandler(w http.ResponseWriter, r *http.Request) {
-    if cs.apiKey == "" {
-        cs.RespondWithError(w, http.StatusServiceUnavailable, "NO_API_KEY", "Exchange rate API not configured")
+    if len(cs.providers) == 0 {
+        cs.RespondWithError(w, http.StatusServiceUnavailable, "NO_RATE_PROVIDER", "No exchange rate provider configured")
         return
     }
     
@@ -268,6 +566,57 @@ func (cs *CurrencyService) updateRatesHandler(w http.ResponseWriter, r *http.Req
     })
 }
 
+// getRateHistoryHandler returns the stored rate in effect for ?code= on ?date=, today when
+// no date is given
+func (cs *CurrencyService) getRateHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    code := r.URL.Query().Get("code")
+    dateParam := r.URL.Query().Get("date")
+
+    validator := validation.New()
+    validator.Required("code", code)
+    date := service.NewJakartaTime(time.Now()).Time()
+    if dateParam != "" {
+        parsed, err := time.Parse(rateDateLayout, dateParam)
+        if err != nil {
+            validator.AddError("date", "Date must use YYYY-MM-DD format")
+        }
+        date = parsed
+    }
+    if !validator.IsValid() {
+        cs.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    currency, err := cs.rateOn(r.Context(), code, date)
+    if errors.Is(err, errUnknownCurrency) {
+        cs.RespondWithError(w, http.StatusNotFound, "CURRENCY_NOT_FOUND", "Currency not found")
+        return
+    }
+    if err != nil {
+        cs.respondWithRateError(w, err)
+        return
+    }
+    cs.RespondWithJSON(w, http.StatusOK, currency)
+}
+
+// respondWithRateError answers for a failed historical rate lookup
+func (cs *CurrencyService) respondWithRateError(w http.ResponseWriter, err error) {
+    var unknown unknownCurrencyError
+    switch {
+    case errors.As(err, &unknown):
+        cs.RespondWithError(w, http.StatusBadRequest, "INVALID_CURRENCY", fmt.Sprintf("Unknown currency code %s", string(unknown)))
+    case errors.Is(err, errUnknownCurrency):
+        cs.RespondWithError(w, http.StatusBadRequest, "INVALID_CURRENCY", "Invalid currency codes")
+    case errors.Is(err, errRateStale):
+        cs.RespondWithError(w, http.StatusServiceUnavailable, "RATE_STALE",
+            fmt.Sprintf("Exchange rates have not been updated in the last %s", cs.maxRateAge))
+    case errors.Is(err, errRateNotFound):
+        cs.RespondWithError(w, http.StatusNotFound, "RATE_NOT_FOUND", "No exchange rate recorded on or before that date")
+    default:
+        cs.HandleDBError(w, err, "Failed to look up exchange rate")
+    }
+}
+
 func getEnv(key, defaultValue string) string {
     if value := os.Getenv(key); value != "" {
         return value
@@ -0,0 +1,10 @@
+// currency-service/migrations.go
+package main
+
+import "embed"
+
+// migrations is the service's schema, applied at startup by database.MustMigrate. Applied
+// migrations must not be edited; change the schema by adding the next numbered file.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
\ No newline at end of file
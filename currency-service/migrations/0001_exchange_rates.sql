@@ -0,0 +1,10 @@
+-- currency-service/migrations/0001_exchange_rates.sql
+-- Fetched rates by currency and the date they apply to; rates are units of the currency per IDR,
+-- as fetched with base=IDR. A rate stays in effect until a later date has one.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency_code CHAR(3) NOT NULL,
+    rate_date DATE NOT NULL,
+    rate NUMERIC(24,12) NOT NULL CHECK (rate > 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (currency_code, rate_date)
+);
@@ -0,0 +1,17 @@
+-- currency-service/migrations/0002_conversion_audit.sql
+-- Conversions made on behalf of a company, so the figures in its books can be traced back
+CREATE TABLE IF NOT EXISTS conversion_audit (
+    id BIGSERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    user_id INTEGER,
+    amount NUMERIC(24,6) NOT NULL,
+    from_currency CHAR(3) NOT NULL,
+    to_currency CHAR(3) NOT NULL,
+    converted_amount NUMERIC(24,6) NOT NULL,
+    exchange_rate NUMERIC(24,12) NOT NULL,
+    as_of DATE,
+    rate_date DATE,
+    converted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversion_audit_company_date ON conversion_audit(company_id, converted_at);
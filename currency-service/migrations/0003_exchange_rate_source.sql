@@ -0,0 +1,6 @@
+-- currency-service/migrations/0003_exchange_rate_source.sql
+-- The provider each rate came from. Rates saved before providers were pluggable all came
+-- from exchangeratesapi.io.
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS source VARCHAR(30);
+UPDATE exchange_rates SET source = 'exchangeratesapi' WHERE source IS NULL;
+ALTER TABLE exchange_rates ALTER COLUMN source SET NOT NULL;
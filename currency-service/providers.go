@@ -0,0 +1,264 @@
+// currency-service/providers.go
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+// RateProvider is a source of exchange rates. FetchRates returns rates for as many of codes
+// as the source has, as units of each currency per IDR, with the date they apply to. Each
+// provider parses its own response format into a RateSet.
+type RateProvider interface {
+    Name() string
+    FetchRates(ctx context.Context, codes []string) (RateSet, error)
+}
+
+type RateSet struct {
+    Date  string
+    Rates map[string]float64
+}
+
+const providerTimeout = 15 * time.Second
+
+// newRateProviders builds the providers named in RATE_PROVIDER, a comma-separated list in
+// priority order: the first is the primary, the rest are fallbacks. Providers missing their
+// configuration are left out with a warning.
+func newRateProviders(names string) []RateProvider {
+    client := &http.Client{Timeout: providerTimeout}
+
+    var providers []RateProvider
+    for _, name := range strings.Split(names, ",") {
+        switch name = strings.TrimSpace(name); name {
+        case "":
+        case "exchangeratesapi":
+            apiKey := getEnv("EXCHANGE_API_KEY", "")
+            if apiKey == "" {
+                log.Printf("Rate provider exchangeratesapi skipped: EXCHANGE_API_KEY is not set")
+                continue
+            }
+            providers = append(providers, &exchangeRatesAPIProvider{client: client, apiKey: apiKey})
+        case "openexchangerates":
+            appID := getEnv("OPENEXCHANGERATES_APP_ID", "")
+            if appID == "" {
+                log.Printf("Rate provider openexchangerates skipped: OPENEXCHANGERATES_APP_ID is not set")
+                continue
+            }
+            providers = append(providers, &openExchangeRatesProvider{client: client, appID: appID})
+        case "bi":
+            providers = append(providers, &biProvider{
+                client:  client,
+                baseURL: getEnv("BI_RATES_URL", "https://www.bi.go.id/biwebservice/wskursbi.asmx/getSubKursLokal3"),
+            })
+        default:
+            log.Fatalf("Invalid RATE_PROVIDER: unknown provider %q", name)
+        }
+    }
+    return providers
+}
+
+// exchangeRatesAPIProvider reads exchangeratesapi.io, which quotes against IDR directly
+type exchangeRatesAPIProvider struct {
+    client *http.Client
+    apiKey string
+}
+
+type ExchangeAPIResponse struct {
+    Success bool               `json:"success"`
+    Base    string             `json:"base"`
+    Date    string             `json:"date"`
+    Rates   map[string]float64 `json:"rates"`
+}
+
+func (p *exchangeRatesAPIProvider) Name() string {
+    return "exchangeratesapi"
+}
+
+func (p *exchangeRatesAPIProvider) FetchRates(ctx context.Context, codes []string) (RateSet, error) {
+    query := url.Values{
+        "access_key": {p.apiKey},
+        "base":       {baseCurrency},
+        "symbols":    {strings.Join(codes, ",")},
+    }
+    body, err := fetch(ctx, p.client, "https://api.exchangeratesapi.io/v1/latest?"+query.Encode())
+    if err != nil {
+        return RateSet{}, err
+    }
+    return parseExchangeRatesAPI(body)
+}
+
+func parseExchangeRatesAPI(body []byte) (RateSet, error) {
+    var apiResp ExchangeAPIResponse
+    if err := json.Unmarshal(body, &apiResp); err != nil {
+        return RateSet{}, err
+    }
+    if !apiResp.Success {
+        return RateSet{}, fmt.Errorf("API request failed")
+    }
+    if apiResp.Base != baseCurrency {
+        return RateSet{}, fmt.Errorf("rates quoted against %s, not %s", apiResp.Base, baseCurrency)
+    }
+    return RateSet{Date: apiResp.Date, Rates: apiResp.Rates}, nil
+}
+
+// openExchangeRatesProvider reads openexchangerates.org. Its free plan only quotes against
+// USD, so rates are crossed through the IDR quote.
+type openExchangeRatesProvider struct {
+    client *http.Client
+    appID  string
+}
+
+type openExchangeRatesResponse struct {
+    Timestamp int64              `json:"timestamp"`
+    Base      string             `json:"base"`
+    Rates     map[string]float64 `json:"rates"`
+}
+
+func (p *openExchangeRatesProvider) Name() string {
+    return "openexchangerates"
+}
+
+func (p *openExchangeRatesProvider) FetchRates(ctx context.Context, codes []string) (RateSet, error) {
+    query := url.Values{
+        "app_id":  {p.appID},
+        "symbols": {strings.Join(append([]string{baseCurrency}, codes...), ",")},
+    }
+    body, err := fetch(ctx, p.client, "https://openexchangerates.org/api/latest.json?"+query.Encode())
+    if err != nil {
+        return RateSet{}, err
+    }
+    return parseOpenExchangeRates(body)
+}
+
+func parseOpenExchangeRates(body []byte) (RateSet, error) {
+    var resp openExchangeRatesResponse
+    if err := json.Unmarshal(body, &resp); err != nil {
+        return RateSet{}, err
+    }
+    // The quote currency itself is only listed when asked for
+    if _, listed := resp.Rates[resp.Base]; resp.Base != "" && resp.Rates != nil && !listed {
+        resp.Rates[resp.Base] = 1
+    }
+    idrPerBase, ok := resp.Rates[baseCurrency]
+    if !ok || idrPerBase <= 0 {
+        return RateSet{}, fmt.Errorf("response has no %s rate", baseCurrency)
+    }
+
+    set := RateSet{Rates: make(map[string]float64, len(resp.Rates))}
+    if resp.Timestamp > 0 {
+        set.Date = service.NewJakartaTime(time.Unix(resp.Timestamp, 0)).Time().Format(rateDateLayout)
+    }
+    for code, rate := range resp.Rates {
+        if code != baseCurrency && rate > 0 {
+            set.Rates[code] = rate / idrPerBase
+        }
+    }
+    return set, nil
+}
+
+// biProvider reads Bank Indonesia's transaction rates (kurs transaksi BI). BI publishes a
+// buy and a sell rate per currency in IDR for a number of units; the rate used is their
+// middle, the BI middle rate Indonesian reporting refers to. Rates are published on working
+// days only, so it asks for the last week and takes each currency's latest.
+type biProvider struct {
+    client  *http.Client
+    baseURL string
+}
+
+type biRatesResponse struct {
+    Rows []struct {
+        Currency string  `xml:"mts_subkurslokal"`
+        Units    float64 `xml:"nil_subkurslokal"`
+        Buy      float64 `xml:"beli_subkurslokal"`
+        Sell     float64 `xml:"jual_subkurslokal"`
+        Date     string  `xml:"tgl_subkurslokal"`
+    } `xml:"diffgram>NewDataSet>Table"`
+}
+
+func (p *biProvider) Name() string {
+    return "bi"
+}
+
+func (p *biProvider) FetchRates(ctx context.Context, codes []string) (RateSet, error) {
+    end := service.NewJakartaTime(time.Now()).Time()
+    start := end.AddDate(0, 0, -7)
+
+    set := RateSet{Rates: make(map[string]float64, len(codes))}
+    for _, code := range codes {
+        query := url.Values{
+            "mts":       {code},
+            "startdate": {start.Format(rateDateLayout)},
+            "enddate":   {end.Format(rateDateLayout)},
+        }
+        body, err := fetch(ctx, p.client, p.baseURL+"?"+query.Encode())
+        if err != nil {
+            return RateSet{}, err
+        }
+
+        date, rate, err := parseBIRates(code, body)
+        if err != nil {
+            return RateSet{}, fmt.Errorf("parsing BI rates for %s: %w", code, err)
+        }
+        if rate == 0 {
+            continue
+        }
+        set.Rates[code] = rate
+        if date > set.Date {
+            set.Date = date
+        }
+    }
+    if len(set.Rates) == 0 {
+        return RateSet{}, fmt.Errorf("no BI rates published in the last week")
+    }
+    return set, nil
+}
+
+// parseBIRates returns the latest rate for code in a BI response and the date it is for, or
+// a zero rate when the response has none
+func parseBIRates(code string, body []byte) (string, float64, error) {
+    var resp biRatesResponse
+    if err := xml.Unmarshal(body, &resp); err != nil {
+        return "", 0, err
+    }
+
+    latest, rate := "", 0.0
+    for _, row := range resp.Rows {
+        date := row.Date
+        if len(date) > len(rateDateLayout) {
+            date = date[:len(rateDateLayout)]
+        }
+        middle := (row.Buy + row.Sell) / 2
+        if strings.TrimSpace(row.Currency) != code || row.Units <= 0 || middle <= 0 || date < latest {
+            continue
+        }
+        latest, rate = date, row.Units/middle
+    }
+    return latest, rate, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+    }
+    return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
\ No newline at end of file
@@ -0,0 +1,92 @@
+package main
+
+import (
+    "math"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// The fixtures in testdata are responses recorded from each provider, trimmed to a few
+// currencies
+
+func readFixture(t *testing.T, name string) []byte {
+    t.Helper()
+    body, err := os.ReadFile(filepath.Join("testdata", name))
+    if err != nil {
+        t.Fatalf("read fixture: %v", err)
+    }
+    return body
+}
+
+func assertRates(t *testing.T, got, want map[string]float64) {
+    t.Helper()
+    if len(got) != len(want) {
+        t.Errorf("rates = %v, want %v", got, want)
+        return
+    }
+    for code, rate := range want {
+        if math.Abs(got[code]-rate) > 1e-12 {
+            t.Errorf("%s rate = %v, want %v", code, got[code], rate)
+        }
+    }
+}
+
+func TestParseExchangeRatesAPI(t *testing.T) {
+    set, err := parseExchangeRatesAPI(readFixture(t, "exchangeratesapi_latest.json"))
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+    if set.Date != "2025-10-16" {
+        t.Errorf("date = %q, want 2025-10-16", set.Date)
+    }
+    assertRates(t, set.Rates, map[string]float64{"EUR": 0.0000517, "SGD": 0.0000779, "USD": 0.0000603})
+
+    if _, err := parseExchangeRatesAPI([]byte(`{"success":false}`)); err == nil {
+        t.Error("expected an error for an unsuccessful response")
+    }
+    if _, err := parseExchangeRatesAPI([]byte(`{"success":true,"base":"EUR","rates":{"USD":1.17}}`)); err == nil {
+        t.Error("expected an error for rates quoted against another currency")
+    }
+}
+
+func TestParseOpenExchangeRates(t *testing.T) {
+    set, err := parseOpenExchangeRates(readFixture(t, "openexchangerates_latest.json"))
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+    // The timestamp is midnight UTC, which is already the same day in Jakarta
+    if set.Date != "2025-10-16" {
+        t.Errorf("date = %q, want 2025-10-16", set.Date)
+    }
+    // USD is the quote currency, so it is crossed through IDR like the rest
+    assertRates(t, set.Rates, map[string]float64{
+        "EUR": 0.857 / 16580.5,
+        "SGD": 1.2925 / 16580.5,
+        "USD": 1 / 16580.5,
+    })
+
+    if _, err := parseOpenExchangeRates([]byte(`{"base":"USD","rates":{"EUR":0.857}}`)); err == nil {
+        t.Error("expected an error for a response without an IDR rate")
+    }
+}
+
+func TestParseBIRates(t *testing.T) {
+    body := readFixture(t, "bi_kurs_jpy.xml")
+
+    // The latest day wins; BI quotes JPY per 100 units, at the middle of buy and sell
+    date, rate, err := parseBIRates("JPY", body)
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+    if date != "2025-10-15" {
+        t.Errorf("date = %q, want 2025-10-15", date)
+    }
+    if want := 100 / 11000.0; math.Abs(rate-want) > 1e-12 {
+        t.Errorf("rate = %v, want %v", rate, want)
+    }
+
+    if _, rate, err := parseBIRates("USD", body); err != nil || rate != 0 {
+        t.Errorf("currency not in response: rate = %v, err = %v, want 0 and no error", rate, err)
+    }
+}
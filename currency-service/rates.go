@@ -0,0 +1,131 @@
+// currency-service/rates.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "strings"
+    "time"
+)
+
+const rateDateLayout = "2006-01-02"
+
+// errRateNotFound means no rate had been recorded for a currency on or before the date asked for
+var errRateNotFound = errors.New("no exchange rate recorded on or before that date")
+
+// loadRates makes the latest saved rate of each supported currency current, so a restart
+// picks up where the last fetch left off. Currencies with no saved rate keep their seed.
+func (cs *CurrencyService) loadRates() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    rows, err := cs.DB.QueryContext(ctx, `
+        SELECT DISTINCT ON (currency_code) currency_code, rate, source, updated_at
+        FROM exchange_rates
+        ORDER BY currency_code, rate_date DESC`)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    cs.mutex.Lock()
+    defer cs.mutex.Unlock()
+    var latest time.Time
+    for rows.Next() {
+        var code, source string
+        var rate float64
+        var updatedAt time.Time
+        if err := rows.Scan(&code, &rate, &source, &updatedAt); err != nil {
+            return err
+        }
+        currency, exists := cs.rates[strings.TrimSpace(code)]
+        if !exists || currency.Code == baseCurrency {
+            continue
+        }
+        currency.Rate, currency.LastSource, currency.LastUpdated = rate, source, updatedAt
+        cs.rates[currency.Code] = currency
+        if updatedAt.After(latest) {
+            latest = updatedAt
+        }
+    }
+    if !latest.IsZero() {
+        cs.lastUpdated = latest
+    }
+    return rows.Err()
+}
+
+// saveRates records rates from source as the ones in effect on date, replacing any saved
+// earlier that day
+func (cs *CurrencyService) saveRates(ctx context.Context, date, source string, rates map[string]float64) error {
+    tx, err := cs.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    for code, rate := range rates {
+        if _, err := tx.ExecContext(ctx, `
+            INSERT INTO exchange_rates (currency_code, rate_date, rate, source)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (currency_code, rate_date)
+            DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source, updated_at = CURRENT_TIMESTAMP`,
+            code, date, rate, source); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+// rateOn returns the rate in effect for a supported currency on date: the one recorded on
+// that date or, failing that, the latest one before it. IDR, the base, is always 1.
+func (cs *CurrencyService) rateOn(ctx context.Context, code string, date time.Time) (Currency, error) {
+    cs.mutex.RLock()
+    currency, exists := cs.rates[code]
+    cs.mutex.RUnlock()
+    if !exists {
+        return Currency{}, unknownCurrencyError(code)
+    }
+    if code == baseCurrency {
+        currency.RateDate = date.Format(rateDateLayout)
+        return currency, nil
+    }
+
+    var rateDate time.Time
+    err := cs.DB.QueryRowContext(ctx, `
+        SELECT rate, source, rate_date, updated_at FROM exchange_rates
+        WHERE currency_code = $1 AND rate_date <= $2
+        ORDER BY rate_date DESC LIMIT 1`,
+        code, date.Format(rateDateLayout)).Scan(&currency.Rate, &currency.LastSource, &rateDate, &currency.LastUpdated)
+    if err == sql.ErrNoRows {
+        return Currency{}, errRateNotFound
+    }
+    if err != nil {
+        return Currency{}, err
+    }
+    currency.RateDate = rateDate.Format(rateDateLayout)
+    return currency, nil
+}
+
+// convertAmountOn converts with the rates in effect on date. The returned rate date is the
+// older of the two rates' dates, the one the conversion is only as current as.
+func (cs *CurrencyService) convertAmountOn(ctx context.Context, amount float64, from, to string, date time.Time) (float64, float64, string, error) {
+    if from == to {
+        return amount, 1.0, date.Format(rateDateLayout), nil
+    }
+    fromCurrency, err := cs.rateOn(ctx, from, date)
+    if err != nil {
+        return 0, 0, "", err
+    }
+    toCurrency, err := cs.rateOn(ctx, to, date)
+    if err != nil {
+        return 0, 0, "", err
+    }
+
+    rateDate := fromCurrency.RateDate
+    if toCurrency.RateDate < rateDate {
+        rateDate = toCurrency.RateDate
+    }
+    exchangeRate := toCurrency.Rate / fromCurrency.Rate
+    return amount / fromCurrency.Rate * toCurrency.Rate, exchangeRate, rateDate, nil
+}
\ No newline at end of file
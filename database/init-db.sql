@@ -1,5 +1,7 @@
 -- database/init-db.sql - CORRECTED VERSION WITH PROPER SERVICE SEPARATION
 -- Enhanced Database Initialization Script with Company Service Support
+-- Schema changes belong in each service's migrations directory, applied at service startup;
+-- this script creates the databases, their baseline schema and sample data for local development.
 
 -- Create all databases (including company_db)
 CREATE DATABASE user_db;
@@ -10,6 +12,8 @@ CREATE DATABASE invoice_db;
 CREATE DATABASE vendor_db;
 CREATE DATABASE inventory_db;
 CREATE DATABASE tax_db;
+CREATE DATABASE currency_db;
+CREATE DATABASE notification_db;
 
 -- User Database Setup (COMPANIES TABLE REMOVED - MICROSERVICES COMPLIANCE)
 \c user_db;
@@ -80,7 +84,7 @@ CREATE TABLE company_settings (
 
 -- Insert sample company data
 INSERT INTO companies (name, tax_id, address, phone, email, business_type) VALUES 
-('PT Contoh Indonesia', '01.234.567.8-901.000', 'Jakarta, Indonesia', '+62-21-1234567', 'admin@contoh.co.id', 'Technology Services');
+('PT Contoh Indonesia', '01.234.567.4-901.000', 'Jakarta, Indonesia', '+62-21-1234567', 'admin@contoh.co.id', 'Technology Services');
 
 -- Insert Indonesian compliance settings
 INSERT INTO company_settings (company_id, setting_key, setting_value) VALUES 
@@ -88,7 +92,10 @@ INSERT INTO company_settings (company_id, setting_key, setting_value) VALUES
 (1, 'default_timezone', 'Asia/Jakarta'),
 (1, 'tax_rate_ppn', '11.00'),
 (1, 'fiscal_year_start', '01-01'),
-(1, 'reporting_language', 'id-ID');
+(1, 'reporting_language', 'id-ID'),
+(1, 'require_separate_approver', 'false'),
+(1, 'inventory_valuation_method', 'average'),
+(1, 'invoice_number_format', 'INV/{YYYY}/{SEQ:6}');
 
 -- Account Database Setup
 \c account_db;
@@ -249,9 +256,9 @@ CREATE TABLE invoice_lines (
 
 -- Insert sample customers
 INSERT INTO customers (company_id, customer_code, name, email, phone, address, tax_id) VALUES 
-(1, 'CUST001', 'PT Mitra Bisnis', 'mitra@bisnis.co.id', '+62-21-1234567', 'Jakarta', '01.234.567.8-901.001'),
-(1, 'CUST002', 'CV Sejahtera', 'info@sejahtera.co.id', '+62-21-1234568', 'Bandung', '01.234.567.8-901.002'),
-(1, 'CUST003', 'PT Global Tech', 'admin@globaltech.co.id', '+62-21-1234569', 'Surabaya', '01.234.567.8-901.003');
+(1, 'CUST001', 'PT Mitra Bisnis', 'mitra@bisnis.co.id', '+62-21-1234567', 'Jakarta', '01.234.567.4-901.001'),
+(1, 'CUST002', 'CV Sejahtera', 'info@sejahtera.co.id', '+62-21-1234568', 'Bandung', '01.234.567.4-901.002'),
+(1, 'CUST003', 'PT Global Tech', 'admin@globaltech.co.id', '+62-21-1234569', 'Surabaya', '01.234.567.4-901.003');
 
 -- Vendor Database Setup
 \c vendor_db;
@@ -296,9 +303,9 @@ CREATE TABLE purchase_orders (
 
 -- Insert sample vendors
 INSERT INTO vendors (company_id, vendor_code, name, email, phone, address, tax_id, payment_terms) VALUES 
-(1, 'VEND001', 'PT Supplier Utama', 'supplier@utama.co.id', '+62-21-2345678', 'Jakarta', '01.234.567.8-902.001', 30),
-(1, 'VEND002', 'CV Distributor Prima', 'info@distributor.co.id', '+62-21-2345679', 'Surabaya', '01.234.567.8-902.002', 15),
-(1, 'VEND003', 'PT Office Supply', 'sales@office.co.id', '+62-21-2345680', 'Bandung', '01.234.567.8-902.003', 45);
+(1, 'VEND001', 'PT Supplier Utama', 'supplier@utama.co.id', '+62-21-2345678', 'Jakarta', '01.234.567.4-902.001', 30),
+(1, 'VEND002', 'CV Distributor Prima', 'info@distributor.co.id', '+62-21-2345679', 'Surabaya', '01.234.567.4-902.002', 15),
+(1, 'VEND003', 'PT Office Supply', 'sales@office.co.id', '+62-21-2345680', 'Bandung', '01.234.567.4-902.003', 45);
 
 -- Inventory Database Setup
 \c inventory_db;
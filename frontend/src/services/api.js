@@ -8,6 +8,8 @@ class ApiService {
         this.api = axios.create({
             baseURL: API_BASE_URL,
             timeout: 30000,
+            // Sends the csrf_session cookie that /csrf-token tokens are bound to
+            withCredentials: true,
             headers: {
                 'Content-Type': 'application/json',
             }
@@ -19,10 +21,13 @@ class ApiService {
     setupInterceptors() {
         // Request interceptor
         this.api.interceptors.request.use(
-            (config) => {
+            async (config) => {
                 const token = localStorage.getItem('token');
                 if (token) {
                     config.headers.Authorization = `Bearer ${token}`;
+                } else if (!['get', 'head', 'options'].includes(config.method)) {
+                    // Requests without a bearer token, such as login, need a CSRF token
+                    config.headers['X-CSRF-Token'] = await this.getCsrfToken();
                 }
                 return config;
             },
@@ -42,6 +47,11 @@ class ApiService {
         );
     }
 
+    async getCsrfToken() {
+        const response = await axios.get(`${API_BASE_URL}/csrf-token`, { withCredentials: true });
+        return response.data.csrf_token;
+    }
+
     // Authentication
     async login(credentials) {
         const response = await this.api.post('/auth/login', credentials);
@@ -0,0 +1,151 @@
+// inventory-service/alerts.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "html"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/lib/pq"
+
+    "github.com/massehanto/accounting-system-go/shared/client"
+)
+
+// LowStockAlerter emails a summary of products at or below their minimum stock.
+// Each product is alerted at most once per window, tracked by low_stock_alerted_at.
+type LowStockAlerter struct {
+    db           *sql.DB
+    notifyClient *client.Client
+    recipient    string
+    interval     time.Duration
+    window       time.Duration
+    mu           sync.Mutex
+}
+
+// Enabled reports whether alerts have somewhere to go
+func (a *LowStockAlerter) Enabled() bool {
+    return a.recipient != ""
+}
+
+// Run scans for low stock every interval until ctx is cancelled
+func (a *LowStockAlerter) Run(ctx context.Context) {
+    if !a.Enabled() || a.interval <= 0 {
+        log.Printf("Low stock alert job disabled")
+        return
+    }
+
+    ticker := time.NewTicker(a.interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            scanCtx, cancel := context.WithTimeout(ctx, time.Minute)
+            if count, err := a.Notify(scanCtx, 0); err != nil {
+                log.Printf("Low stock alert scan failed: %v", err)
+            } else if count > 0 {
+                log.Printf("Sent low stock alerts for %d products", count)
+            }
+            cancel()
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// Notify alerts on low-stock products that are outside the throttle window and returns
+// how many were included. A companyID of 0 scans every company.
+func (a *LowStockAlerter) Notify(ctx context.Context, companyID int) (int, error) {
+    // Serialize scans so the background job and a manual trigger cannot double-alert
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    query := `SELECT id, company_id, product_code, product_name, quantity_on_hand, minimum_stock
+              FROM products
+              WHERE is_active = true AND quantity_on_hand <= minimum_stock
+                AND (low_stock_alerted_at IS NULL OR low_stock_alerted_at < $1)`
+    args := []interface{}{time.Now().Add(-a.window)}
+    if companyID != 0 {
+        query += " AND company_id = $2"
+        args = append(args, companyID)
+    }
+    query += " ORDER BY company_id, (quantity_on_hand - minimum_stock), product_name"
+
+    rows, err := a.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return 0, err
+    }
+
+    byCompany := make(map[int][]Product)
+    var companies []int
+    for rows.Next() {
+        var product Product
+        if err := rows.Scan(&product.ID, &product.CompanyID, &product.ProductCode, &product.ProductName,
+            &product.QuantityOnHand, &product.MinimumStock); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        if _, seen := byCompany[product.CompanyID]; !seen {
+            companies = append(companies, product.CompanyID)
+        }
+        byCompany[product.CompanyID] = append(byCompany[product.CompanyID], product)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    alerted := 0
+    for _, id := range companies {
+        products := byCompany[id]
+        if err := a.sendSummary(ctx, id, products); err != nil {
+            return alerted, err
+        }
+
+        productIDs := make([]int64, len(products))
+        for i, product := range products {
+            productIDs[i] = int64(product.ID)
+        }
+        _, err := a.db.ExecContext(ctx,
+            "UPDATE products SET low_stock_alerted_at = CURRENT_TIMESTAMP WHERE id = ANY($1)",
+            pq.Array(productIDs))
+        if err != nil {
+            return alerted, err
+        }
+        alerted += len(products)
+    }
+
+    return alerted, nil
+}
+
+func (a *LowStockAlerter) sendSummary(ctx context.Context, companyID int, products []Product) error {
+    var rows strings.Builder
+    for _, product := range products {
+        fmt.Fprintf(&rows, "<tr><td>%s</td><td>%s</td><td>%d</td><td>%d</td></tr>",
+            html.EscapeString(product.ProductCode), html.EscapeString(product.ProductName),
+            product.QuantityOnHand, product.MinimumStock)
+    }
+
+    message := fmt.Sprintf(`<h2>Low stock alert</h2>
+<p>%d products are at or below their minimum stock level:</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Code</th><th>Product</th><th>On hand</th><th>Minimum</th></tr>
+%s
+</table>`, len(products), rows.String())
+
+    email := map[string]interface{}{
+        "to":      a.recipient,
+        "subject": fmt.Sprintf("Low stock alert: %d products need reordering (company %d)", len(products), companyID),
+        "data": map[string]interface{}{
+            "message": message,
+        },
+    }
+
+    return a.notifyClient.Do(ctx, http.MethodPost, "/send-email", nil, email, nil)
+}
\ No newline at end of file
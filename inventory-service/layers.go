@@ -0,0 +1,90 @@
+// inventory-service/layers.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "math"
+)
+
+// averageCostColumn selects a product's average cost from its open cost layers, falling back
+// to cost_price for products whose stock predates layer tracking.
+const averageCostColumn = `COALESCE((SELECT ROUND(SUM(l.remaining_quantity * l.unit_cost) / NULLIF(SUM(l.remaining_quantity), 0))
+                                     FROM stock_cost_layers l
+                                     WHERE l.product_id = products.id AND l.remaining_quantity > 0), cost_price, 0)`
+
+// openLayer is a persisted receipt of stock that has not been fully consumed
+type openLayer struct {
+    ID        int
+    Remaining int
+    UnitCost  float64
+}
+
+// lockOpenLayers loads a product's open layers oldest first and locks them for consumption
+func lockOpenLayers(ctx context.Context, tx *sql.Tx, productID int) ([]openLayer, error) {
+    rows, err := tx.QueryContext(ctx, `SELECT id, remaining_quantity, unit_cost FROM stock_cost_layers
+                                       WHERE product_id = $1 AND remaining_quantity > 0
+                                       ORDER BY received_date, id FOR UPDATE`, productID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var layers []openLayer
+    for rows.Next() {
+        var layer openLayer
+        if err := rows.Scan(&layer.ID, &layer.Remaining, &layer.UnitCost); err != nil {
+            return nil, err
+        }
+        layers = append(layers, layer)
+    }
+    return layers, rows.Err()
+}
+
+// realizeCost takes quantity out of stock and returns its cost in whole Rupiah along with the
+// layers whose remaining quantity changed. Stock on hand that is not covered by any layer
+// predates layer tracking; it is treated as the oldest stock and valued at openingCost.
+// FIFO costs each unit at its layer's price, weighted average at the blended price of all
+// stock on hand; either way layer quantities are drawn down oldest first.
+func realizeCost(method string, onHand int, openingCost float64, layers []openLayer, quantity int) (float64, []openLayer) {
+    layered := 0
+    layeredValue := 0.0
+    for _, layer := range layers {
+        layered += layer.Remaining
+        layeredValue += float64(layer.Remaining) * layer.UnitCost
+    }
+    opening := onHand - layered
+    if opening < 0 {
+        opening = 0
+    }
+
+    var cost float64
+    var changed []openLayer
+
+    take := quantity
+    if take > opening {
+        take = opening
+    }
+    cost += float64(take) * openingCost
+    remaining := quantity - take
+
+    for i := range layers {
+        if remaining == 0 {
+            break
+        }
+        take := layers[i].Remaining
+        if take > remaining {
+            take = remaining
+        }
+        cost += float64(take) * layers[i].UnitCost
+        layers[i].Remaining -= take
+        remaining -= take
+        changed = append(changed, layers[i])
+    }
+
+    if method == ValuationAverage && opening+layered > 0 {
+        average := (float64(opening)*openingCost + layeredValue) / float64(opening+layered)
+        cost = average * float64(quantity)
+    }
+    return math.Round(cost), changed
+}
\ No newline at end of file
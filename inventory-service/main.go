@@ -5,14 +5,21 @@ import (
     "context"
     "database/sql"
     "encoding/json"
+    "fmt"
+    "log"
+    "math"
     "net/http"
+    "os"
     "strconv"
+    "strings"
     "time"
     
     "github.com/gorilla/mux"
     _ "github.com/lib/pq"
     
+    "github.com/massehanto/accounting-system-go/shared/client"
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/database"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
@@ -20,8 +27,14 @@ import (
     "github.com/massehanto/accounting-system-go/shared/validation"
 )
 
+// minAdjustmentNotes is the shortest justification accepted for a stock adjustment
+const minAdjustmentNotes = 10
+
 type InventoryService struct {
     *service.BaseService
+    companyClient   *client.Client
+    alerter         *LowStockAlerter
+    reorderDefaults ReorderAssumptions
 }
 
 type Product struct {
@@ -30,8 +43,10 @@ type Product struct {
     ProductCode    string    `json:"product_code"`
     ProductName    string    `json:"product_name"`
     Description    string    `json:"description"`
+    Category       string    `json:"category"`
     UnitPrice      float64   `json:"unit_price"`
     CostPrice      float64   `json:"cost_price"`
+    AverageCost    float64   `json:"average_cost"`
     QuantityOnHand int       `json:"quantity_on_hand"`
     MinimumStock   int       `json:"minimum_stock"`
     IsActive       bool      `json:"is_active"`
@@ -43,38 +58,93 @@ type StockMovement struct {
     ID              int       `json:"id"`
     CompanyID       int       `json:"company_id"`
     ProductID       int       `json:"product_id"`
+    WarehouseID     int       `json:"warehouse_id"`
+    ToWarehouseID   *int      `json:"to_warehouse_id,omitempty"`
     MovementType    string    `json:"movement_type"`
     Quantity        int       `json:"quantity"`
     UnitCost        float64   `json:"unit_cost"`
+    CostAmount      float64   `json:"cost_amount"`
     ReferenceNumber string    `json:"reference_number"`
     MovementDate    time.Time `json:"movement_date"`
     Notes           string    `json:"notes"`
+    ApprovedBy      *int      `json:"approved_by,omitempty"`
     CreatedBy       int       `json:"created_by"`
     CreatedAt       time.Time `json:"created_at"`
 }
 
 func main() {
+    logger.Init("inventory-service")
+    
     cfg := config.Load()
     cfg.Database.Name = "inventory_db"
     
     db := database.InitDatabase(cfg.Database)
     defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
+    
+    scanInterval, err := time.ParseDuration(getEnv("LOW_STOCK_SCAN_INTERVAL", "1h"))
+    if err != nil {
+        log.Fatalf("Invalid LOW_STOCK_SCAN_INTERVAL: %v", err)
+    }
+    alertWindow, err := time.ParseDuration(getEnv("LOW_STOCK_ALERT_WINDOW", "24h"))
+    if err != nil {
+        log.Fatalf("Invalid LOW_STOCK_ALERT_WINDOW: %v", err)
+    }
+    idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_KEY_TTL", "24h"))
+    if err != nil || idempotencyTTL <= 0 {
+        log.Fatalf("Invalid IDEMPOTENCY_KEY_TTL: %q", os.Getenv("IDEMPOTENCY_KEY_TTL"))
+    }
+    
+    alerter := &LowStockAlerter{
+        db:           db,
+        notifyClient: client.New(getEnv("NOTIFICATION_SERVICE_URL", "http://localhost:8010")),
+        recipient:    os.Getenv("LOW_STOCK_ALERT_RECIPIENT"),
+        interval:     scanInterval,
+        window:       alertWindow,
+    }
+    go alerter.Run(context.Background())
     
     inventoryService := &InventoryService{
-        BaseService: &service.BaseService{DB: db},
+        BaseService:   &service.BaseService{DB: db},
+        companyClient: client.New(getEnv("COMPANY_SERVICE_URL", "http://localhost:8011")),
+        alerter:       alerter,
+        reorderDefaults: ReorderAssumptions{
+            WindowDays:   envDays("REORDER_WINDOW_DAYS", "90"),
+            LeadTimeDays: envDays("REORDER_LEAD_TIME_DAYS", "14"),
+            SafetyDays:   envDays("REORDER_SAFETY_DAYS", "7"),
+        },
     }
     
     r := mux.NewRouter()
     api := middleware.APIMiddleware(cfg.JWT.Secret)
+    manager := middleware.RoleMiddleware(cfg.JWT.Secret, "manager")
     
     r.Handle("/health", middleware.HealthCheck(db, "inventory-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "inventory-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+        Dependencies: map[string]middleware.Pinger{
+            "company-service":      inventoryService.companyClient,
+            "notification-service": alerter.notifyClient,
+        },
+    })).Methods("GET")
     r.Handle("/products", api(inventoryService.getProductsHandler)).Methods("GET")
     r.Handle("/products", api(inventoryService.createProductHandler)).Methods("POST")
     r.Handle("/products/{id}", api(inventoryService.updateProductHandler)).Methods("PUT")
-    r.Handle("/products/{id}", api(inventoryService.deleteProductHandler)).Methods("DELETE")
+    r.Handle("/products/{id}", manager(inventoryService.deleteProductHandler)).Methods("DELETE")
+    r.Handle("/products/{id}/stock", api(inventoryService.getProductStockHandler)).Methods("GET")
+    r.Handle("/products/{id}/valuation", api(inventoryService.getProductValuationHandler)).Methods("GET")
+    r.Handle("/inventory/valuation", api(inventoryService.getInventoryValuationHandler)).Methods("GET")
+    r.Handle("/products/{id}/reorder-suggestion", api(inventoryService.getReorderSuggestionHandler)).Methods("GET")
+    r.Handle("/reorder-suggestions", api(inventoryService.getReorderSuggestionsHandler)).Methods("GET")
+    r.Handle("/warehouses", api(inventoryService.getWarehousesHandler)).Methods("GET")
+    r.Handle("/warehouses", manager(inventoryService.createWarehouseHandler)).Methods("POST")
     r.Handle("/stock-movements", api(inventoryService.getStockMovementsHandler)).Methods("GET")
-    r.Handle("/stock-movements", api(inventoryService.createStockMovementHandler)).Methods("POST")
+    // Retried movements with the same Idempotency-Key, such as goods receipts, return the first response
+    r.Handle("/stock-movements", middleware.Chain(api, middleware.Idempotency(db, idempotencyTTL))(inventoryService.createStockMovementHandler)).Methods("POST")
     r.Handle("/low-stock", api(inventoryService.getLowStockHandler)).Methods("GET")
+    r.Handle("/low-stock/notify", api(inventoryService.notifyLowStockHandler)).Methods("POST")
 
     server.SetupServer(r, cfg)
 }
@@ -83,19 +153,64 @@ func (s *InventoryService) getProductsHandler(w http.ResponseWriter, r *http.Req
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
-    activeOnly := r.URL.Query().Get("active_only") == "true"
+    companyID := s.GetCompanyIDFromRequest(r)
+    params := r.URL.Query()
+    page, pageSize := s.GetPaginationParams(r)
     
-    query := `SELECT id, company_id, product_code, product_name, description, 
-                     unit_price, cost_price, quantity_on_hand, minimum_stock, 
-                     is_active, created_at, updated_at
-              FROM products WHERE company_id = $1`
+    sortColumns := map[string]string{
+        "code":     "product_code",
+        "name":     "product_name",
+        "quantity": "quantity_on_hand",
+    }
+    sortKey := strings.TrimPrefix(params.Get("sort"), "-")
+    if sortKey == "" {
+        sortKey = "code"
+    }
+    sortColumn, ok := sortColumns[sortKey]
+    if !ok {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_SORT", "sort must be one of code, name or quantity")
+        return
+    }
+    sortDirection := "ASC"
+    if strings.HasPrefix(params.Get("sort"), "-") {
+        sortDirection = "DESC"
+    }
     
+    where := " WHERE company_id = $1"
     args := []interface{}{companyID}
-    if activeOnly {
-        query += " AND is_active = true"
+    
+    if params.Get("active_only") == "true" {
+        where += " AND is_active = true"
+    }
+    if search := strings.TrimSpace(params.Get("search")); search != "" {
+        args = append(args, "%"+escapeLike(search)+"%")
+        where += fmt.Sprintf(" AND (product_code ILIKE $%d OR product_name ILIKE $%d)", len(args), len(args))
+    }
+    if minStock := params.Get("min_stock"); minStock != "" {
+        value, err := strconv.Atoi(minStock)
+        if err != nil {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_FILTER", "min_stock must be an integer")
+            return
+        }
+        args = append(args, value)
+        where += fmt.Sprintf(" AND quantity_on_hand >= $%d", len(args))
+    }
+    if params.Get("below_minimum") == "true" {
+        where += " AND quantity_on_hand < minimum_stock"
     }
-    query += " ORDER BY product_code"
+    
+    var total int
+    if err := s.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM products"+where, args...).Scan(&total); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error counting products")
+        return
+    }
+    
+    query := `SELECT id, company_id, product_code, product_name, description, COALESCE(category, ''), 
+                     unit_price, cost_price, ` + averageCostColumn + `, quantity_on_hand, minimum_stock, 
+                     is_active, created_at, updated_at
+              FROM products` + where +
+        fmt.Sprintf(" ORDER BY %s %s, id LIMIT $%d OFFSET $%d", sortColumn, sortDirection, len(args)+1, len(args)+2)
+    args = append(args, pageSize, (page-1)*pageSize)
     
     rows, err := s.DB.QueryContext(ctx, query, args...)
     if err != nil {
@@ -104,12 +219,12 @@ func (s *InventoryService) getProductsHandler(w http.ResponseWriter, r *http.Req
     }
     defer rows.Close()
     
-    var products []Product
+    products := []Product{}
     for rows.Next() {
         var product Product
         err := rows.Scan(&product.ID, &product.CompanyID, &product.ProductCode, 
-                        &product.ProductName, &product.Description, &product.UnitPrice, 
-                        &product.CostPrice, &product.QuantityOnHand, &product.MinimumStock,
+                        &product.ProductName, &product.Description, &product.Category, &product.UnitPrice, 
+                        &product.CostPrice, &product.AverageCost, &product.QuantityOnHand, &product.MinimumStock,
                         &product.IsActive, &product.CreatedAt, &product.UpdatedAt)
         if err != nil {
             continue
@@ -117,7 +232,7 @@ func (s *InventoryService) getProductsHandler(w http.ResponseWriter, r *http.Req
         products = append(products, product)
     }
     
-    s.RespondWithJSON(w, http.StatusOK, products)
+    s.RespondWithPagination(w, http.StatusOK, products, page, pageSize, total)
 }
 
 func (s *InventoryService) createProductHandler(w http.ResponseWriter, r *http.Request) {
@@ -149,7 +264,7 @@ func (s *InventoryService) createProductHandler(w http.ResponseWriter, r *http.R
         return
     }
 
-    product.CompanyID, _ = strconv.Atoi(r.Header.Get("Company-ID"))
+    product.CompanyID = s.GetCompanyIDFromRequest(r)
     product.IsActive = true
 
     // Check for duplicate product code
@@ -166,14 +281,21 @@ func (s *InventoryService) createProductHandler(w http.ResponseWriter, r *http.R
         return
     }
 
-    query := `INSERT INTO products (company_id, product_code, product_name, description, 
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    query := `INSERT INTO products (company_id, product_code, product_name, description, category, 
                                     unit_price, cost_price, quantity_on_hand, minimum_stock, is_active) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+              VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10) 
               RETURNING id, created_at, updated_at`
     
-    err = s.DB.QueryRowContext(ctx, query, 
+    err = tx.QueryRowContext(ctx, query, 
         product.CompanyID, product.ProductCode, product.ProductName,
-        product.Description, product.UnitPrice, product.CostPrice, 
+        product.Description, product.Category, product.UnitPrice, product.CostPrice, 
         product.QuantityOnHand, product.MinimumStock, product.IsActive).Scan(
         &product.ID, &product.CreatedAt, &product.UpdatedAt)
     if err != nil {
@@ -181,6 +303,23 @@ func (s *InventoryService) createProductHandler(w http.ResponseWriter, r *http.R
         return
     }
 
+    // Opening stock is placed in the default warehouse
+    if product.QuantityOnHand > 0 {
+        warehouseID, err := defaultWarehouse(ctx, tx, product.CompanyID)
+        if err == nil {
+            err = adjustWarehouseStock(ctx, tx, product.ID, warehouseID, product.QuantityOnHand)
+        }
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error recording opening stock")
+            return
+        }
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
     s.RespondWithJSON(w, http.StatusCreated, product)
 }
 
@@ -219,15 +358,15 @@ func (s *InventoryService) updateProductHandler(w http.ResponseWriter, r *http.R
         return
     }
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
     query := `UPDATE products 
-              SET product_name = $1, description = $2, unit_price = $3, cost_price = $4, 
-                  minimum_stock = $5, is_active = $6, updated_at = CURRENT_TIMESTAMP 
-              WHERE id = $7 AND company_id = $8 
+              SET product_name = $1, description = $2, category = NULLIF($3, ''), unit_price = $4, cost_price = $5, 
+                  minimum_stock = $6, is_active = $7, updated_at = CURRENT_TIMESTAMP 
+              WHERE id = $8 AND company_id = $9 
               RETURNING updated_at`
     
-    err = s.DB.QueryRowContext(ctx, query, product.ProductName, product.Description,
+    err = s.DB.QueryRowContext(ctx, query, product.ProductName, product.Description, product.Category,
                               product.UnitPrice, product.CostPrice, product.MinimumStock, 
                               product.IsActive, id, companyID).Scan(&product.UpdatedAt)
     if err == sql.ErrNoRows {
@@ -255,7 +394,7 @@ func (s *InventoryService) deleteProductHandler(w http.ResponseWriter, r *http.R
         return
     }
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
     // Soft delete by setting is_active to false
     query := `UPDATE products SET is_active = false, updated_at = CURRENT_TIMESTAMP 
@@ -283,22 +422,35 @@ func (s *InventoryService) getStockMovementsHandler(w http.ResponseWriter, r *ht
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
-    productID := r.URL.Query().Get("product_id")
-    
-    query := `SELECT sm.id, sm.company_id, sm.product_id, sm.movement_type, sm.quantity, 
-                     sm.unit_cost, sm.reference_number, sm.movement_date, sm.notes, 
-                     sm.created_by, sm.created_at
-              FROM stock_movements sm WHERE sm.company_id = $1`
+    companyID := s.GetCompanyIDFromRequest(r)
+    page, pageSize := s.GetPaginationParams(r)
     
+    where := " WHERE sm.company_id = $1"
     args := []interface{}{companyID}
     
-    if productID != "" {
-        query += " AND sm.product_id = $2"
+    if productID := r.URL.Query().Get("product_id"); productID != "" {
         args = append(args, productID)
+        where += fmt.Sprintf(" AND sm.product_id = $%d", len(args))
     }
     
-    query += " ORDER BY sm.movement_date DESC, sm.created_at DESC LIMIT 1000"
+    if warehouseID := r.URL.Query().Get("warehouse_id"); warehouseID != "" {
+        args = append(args, warehouseID)
+        where += fmt.Sprintf(" AND (sm.warehouse_id = $%d OR sm.to_warehouse_id = $%d)", len(args), len(args))
+    }
+    
+    var total int
+    if err := s.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM stock_movements sm"+where, args...).Scan(&total); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error counting stock movements")
+        return
+    }
+    
+    query := `SELECT sm.id, sm.company_id, sm.product_id, COALESCE(sm.warehouse_id, 0), sm.to_warehouse_id,
+                     sm.movement_type, sm.quantity, 
+                     sm.unit_cost, COALESCE(sm.cost_amount, 0), sm.reference_number, sm.movement_date, sm.notes, 
+                     sm.approved_by, sm.created_by, sm.created_at
+              FROM stock_movements sm` + where +
+        fmt.Sprintf(" ORDER BY sm.movement_date DESC, sm.created_at DESC, sm.id DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+    args = append(args, pageSize, (page-1)*pageSize)
     
     rows, err := s.DB.QueryContext(ctx, query, args...)
     if err != nil {
@@ -307,20 +459,20 @@ func (s *InventoryService) getStockMovementsHandler(w http.ResponseWriter, r *ht
     }
     defer rows.Close()
     
-    var movements []StockMovement
+    movements := []StockMovement{}
     for rows.Next() {
         var movement StockMovement
         err := rows.Scan(&movement.ID, &movement.CompanyID, &movement.ProductID,
-                        &movement.MovementType, &movement.Quantity, &movement.UnitCost,
+                        &movement.WarehouseID, &movement.ToWarehouseID, &movement.MovementType, &movement.Quantity, &movement.UnitCost, &movement.CostAmount,
                         &movement.ReferenceNumber, &movement.MovementDate, &movement.Notes,
-                        &movement.CreatedBy, &movement.CreatedAt)
+                        &movement.ApprovedBy, &movement.CreatedBy, &movement.CreatedAt)
         if err != nil {
             continue
         }
         movements = append(movements, movement)
     }
     
-    s.RespondWithJSON(w, http.StatusOK, movements)
+    s.RespondWithPagination(w, http.StatusOK, movements, page, pageSize, total)
 }
 
 func (s *InventoryService) createStockMovementHandler(w http.ResponseWriter, r *http.Request) {
@@ -338,27 +490,61 @@ func (s *InventoryService) createStockMovementHandler(w http.ResponseWriter, r *
         validator.AddError("product_id", "Product ID required")
     }
     validator.Required("movement_type", movement.MovementType)
-    if movement.Quantity == 0 {
-        validator.AddError("quantity", "Quantity cannot be zero")
+    // The movement type gives the direction, so the quantity is always positive
+    if movement.Quantity <= 0 {
+        validator.AddError("quantity", "Quantity must be positive")
+    }
+    if movement.UnitCost < 0 {
+        validator.AddError("unit_cost", "Unit cost cannot be negative")
     }
 
     validTypes := []string{"IN", "OUT", "ADJUSTMENT_IN", "ADJUSTMENT_OUT", "TRANSFER"}
     if !contains(validTypes, movement.MovementType) {
         validator.AddError("movement_type", "Invalid movement type")
     }
+    if movement.MovementType == "TRANSFER" {
+        if movement.WarehouseID == 0 {
+            validator.AddError("warehouse_id", "Source warehouse required for transfers")
+        }
+        if movement.ToWarehouseID == nil {
+            validator.AddError("to_warehouse_id", "Destination warehouse required for transfers")
+        } else if *movement.ToWarehouseID == movement.WarehouseID {
+            validator.AddError("to_warehouse_id", "Destination must differ from source warehouse")
+        }
+    } else if movement.ToWarehouseID != nil {
+        validator.AddError("to_warehouse_id", "Destination warehouse only applies to transfers")
+    }
+    // Stock corrections must be justified for auditors; other movements keep notes optional
+    if movement.MovementType == "ADJUSTMENT_IN" || movement.MovementType == "ADJUSTMENT_OUT" {
+        movement.Notes = strings.TrimSpace(movement.Notes)
+        validator.Required("notes", movement.Notes)
+        validator.MinLength("notes", movement.Notes, minAdjustmentNotes)
+        if movement.ApprovedBy != nil && *movement.ApprovedBy <= 0 {
+            validator.AddError("approved_by", "Approver must be a valid user ID")
+        }
+    } else if movement.ApprovedBy != nil {
+        validator.AddError("approved_by", "Approver only applies to adjustments")
+    }
 
     if !validator.IsValid() {
         s.RespondValidationError(w, validator.Errors())
         return
     }
 
-    movement.CompanyID, _ = strconv.Atoi(r.Header.Get("Company-ID"))
-    movement.CreatedBy, _ = strconv.Atoi(r.Header.Get("User-ID"))
+    movement.CompanyID = s.GetCompanyIDFromRequest(r)
+    movement.CreatedBy = s.GetUserIDFromRequest(r)
 
     if movement.MovementDate.IsZero() {
         movement.MovementDate = time.Now()
     }
 
+    // Resolved before the transaction so company-service is not called while rows are locked
+    outbound := movement.MovementType == "OUT" || movement.MovementType == "ADJUSTMENT_OUT"
+    var method string
+    if outbound {
+        method = s.companyValuationMethod(ctx, r, movement.CompanyID)
+    }
+
     tx, err := s.DB.BeginTx(ctx, nil)
     if err != nil {
         s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
@@ -366,11 +552,13 @@ func (s *InventoryService) createStockMovementHandler(w http.ResponseWriter, r *
     }
     defer tx.Rollback()
 
-    // Verify product exists and belongs to company
+    // Verify product exists and belongs to company. The row lock serializes concurrent movements
+    // of the same product, so the stock checks below see the quantity they will update.
     var currentQty int
+    var currentCost float64
     err = tx.QueryRowContext(ctx, 
-        "SELECT quantity_on_hand FROM products WHERE id = $1 AND company_id = $2 AND is_active = true",
-        movement.ProductID, movement.CompanyID).Scan(&currentQty)
+        "SELECT quantity_on_hand, cost_price FROM products WHERE id = $1 AND company_id = $2 AND is_active = true FOR UPDATE",
+        movement.ProductID, movement.CompanyID).Scan(&currentQty, &currentCost)
     if err == sql.ErrNoRows {
         s.RespondWithError(w, http.StatusBadRequest, "INVALID_PRODUCT", "Product not found or inactive")
         return
@@ -380,11 +568,41 @@ func (s *InventoryService) createStockMovementHandler(w http.ResponseWriter, r *
         return
     }
 
+    // Movements without a warehouse predate multi-warehouse support and go to the default one
+    if movement.WarehouseID == 0 {
+        movement.WarehouseID, err = defaultWarehouse(ctx, tx, movement.CompanyID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error resolving default warehouse")
+            return
+        }
+    }
+    warehouses := []int{movement.WarehouseID}
+    if movement.ToWarehouseID != nil {
+        warehouses = append(warehouses, *movement.ToWarehouseID)
+    }
+    for _, warehouseID := range warehouses {
+        ok, err := activeWarehouse(ctx, tx, movement.CompanyID, warehouseID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error verifying warehouse")
+            return
+        }
+        if !ok {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_WAREHOUSE",
+                fmt.Sprintf("Warehouse %d not found or inactive", warehouseID))
+            return
+        }
+    }
+
     // Check for negative stock on OUT movements
     var qtyChange int
+    newCost := currentCost
     switch movement.MovementType {
     case "IN", "ADJUSTMENT_IN":
         qtyChange = movement.Quantity
+        // Receipts without a cost leave the average untouched rather than diluting it
+        if movement.UnitCost > 0 {
+            newCost = movingAverageCost(currentQty, currentCost, movement.Quantity, movement.UnitCost)
+        }
     case "OUT", "ADJUSTMENT_OUT":
         qtyChange = -movement.Quantity
         if currentQty+qtyChange < 0 {
@@ -392,31 +610,97 @@ func (s *InventoryService) createStockMovementHandler(w http.ResponseWriter, r *
                               "Insufficient stock for this movement")
             return
         }
+    case "TRANSFER":
+        // Moves stock between warehouses; the product total and its cost are unchanged
+        qtyChange = 0
+    default:
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_MOVEMENT_TYPE",
+            fmt.Sprintf("Unhandled movement type %s", movement.MovementType))
+        return
+    }
+
+    var consumedLayers []openLayer
+    if outbound {
+        layers, err := lockOpenLayers(ctx, tx, movement.ProductID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching cost layers")
+            return
+        }
+        movement.CostAmount, consumedLayers = realizeCost(method, currentQty, currentCost, layers, movement.Quantity)
+    }
+
+    // Apply the movement to per-warehouse stock; a transfer is an out and an in
+    stockChanges := map[int]int{movement.WarehouseID: qtyChange}
+    if movement.MovementType == "TRANSFER" {
+        stockChanges = map[int]int{movement.WarehouseID: -movement.Quantity, *movement.ToWarehouseID: movement.Quantity}
+    }
+    for _, warehouseID := range warehouses {
+        err = adjustWarehouseStock(ctx, tx, movement.ProductID, warehouseID, stockChanges[warehouseID])
+        if err == errInsufficientStock {
+            s.RespondWithError(w, http.StatusBadRequest, "INSUFFICIENT_STOCK",
+                fmt.Sprintf("Insufficient stock in warehouse %d for this movement", warehouseID))
+            return
+        }
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error updating warehouse stock")
+            return
+        }
     }
 
     // Create stock movement record
-    query := `INSERT INTO stock_movements (company_id, product_id, movement_type, quantity, 
-                                          unit_cost, reference_number, movement_date, notes, created_by) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+    query := `INSERT INTO stock_movements (company_id, product_id, warehouse_id, to_warehouse_id, movement_type, quantity, 
+                                          unit_cost, cost_amount, reference_number, movement_date, notes, approved_by, created_by) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) 
               RETURNING id, created_at`
     
     err = tx.QueryRowContext(ctx, query, 
-        movement.CompanyID, movement.ProductID, movement.MovementType,
-        movement.Quantity, movement.UnitCost, movement.ReferenceNumber, 
-        movement.MovementDate, movement.Notes, movement.CreatedBy).Scan(&movement.ID, &movement.CreatedAt)
+        movement.CompanyID, movement.ProductID, movement.WarehouseID, movement.ToWarehouseID, movement.MovementType,
+        movement.Quantity, movement.UnitCost, movement.CostAmount, movement.ReferenceNumber, 
+        movement.MovementDate, movement.Notes, movement.ApprovedBy, movement.CreatedBy).Scan(&movement.ID, &movement.CreatedAt)
     if err != nil {
         s.HandleDBError(w, err, "Error creating stock movement")
         return
     }
 
-    // Update product quantity
-    _, err = tx.ExecContext(ctx, 
-        "UPDATE products SET quantity_on_hand = quantity_on_hand + $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", 
-        qtyChange, movement.ProductID)
+    // Receipts open a cost layer; a receipt without a cost is layered at the current average
+    if qtyChange > 0 {
+        layerCost := movement.UnitCost
+        if layerCost <= 0 {
+            layerCost = currentCost
+        }
+        _, err = tx.ExecContext(ctx, `INSERT INTO stock_cost_layers (company_id, product_id, movement_id, 
+                                                                     original_quantity, remaining_quantity, unit_cost, received_date)
+                                      VALUES ($1, $2, $3, $4, $4, $5, $6)`,
+            movement.CompanyID, movement.ProductID, movement.ID, movement.Quantity, math.Round(layerCost), movement.MovementDate)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error recording cost layer")
+            return
+        }
+    }
+    for _, layer := range consumedLayers {
+        _, err = tx.ExecContext(ctx, "UPDATE stock_cost_layers SET remaining_quantity = $1 WHERE id = $2",
+            layer.Remaining, layer.ID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error consuming cost layers")
+            return
+        }
+    }
+
+    // Update product quantity and weighted-average cost. The guard keeps stock from going
+    // negative even if a writer ever updates the row without taking the lock above.
+    result, err := tx.ExecContext(ctx, 
+        `UPDATE products SET quantity_on_hand = quantity_on_hand + $1, cost_price = $2, updated_at = CURRENT_TIMESTAMP 
+         WHERE id = $3 AND quantity_on_hand + $1 >= 0`, 
+        qtyChange, newCost, movement.ProductID)
     if err != nil {
         s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error updating stock")
         return
     }
+    if updated, _ := result.RowsAffected(); updated == 0 {
+        s.RespondWithError(w, http.StatusConflict, "INSUFFICIENT_STOCK", 
+                          "Insufficient stock for this movement")
+        return
+    }
 
     if err = tx.Commit(); err != nil {
         s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
@@ -426,14 +710,210 @@ func (s *InventoryService) createStockMovementHandler(w http.ResponseWriter, r *
     s.RespondWithJSON(w, http.StatusCreated, movement)
 }
 
+func (s *InventoryService) getProductValuationHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid product ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    method := r.URL.Query().Get("method")
+    if method == "" {
+        method = s.companyValuationMethod(ctx, r, companyID)
+    }
+    if method != ValuationFIFO && method != ValuationAverage {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_METHOD", "Valuation method must be fifo or average")
+        return
+    }
+
+    var quantityOnHand int
+    var costPrice float64
+    err = s.DB.QueryRowContext(ctx,
+        "SELECT quantity_on_hand, COALESCE(cost_price, 0) FROM products WHERE id = $1 AND company_id = $2",
+        id, companyID).Scan(&quantityOnHand, &costPrice)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Product not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching product")
+        return
+    }
+
+    rows, err := s.DB.QueryContext(ctx, `SELECT id, movement_type, quantity, COALESCE(unit_cost, 0), movement_date
+                                         FROM stock_movements WHERE product_id = $1 AND company_id = $2
+                                         ORDER BY movement_date, id`, id, companyID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching stock movements")
+        return
+    }
+    defer rows.Close()
+
+    var movements []StockMovement
+    netQuantity := 0
+    for rows.Next() {
+        var movement StockMovement
+        if err := rows.Scan(&movement.ID, &movement.MovementType, &movement.Quantity,
+            &movement.UnitCost, &movement.MovementDate); err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error reading stock movements")
+            return
+        }
+        switch movement.MovementType {
+        case "IN", "ADJUSTMENT_IN":
+            netQuantity += movement.Quantity
+        case "OUT", "ADJUSTMENT_OUT":
+            netQuantity -= movement.Quantity
+        }
+        movements = append(movements, movement)
+    }
+
+    // Stock on hand that predates the movement history is valued at the product's cost price
+    valuation := valueMovements(method, quantityOnHand-netQuantity, costPrice, movements)
+    valuation.ProductID = id
+
+    s.RespondWithJSON(w, http.StatusOK, valuation)
+}
+
+func (s *InventoryService) getReorderSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid product ID")
+        return
+    }
+
+    assumptions, err := reorderAssumptions(r, s.reorderDefaults)
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_PARAMETER", err.Error())
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    suggestions, err := s.reorderSuggestions(ctx, companyID, id, assumptions)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error calculating reorder suggestion")
+        return
+    }
+    if len(suggestions) == 0 {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Product not found")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, suggestions[0])
+}
+
+// getReorderSuggestionsHandler lists active products that need ordering, or every active
+// product when include_all=true.
+func (s *InventoryService) getReorderSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+
+    assumptions, err := reorderAssumptions(r, s.reorderDefaults)
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_PARAMETER", err.Error())
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    suggestions, err := s.reorderSuggestions(ctx, companyID, 0, assumptions)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error calculating reorder suggestions")
+        return
+    }
+
+    if r.URL.Query().Get("include_all") != "true" {
+        needed := suggestions[:0]
+        for _, suggestion := range suggestions {
+            if suggestion.SuggestedQuantity > 0 {
+                needed = append(needed, suggestion)
+            }
+        }
+        suggestions = needed
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, suggestions)
+}
+
+// reorderSuggestions totals OUT movements per product over the trailing window and sizes an
+// order for each. A productID of 0 covers every active product in the company.
+func (s *InventoryService) reorderSuggestions(ctx context.Context, companyID, productID int, assumptions ReorderAssumptions) ([]*ReorderSuggestion, error) {
+    now := time.Now()
+    since := now.AddDate(0, 0, -assumptions.WindowDays+1).Format("2006-01-02")
+
+    query := `SELECT p.id, p.product_code, p.product_name, p.quantity_on_hand, p.minimum_stock, p.created_at,
+                     COALESCE(SUM(m.quantity), 0)
+              FROM products p
+              LEFT JOIN stock_movements m ON m.product_id = p.id AND m.company_id = p.company_id
+                   AND m.movement_type = 'OUT' AND m.movement_date >= $2
+              WHERE p.company_id = $1`
+    args := []interface{}{companyID, since}
+    if productID != 0 {
+        query += " AND p.id = $3"
+        args = append(args, productID)
+    } else {
+        query += " AND p.is_active = true"
+    }
+    query += " GROUP BY p.id ORDER BY p.product_code"
+
+    rows, err := s.DB.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    suggestions := []*ReorderSuggestion{}
+    for rows.Next() {
+        var product Product
+        var consumed int
+        if err := rows.Scan(&product.ID, &product.ProductCode, &product.ProductName, &product.QuantityOnHand,
+            &product.MinimumStock, &product.CreatedAt, &consumed); err != nil {
+            return nil, err
+        }
+
+        productAssumptions := assumptions
+        productAssumptions.ObservedDays = observedDays(assumptions.WindowDays, product.CreatedAt, now)
+        suggestions = append(suggestions, suggestReorder(product, consumed, productAssumptions))
+    }
+    return suggestions, rows.Err()
+}
+
+// companyValuationMethod reads the company's inventory_valuation_method setting,
+// falling back to weighted average when it is unset or company-service is unavailable.
+func (s *InventoryService) companyValuationMethod(ctx context.Context, r *http.Request, companyID int) string {
+    var settings []struct {
+        SettingKey   string `json:"setting_key"`
+        SettingValue string `json:"setting_value"`
+    }
+
+    path := fmt.Sprintf("/companies/%d/settings", companyID)
+    if err := s.companyClient.Do(ctx, http.MethodGet, path, client.ForwardHeaders(r), nil, &settings); err != nil {
+        log.Printf("Falling back to average cost valuation for company %d: %v", companyID, err)
+        return ValuationAverage
+    }
+
+    for _, setting := range settings {
+        if setting.SettingKey == "inventory_valuation_method" && setting.SettingValue != "" {
+            return setting.SettingValue
+        }
+    }
+    return ValuationAverage
+}
+
 func (s *InventoryService) getLowStockHandler(w http.ResponseWriter, r *http.Request) {
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
-    query := `SELECT id, company_id, product_code, product_name, description, 
-                     unit_price, cost_price, quantity_on_hand, minimum_stock, 
+    query := `SELECT id, company_id, product_code, product_name, description, COALESCE(category, ''), 
+                     unit_price, cost_price, ` + averageCostColumn + `, quantity_on_hand, minimum_stock, 
                      is_active, created_at, updated_at
               FROM products 
               WHERE company_id = $1 AND is_active = true AND quantity_on_hand <= minimum_stock
@@ -450,8 +930,8 @@ func (s *InventoryService) getLowStockHandler(w http.ResponseWriter, r *http.Req
     for rows.Next() {
         var product Product
         err := rows.Scan(&product.ID, &product.CompanyID, &product.ProductCode, 
-                        &product.ProductName, &product.Description, &product.UnitPrice, 
-                        &product.CostPrice, &product.QuantityOnHand, &product.MinimumStock,
+                        &product.ProductName, &product.Description, &product.Category, &product.UnitPrice, 
+                        &product.CostPrice, &product.AverageCost, &product.QuantityOnHand, &product.MinimumStock,
                         &product.IsActive, &product.CreatedAt, &product.UpdatedAt)
         if err != nil {
             continue
@@ -462,6 +942,36 @@ func (s *InventoryService) getLowStockHandler(w http.ResponseWriter, r *http.Req
     s.RespondWithJSON(w, http.StatusOK, products)
 }
 
+func (s *InventoryService) notifyLowStockHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+    
+    if !s.alerter.Enabled() {
+        s.RespondWithError(w, http.StatusServiceUnavailable, "ALERTS_DISABLED", "Low stock alert recipient is not configured")
+        return
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    if companyID == 0 {
+        s.RespondWithError(w, http.StatusBadRequest, "MISSING_COMPANY", "Company ID required")
+        return
+    }
+    
+    count, err := s.alerter.Notify(ctx, companyID)
+    if err != nil {
+        log.Printf("Manual low stock alert failed for company %d: %v", companyID, err)
+        s.RespondWithError(w, http.StatusBadGateway, "NOTIFICATION_ERROR", "Error sending low stock alert")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, map[string]int{"alerted_products": count})
+}
+
+// escapeLike escapes LIKE wildcards so user search text is matched literally
+func escapeLike(value string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
 func contains(slice []string, item string) bool {
     for _, s := range slice {
         if s == item {
@@ -469,4 +979,20 @@ func contains(slice []string, item string) bool {
         }
     }
     return false
+}
+
+// envDays reads a whole number of days from the environment, exiting on invalid values
+func envDays(key, defaultValue string) int {
+    days, err := strconv.Atoi(getEnv(key, defaultValue))
+    if err != nil || days < 0 {
+        log.Fatalf("Invalid %s: must be a whole number of days", key)
+    }
+    return days
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
 }
\ No newline at end of file
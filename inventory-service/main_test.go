@@ -0,0 +1,279 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/massehanto/accounting-system-go/shared/client"
+    "github.com/massehanto/accounting-system-go/shared/database/dbtest"
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+// stockDB keeps one product's stock in memory and answers the statements a stock movement
+// issues. Like Postgres it holds row locks taken by FOR UPDATE, and by UPDATE, until the
+// transaction ends, and keeps a transaction's writes to itself until it commits.
+type stockDB struct {
+    mu       sync.Mutex
+    released *sync.Cond
+    locks    map[string]*stockTx
+    onHand   int
+    cost     float64
+    stock    map[int]int
+    nextID   int64
+}
+
+type stockTx struct {
+    db     *stockDB
+    onHand *int
+    cost   float64
+    stock  map[int]int
+    held   []string
+}
+
+func newStockDB(onHand int, cost float64) *stockDB {
+    db := &stockDB{locks: map[string]*stockTx{}, onHand: onHand, cost: cost, stock: map[int]int{1: onHand}}
+    db.released = sync.NewCond(&db.mu)
+    return db
+}
+
+func (db *stockDB) open() *sql.DB {
+    return dbtest.Open(&dbtest.Driver{Query: db.query, Exec: db.exec})
+}
+
+// begin returns the stock state of the transaction a statement runs in
+func (db *stockDB) begin(tx *dbtest.Tx) (*stockTx, error) {
+    if tx == nil {
+        return nil, errors.New("stock movements run in a transaction")
+    }
+    if tx.State == nil {
+        stx := &stockTx{db: db, stock: map[int]int{}}
+        tx.State = stx
+        tx.OnEnd(stx.end)
+    }
+    return tx.State.(*stockTx), nil
+}
+
+// lock blocks until tx holds the row lock for key
+func (tx *stockTx) lock(key string) {
+    db := tx.db
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    for db.locks[key] != nil && db.locks[key] != tx {
+        db.released.Wait()
+    }
+    if db.locks[key] == nil {
+        db.locks[key] = tx
+        tx.held = append(tx.held, key)
+    }
+}
+
+func (tx *stockTx) quantityOnHand() int {
+    if tx.onHand != nil {
+        return *tx.onHand
+    }
+    tx.db.mu.Lock()
+    defer tx.db.mu.Unlock()
+    return tx.db.onHand
+}
+
+func (tx *stockTx) warehouseStock(warehouseID int) int {
+    if quantity, ok := tx.stock[warehouseID]; ok {
+        return quantity
+    }
+    tx.db.mu.Lock()
+    defer tx.db.mu.Unlock()
+    return tx.db.stock[warehouseID]
+}
+
+func (tx *stockTx) end(commit bool) {
+    db := tx.db
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    if commit {
+        if tx.onHand != nil {
+            db.onHand, db.cost = *tx.onHand, tx.cost
+        }
+        for warehouseID, quantity := range tx.stock {
+            db.stock[warehouseID] = quantity
+        }
+    }
+    for _, key := range tx.held {
+        delete(db.locks, key)
+    }
+    db.released.Broadcast()
+}
+
+func (db *stockDB) query(dtx *dbtest.Tx, query string, args []driver.Value) (driver.Rows, error) {
+    tx, err := db.begin(dtx)
+    if err != nil {
+        return nil, err
+    }
+    switch {
+    case strings.Contains(query, "FROM products") && strings.Contains(query, "FOR UPDATE"):
+        tx.lock("product")
+        db.mu.Lock()
+        cost := db.cost
+        db.mu.Unlock()
+        return dbtest.Rows([]string{"quantity_on_hand", "cost_price"}, []driver.Value{int64(tx.quantityOnHand()), cost}), nil
+    case strings.Contains(query, "FROM warehouses WHERE company_id = $1 AND is_default"):
+        return dbtest.Rows([]string{"id"}, []driver.Value{int64(1)}), nil
+    case strings.Contains(query, "SELECT EXISTS(SELECT 1 FROM warehouses"):
+        return dbtest.Rows([]string{"exists"}, []driver.Value{true}), nil
+    case strings.Contains(query, "FROM product_stock") && strings.Contains(query, "FOR UPDATE"):
+        warehouseID := int(args[1].(int64))
+        tx.lock(fmt.Sprintf("product_stock:%d", warehouseID))
+        return dbtest.Rows([]string{"quantity"}, []driver.Value{int64(tx.warehouseStock(warehouseID))}), nil
+    case strings.Contains(query, "FROM stock_cost_layers"):
+        return dbtest.Rows([]string{"id", "remaining_quantity", "unit_cost"}), nil
+    case strings.Contains(query, "INSERT INTO stock_movements"):
+        db.mu.Lock()
+        db.nextID++
+        id := db.nextID
+        db.mu.Unlock()
+        return dbtest.Rows([]string{"id", "created_at"}, []driver.Value{id, time.Now()}), nil
+    }
+    return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+func (db *stockDB) exec(dtx *dbtest.Tx, query string, args []driver.Value) (driver.Result, error) {
+    tx, err := db.begin(dtx)
+    if err != nil {
+        return nil, err
+    }
+    switch {
+    case strings.Contains(query, "INSERT INTO product_stock"):
+        warehouseID := int(args[1].(int64))
+        tx.stock[warehouseID] = tx.warehouseStock(warehouseID) + int(args[2].(int64))
+        return driver.RowsAffected(1), nil
+    case strings.Contains(query, "INSERT INTO stock_cost_layers"), strings.Contains(query, "UPDATE stock_cost_layers"):
+        return driver.RowsAffected(1), nil
+    case strings.Contains(query, "UPDATE products SET quantity_on_hand"):
+        tx.lock("product")
+        onHand := tx.quantityOnHand() + int(args[0].(int64))
+        if onHand < 0 {
+            return driver.RowsAffected(0), nil
+        }
+        tx.onHand, tx.cost = &onHand, args[1].(float64)
+        return driver.RowsAffected(1), nil
+    }
+    return nil, fmt.Errorf("unexpected statement: %s", query)
+}
+
+// Ten simultaneous movements each taking one unit out of five in stock: exactly five may
+// succeed, and stock must end at zero rather than below it
+func TestConcurrentOutMovementsCannotOversell(t *testing.T) {
+    company := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        io.WriteString(w, `{"success":true,"data":[]}`)
+    }))
+    defer company.Close()
+
+    stock := newStockDB(5, 1000)
+    db := stock.open()
+    defer db.Close()
+    s := &InventoryService{BaseService: &service.BaseService{DB: db}, companyClient: client.New(company.URL)}
+
+    const movements = 10
+    statuses := make([]int, movements)
+    var start, done sync.WaitGroup
+    start.Add(1)
+    for i := 0; i < movements; i++ {
+        done.Add(1)
+        go func(i int) {
+            defer done.Done()
+            req := httptest.NewRequest("POST", "/stock-movements",
+                strings.NewReader(`{"product_id":1,"movement_type":"OUT","quantity":1}`))
+            ctx := context.WithValue(req.Context(), "company_id", 1)
+            ctx = context.WithValue(ctx, "user_id", 1)
+            rec := httptest.NewRecorder()
+            start.Wait()
+            s.createStockMovementHandler(rec, req.WithContext(ctx))
+            statuses[i] = rec.Code
+        }(i)
+    }
+    start.Done()
+    done.Wait()
+
+    created, refused := 0, 0
+    for _, status := range statuses {
+        switch status {
+        case http.StatusCreated:
+            created++
+        case http.StatusBadRequest, http.StatusConflict:
+            refused++
+        default:
+            t.Errorf("unexpected status %d", status)
+        }
+    }
+    if created != 5 || refused != 5 {
+        t.Errorf("created %d and refused %d movements, want 5 and 5", created, refused)
+    }
+
+    stock.mu.Lock()
+    defer stock.mu.Unlock()
+    if stock.onHand != 0 || stock.stock[1] != 0 {
+        t.Errorf("stock after movements: on hand %d, warehouse %d; want 0 and 0", stock.onHand, stock.stock[1])
+    }
+}
+
+func TestCreateStockMovementRejectsNegativeUnitCost(t *testing.T) {
+    s := &InventoryService{BaseService: &service.BaseService{}}
+    req := httptest.NewRequest("POST", "/stock-movements",
+        strings.NewReader(`{"product_id":1,"movement_type":"IN","quantity":5,"unit_cost":-100}`))
+    rec := httptest.NewRecorder()
+    s.createStockMovementHandler(rec, req)
+
+    if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unit_cost") {
+        t.Errorf("status = %d, body = %s; want a 400 naming unit_cost", rec.Code, rec.Body.String())
+    }
+}
+
+func TestCreateStockMovementRejectsNonPositiveQuantity(t *testing.T) {
+    s := &InventoryService{BaseService: &service.BaseService{}}
+    for _, body := range []string{
+        `{"product_id":1,"movement_type":"IN","quantity":0,"unit_cost":100}`,
+        `{"product_id":1,"movement_type":"OUT","quantity":-5}`,
+        `{"product_id":1,"movement_type":"TRANSFER","quantity":-5,"warehouse_id":1,"to_warehouse_id":2}`,
+    } {
+        req := httptest.NewRequest("POST", "/stock-movements", strings.NewReader(body))
+        rec := httptest.NewRecorder()
+        s.createStockMovementHandler(rec, req)
+
+        if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "quantity") {
+            t.Errorf("%s: status = %d, body = %s; want a 400 naming quantity", body, rec.Code, rec.Body.String())
+        }
+    }
+}
+
+// A receipt at a different cost blends into cost_price in the same transaction as the stock
+func TestCreateStockMovementUpdatesAverageCost(t *testing.T) {
+    stock := newStockDB(10, 1000)
+    db := stock.open()
+    defer db.Close()
+    s := &InventoryService{BaseService: &service.BaseService{DB: db}}
+
+    req := httptest.NewRequest("POST", "/stock-movements",
+        strings.NewReader(`{"product_id":1,"movement_type":"IN","quantity":30,"unit_cost":1400}`))
+    ctx := context.WithValue(req.Context(), "company_id", 1)
+    rec := httptest.NewRecorder()
+    s.createStockMovementHandler(rec, req.WithContext(ctx))
+    if rec.Code != http.StatusCreated {
+        t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+    }
+
+    stock.mu.Lock()
+    defer stock.mu.Unlock()
+    if stock.onHand != 40 || stock.cost != 1300 {
+        t.Errorf("after receipt: %d on hand at %v, want 40 at 1300", stock.onHand, stock.cost)
+    }
+}
@@ -0,0 +1,52 @@
+-- inventory-service/migrations/0001_initial_schema.sql
+-- Baseline schema, as database/init-db.sql creates it. Later schema changes are the numbered
+-- migrations that follow; each is also safe to run on a database that already has it.
+
+CREATE TABLE IF NOT EXISTS products (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    product_code VARCHAR(50) NOT NULL,
+    product_name VARCHAR(255) NOT NULL,
+    description TEXT,
+    unit_price DECIMAL(15,0) NOT NULL CHECK (unit_price >= 0),
+    cost_price DECIMAL(15,0) NOT NULL CHECK (cost_price >= 0),
+    quantity_on_hand INTEGER DEFAULT 0 CHECK (quantity_on_hand >= 0),
+    minimum_stock INTEGER DEFAULT 0 CHECK (minimum_stock >= 0),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, product_code),
+    CONSTRAINT check_idr_product_amounts CHECK (
+        unit_price = ROUND(unit_price) AND cost_price = ROUND(cost_price)
+    )
+);
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    product_id INTEGER REFERENCES products(id),
+    movement_type VARCHAR(20) NOT NULL CHECK (movement_type IN ('IN', 'OUT', 'ADJUSTMENT_IN', 'ADJUSTMENT_OUT', 'TRANSFER')),
+    quantity INTEGER NOT NULL,
+    unit_cost DECIMAL(15,0),
+    reference_number VARCHAR(100),
+    movement_date DATE NOT NULL,
+    notes TEXT,
+    created_by INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_idr_unit_cost CHECK (unit_cost IS NULL OR unit_cost = ROUND(unit_cost))
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_company_active ON products(company_id, is_active) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_products_low_stock ON products(company_id) WHERE quantity_on_hand <= minimum_stock AND is_active = true;
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product_date ON stock_movements(product_id, movement_date);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_company_date ON stock_movements(company_id, movement_date);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER update_products_updated_at BEFORE UPDATE ON products FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,3 @@
+-- inventory-service/migrations/0002_low_stock_alerts.sql
+-- When a product's low-stock alert was last sent, so alerts are throttled
+ALTER TABLE products ADD COLUMN IF NOT EXISTS low_stock_alerted_at TIMESTAMP;
@@ -0,0 +1,20 @@
+-- inventory-service/migrations/0003_stock_cost_layers.sql
+-- Realized cost of outbound movements. Stock on hand from before this change has no layer and
+-- is costed at the product's cost_price when it goes out.
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS cost_amount DECIMAL(15,0);
+
+-- Each receipt opens a cost layer that outbound movements draw down oldest first
+CREATE TABLE IF NOT EXISTS stock_cost_layers (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    movement_id INTEGER REFERENCES stock_movements(id),
+    original_quantity INTEGER NOT NULL CHECK (original_quantity > 0),
+    remaining_quantity INTEGER NOT NULL CHECK (remaining_quantity >= 0),
+    unit_cost DECIMAL(15,0) NOT NULL CHECK (unit_cost >= 0 AND unit_cost = ROUND(unit_cost)),
+    received_date DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_layer_remaining CHECK (remaining_quantity <= original_quantity)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_cost_layers_open ON stock_cost_layers(product_id, received_date) WHERE remaining_quantity > 0;
@@ -0,0 +1,45 @@
+-- inventory-service/migrations/0004_warehouses.sql
+-- Warehouses with per-warehouse stock. Stock already on hand is placed in each company's
+-- default warehouse.
+CREATE TABLE IF NOT EXISTS warehouses (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    code VARCHAR(20) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    address TEXT,
+    is_default BOOLEAN DEFAULT FALSE,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, code)
+);
+
+-- Per-warehouse stock; products.quantity_on_hand remains the total across warehouses
+CREATE TABLE IF NOT EXISTS product_stock (
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    warehouse_id INTEGER NOT NULL REFERENCES warehouses(id),
+    quantity INTEGER NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, warehouse_id)
+);
+
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS warehouse_id INTEGER REFERENCES warehouses(id);
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS to_warehouse_id INTEGER REFERENCES warehouses(id); -- Destination of TRANSFER movements
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_warehouses_company_default ON warehouses(company_id) WHERE is_default = true;
+CREATE INDEX IF NOT EXISTS idx_product_stock_warehouse ON product_stock(warehouse_id);
+
+CREATE OR REPLACE TRIGGER update_warehouses_updated_at BEFORE UPDATE ON warehouses FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO warehouses (company_id, code, name, is_default, is_active)
+SELECT DISTINCT p.company_id, 'MAIN', 'Main Warehouse', true, true
+FROM products p
+WHERE NOT EXISTS (SELECT 1 FROM warehouses w WHERE w.company_id = p.company_id AND w.is_default = true)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO product_stock (product_id, warehouse_id, quantity)
+SELECT p.id, w.id, p.quantity_on_hand
+FROM products p JOIN warehouses w ON w.company_id = p.company_id AND w.is_default = true
+WHERE p.quantity_on_hand > 0
+  AND NOT EXISTS (SELECT 1 FROM product_stock ps WHERE ps.product_id = p.id)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+-- inventory-service/migrations/0005_product_category.sql
+-- Category used to group the inventory valuation report
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category VARCHAR(100);
@@ -0,0 +1,33 @@
+-- inventory-service/migrations/0006_stock_adjustment_approval.sql
+-- Stock adjustments need a justification, may name an approver and are audited. The notes
+-- check is NOT VALID so adjustments recorded before it are kept as they are.
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS approved_by INTEGER; -- User who approved an adjustment, if any
+
+ALTER TABLE stock_movements DROP CONSTRAINT IF EXISTS check_adjustment_notes;
+ALTER TABLE stock_movements ADD CONSTRAINT check_adjustment_notes CHECK (
+    movement_type NOT IN ('ADJUSTMENT_IN', 'ADJUSTMENT_OUT') OR LENGTH(TRIM(notes)) >= 10
+) NOT VALID;
+
+-- Stock adjustments are recorded here for auditors
+CREATE TABLE IF NOT EXISTS audit_log (
+    id SERIAL PRIMARY KEY,
+    table_name VARCHAR(50) NOT NULL,
+    record_id INTEGER,
+    operation VARCHAR(10) NOT NULL CHECK (operation IN ('INSERT', 'UPDATE', 'DELETE')),
+    user_id INTEGER,
+    old_values JSONB,
+    new_values JSONB,
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE OR REPLACE FUNCTION audit_stock_adjustment()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO audit_log (table_name, record_id, operation, user_id, new_values)
+    VALUES (TG_TABLE_NAME, NEW.id, TG_OP, NEW.created_by, row_to_json(NEW));
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER audit_stock_adjustments AFTER INSERT ON stock_movements FOR EACH ROW
+    WHEN (NEW.movement_type IN ('ADJUSTMENT_IN', 'ADJUSTMENT_OUT')) EXECUTE FUNCTION audit_stock_adjustment();
@@ -0,0 +1,19 @@
+-- inventory-service/migrations/0007_idempotency_keys.sql
+-- Stored responses for Idempotency-Key retries of stock movements, see
+-- shared/middleware/idempotency.go. vendor-service keys goods receipt movements this way.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    endpoint VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    response_status INTEGER,
+    response_body BYTEA,
+    content_type VARCHAR(100),
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, endpoint, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at);
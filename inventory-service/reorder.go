@@ -0,0 +1,134 @@
+// inventory-service/reorder.go
+package main
+
+import (
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+const (
+    ReorderBasisConsumption  = "consumption"
+    ReorderBasisMinimumStock = "minimum_stock"
+)
+
+// ReorderAssumptions are the planning inputs behind a suggestion. ObservedDays is the part of
+// the window the product actually existed for, so new products are not diluted by empty days.
+type ReorderAssumptions struct {
+    WindowDays   int `json:"window_days"`
+    ObservedDays int `json:"observed_days"`
+    LeadTimeDays int `json:"lead_time_days"`
+    SafetyDays   int `json:"safety_days"`
+}
+
+type ReorderSuggestion struct {
+    ProductID         int                `json:"product_id"`
+    ProductCode       string             `json:"product_code"`
+    ProductName       string             `json:"product_name"`
+    QuantityOnHand    int                `json:"quantity_on_hand"`
+    MinimumStock      int                `json:"minimum_stock"`
+    ConsumedQuantity  int                `json:"consumed_quantity"`
+    DailyVelocity     float64            `json:"daily_velocity"`
+    DaysOfCover       *float64           `json:"days_of_cover,omitempty"`
+    LeadTimeDemand    int                `json:"lead_time_demand"`
+    SafetyStock       int                `json:"safety_stock"`
+    TargetStock       int                `json:"target_stock"`
+    SuggestedQuantity int                `json:"suggested_quantity"`
+    Basis             string             `json:"basis"`
+    Note              string             `json:"note,omitempty"`
+    Assumptions       ReorderAssumptions `json:"assumptions"`
+}
+
+// suggestReorder sizes an order that brings stock up to lead-time demand plus safety stock.
+// Velocity is OUT quantity per observed day; without any consumption the product's minimum
+// stock is used as the target instead. The target never drops below minimum stock.
+func suggestReorder(product Product, consumed int, assumptions ReorderAssumptions) *ReorderSuggestion {
+    suggestion := &ReorderSuggestion{
+        ProductID:        product.ID,
+        ProductCode:      product.ProductCode,
+        ProductName:      product.ProductName,
+        QuantityOnHand:   product.QuantityOnHand,
+        MinimumStock:     product.MinimumStock,
+        ConsumedQuantity: consumed,
+        Basis:            ReorderBasisConsumption,
+        Assumptions:      assumptions,
+    }
+
+    var velocity float64
+    if consumed > 0 && assumptions.ObservedDays > 0 {
+        velocity = float64(consumed) / float64(assumptions.ObservedDays)
+    }
+
+    if velocity > 0 {
+        suggestion.LeadTimeDemand = int(math.Ceil(velocity * float64(assumptions.LeadTimeDays)))
+        suggestion.SafetyStock = int(math.Ceil(velocity * float64(assumptions.SafetyDays)))
+        suggestion.TargetStock = suggestion.LeadTimeDemand + suggestion.SafetyStock
+
+        cover := math.Round(float64(product.QuantityOnHand)/velocity*10) / 10
+        if cover < 0 {
+            cover = 0
+        }
+        suggestion.DaysOfCover = &cover
+    } else {
+        suggestion.Basis = ReorderBasisMinimumStock
+        suggestion.Note = fmt.Sprintf("No consumption in the last %d days; target is the minimum stock level",
+            assumptions.ObservedDays)
+    }
+
+    if suggestion.TargetStock < product.MinimumStock {
+        if velocity > 0 {
+            suggestion.Note = "Projected demand is below minimum stock; target raised to the minimum stock level"
+        }
+        suggestion.TargetStock = product.MinimumStock
+    }
+
+    suggestion.DailyVelocity = math.Round(velocity*100) / 100
+    if shortfall := suggestion.TargetStock - product.QuantityOnHand; shortfall > 0 {
+        suggestion.SuggestedQuantity = shortfall
+    }
+    return suggestion
+}
+
+// observedDays limits the window to the days since the product was created, with a floor of one
+func observedDays(windowDays int, createdAt, now time.Time) int {
+    days := int(now.Sub(createdAt).Hours()/24) + 1
+    if createdAt.IsZero() || days > windowDays {
+        return windowDays
+    }
+    if days < 1 {
+        return 1
+    }
+    return days
+}
+
+// reorderAssumptions applies window_days, lead_time_days and safety_days query overrides
+// on top of the service defaults.
+func reorderAssumptions(r *http.Request, defaults ReorderAssumptions) (ReorderAssumptions, error) {
+    assumptions := defaults
+    params := []struct {
+        name  string
+        min   int
+        value *int
+    }{
+        {"window_days", 1, &assumptions.WindowDays},
+        {"lead_time_days", 0, &assumptions.LeadTimeDays},
+        {"safety_days", 0, &assumptions.SafetyDays},
+    }
+
+    for _, param := range params {
+        raw := r.URL.Query().Get(param.name)
+        if raw == "" {
+            continue
+        }
+        value, err := strconv.Atoi(raw)
+        if err != nil || value < param.min || value > 365 {
+            return assumptions, fmt.Errorf("%s must be a whole number between %d and 365", param.name, param.min)
+        }
+        *param.value = value
+    }
+
+    assumptions.ObservedDays = assumptions.WindowDays
+    return assumptions, nil
+}
\ No newline at end of file
@@ -0,0 +1,127 @@
+// inventory-service/valuation.go
+package main
+
+import (
+    "math"
+)
+
+const (
+    ValuationFIFO    = "fifo"
+    ValuationAverage = "average"
+)
+
+// CostLayer is a quantity of stock still on hand at the unit cost it was received at
+type CostLayer struct {
+    Quantity int     `json:"quantity"`
+    UnitCost float64 `json:"unit_cost"`
+}
+
+type ProductValuation struct {
+    ProductID       int         `json:"product_id"`
+    Method          string      `json:"method"`
+    QuantityOnHand  int         `json:"quantity_on_hand"`
+    UnitCost        float64     `json:"unit_cost"`
+    TotalValue      float64     `json:"total_value"`
+    CostOfGoodsSold float64     `json:"cost_of_goods_sold"`
+    Layers          []CostLayer `json:"layers,omitempty"`
+}
+
+// valueMovements replays a product's stock movements, oldest first, and returns the value of
+// what remains on hand. openingQty and openingCost describe stock that existed before the
+// movement history began. Inbound movements without a unit cost are valued at the current
+// cost basis, and TRANSFER movements do not change quantity so they are ignored.
+func valueMovements(method string, openingQty int, openingCost float64, movements []StockMovement) *ProductValuation {
+    valuation := &ProductValuation{Method: method}
+
+    var layers []CostLayer
+    var quantity int
+    var value float64
+
+    if openingQty > 0 {
+        layers = append(layers, CostLayer{Quantity: openingQty, UnitCost: openingCost})
+        quantity = openingQty
+        value = float64(openingQty) * openingCost
+    }
+
+    for _, movement := range movements {
+        switch movement.MovementType {
+        case "IN", "ADJUSTMENT_IN":
+            unitCost := movement.UnitCost
+            if unitCost <= 0 && quantity > 0 {
+                unitCost = value / float64(quantity)
+            }
+            layers = append(layers, CostLayer{Quantity: movement.Quantity, UnitCost: unitCost})
+            quantity += movement.Quantity
+            value += float64(movement.Quantity) * unitCost
+
+        case "OUT", "ADJUSTMENT_OUT":
+            var cost float64
+            if method == ValuationFIFO {
+                cost, layers = consumeLayers(layers, movement.Quantity)
+            } else if quantity > 0 {
+                take := movement.Quantity
+                if take > quantity {
+                    take = quantity
+                }
+                cost = value / float64(quantity) * float64(take)
+            }
+            quantity -= movement.Quantity
+            if quantity < 0 {
+                quantity = 0
+            }
+            value -= cost
+            if quantity == 0 {
+                value = 0
+            }
+            if movement.MovementType == "OUT" {
+                valuation.CostOfGoodsSold += cost
+            }
+        }
+    }
+
+    valuation.QuantityOnHand = quantity
+    if method == ValuationFIFO {
+        value = 0
+        for _, layer := range layers {
+            value += float64(layer.Quantity) * layer.UnitCost
+        }
+        valuation.Layers = layers
+    }
+
+    // Rupiah has no minor unit, so totals are reported in whole Rupiah
+    valuation.TotalValue = math.Round(value)
+    valuation.CostOfGoodsSold = math.Round(valuation.CostOfGoodsSold)
+    if quantity > 0 {
+        valuation.UnitCost = math.Round(value/float64(quantity)*100) / 100
+    }
+    return valuation
+}
+
+// movingAverageCost blends a receipt into the current average unit cost, rounded to whole
+// Rupiah. Starting from zero (or inconsistent negative) stock the receipt cost is taken as is.
+func movingAverageCost(oldQty int, oldCost float64, inQty int, inCost float64) float64 {
+    if oldQty <= 0 || oldQty+inQty <= 0 {
+        return math.Round(inCost)
+    }
+    total := float64(oldQty)*oldCost + float64(inQty)*inCost
+    return math.Round(total / float64(oldQty+inQty))
+}
+
+// consumeLayers removes quantity from the oldest layers first and returns the cost taken
+// along with the layers that remain.
+func consumeLayers(layers []CostLayer, quantity int) (float64, []CostLayer) {
+    var cost float64
+    for quantity > 0 && len(layers) > 0 {
+        take := layers[0].Quantity
+        if take > quantity {
+            take = quantity
+        }
+        cost += float64(take) * layers[0].UnitCost
+        layers[0].Quantity -= take
+        quantity -= take
+        if layers[0].Quantity == 0 {
+            layers = layers[1:]
+        }
+    }
+    return cost, layers
+}
\ No newline at end of file
@@ -0,0 +1,155 @@
+// inventory-service/valuation_report.go
+package main
+
+import (
+    "context"
+    "net/http"
+    "time"
+)
+
+const uncategorized = "Uncategorized"
+
+type ValuationLine struct {
+    ProductID   int     `json:"product_id"`
+    ProductCode string  `json:"product_code"`
+    ProductName string  `json:"product_name"`
+    Quantity    int     `json:"quantity"`
+    UnitCost    float64 `json:"unit_cost"`
+    TotalValue  float64 `json:"total_value"`
+}
+
+type CategoryValuation struct {
+    Category   string          `json:"category"`
+    Products   []ValuationLine `json:"products"`
+    TotalValue float64         `json:"total_value"`
+}
+
+type InventoryValuation struct {
+    AsOf       string              `json:"as_of"`
+    Method     string              `json:"method"`
+    Categories []CategoryValuation `json:"categories"`
+    TotalValue float64             `json:"total_value"`
+}
+
+// getInventoryValuationHandler values all stock on hand, subtotaled by category. With as_of the
+// quantities are reconstructed by replaying stock movements up to and including that date.
+func (s *InventoryService) getInventoryValuationHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    asOf := time.Now()
+    if value := r.URL.Query().Get("as_of"); value != "" {
+        parsed, err := time.Parse("2006-01-02", value)
+        if err != nil {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_DATE", "as_of must be a date in YYYY-MM-DD format")
+            return
+        }
+        asOf = parsed
+    }
+    asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+
+    method := r.URL.Query().Get("method")
+    if method == "" {
+        method = s.companyValuationMethod(ctx, r, companyID)
+    }
+    if method != ValuationFIFO && method != ValuationAverage {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_METHOD", "Valuation method must be fifo or average")
+        return
+    }
+
+    movements, err := s.companyMovements(ctx, companyID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching stock movements")
+        return
+    }
+
+    rows, err := s.DB.QueryContext(ctx, `SELECT id, product_code, product_name, COALESCE(category, ''),
+                                                quantity_on_hand, COALESCE(cost_price, 0)
+                                         FROM products WHERE company_id = $1
+                                         ORDER BY COALESCE(category, ''), product_code`, companyID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching products")
+        return
+    }
+    defer rows.Close()
+
+    report := InventoryValuation{
+        AsOf:       asOf.Format("2006-01-02"),
+        Method:     method,
+        Categories: []CategoryValuation{},
+    }
+
+    for rows.Next() {
+        var line ValuationLine
+        var category string
+        var quantityOnHand int
+        var costPrice float64
+        if err := rows.Scan(&line.ProductID, &line.ProductCode, &line.ProductName, &category,
+            &quantityOnHand, &costPrice); err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error reading products")
+            return
+        }
+
+        history := movements[line.ProductID]
+        netQuantity := 0
+        cutoff := len(history)
+        for i, movement := range history {
+            switch movement.MovementType {
+            case "IN", "ADJUSTMENT_IN":
+                netQuantity += movement.Quantity
+            case "OUT", "ADJUSTMENT_OUT":
+                netQuantity -= movement.Quantity
+            }
+            if cutoff == len(history) && movement.MovementDate.After(asOf) {
+                cutoff = i
+            }
+        }
+
+        // Stock that predates the movement history is valued at the product's cost price
+        valuation := valueMovements(method, quantityOnHand-netQuantity, costPrice, history[:cutoff])
+        if valuation.QuantityOnHand == 0 {
+            continue
+        }
+        line.Quantity = valuation.QuantityOnHand
+        line.UnitCost = valuation.UnitCost
+        line.TotalValue = valuation.TotalValue
+
+        if category == "" {
+            category = uncategorized
+        }
+        last := len(report.Categories) - 1
+        if last < 0 || report.Categories[last].Category != category {
+            report.Categories = append(report.Categories, CategoryValuation{Category: category})
+            last++
+        }
+        report.Categories[last].Products = append(report.Categories[last].Products, line)
+        report.Categories[last].TotalValue += line.TotalValue
+        report.TotalValue += line.TotalValue
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// companyMovements loads every stock movement of a company grouped by product, oldest first
+func (s *InventoryService) companyMovements(ctx context.Context, companyID int) (map[int][]StockMovement, error) {
+    rows, err := s.DB.QueryContext(ctx, `SELECT id, product_id, movement_type, quantity, COALESCE(unit_cost, 0), movement_date
+                                         FROM stock_movements WHERE company_id = $1
+                                         ORDER BY product_id, movement_date, id`, companyID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    movements := make(map[int][]StockMovement)
+    for rows.Next() {
+        var movement StockMovement
+        if err := rows.Scan(&movement.ID, &movement.ProductID, &movement.MovementType, &movement.Quantity,
+            &movement.UnitCost, &movement.MovementDate); err != nil {
+            return nil, err
+        }
+        movements[movement.ProductID] = append(movements[movement.ProductID], movement)
+    }
+    return movements, rows.Err()
+}
\ No newline at end of file
@@ -0,0 +1,126 @@
+package main
+
+import "testing"
+
+// knownMovements receives 10 units at 1.000 and 10 at 1.300, sells 15, then receives 5 at 1.600
+func knownMovements() []StockMovement {
+    return []StockMovement{
+        {MovementType: "IN", Quantity: 10, UnitCost: 1000},
+        {MovementType: "IN", Quantity: 10, UnitCost: 1300},
+        {MovementType: "OUT", Quantity: 15},
+        {MovementType: "IN", Quantity: 5, UnitCost: 1600},
+    }
+}
+
+func TestValueMovementsFIFO(t *testing.T) {
+    valuation := valueMovements(ValuationFIFO, 0, 0, knownMovements())
+
+    // The sale takes all of the first receipt and 5 of the second
+    if valuation.CostOfGoodsSold != 16500 {
+        t.Errorf("cost of goods sold = %v, want 16500", valuation.CostOfGoodsSold)
+    }
+    if valuation.QuantityOnHand != 10 || valuation.TotalValue != 14500 || valuation.UnitCost != 1450 {
+        t.Errorf("on hand = %d valued %v at %v, want 10 valued 14500 at 1450",
+            valuation.QuantityOnHand, valuation.TotalValue, valuation.UnitCost)
+    }
+    want := []CostLayer{{Quantity: 5, UnitCost: 1300}, {Quantity: 5, UnitCost: 1600}}
+    if len(valuation.Layers) != len(want) {
+        t.Fatalf("layers = %+v, want %+v", valuation.Layers, want)
+    }
+    for i := range want {
+        if valuation.Layers[i] != want[i] {
+            t.Errorf("layer %d = %+v, want %+v", i, valuation.Layers[i], want[i])
+        }
+    }
+}
+
+func TestValueMovementsAverage(t *testing.T) {
+    valuation := valueMovements(ValuationAverage, 0, 0, knownMovements())
+
+    // The sale is costed at the 1.150 average of the first two receipts
+    if valuation.CostOfGoodsSold != 17250 {
+        t.Errorf("cost of goods sold = %v, want 17250", valuation.CostOfGoodsSold)
+    }
+    if valuation.QuantityOnHand != 10 || valuation.TotalValue != 13750 || valuation.UnitCost != 1375 {
+        t.Errorf("on hand = %d valued %v at %v, want 10 valued 13750 at 1375",
+            valuation.QuantityOnHand, valuation.TotalValue, valuation.UnitCost)
+    }
+    if valuation.Layers != nil {
+        t.Errorf("average valuation reported layers %+v", valuation.Layers)
+    }
+}
+
+func TestValueMovementsOpeningStockIsOldest(t *testing.T) {
+    movements := []StockMovement{
+        {MovementType: "IN", Quantity: 4, UnitCost: 1200},
+        {MovementType: "OUT", Quantity: 3},
+        // A receipt without a cost comes in at the current cost basis
+        {MovementType: "ADJUSTMENT_IN", Quantity: 2},
+    }
+    valuation := valueMovements(ValuationFIFO, 2, 900, movements)
+
+    // 2 opening units at 900 go first, then one from the receipt
+    if valuation.CostOfGoodsSold != 3000 {
+        t.Errorf("cost of goods sold = %v, want 3000", valuation.CostOfGoodsSold)
+    }
+    // 3 left at 1.200 value 3.600; the uncosted receipt is valued at that 1.200 basis
+    if valuation.QuantityOnHand != 5 || valuation.TotalValue != 6000 {
+        t.Errorf("on hand = %d valued %v, want 5 valued 6000", valuation.QuantityOnHand, valuation.TotalValue)
+    }
+}
+
+func TestRealizeCostConsumesLayersOldestFirst(t *testing.T) {
+    layers := func() []openLayer {
+        return []openLayer{{ID: 1, Remaining: 10, UnitCost: 1000}, {ID: 2, Remaining: 10, UnitCost: 1300}}
+    }
+
+    cost, changed := realizeCost(ValuationFIFO, 20, 0, layers(), 15)
+    if cost != 16500 {
+        t.Errorf("fifo cost = %v, want 16500", cost)
+    }
+    if len(changed) != 2 || changed[0].Remaining != 0 || changed[1].Remaining != 5 {
+        t.Errorf("fifo changed layers = %+v, want layer 1 emptied and 5 left in layer 2", changed)
+    }
+
+    // Average costs the sale at the blend but still draws layers down oldest first
+    cost, changed = realizeCost(ValuationAverage, 20, 0, layers(), 15)
+    if cost != 17250 {
+        t.Errorf("average cost = %v, want 17250", cost)
+    }
+    if len(changed) != 2 || changed[0].Remaining != 0 || changed[1].Remaining != 5 {
+        t.Errorf("average changed layers = %+v, want layer 1 emptied and 5 left in layer 2", changed)
+    }
+
+    // Stock on hand beyond the layers predates them and is consumed first at the opening cost
+    cost, changed = realizeCost(ValuationFIFO, 25, 800, layers(), 7)
+    if cost != 5*800+2*1000 || len(changed) != 1 || changed[0].Remaining != 8 {
+        t.Errorf("with opening stock: cost %v, changed %+v; want 6000 and layer 1 at 8", cost, changed)
+    }
+}
+
+func TestMovingAverageCostAfterReceiptsAtDifferentPrices(t *testing.T) {
+    // 10 at 1.000, then 30 at 1.400: (10*1000 + 30*1400) / 40 = 1.300
+    cost := movingAverageCost(10, 1000, 30, 1400)
+    if cost != 1300 {
+        t.Errorf("after second receipt = %v, want 1300", cost)
+    }
+    // Then 20 at 1.000: (40*1300 + 20*1000) / 60 = 1.200
+    if cost = movingAverageCost(40, cost, 20, 1000); cost != 1200 {
+        t.Errorf("after third receipt = %v, want 1200", cost)
+    }
+    // Blends that are not whole Rupiah are rounded: (3*1000 + 1*1001) / 4 = 1.000,25
+    if cost = movingAverageCost(3, 1000, 1, 1001); cost != 1000 {
+        t.Errorf("fractional blend = %v, want 1000", cost)
+    }
+}
+
+func TestMovingAverageCostIntoZeroStock(t *testing.T) {
+    // Nothing on hand: the old cost no longer describes any stock, so the receipt sets it
+    if cost := movingAverageCost(0, 1000, 5, 1500); cost != 1500 {
+        t.Errorf("from zero stock = %v, want 1500", cost)
+    }
+    // Inconsistent negative stock does not divide by zero or skew the result either
+    if cost := movingAverageCost(-5, 1000, 5, 1500); cost != 1500 {
+        t.Errorf("from negative stock = %v, want 1500", cost)
+    }
+}
@@ -0,0 +1,245 @@
+// inventory-service/warehouses.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gorilla/mux"
+
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+var errInsufficientStock = errors.New("insufficient stock")
+
+type Warehouse struct {
+    ID        int       `json:"id"`
+    CompanyID int       `json:"company_id"`
+    Code      string    `json:"code"`
+    Name      string    `json:"name"`
+    Address   string    `json:"address"`
+    IsDefault bool      `json:"is_default"`
+    IsActive  bool      `json:"is_active"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WarehouseStock is a product's quantity at one warehouse
+type WarehouseStock struct {
+    WarehouseID   int    `json:"warehouse_id"`
+    WarehouseCode string `json:"warehouse_code"`
+    WarehouseName string `json:"warehouse_name"`
+    Quantity      int    `json:"quantity"`
+}
+
+func (s *InventoryService) getWarehousesHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    query := `SELECT id, company_id, code, name, COALESCE(address, ''), is_default, is_active, created_at, updated_at
+              FROM warehouses WHERE company_id = $1`
+    if r.URL.Query().Get("active_only") == "true" {
+        query += " AND is_active = true"
+    }
+    query += " ORDER BY is_default DESC, code"
+
+    rows, err := s.DB.QueryContext(ctx, query, companyID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching warehouses")
+        return
+    }
+    defer rows.Close()
+
+    warehouses := []Warehouse{}
+    for rows.Next() {
+        var warehouse Warehouse
+        if err := rows.Scan(&warehouse.ID, &warehouse.CompanyID, &warehouse.Code, &warehouse.Name,
+            &warehouse.Address, &warehouse.IsDefault, &warehouse.IsActive, &warehouse.CreatedAt,
+            &warehouse.UpdatedAt); err != nil {
+            continue
+        }
+        warehouses = append(warehouses, warehouse)
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, warehouses)
+}
+
+// createWarehouseHandler adds a warehouse. A company's first warehouse becomes its default, and
+// marking a new warehouse as default moves the flag from the previous one.
+func (s *InventoryService) createWarehouseHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+
+    var warehouse Warehouse
+    if err := json.NewDecoder(r.Body).Decode(&warehouse); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    validator.Required("code", warehouse.Code)
+    validator.MaxLength("code", warehouse.Code, 20)
+    validator.Required("name", warehouse.Name)
+    validator.MaxLength("name", warehouse.Name, 255)
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    warehouse.CompanyID = s.GetCompanyIDFromRequest(r)
+    warehouse.IsActive = true
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    var exists, hasDefault bool
+    err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM warehouses WHERE company_id = $1 AND code = $2),
+                                          EXISTS(SELECT 1 FROM warehouses WHERE company_id = $1 AND is_default = true)`,
+        warehouse.CompanyID, warehouse.Code).Scan(&exists, &hasDefault)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error checking duplicate")
+        return
+    }
+    if exists {
+        s.RespondWithError(w, http.StatusConflict, "DUPLICATE_CODE", "Warehouse code already exists")
+        return
+    }
+
+    if !hasDefault {
+        warehouse.IsDefault = true
+    } else if warehouse.IsDefault {
+        _, err = tx.ExecContext(ctx,
+            "UPDATE warehouses SET is_default = false, updated_at = CURRENT_TIMESTAMP WHERE company_id = $1 AND is_default = true",
+            warehouse.CompanyID)
+        if err != nil {
+            s.HandleDBError(w, err, "Error updating default warehouse")
+            return
+        }
+    }
+
+    err = tx.QueryRowContext(ctx, `INSERT INTO warehouses (company_id, code, name, address, is_default, is_active)
+                                   VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at`,
+        warehouse.CompanyID, warehouse.Code, warehouse.Name, warehouse.Address, warehouse.IsDefault,
+        warehouse.IsActive).Scan(&warehouse.ID, &warehouse.CreatedAt, &warehouse.UpdatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error creating warehouse")
+        return
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusCreated, warehouse)
+}
+
+func (s *InventoryService) getProductStockHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid product ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    var quantityOnHand int
+    err = s.DB.QueryRowContext(ctx, "SELECT quantity_on_hand FROM products WHERE id = $1 AND company_id = $2",
+        id, companyID).Scan(&quantityOnHand)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Product not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching product")
+        return
+    }
+
+    rows, err := s.DB.QueryContext(ctx, `SELECT w.id, w.code, w.name, ps.quantity
+                                         FROM product_stock ps JOIN warehouses w ON w.id = ps.warehouse_id
+                                         WHERE ps.product_id = $1 AND w.company_id = $2
+                                         ORDER BY w.is_default DESC, w.code`, id, companyID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching stock levels")
+        return
+    }
+    defer rows.Close()
+
+    stock := []WarehouseStock{}
+    for rows.Next() {
+        var level WarehouseStock
+        if err := rows.Scan(&level.WarehouseID, &level.WarehouseCode, &level.WarehouseName, &level.Quantity); err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error reading stock levels")
+            return
+        }
+        stock = append(stock, level)
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+        "product_id":       id,
+        "quantity_on_hand": quantityOnHand,
+        "warehouses":       stock,
+    })
+}
+
+// defaultWarehouse returns the company's default warehouse, creating one for companies that
+// predate warehouse support so existing callers that send no warehouse keep working.
+func defaultWarehouse(ctx context.Context, tx *sql.Tx, companyID int) (int, error) {
+    var id int
+    err := tx.QueryRowContext(ctx,
+        "SELECT id FROM warehouses WHERE company_id = $1 AND is_default = true", companyID).Scan(&id)
+    if err != sql.ErrNoRows {
+        return id, err
+    }
+
+    err = tx.QueryRowContext(ctx, `INSERT INTO warehouses (company_id, code, name, is_default, is_active)
+                                   VALUES ($1, 'MAIN', 'Main Warehouse', true, true) RETURNING id`,
+        companyID).Scan(&id)
+    return id, err
+}
+
+// activeWarehouse reports whether warehouseID is an active warehouse of the company
+func activeWarehouse(ctx context.Context, tx *sql.Tx, companyID, warehouseID int) (bool, error) {
+    var exists bool
+    err := tx.QueryRowContext(ctx,
+        "SELECT EXISTS(SELECT 1 FROM warehouses WHERE id = $1 AND company_id = $2 AND is_active = true)",
+        warehouseID, companyID).Scan(&exists)
+    return exists, err
+}
+
+// adjustWarehouseStock changes a product's quantity at one warehouse, refusing to go negative
+func adjustWarehouseStock(ctx context.Context, tx *sql.Tx, productID, warehouseID, change int) error {
+    var current int
+    err := tx.QueryRowContext(ctx,
+        "SELECT quantity FROM product_stock WHERE product_id = $1 AND warehouse_id = $2 FOR UPDATE",
+        productID, warehouseID).Scan(&current)
+    if err != nil && err != sql.ErrNoRows {
+        return err
+    }
+    if current+change < 0 {
+        return errInsufficientStock
+    }
+
+    _, err = tx.ExecContext(ctx, `INSERT INTO product_stock (product_id, warehouse_id, quantity)
+                                  VALUES ($1, $2, $3)
+                                  ON CONFLICT (product_id, warehouse_id)
+                                  DO UPDATE SET quantity = product_stock.quantity + EXCLUDED.quantity,
+                                                updated_at = CURRENT_TIMESTAMP`,
+        productID, warehouseID, change)
+    return err
+}
\ No newline at end of file
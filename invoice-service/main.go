@@ -4,15 +4,24 @@ import (
     "context"
     "database/sql"
     "encoding/json"
+    "errors"
     "fmt"
+    "log"
+    "math"
     "net/http"
+    "os"
+    "regexp"
     "strconv"
+    "strings"
+    "sync"
     "time"
     
     "github.com/gorilla/mux"
     _ "github.com/lib/pq"
     
+    "github.com/massehanto/accounting-system-go/shared/client"
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/database"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
@@ -22,22 +31,75 @@ import (
 
 type InvoiceService struct {
     *service.BaseService
+    numberFormat   string
+    defaultTaxRate float64
+    taxRates       *rateCache
+    taxClient      *client.Client
+    companyClient  *client.Client
+    notifyClient   *client.Client
 }
 
 type Invoice struct {
-    ID            int           `json:"id"`
-    CompanyID     int           `json:"company_id"`
-    CustomerID    int           `json:"customer_id"`
-    InvoiceNumber string        `json:"invoice_number"`
-    InvoiceDate   time.Time     `json:"invoice_date"`
-    DueDate       time.Time     `json:"due_date"`
-    Subtotal      float64       `json:"subtotal"`
-    TaxAmount     float64       `json:"tax_amount"`
-    TotalAmount   float64       `json:"total_amount"`
-    Status        string        `json:"status"`
-    CreatedAt     time.Time     `json:"created_at"`
-    Customer      *Customer     `json:"customer,omitempty"`
-    Lines         []InvoiceLine `json:"lines,omitempty"`
+    ID               int              `json:"id"`
+    CompanyID        int              `json:"company_id"`
+    CustomerID       int              `json:"customer_id"`
+    InvoiceNumber    string           `json:"invoice_number"`
+    // TaxInvoiceNumber is the faktur pajak serial, assigned to invoices that carry PPN
+    TaxInvoiceNumber string           `json:"tax_invoice_number,omitempty"`
+    InvoiceDate      service.JakartaTime `json:"invoice_date"`
+    DueDate          service.JakartaTime `json:"due_date"`
+    Subtotal         service.Rupiah   `json:"subtotal"`
+    TaxRateID        *int             `json:"tax_rate_id,omitempty"`
+    TaxRate          float64          `json:"tax_rate"`
+    TaxExempt        bool             `json:"tax_exempt"`
+    TaxAmount        service.Rupiah   `json:"tax_amount"`
+    TotalAmount      service.Rupiah   `json:"total_amount"`
+    AmountPaid       service.Rupiah   `json:"amount_paid"`
+    BalanceDue       service.Rupiah   `json:"balance_due"`
+    Status           string           `json:"status"`
+    SentAt           *time.Time       `json:"sent_at,omitempty"`
+    // EmailID tracks the email queued by the last send at notification-service's /notifications/{id}
+    EmailID          string           `json:"email_id,omitempty"`
+    CreatedAt        time.Time        `json:"created_at"`
+    Customer         *Customer        `json:"customer,omitempty"`
+    Lines            []InvoiceLine    `json:"lines,omitempty"`
+    Payments         []InvoicePayment `json:"payments,omitempty"`
+}
+
+// rateCache keeps resolved tax rates for a short time so invoice creation does not
+// call tax-service or company-service on every request.
+type rateCache struct {
+    mu    sync.Mutex
+    ttl   time.Duration
+    rates map[string]cachedRate
+}
+
+type cachedRate struct {
+    rate    float64
+    expires time.Time
+}
+
+func newRateCache(ttl time.Duration) *rateCache {
+    return &rateCache{ttl: ttl, rates: make(map[string]cachedRate)}
+}
+
+func (c *rateCache) get(key string) (float64, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    
+    cached, ok := c.rates[key]
+    if !ok || time.Now().After(cached.expires) {
+        delete(c.rates, key)
+        return 0, false
+    }
+    return cached.rate, true
+}
+
+func (c *rateCache) set(key string, rate float64) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    
+    c.rates[key] = cachedRate{rate: rate, expires: time.Now().Add(c.ttl)}
 }
 
 type Customer struct {
@@ -49,37 +111,97 @@ type Customer struct {
     Phone        string `json:"phone"`
     Address      string `json:"address"`
     TaxID        string `json:"tax_id"`
+    PaymentTerms int    `json:"payment_terms"`
+    IsActive     bool   `json:"is_active"`
 }
 
 type InvoiceLine struct {
-    ID          int     `json:"id"`
-    InvoiceID   int     `json:"invoice_id"`
-    ProductName string  `json:"product_name"`
-    Quantity    float64 `json:"quantity"`
-    UnitPrice   float64 `json:"unit_price"`
-    LineTotal   float64 `json:"line_total"`
+    ID             int      `json:"id"`
+    InvoiceID      int      `json:"invoice_id"`
+    ProductName    string   `json:"product_name"`
+    Quantity       float64  `json:"quantity"`
+    UnitPrice      service.Rupiah `json:"unit_price"`
+    DiscountAmount service.Rupiah `json:"discount_amount"`
+    LineTotal      service.Rupiah `json:"line_total"`
+    Taxable        *bool          `json:"taxable"`
+    TaxRate        *float64       `json:"tax_rate"`
+    TaxAmount      service.Rupiah `json:"tax_amount"`
+}
+
+type InvoicePayment struct {
+    ID            int       `json:"id"`
+    InvoiceID     int       `json:"invoice_id"`
+    Amount        service.Rupiah      `json:"amount"`
+    PaymentDate   service.JakartaTime `json:"payment_date"`
+    PaymentMethod string    `json:"payment_method"`
+    Reference     string    `json:"reference"`
+    Notes         string    `json:"notes"`
+    CreatedBy     int       `json:"created_by"`
+    CreatedAt     time.Time `json:"created_at"`
 }
 
 func main() {
+    logger.Init("invoice-service")
+    
     cfg := config.Load()
     cfg.Database.Name = "invoice_db"
     
     db := database.InitDatabase(cfg.Database)
     defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
+    
+    defaultTaxRate, err := strconv.ParseFloat(getEnv("TAX_RATE_PPN", "11.00"), 64)
+    if err != nil {
+        log.Fatalf("Invalid TAX_RATE_PPN: %v", err)
+    }
+    
+    rateTTL, err := time.ParseDuration(getEnv("TAX_RATE_CACHE_TTL", "5m"))
+    if err != nil {
+        log.Fatalf("Invalid TAX_RATE_CACHE_TTL: %v", err)
+    }
+    
+    idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_KEY_TTL", "24h"))
+    if err != nil || idempotencyTTL <= 0 {
+        log.Fatalf("Invalid IDEMPOTENCY_KEY_TTL: %q", os.Getenv("IDEMPOTENCY_KEY_TTL"))
+    }
     
     invoiceService := &InvoiceService{
-        BaseService: &service.BaseService{DB: db},
+        BaseService:    &service.BaseService{DB: db},
+        numberFormat:   getEnv("INVOICE_NUMBER_FORMAT", "INV/{YYYY}/{SEQ:6}"),
+        defaultTaxRate: defaultTaxRate,
+        taxRates:       newRateCache(rateTTL),
+        taxClient:      client.New(getEnv("TAX_SERVICE_URL", "http://localhost:8008")),
+        companyClient:  client.New(getEnv("COMPANY_SERVICE_URL", "http://localhost:8011")),
+        notifyClient:   client.New(getEnv("NOTIFICATION_SERVICE_URL", "http://localhost:8010")),
     }
     
     r := mux.NewRouter()
     api := middleware.APIMiddleware(cfg.JWT.Secret)
+    accountant := middleware.RoleMiddleware(cfg.JWT.Secret, "accountant")
+    manager := middleware.RoleMiddleware(cfg.JWT.Secret, "manager")
+    // Retried creates with the same Idempotency-Key return the first response
+    idempotent := middleware.Chain(accountant, middleware.Idempotency(db, idempotencyTTL))
     
     r.Handle("/health", middleware.HealthCheck(db, "invoice-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "invoice-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+        Dependencies: map[string]middleware.Pinger{
+            "tax-service":          invoiceService.taxClient,
+            "company-service":      invoiceService.companyClient,
+            "notification-service": invoiceService.notifyClient,
+        },
+    })).Methods("GET")
     r.Handle("/invoices", api(invoiceService.getInvoicesHandler)).Methods("GET")
-    r.Handle("/invoices", api(invoiceService.createInvoiceHandler)).Methods("POST")
-    r.Handle("/invoices/{id}/send", api(invoiceService.sendInvoiceHandler)).Methods("POST")
+    r.Handle("/invoices", idempotent(invoiceService.createInvoiceHandler)).Methods("POST")
+    r.Handle("/invoices/{id}", api(invoiceService.getInvoiceHandler)).Methods("GET")
+    r.Handle("/invoices/{id}/payments", idempotent(invoiceService.recordPaymentHandler)).Methods("POST")
+    r.Handle("/invoices/{id}/send", accountant(invoiceService.sendInvoiceHandler)).Methods("POST")
     r.Handle("/customers", api(invoiceService.getCustomersHandler)).Methods("GET")
-    r.Handle("/customers", api(invoiceService.createCustomerHandler)).Methods("POST")
+    r.Handle("/customers", accountant(invoiceService.createCustomerHandler)).Methods("POST")
+    r.Handle("/customers/{id}", accountant(invoiceService.updateCustomerHandler)).Methods("PUT")
+    r.Handle("/customers/{id}", manager(invoiceService.deleteCustomerHandler)).Methods("DELETE")
 
     server.SetupServer(r, cfg)
 }
@@ -88,10 +210,11 @@ func (s *InvoiceService) getInvoicesHandler(w http.ResponseWriter, r *http.Reque
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
     query := `SELECT i.id, i.company_id, i.customer_id, i.invoice_number, i.invoice_date, i.due_date, 
-                     i.subtotal, i.tax_amount, i.total_amount, i.status, i.created_at, c.name
+                     i.subtotal, i.tax_rate, i.tax_exempt, i.tax_amount, i.total_amount, i.amount_paid, 
+                     i.status, i.created_at, c.name
               FROM invoices i LEFT JOIN customers c ON i.customer_id = c.id 
               WHERE i.company_id = $1 ORDER BY i.created_at DESC`
     
@@ -107,28 +230,35 @@ func (s *InvoiceService) getInvoicesHandler(w http.ResponseWriter, r *http.Reque
         var invoice Invoice
         var customerName sql.NullString
         err := rows.Scan(&invoice.ID, &invoice.CompanyID, &invoice.CustomerID, &invoice.InvoiceNumber,
-                        &invoice.InvoiceDate, &invoice.DueDate, &invoice.Subtotal, &invoice.TaxAmount,
-                        &invoice.TotalAmount, &invoice.Status, &invoice.CreatedAt, &customerName)
+                        &invoice.InvoiceDate, &invoice.DueDate, &invoice.Subtotal, &invoice.TaxRate,
+                        &invoice.TaxExempt, &invoice.TaxAmount, &invoice.TotalAmount, &invoice.AmountPaid,
+                        &invoice.Status, &invoice.CreatedAt, &customerName)
         if err != nil {
             continue
         }
+        invoice.BalanceDue = invoice.TotalAmount - invoice.AmountPaid
         if customerName.Valid {
             invoice.Customer = &Customer{Name: customerName.String}
         }
         invoices = append(invoices, invoice)
     }
     
-    s.RespondWithJSON(w, http.StatusOK, invoices)
+    s.RespondFormatted(w, r, http.StatusOK, invoices)
 }
 
 func (s *InvoiceService) getCustomersHandler(w http.ResponseWriter, r *http.Request) {
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
+    activeOnly := r.URL.Query().Get("active_only") == "true"
     
-    query := `SELECT id, company_id, customer_code, name, email, phone, address, tax_id
-              FROM customers WHERE company_id = $1 ORDER BY name`
+    query := `SELECT id, company_id, customer_code, name, email, phone, address, tax_id, payment_terms, is_active
+              FROM customers WHERE company_id = $1`
+    if activeOnly {
+        query += " AND is_active = true"
+    }
+    query += " ORDER BY name"
     
     rows, err := s.DB.QueryContext(ctx, query, companyID)
     if err != nil {
@@ -141,7 +271,8 @@ func (s *InvoiceService) getCustomersHandler(w http.ResponseWriter, r *http.Requ
     for rows.Next() {
         var customer Customer
         err := rows.Scan(&customer.ID, &customer.CompanyID, &customer.CustomerCode, &customer.Name,
-                        &customer.Email, &customer.Phone, &customer.Address, &customer.TaxID)
+                        &customer.Email, &customer.Phone, &customer.Address, &customer.TaxID,
+                        &customer.PaymentTerms, &customer.IsActive)
         if err != nil {
             continue
         }
@@ -156,13 +287,13 @@ func (s *InvoiceService) createInvoiceHandler(w http.ResponseWriter, r *http.Req
     defer cancel()
     
     var invoice Invoice
-    if err := json.NewDecoder(r.Body).Decode(&invoice); err != nil {
-        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+    if err := service.DecodeJSONBody(w, r, &invoice, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
         return
     }
 
     validator := validation.New()
-    validator.Required("invoice_number", invoice.InvoiceNumber)
+    validator.MaxLength("invoice_number", invoice.InvoiceNumber, 50)
     
     if invoice.CustomerID == 0 {
         validator.AddError("customer_id", "Customer ID is required")
@@ -172,7 +303,7 @@ func (s *InvoiceService) createInvoiceHandler(w http.ResponseWriter, r *http.Req
         validator.AddError("lines", "At least one invoice line is required")
     }
 
-    var subtotal float64
+    var subtotal service.Rupiah
     for i, line := range invoice.Lines {
         validator.Required(fmt.Sprintf("lines[%d].product_name", i), line.ProductName)
         if line.Quantity <= 0 {
@@ -182,7 +313,36 @@ func (s *InvoiceService) createInvoiceHandler(w http.ResponseWriter, r *http.Req
             validator.AddError(fmt.Sprintf("lines[%d].unit_price", i), "Unit price cannot be negative")
         }
         
-        expectedTotal := line.Quantity * line.UnitPrice
+        gross := service.Rupiah(line.Quantity * float64(line.UnitPrice))
+        if line.DiscountAmount < 0 {
+            validator.AddError(fmt.Sprintf("lines[%d].discount_amount", i), "Discount cannot be negative")
+        } else if line.DiscountAmount > gross {
+            validator.AddError(fmt.Sprintf("lines[%d].discount_amount", i), "Discount cannot exceed the line amount")
+        }
+        if line.TaxRate != nil && (*line.TaxRate < 0 || *line.TaxRate > 100) {
+            validator.AddError(fmt.Sprintf("lines[%d].tax_rate", i), "Tax rate must be between 0 and 100")
+        }
+        if line.TaxAmount < 0 {
+            validator.AddError(fmt.Sprintf("lines[%d].tax_amount", i), "Tax amount cannot be negative")
+        }
+
+        // Rupiah has no minor unit, so every stored line amount must be whole
+        amounts := []struct {
+            field  string
+            amount service.Rupiah
+        }{
+            {"unit_price", line.UnitPrice},
+            {"discount_amount", line.DiscountAmount},
+            {"line_total", line.LineTotal},
+            {"tax_amount", line.TaxAmount},
+        }
+        for _, a := range amounts {
+            if float64(a.amount) != math.Round(float64(a.amount)) {
+                validator.AddError(fmt.Sprintf("lines[%d].%s", i, a.field), "Amount must be in whole Rupiah")
+            }
+        }
+
+        expectedTotal := gross - line.DiscountAmount
         if abs(line.LineTotal-expectedTotal) > 0.01 {
             validator.AddError(fmt.Sprintf("lines[%d].line_total", i), "Line total calculation incorrect")
         }
@@ -194,11 +354,122 @@ func (s *InvoiceService) createInvoiceHandler(w http.ResponseWriter, r *http.Req
         return
     }
 
-    invoice.CompanyID, _ = strconv.Atoi(r.Header.Get("Company-ID"))
+    invoice.CompanyID = s.GetCompanyIDFromRequest(r)
+    if invoice.InvoiceDate.IsZero() {
+        invoice.InvoiceDate = service.NewJakartaTime(time.Now())
+    }
+
+    var paymentTerms int
+    var customerTaxID string
+    err := s.DB.QueryRowContext(ctx,
+        "SELECT COALESCE(payment_terms, 0), COALESCE(tax_id, '') FROM customers WHERE id = $1 AND company_id = $2 AND is_active = true",
+        invoice.CustomerID, invoice.CompanyID).Scan(&paymentTerms, &customerTaxID)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_CUSTOMER", "Customer not found or inactive")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching customer")
+        return
+    }
+
+    if invoice.DueDate.IsZero() {
+        invoice.DueDate = service.NewJakartaTime(invoice.InvoiceDate.Time().AddDate(0, 0, paymentTerms))
+    } else if invoice.DueDate.Time().Before(invoice.InvoiceDate.Time().Truncate(24 * time.Hour)) {
+        validator.AddError("due_date", "Due date cannot be earlier than invoice date")
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    taxRate, err := s.resolveTaxRate(ctx, r, &invoice)
+    if err != nil {
+        var statusErr *client.StatusError
+        if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_TAX_RATE", "Tax rate not found")
+            return
+        }
+        s.RespondWithError(w, http.StatusBadGateway, "TAX_SERVICE_ERROR", "Error resolving tax rate")
+        return
+    }
+
+    suppliedLineTax := make([]service.Rupiah, len(invoice.Lines))
+    for i, line := range invoice.Lines {
+        suppliedLineTax[i] = line.TaxAmount
+    }
+
+    taxAmount := applyLineTaxes(invoice.Lines, taxRate, invoice.TaxExempt)
+
+    for i, line := range invoice.Lines {
+        if suppliedLineTax[i] != 0 && abs(suppliedLineTax[i]-line.TaxAmount) > 0.01 {
+            validator.AddError(fmt.Sprintf("lines[%d].tax_amount", i), "Line tax amount calculation incorrect")
+        }
+    }
+
+    // Totals supplied by the client must reconcile with the lines
+    if invoice.Subtotal != 0 && abs(invoice.Subtotal-subtotal) > 0.01 {
+        validator.AddError("subtotal", "Subtotal does not match invoice lines")
+    }
+    if invoice.TaxAmount != 0 && abs(invoice.TaxAmount-taxAmount) > 0.01 {
+        validator.AddError("tax_amount", "Tax amount does not match taxable invoice lines")
+    }
+    if invoice.TotalAmount != 0 && abs(invoice.TotalAmount-(subtotal+taxAmount)) > 0.01 {
+        validator.AddError("total_amount", "Total amount must equal subtotal plus tax")
+    }
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
     invoice.Subtotal = subtotal
-    invoice.TaxAmount = subtotal * 0.11
-    invoice.TotalAmount = subtotal + invoice.TaxAmount
+    invoice.TaxRate = taxRate
+    invoice.TaxAmount = taxAmount
+    invoice.TotalAmount = subtotal + taxAmount
+    invoice.AmountPaid = 0
+    invoice.BalanceDue = invoice.TotalAmount
     invoice.Status = "draft"
+    invoice.TaxInvoiceNumber = ""
+
+    numberFormat := s.numberFormat
+    if invoice.InvoiceNumber == "" {
+        numberFormat = s.invoiceNumberFormat(ctx, client.ForwardHeaders(r), invoice.CompanyID)
+    } else {
+        // A number the client chose must be free; generated numbers skip taken ones instead
+        var exists bool
+        err = s.DB.QueryRowContext(ctx,
+            "SELECT EXISTS(SELECT 1 FROM invoices WHERE company_id = $1 AND invoice_number = $2)",
+            invoice.CompanyID, invoice.InvoiceNumber).Scan(&exists)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error checking duplicate")
+            return
+        }
+        if exists {
+            s.RespondWithError(w, http.StatusConflict, "DUPLICATE_INVOICE", "Invoice number already exists")
+            return
+        }
+    }
+
+    // Invoices charging PPN to a PKP customer, identified by its NPWP, need a faktur pajak.
+    // The serial is taken once only saving can fail, before the transaction so invoice
+    // numbering does not wait on tax-service, and is voided if the invoice is not saved.
+    saved := false
+    if invoice.TaxAmount > 0 && customerTaxID != "" {
+        invoice.TaxInvoiceNumber, err = s.nextTaxInvoiceNumber(ctx, r, &invoice)
+        if err != nil {
+            var statusErr *client.StatusError
+            if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+                s.RespondWithError(w, http.StatusConflict, "FAKTUR_SERIES_EXHAUSTED",
+                    "No faktur pajak serials available; register a new series in tax-service")
+                return
+            }
+            s.RespondWithError(w, http.StatusBadGateway, "TAX_SERVICE_ERROR", "Error allocating faktur pajak serial")
+            return
+        }
+        defer func() {
+            if !saved {
+                s.voidTaxInvoiceNumber(r, &invoice)
+            }
+        }()
+    }
 
     tx, err := s.DB.BeginTx(ctx, nil)
     if err != nil {
@@ -207,13 +478,25 @@ func (s *InvoiceService) createInvoiceHandler(w http.ResponseWriter, r *http.Req
     }
     defer tx.Rollback()
 
-    query := `INSERT INTO invoices (company_id, customer_id, invoice_number, invoice_date, due_date, subtotal, tax_amount, total_amount, status) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+    if invoice.InvoiceNumber == "" {
+        invoice.InvoiceNumber, err = s.nextInvoiceNumber(ctx, tx, invoice.CompanyID, numberFormat, invoice.InvoiceDate.Time())
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error generating invoice number")
+            return
+        }
+    }
+
+    query := `INSERT INTO invoices (company_id, customer_id, invoice_number, tax_invoice_number, invoice_date, 
+                                    due_date, subtotal, tax_rate_id, tax_rate, tax_exempt, tax_amount, 
+                                    total_amount, status) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) 
               RETURNING id, created_at`
     
+    taxInvoiceNumber := sql.NullString{String: invoice.TaxInvoiceNumber, Valid: invoice.TaxInvoiceNumber != ""}
     err = tx.QueryRowContext(ctx, query, 
-        invoice.CompanyID, invoice.CustomerID, invoice.InvoiceNumber,
+        invoice.CompanyID, invoice.CustomerID, invoice.InvoiceNumber, taxInvoiceNumber,
         invoice.InvoiceDate, invoice.DueDate, invoice.Subtotal, 
+        invoice.TaxRateID, invoice.TaxRate, invoice.TaxExempt,
         invoice.TaxAmount, invoice.TotalAmount, invoice.Status).Scan(&invoice.ID, &invoice.CreatedAt)
     if err != nil {
         s.HandleDBError(w, err, "Error creating invoice")
@@ -222,13 +505,16 @@ func (s *InvoiceService) createInvoiceHandler(w http.ResponseWriter, r *http.Req
 
     for i := range invoice.Lines {
         invoice.Lines[i].InvoiceID = invoice.ID
-        lineQuery := `INSERT INTO invoice_lines (invoice_id, product_name, quantity, unit_price, line_total) 
-                      VALUES ($1, $2, $3, $4, $5) RETURNING id`
+        lineQuery := `INSERT INTO invoice_lines (invoice_id, product_name, quantity, unit_price, discount_amount, 
+                                                 line_total, taxable, tax_rate, tax_amount) 
+                      VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
         
         err = tx.QueryRowContext(ctx, lineQuery, 
             invoice.Lines[i].InvoiceID, invoice.Lines[i].ProductName, 
             invoice.Lines[i].Quantity, invoice.Lines[i].UnitPrice, 
-            invoice.Lines[i].LineTotal).Scan(&invoice.Lines[i].ID)
+            invoice.Lines[i].DiscountAmount, invoice.Lines[i].LineTotal,
+            *invoice.Lines[i].Taxable, *invoice.Lines[i].TaxRate,
+            invoice.Lines[i].TaxAmount).Scan(&invoice.Lines[i].ID)
         if err != nil {
             s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error creating invoice lines")
             return
@@ -239,6 +525,7 @@ func (s *InvoiceService) createInvoiceHandler(w http.ResponseWriter, r *http.Req
         s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
         return
     }
+    saved = true
 
     s.RespondWithJSON(w, http.StatusCreated, invoice)
 }
@@ -248,8 +535,8 @@ func (s *InvoiceService) createCustomerHandler(w http.ResponseWriter, r *http.Re
     defer cancel()
     
     var customer Customer
-    if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
-        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+    if err := service.DecodeJSONBody(w, r, &customer, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
         return
     }
 
@@ -257,20 +544,26 @@ func (s *InvoiceService) createCustomerHandler(w http.ResponseWriter, r *http.Re
     validator.Required("customer_code", customer.CustomerCode)
     validator.Required("name", customer.Name)
     validator.Email("email", customer.Email)
+    
+    if customer.PaymentTerms < 0 || customer.PaymentTerms > 365 {
+        validator.AddError("payment_terms", "Payment terms must be 0-365 days")
+    }
 
     if !validator.IsValid() {
         s.RespondValidationError(w, validator.Errors())
         return
     }
 
-    customer.CompanyID, _ = strconv.Atoi(r.Header.Get("Company-ID"))
+    customer.CompanyID = s.GetCompanyIDFromRequest(r)
+    customer.IsActive = true
 
-    query := `INSERT INTO customers (company_id, customer_code, name, email, phone, address, tax_id) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7) 
+    query := `INSERT INTO customers (company_id, customer_code, name, email, phone, address, tax_id, payment_terms) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
               RETURNING id`
     
     err := s.DB.QueryRowContext(ctx, query, customer.CompanyID, customer.CustomerCode, customer.Name,
-                               customer.Email, customer.Phone, customer.Address, customer.TaxID).Scan(&customer.ID)
+                               customer.Email, customer.Phone, customer.Address, customer.TaxID,
+                               customer.PaymentTerms).Scan(&customer.ID)
     if err != nil {
         s.HandleDBError(w, err, "Error creating customer")
         return
@@ -279,13 +572,641 @@ func (s *InvoiceService) createCustomerHandler(w http.ResponseWriter, r *http.Re
     s.RespondWithJSON(w, http.StatusCreated, customer)
 }
 
+func (s *InvoiceService) updateCustomerHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid customer ID")
+        return
+    }
+    
+    var customer Customer
+    if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+    
+    validator := validation.New()
+    validator.Required("customer_code", customer.CustomerCode)
+    validator.Required("name", customer.Name)
+    validator.Email("email", customer.Email)
+    
+    if customer.PaymentTerms < 0 || customer.PaymentTerms > 365 {
+        validator.AddError("payment_terms", "Payment terms must be 0-365 days")
+    }
+    
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    query := `UPDATE customers 
+              SET customer_code = $1, name = $2, email = $3, phone = $4, address = $5, tax_id = $6, 
+                  payment_terms = $7, updated_at = CURRENT_TIMESTAMP 
+              WHERE id = $8 AND company_id = $9 
+              RETURNING is_active`
+    
+    err = s.DB.QueryRowContext(ctx, query, customer.CustomerCode, customer.Name, customer.Email,
+                              customer.Phone, customer.Address, customer.TaxID, customer.PaymentTerms,
+                              id, companyID).Scan(&customer.IsActive)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Customer not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating customer")
+        return
+    }
+    
+    customer.ID = id
+    customer.CompanyID = companyID
+    s.RespondWithJSON(w, http.StatusOK, customer)
+}
+
+func (s *InvoiceService) deleteCustomerHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid customer ID")
+        return
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    // Customers with invoices that have not been voided must stay active for follow-up
+    var hasInvoices bool
+    err = s.DB.QueryRowContext(ctx,
+        "SELECT EXISTS(SELECT 1 FROM invoices WHERE customer_id = $1 AND company_id = $2 AND status != 'cancelled')",
+        id, companyID).Scan(&hasInvoices)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error checking customer invoices")
+        return
+    }
+    if hasInvoices {
+        s.RespondWithError(w, http.StatusConflict, "CUSTOMER_HAS_INVOICES", "Customer has invoices that are not cancelled")
+        return
+    }
+    
+    query := `UPDATE customers SET is_active = false, updated_at = CURRENT_TIMESTAMP 
+              WHERE id = $1 AND company_id = $2`
+    
+    result, err := s.DB.ExecContext(ctx, query, id, companyID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error deleting customer")
+        return
+    }
+    
+    rowsAffected, _ := result.RowsAffected()
+    if rowsAffected == 0 {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Customer not found")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (s *InvoiceService) getInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid invoice ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    invoice, err := s.loadInvoice(ctx, id, companyID)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Invoice not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching invoice")
+        return
+    }
+
+    s.RespondFormatted(w, r, http.StatusOK, invoice)
+}
+
+func (s *InvoiceService) recordPaymentHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid invoice ID")
+        return
+    }
+
+    var payment InvoicePayment
+    if err := service.DecodeJSONBody(w, r, &payment, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+
+    validator := validation.New()
+    validator.PositiveNumber("amount", float64(payment.Amount))
+    if float64(payment.Amount) != math.Round(float64(payment.Amount)) {
+        validator.AddError("amount", "Amount must be in whole Rupiah")
+    }
+    validator.Required("payment_method", payment.PaymentMethod)
+    validator.OneOf("payment_method", payment.PaymentMethod,
+        []string{"cash", "bank_transfer", "credit_card", "giro", "other"})
+    validator.MaxLength("reference", payment.Reference, 100)
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    payment.InvoiceID = id
+    payment.CreatedBy = s.GetUserIDFromRequest(r)
+    if payment.PaymentDate.IsZero() {
+        payment.PaymentDate = service.NewJakartaTime(time.Now())
+    }
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    var totalAmount, amountPaid service.Rupiah
+    var status string
+    err = tx.QueryRowContext(ctx,
+        "SELECT total_amount, amount_paid, status FROM invoices WHERE id = $1 AND company_id = $2 FOR UPDATE",
+        id, companyID).Scan(&totalAmount, &amountPaid, &status)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Invoice not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching invoice")
+        return
+    }
+
+    // Payments only apply to invoices the customer has received
+    switch status {
+    case "draft":
+        s.RespondWithError(w, http.StatusConflict, "INVALID_STATUS", "Cannot record payment on a draft invoice, send it first")
+        return
+    case "cancelled":
+        s.RespondWithError(w, http.StatusConflict, "INVALID_STATUS", "Cannot record payment on a cancelled invoice")
+        return
+    case "paid":
+        s.RespondWithError(w, http.StatusConflict, "INVALID_STATUS", "Invoice is already fully paid")
+        return
+    }
+
+    remaining := totalAmount - amountPaid
+    if payment.Amount > remaining {
+        s.RespondWithError(w, http.StatusBadRequest, "PAYMENT_EXCEEDS_BALANCE",
+            fmt.Sprintf("Payment exceeds the remaining balance of %.0f", remaining))
+        return
+    }
+
+    query := `INSERT INTO invoice_payments (invoice_id, company_id, amount, payment_date, payment_method, 
+                                            reference, notes, created_by) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
+              RETURNING id, created_at`
+
+    err = tx.QueryRowContext(ctx, query,
+        payment.InvoiceID, companyID, payment.Amount, payment.PaymentDate, payment.PaymentMethod,
+        payment.Reference, payment.Notes, payment.CreatedBy).Scan(&payment.ID, &payment.CreatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error recording payment")
+        return
+    }
+
+    amountPaid += payment.Amount
+    status = "partially_paid"
+    if amountPaid >= totalAmount {
+        status = "paid"
+    }
+
+    _, err = tx.ExecContext(ctx,
+        "UPDATE invoices SET amount_paid = $1, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
+        amountPaid, status, id)
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating invoice balance")
+        return
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{
+        "payment":        payment,
+        "amount_paid":    amountPaid,
+        "balance_due":    totalAmount - amountPaid,
+        "invoice_status": status,
+    })
+}
+
+// loadInvoice fetches a single invoice with its customer, lines and payment history.
+// It returns sql.ErrNoRows when the invoice does not exist for the company.
+func (s *InvoiceService) loadInvoice(ctx context.Context, id, companyID int) (*Invoice, error) {
+    var invoice Invoice
+    var customer Customer
+    var customerName, customerCode, customerEmail, customerPhone, customerAddress, customerTaxID sql.NullString
+
+    err := s.DB.QueryRowContext(ctx, `
+        SELECT i.id, i.company_id, i.customer_id, i.invoice_number, COALESCE(i.tax_invoice_number, ''), 
+               i.invoice_date, i.due_date, i.subtotal, i.tax_rate_id, i.tax_rate, i.tax_exempt, i.tax_amount, i.total_amount,
+               i.amount_paid, i.status, i.sent_at, i.created_at,
+               c.customer_code, c.name, c.email, c.phone, c.address, c.tax_id, COALESCE(c.payment_terms, 0)
+        FROM invoices i LEFT JOIN customers c ON i.customer_id = c.id
+        WHERE i.id = $1 AND i.company_id = $2`, id, companyID).Scan(
+        &invoice.ID, &invoice.CompanyID, &invoice.CustomerID, &invoice.InvoiceNumber,
+        &invoice.TaxInvoiceNumber, &invoice.InvoiceDate, &invoice.DueDate, &invoice.Subtotal, &invoice.TaxRateID,
+        &invoice.TaxRate, &invoice.TaxExempt, &invoice.TaxAmount, &invoice.TotalAmount,
+        &invoice.AmountPaid, &invoice.Status, &invoice.SentAt, &invoice.CreatedAt,
+        &customerCode, &customerName, &customerEmail, &customerPhone, &customerAddress, &customerTaxID,
+        &customer.PaymentTerms)
+    if err != nil {
+        return nil, err
+    }
+    invoice.BalanceDue = invoice.TotalAmount - invoice.AmountPaid
+
+    if customerName.Valid {
+        customer.ID = invoice.CustomerID
+        customer.CompanyID = invoice.CompanyID
+        customer.CustomerCode = customerCode.String
+        customer.Name = customerName.String
+        customer.Email = customerEmail.String
+        customer.Phone = customerPhone.String
+        customer.Address = customerAddress.String
+        customer.TaxID = customerTaxID.String
+        invoice.Customer = &customer
+    }
+
+    lineRows, err := s.DB.QueryContext(ctx, `
+        SELECT id, invoice_id, product_name, quantity, unit_price, discount_amount, 
+               line_total, taxable, tax_rate, tax_amount
+        FROM invoice_lines WHERE invoice_id = $1 ORDER BY id`, invoice.ID)
+    if err != nil {
+        return nil, err
+    }
+    defer lineRows.Close()
+
+    for lineRows.Next() {
+        var line InvoiceLine
+        var taxable bool
+        var taxRate float64
+        if err := lineRows.Scan(&line.ID, &line.InvoiceID, &line.ProductName, &line.Quantity,
+            &line.UnitPrice, &line.DiscountAmount, &line.LineTotal, &taxable, &taxRate,
+            &line.TaxAmount); err != nil {
+            return nil, err
+        }
+        line.Taxable = &taxable
+        line.TaxRate = &taxRate
+        invoice.Lines = append(invoice.Lines, line)
+    }
+    if err := lineRows.Err(); err != nil {
+        return nil, err
+    }
+
+    paymentRows, err := s.DB.QueryContext(ctx, `
+        SELECT id, invoice_id, amount, payment_date, payment_method, 
+               COALESCE(reference, ''), COALESCE(notes, ''), COALESCE(created_by, 0), created_at
+        FROM invoice_payments WHERE invoice_id = $1 ORDER BY payment_date, id`, invoice.ID)
+    if err != nil {
+        return nil, err
+    }
+    defer paymentRows.Close()
+
+    for paymentRows.Next() {
+        var payment InvoicePayment
+        if err := paymentRows.Scan(&payment.ID, &payment.InvoiceID, &payment.Amount, &payment.PaymentDate,
+            &payment.PaymentMethod, &payment.Reference, &payment.Notes, &payment.CreatedBy,
+            &payment.CreatedAt); err != nil {
+            return nil, err
+        }
+        invoice.Payments = append(invoice.Payments, payment)
+    }
+
+    return &invoice, paymentRows.Err()
+}
+
 func (s *InvoiceService) sendInvoiceHandler(w http.ResponseWriter, r *http.Request) {
-    s.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+    ctx, cancel := context.WithTimeout(r.Context(), 45*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid invoice ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    invoice, err := s.loadInvoice(ctx, id, companyID)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Invoice not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching invoice")
+        return
+    }
+
+    if invoice.Status == "paid" || invoice.Status == "cancelled" {
+        s.RespondWithError(w, http.StatusConflict, "INVALID_STATUS",
+            fmt.Sprintf("Cannot send an invoice with status %s", invoice.Status))
+        return
+    }
+    if invoice.Customer == nil || invoice.Customer.Email == "" {
+        s.RespondWithError(w, http.StatusBadRequest, "MISSING_CUSTOMER_EMAIL", "Customer has no email address")
+        return
+    }
+
+    headers := client.ForwardHeaders(r)
+
+    var company struct {
+        Name string `json:"name"`
+    }
+    if err := s.companyClient.Do(ctx, http.MethodGet, fmt.Sprintf("/companies/%d", companyID), headers, nil, &company); err != nil {
+        s.RespondWithError(w, http.StatusBadGateway, "COMPANY_SERVICE_ERROR", "Error fetching company details")
+        return
+    }
+
+    email := map[string]interface{}{
+        "to":       invoice.Customer.Email,
+        "subject":  fmt.Sprintf("Invoice %s from %s", invoice.InvoiceNumber, company.Name),
+        "template": "invoice",
+        "data": map[string]interface{}{
+            "CompanyName":   company.Name,
+            "CustomerName":  invoice.Customer.Name,
+            "InvoiceNumber": invoice.InvoiceNumber,
+            "InvoiceDate":   invoice.InvoiceDate,
+            "DueDate":       invoice.DueDate,
+            "TotalAmount":   invoice.TotalAmount,
+        },
+    }
+
+    // The email is queued, and retried by notification-service if SMTP is unavailable, so the
+    // invoice is marked sent once it is accepted; only a failure to queue it can be retried here
+    var queued struct {
+        ID string `json:"id"`
+    }
+    if err := s.notifyClient.Do(ctx, http.MethodPost, "/send-email", headers, email, &queued); err != nil {
+        log.Printf("Failed to queue invoice %d email: %v", invoice.ID, err)
+        s.RespondWithError(w, http.StatusBadGateway, "NOTIFICATION_ERROR", "Error sending invoice email, please retry")
+        return
+    }
+    invoice.EmailID = queued.ID
+
+    // Resending keeps payment-related statuses; only drafts move to sent
+    err = s.DB.QueryRowContext(ctx, `UPDATE invoices 
+                                     SET status = CASE WHEN status = 'draft' THEN 'sent' ELSE status END, 
+                                         sent_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP 
+                                     WHERE id = $1 AND company_id = $2 
+                                     RETURNING status, sent_at`,
+        invoice.ID, companyID).Scan(&invoice.Status, &invoice.SentAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating invoice status")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, invoice)
+}
+
+// resolveTaxRate returns the tax percentage applied to an invoice: zero when it is
+// tax exempt, the tax-service rate when tax_rate_id is given, and otherwise the
+// company's configured PPN rate.
+func (s *InvoiceService) resolveTaxRate(ctx context.Context, r *http.Request, invoice *Invoice) (float64, error) {
+    if invoice.TaxExempt {
+        invoice.TaxRateID = nil
+        return 0, nil
+    }
+    
+    headers := client.ForwardHeaders(r)
+    
+    if invoice.TaxRateID != nil {
+        key := fmt.Sprintf("tax-rate:%d:%d", invoice.CompanyID, *invoice.TaxRateID)
+        if rate, ok := s.taxRates.get(key); ok {
+            return rate, nil
+        }
+        
+        var taxRate struct {
+            TaxRate  float64 `json:"tax_rate"`
+            IsActive bool    `json:"is_active"`
+        }
+        path := fmt.Sprintf("/tax-rates/%d", *invoice.TaxRateID)
+        if err := s.taxClient.Do(ctx, http.MethodGet, path, headers, nil, &taxRate); err != nil {
+            return 0, err
+        }
+        if !taxRate.IsActive {
+            return 0, &client.StatusError{StatusCode: http.StatusNotFound, Message: "Tax rate is inactive"}
+        }
+        s.taxRates.set(key, taxRate.TaxRate)
+        return taxRate.TaxRate, nil
+    }
+    
+    return s.companyPPNRate(ctx, headers, invoice.CompanyID), nil
+}
+
+// companySetting returns a single company setting, or "" when the company has not set it.
+func (s *InvoiceService) companySetting(ctx context.Context, headers http.Header, companyID int, key string) (string, error) {
+    var settings []struct {
+        SettingKey   string `json:"setting_key"`
+        SettingValue string `json:"setting_value"`
+    }
+    
+    path := fmt.Sprintf("/companies/%d/settings", companyID)
+    if err := s.companyClient.Do(ctx, http.MethodGet, path, headers, nil, &settings); err != nil {
+        return "", err
+    }
+    
+    for _, setting := range settings {
+        if setting.SettingKey == key {
+            return setting.SettingValue, nil
+        }
+    }
+    return "", nil
+}
+
+// companyPPNRate reads the tax_rate_ppn company setting, falling back to
+// TAX_RATE_PPN when company-service is unreachable or the setting is missing.
+func (s *InvoiceService) companyPPNRate(ctx context.Context, headers http.Header, companyID int) float64 {
+    key := fmt.Sprintf("ppn:%d", companyID)
+    if rate, ok := s.taxRates.get(key); ok {
+        return rate
+    }
+    
+    value, err := s.companySetting(ctx, headers, companyID, "tax_rate_ppn")
+    if err != nil {
+        log.Printf("Falling back to default PPN rate for company %d: %v", companyID, err)
+        return s.defaultTaxRate
+    }
+    
+    rate, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        rate = s.defaultTaxRate
+    }
+    s.taxRates.set(key, rate)
+    return rate
 }
 
-func abs(x float64) float64 {
+// invoiceNumberFormat reads the invoice_number_format company setting, falling back to
+// INVOICE_NUMBER_FORMAT when company-service is unreachable or the setting is missing.
+func (s *InvoiceService) invoiceNumberFormat(ctx context.Context, headers http.Header, companyID int) string {
+    value, err := s.companySetting(ctx, headers, companyID, "invoice_number_format")
+    if err != nil {
+        log.Printf("Falling back to default invoice number format for company %d: %v", companyID, err)
+        return s.numberFormat
+    }
+    if value == "" {
+        return s.numberFormat
+    }
+    return value
+}
+
+// nextSequence allocates the next number in one of a company's document sequences.
+// The upsert locks the sequence row until the surrounding transaction ends, so
+// concurrent invoice creation cannot hand out the same number twice.
+func nextSequence(ctx context.Context, tx *sql.Tx, companyID int, sequenceType string) (int, error) {
+    var next int
+    err := tx.QueryRowContext(ctx, `
+        INSERT INTO invoice_sequences (company_id, sequence_type, last_number) 
+        VALUES ($1, $2, 1)
+        ON CONFLICT (company_id, sequence_type) 
+        DO UPDATE SET last_number = invoice_sequences.last_number + 1, updated_at = CURRENT_TIMESTAMP
+        RETURNING last_number`, companyID, sequenceType).Scan(&next)
+    return next, err
+}
+
+// nextInvoiceNumber allocates the next sequential invoice number for a company and
+// renders it with format, e.g. "INV/{YYYY}/{SEQ:6}" gives INV/2024/000042. Numbers already
+// taken, such as one entered by hand, are skipped. The counter never resets: {YYYY}, {YY}
+// and {MM} label the number but a new year or month carries on from the last one.
+func (s *InvoiceService) nextInvoiceNumber(ctx context.Context, tx *sql.Tx, companyID int, format string, date time.Time) (string, error) {
+    for {
+        next, err := nextSequence(ctx, tx, companyID, "invoice")
+        if err != nil {
+            return "", err
+        }
+        number := formatDocumentNumber(format, date, next)
+        
+        var taken bool
+        err = tx.QueryRowContext(ctx,
+            "SELECT EXISTS(SELECT 1 FROM invoices WHERE company_id = $1 AND invoice_number = $2)",
+            companyID, number).Scan(&taken)
+        if err != nil {
+            return "", err
+        }
+        if !taken {
+            return number, nil
+        }
+    }
+}
+
+// nextTaxInvoiceNumber takes the next faktur pajak serial from the ranges the company has
+// registered in tax-service and returns the full number, e.g. 010.000-24.00000042.
+// Generated invoice numbers are not known yet, so only one chosen by the client is sent as
+// the serial's reference.
+func (s *InvoiceService) nextTaxInvoiceNumber(ctx context.Context, r *http.Request, invoice *Invoice) (string, error) {
+    request := map[string]interface{}{
+        "transaction_code": "01",
+        "date":             invoice.InvoiceDate,
+        "reference":        invoice.InvoiceNumber,
+    }
+    var serial struct {
+        FakturNumber string `json:"faktur_number"`
+    }
+    if err := s.taxClient.Do(ctx, http.MethodPost, "/faktur-pajak/allocate", client.ForwardHeaders(r), request, &serial); err != nil {
+        return "", err
+    }
+    log.Printf("Allocated faktur pajak %s to a new invoice of company %d", serial.FakturNumber, invoice.CompanyID)
+    return serial.FakturNumber, nil
+}
+
+// voidTaxInvoiceNumber records the serial of an invoice that was not saved as unused in
+// tax-service, so it can be reported to DJP. It runs after the request context may have
+// ended, and a serial it fails to void is logged for voiding by hand.
+func (s *InvoiceService) voidTaxInvoiceNumber(r *http.Request, invoice *Invoice) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    
+    request := map[string]string{
+        "faktur_number": invoice.TaxInvoiceNumber,
+        "reason":        "Invoice was not saved",
+    }
+    if err := s.taxClient.Do(ctx, http.MethodPost, "/faktur-pajak/void", client.ForwardHeaders(r), request, nil); err != nil {
+        log.Printf("Faktur pajak %s of company %d is unused but could not be voided: %v",
+            invoice.TaxInvoiceNumber, invoice.CompanyID, err)
+        return
+    }
+    log.Printf("Voided unused faktur pajak %s of company %d", invoice.TaxInvoiceNumber, invoice.CompanyID)
+}
+
+var sequencePlaceholder = regexp.MustCompile(`\{SEQ(?::(\d+))?\}`)
+
+// formatDocumentNumber fills the {YYYY}, {YY}, {MM} and {SEQ} or {SEQ:width}
+// placeholders of a numbering format.
+func formatDocumentNumber(format string, date time.Time, seq int) string {
+    number := strings.NewReplacer(
+        "{YYYY}", fmt.Sprintf("%04d", date.Year()),
+        "{YY}", fmt.Sprintf("%02d", date.Year()%100),
+        "{MM}", fmt.Sprintf("%02d", int(date.Month())),
+    ).Replace(format)
+    
+    return sequencePlaceholder.ReplaceAllStringFunc(number, func(match string) string {
+        width := 0
+        if groups := sequencePlaceholder.FindStringSubmatch(match); groups[1] != "" {
+            width, _ = strconv.Atoi(groups[1])
+        }
+        return fmt.Sprintf("%0*d", width, seq)
+    })
+}
+
+// applyLineTaxes fills in each line's taxable flag, rate and tax amount and returns the
+// invoice tax. Lines are taxable unless flagged otherwise and default to the invoice rate.
+func applyLineTaxes(lines []InvoiceLine, invoiceRate float64, exempt bool) service.Rupiah {
+    var total service.Rupiah
+    for i := range lines {
+        line := &lines[i]
+        if line.Taxable == nil {
+            taxable := true
+            line.Taxable = &taxable
+        }
+        if line.TaxRate == nil {
+            rate := invoiceRate
+            line.TaxRate = &rate
+        }
+
+        line.TaxAmount = 0
+        if *line.Taxable && !exempt {
+            // Rupiah has no minor unit, so tax is rounded per line
+            line.TaxAmount = service.Rupiah(math.Round(float64(line.LineTotal) * *line.TaxRate / 100))
+        }
+        total += line.TaxAmount
+    }
+    return total
+}
+
+func abs(x service.Rupiah) service.Rupiah {
     if x < 0 {
         return -x
     }
     return x
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
 }
\ No newline at end of file
@@ -0,0 +1,136 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/mux"
+
+    "github.com/massehanto/accounting-system-go/shared/database/dbtest"
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+// Invoice amounts are whole Rupiah: unit_price is rounded when encoded, while a fractional
+// quantity is kept as sent
+func TestInvoiceLineEncodesWholeRupiah(t *testing.T) {
+    encoded, err := json.Marshal(InvoiceLine{Quantity: 2.5, UnitPrice: service.Rupiah(1234.567)})
+    if err != nil {
+        t.Fatalf("marshal: %v", err)
+    }
+    var line map[string]json.RawMessage
+    if err := json.Unmarshal(encoded, &line); err != nil {
+        t.Fatalf("unmarshal: %v", err)
+    }
+    if string(line["unit_price"]) != "1235" {
+        t.Errorf("unit_price = %s, want 1235", line["unit_price"])
+    }
+    if string(line["quantity"]) != "2.5" {
+        t.Errorf("quantity = %s, want 2.5", line["quantity"])
+    }
+}
+
+// paymentDB holds one 1.000.000 invoice with no payments yet, in the given status, and
+// counts the payments recorded against it. It also keeps the invoice sequence and the
+// invoice numbers already taken.
+type paymentDB struct {
+    status   string
+    recorded int
+    sequence int64
+    taken    map[string]bool
+}
+
+func (d *paymentDB) open() *sql.DB {
+    return dbtest.Open(&dbtest.Driver{Query: d.query, Exec: d.exec})
+}
+
+func (d *paymentDB) query(_ *dbtest.Tx, query string, args []driver.Value) (driver.Rows, error) {
+    switch {
+    case strings.Contains(query, "INSERT INTO invoice_sequences"):
+        d.sequence++
+        return dbtest.Rows([]string{"last_number"}, []driver.Value{d.sequence}), nil
+    case strings.Contains(query, "SELECT EXISTS(SELECT 1 FROM invoices"):
+        return dbtest.Rows([]string{"exists"}, []driver.Value{d.taken[args[1].(string)]}), nil
+    case strings.Contains(query, "FROM invoices") && strings.Contains(query, "FOR UPDATE"):
+        return dbtest.Rows([]string{"total_amount", "amount_paid", "status"}, []driver.Value{1000000.0, 0.0, d.status}), nil
+    case strings.Contains(query, "INSERT INTO invoice_payments"):
+        d.recorded++
+        return dbtest.Rows([]string{"id", "created_at"}, []driver.Value{int64(d.recorded), time.Now()}), nil
+    }
+    return nil, errors.New("unexpected query: " + query)
+}
+
+func (d *paymentDB) exec(_ *dbtest.Tx, query string, _ []driver.Value) (driver.Result, error) {
+    if strings.Contains(query, "UPDATE invoices SET amount_paid") {
+        return driver.RowsAffected(1), nil
+    }
+    return nil, errors.New("unexpected statement: " + query)
+}
+
+func TestRecordPaymentRequiresSentInvoice(t *testing.T) {
+    payments := &paymentDB{}
+    db := payments.open()
+    defer db.Close()
+    s := &InvoiceService{BaseService: &service.BaseService{DB: db}}
+
+    cases := []struct {
+        status string
+        want   int
+    }{
+        {"draft", http.StatusConflict},
+        {"cancelled", http.StatusConflict},
+        {"paid", http.StatusConflict},
+        {"sent", http.StatusCreated},
+        {"partially_paid", http.StatusCreated},
+        {"overdue", http.StatusCreated},
+    }
+    for _, tc := range cases {
+        payments.status, payments.recorded = tc.status, 0
+
+        req := httptest.NewRequest("POST", "/invoices/1/payments",
+            strings.NewReader(`{"amount":250000,"payment_method":"bank_transfer"}`))
+        req = mux.SetURLVars(req, map[string]string{"id": "1"})
+        req = req.WithContext(context.WithValue(req.Context(), "company_id", 1))
+        rec := httptest.NewRecorder()
+        s.recordPaymentHandler(rec, req)
+
+        if rec.Code != tc.want {
+            t.Errorf("%s invoice: status = %d, want %d (%s)", tc.status, rec.Code, tc.want, rec.Body.String())
+        }
+        if recorded := payments.recorded == 1; recorded != (tc.want == http.StatusCreated) {
+            t.Errorf("%s invoice: payment recorded = %v", tc.status, recorded)
+        }
+    }
+}
+
+// A generated number that was already entered by hand is skipped rather than rejected
+func TestNextInvoiceNumberSkipsTakenNumbers(t *testing.T) {
+    payments := &paymentDB{}
+    db := payments.open()
+    defer db.Close()
+    s := &InvoiceService{BaseService: &service.BaseService{DB: db}}
+
+    payments.sequence = 41
+    payments.taken = map[string]bool{"INV/2024/000042": true, "INV/2024/000043": true}
+
+    tx, err := db.Begin()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer tx.Rollback()
+    number, err := s.nextInvoiceNumber(context.Background(), tx, 1, "INV/{YYYY}/{SEQ:6}",
+        time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+    if err != nil {
+        t.Fatalf("nextInvoiceNumber: %v", err)
+    }
+    if number != "INV/2024/000044" {
+        t.Errorf("number = %s, want INV/2024/000044", number)
+    }
+}
@@ -0,0 +1,71 @@
+-- invoice-service/migrations/0001_initial_schema.sql
+-- Baseline schema, as database/init-db.sql creates it. Later schema changes are the numbered
+-- migrations that follow; each is also safe to run on a database that already has it.
+
+CREATE TABLE IF NOT EXISTS customers (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    customer_code VARCHAR(20) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    phone VARCHAR(20),
+    address TEXT,
+    tax_id VARCHAR(50),
+    payment_terms INTEGER DEFAULT 30 CHECK (payment_terms >= 0 AND payment_terms <= 365),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, customer_code),
+    CONSTRAINT check_customer_tax_id CHECK (tax_id IS NULL OR tax_id ~ '^\d{2}\.\d{3}\.\d{3}\.\d{1}-\d{3}\.\d{3}$')
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    customer_id INTEGER REFERENCES customers(id),
+    invoice_number VARCHAR(50) NOT NULL,
+    invoice_date DATE NOT NULL,
+    due_date DATE NOT NULL,
+    subtotal DECIMAL(15,0) NOT NULL CHECK (subtotal >= 0),
+    tax_amount DECIMAL(15,0) DEFAULT 0 CHECK (tax_amount >= 0),
+    total_amount DECIMAL(15,0) NOT NULL CHECK (total_amount >= 0),
+    status VARCHAR(20) DEFAULT 'draft' CHECK (status IN ('draft', 'sent', 'paid', 'overdue', 'cancelled')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, invoice_number),
+    CONSTRAINT check_idr_invoice_amounts CHECK (
+        subtotal = ROUND(subtotal) AND 
+        tax_amount = ROUND(tax_amount) AND 
+        total_amount = ROUND(total_amount)
+    )
+);
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+    id SERIAL PRIMARY KEY,
+    invoice_id INTEGER REFERENCES invoices(id) ON DELETE CASCADE,
+    product_name VARCHAR(255) NOT NULL,
+    quantity DECIMAL(10,2) NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(15,0) NOT NULL CHECK (unit_price >= 0),
+    line_total DECIMAL(15,0) NOT NULL CHECK (line_total >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_idr_line_amounts CHECK (
+        unit_price = ROUND(unit_price) AND line_total = ROUND(line_total)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_company_status ON invoices(company_id, status);
+CREATE INDEX IF NOT EXISTS idx_invoices_date ON invoices(company_id, invoice_date);
+CREATE INDEX IF NOT EXISTS idx_invoices_due_date ON invoices(due_date) WHERE status IN ('sent', 'overdue');
+CREATE INDEX IF NOT EXISTS idx_customers_company_active ON customers(company_id, is_active) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_invoice_lines_invoice ON invoice_lines(invoice_id);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER update_customers_updated_at BEFORE UPDATE ON customers FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE OR REPLACE TRIGGER update_invoices_updated_at BEFORE UPDATE ON invoices FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
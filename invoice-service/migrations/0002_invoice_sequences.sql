@@ -0,0 +1,7 @@
+-- invoice-service/migrations/0002_invoice_sequences.sql
+-- Per-company counter used to auto-generate invoice numbers
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    company_id INTEGER PRIMARY KEY,
+    last_number INTEGER NOT NULL DEFAULT 0 CHECK (last_number >= 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
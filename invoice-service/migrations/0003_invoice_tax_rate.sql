@@ -0,0 +1,5 @@
+-- invoice-service/migrations/0003_invoice_tax_rate.sql
+-- The tax rate an invoice was issued at, resolved from tax-service or the company's PPN setting
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_rate_id INTEGER; -- Reference to tax service (no FK constraint across services)
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_rate DECIMAL(5,2) NOT NULL DEFAULT 0 CHECK (tax_rate >= 0 AND tax_rate <= 100);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_exempt BOOLEAN DEFAULT FALSE;
@@ -0,0 +1,14 @@
+-- invoice-service/migrations/0004_invoice_line_discount_tax.sql
+-- Per-line discount and tax
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS discount_amount DECIMAL(15,0) DEFAULT 0 CHECK (discount_amount >= 0);
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS taxable BOOLEAN DEFAULT TRUE;
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS tax_rate DECIMAL(5,2) NOT NULL DEFAULT 0 CHECK (tax_rate >= 0 AND tax_rate <= 100);
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS tax_amount DECIMAL(15,0) DEFAULT 0 CHECK (tax_amount >= 0);
+
+ALTER TABLE invoice_lines DROP CONSTRAINT IF EXISTS check_idr_line_amounts;
+ALTER TABLE invoice_lines ADD CONSTRAINT check_idr_line_amounts CHECK (
+    unit_price = ROUND(unit_price) AND 
+    discount_amount = ROUND(discount_amount) AND 
+    line_total = ROUND(line_total) AND 
+    tax_amount = ROUND(tax_amount)
+);
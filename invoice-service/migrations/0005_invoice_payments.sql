@@ -0,0 +1,35 @@
+-- invoice-service/migrations/0005_invoice_payments.sql
+-- Payments recorded against invoices, with the running amount paid kept on the invoice
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS amount_paid DECIMAL(15,0) NOT NULL DEFAULT 0 CHECK (amount_paid >= 0);
+
+ALTER TABLE invoices DROP CONSTRAINT IF EXISTS invoices_status_check;
+ALTER TABLE invoices ADD CONSTRAINT invoices_status_check
+    CHECK (status IN ('draft', 'sent', 'partially_paid', 'paid', 'overdue', 'cancelled'));
+
+ALTER TABLE invoices DROP CONSTRAINT IF EXISTS check_paid_not_over_total;
+ALTER TABLE invoices ADD CONSTRAINT check_paid_not_over_total CHECK (amount_paid <= total_amount);
+
+ALTER TABLE invoices DROP CONSTRAINT IF EXISTS check_idr_invoice_amounts;
+ALTER TABLE invoices ADD CONSTRAINT check_idr_invoice_amounts CHECK (
+    subtotal = ROUND(subtotal) AND 
+    tax_amount = ROUND(tax_amount) AND 
+    total_amount = ROUND(total_amount) AND 
+    amount_paid = ROUND(amount_paid)
+);
+
+CREATE TABLE IF NOT EXISTS invoice_payments (
+    id SERIAL PRIMARY KEY,
+    invoice_id INTEGER REFERENCES invoices(id) ON DELETE CASCADE,
+    company_id INTEGER NOT NULL,
+    amount DECIMAL(15,0) NOT NULL CHECK (amount > 0 AND amount = ROUND(amount)),
+    payment_date DATE NOT NULL,
+    payment_method VARCHAR(20) NOT NULL CHECK (payment_method IN ('cash', 'bank_transfer', 'credit_card', 'giro', 'other')),
+    reference VARCHAR(100),
+    notes TEXT,
+    created_by INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP INDEX IF EXISTS idx_invoices_due_date;
+CREATE INDEX idx_invoices_due_date ON invoices(due_date) WHERE status IN ('sent', 'partially_paid', 'overdue');
+CREATE INDEX IF NOT EXISTS idx_invoice_payments_invoice ON invoice_payments(invoice_id);
@@ -0,0 +1,3 @@
+-- invoice-service/migrations/0006_invoice_sent_at.sql
+-- When an invoice was emailed to its customer
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS sent_at TIMESTAMP;
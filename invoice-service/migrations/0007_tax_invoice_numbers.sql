@@ -0,0 +1,11 @@
+-- invoice-service/migrations/0007_tax_invoice_numbers.sql
+-- Faktur pajak numbers on invoices, and a separate counter per company for each kind of number
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_invoice_number VARCHAR(20);
+ALTER TABLE invoices DROP CONSTRAINT IF EXISTS invoices_company_id_tax_invoice_number_key;
+ALTER TABLE invoices ADD CONSTRAINT invoices_company_id_tax_invoice_number_key UNIQUE (company_id, tax_invoice_number);
+
+-- Existing counters are invoice counters
+ALTER TABLE invoice_sequences ADD COLUMN IF NOT EXISTS sequence_type VARCHAR(20) NOT NULL DEFAULT 'invoice'
+    CHECK (sequence_type IN ('invoice', 'faktur_pajak'));
+ALTER TABLE invoice_sequences DROP CONSTRAINT IF EXISTS invoice_sequences_pkey;
+ALTER TABLE invoice_sequences ADD PRIMARY KEY (company_id, sequence_type);
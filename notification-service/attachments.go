@@ -0,0 +1,123 @@
+// notification-service/attachments.go
+package main
+
+import (
+    "bytes"
+    "encoding/base64"
+    "fmt"
+    "mime"
+    "mime/multipart"
+    "net/http"
+    "net/textproto"
+    "strings"
+    
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// attachmentTypes are the content types an email may carry. Executables and archives are left
+// out, as mail providers tend to reject or quarantine them.
+var attachmentTypes = map[string]bool{
+    "application/pdf":          true,
+    "text/csv":                 true,
+    "text/plain":               true,
+    "image/png":                true,
+    "image/jpeg":               true,
+    "application/vnd.ms-excel": true,
+    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
+}
+
+// sniffedTypes are the allowed types whose content can be recognised, so a file labelled as one
+// of them must really be one. Text and spreadsheet formats don't sniff reliably and are taken
+// at their word.
+var sniffedTypes = map[string]bool{
+    "application/pdf": true,
+    "image/png":       true,
+    "image/jpeg":      true,
+}
+
+// Attachment is a file sent with an email. Content is base64 in JSON.
+type Attachment struct {
+    Filename    string `json:"filename"`
+    ContentType string `json:"content_type"`
+    Content     []byte `json:"content"`
+}
+
+// validateAttachments checks each attachment's name and type against the allowlist, and that
+// together they stay within maxBytes once decoded
+func validateAttachments(validator *validation.Validator, attachments []Attachment, maxBytes int64) {
+    var total int64
+    for i, attachment := range attachments {
+        prefix := fmt.Sprintf("attachments[%d]", i)
+        validator.Required(prefix+".filename", attachment.Filename)
+        if strings.ContainsAny(attachment.Filename, "/\\\r\n\"") {
+            validator.AddError(prefix+".filename", "Filename must not contain path separators, quotes or line breaks")
+        }
+        mediaType, _, err := mime.ParseMediaType(attachment.ContentType)
+        if err != nil || !attachmentTypes[mediaType] {
+            validator.AddError(prefix+".content_type", fmt.Sprintf("Content type %q is not allowed", attachment.ContentType))
+        }
+        if len(attachment.Content) == 0 {
+            validator.AddError(prefix+".content", "Attachment content is required")
+        } else if sniffedTypes[mediaType] && http.DetectContentType(attachment.Content) != mediaType {
+            validator.AddError(prefix+".content", fmt.Sprintf("Content is not %s", mediaType))
+        }
+        total += int64(len(attachment.Content))
+    }
+    if total > maxBytes {
+        validator.AddError("attachments", fmt.Sprintf("Attachments must not exceed %d bytes in total", maxBytes))
+    }
+}
+
+// writeMessageBody writes the HTML body, and the attachments if there are any, after the
+// message headers. With attachments the message becomes multipart/mixed, the body its first
+// part.
+func writeMessageBody(msg *bytes.Buffer, body string, attachments []Attachment) error {
+    msg.WriteString("MIME-Version: 1.0\r\n")
+    if len(attachments) == 0 {
+        msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+        msg.WriteString(body)
+        return nil
+    }
+    
+    mw := multipart.NewWriter(msg)
+    msg.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary()))
+    
+    part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+    if err != nil {
+        return err
+    }
+    if _, err := part.Write([]byte(body)); err != nil {
+        return err
+    }
+    
+    for _, attachment := range attachments {
+        part, err := mw.CreatePart(textproto.MIMEHeader{
+            "Content-Type":              {attachment.ContentType},
+            "Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+            "Content-Transfer-Encoding": {"base64"},
+        })
+        if err != nil {
+            return err
+        }
+        if err := writeBase64Lines(part, attachment.Content); err != nil {
+            return err
+        }
+    }
+    return mw.Close()
+}
+
+// writeBase64Lines encodes content in lines of 76 characters, the most RFC 2045 allows
+func writeBase64Lines(w interface{ Write([]byte) (int, error) }, content []byte) error {
+    encoded := base64.StdEncoding.EncodeToString(content)
+    for len(encoded) > 0 {
+        n := 76
+        if len(encoded) < n {
+            n = len(encoded)
+        }
+        if _, err := w.Write([]byte(encoded[:n] + "\r\n")); err != nil {
+            return err
+        }
+        encoded = encoded[n:]
+    }
+    return nil
+}
\ No newline at end of file
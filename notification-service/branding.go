@@ -0,0 +1,118 @@
+// notification-service/branding.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "net/url"
+    "regexp"
+    "time"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+const defaultPrimaryColor = "#1976d2"
+
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Branding is what a company's emails show around the template content: its logo, header
+// color and footer. Companies without saved branding get the default color and the company
+// name from the email data.
+type Branding struct {
+    CompanyName  string     `json:"company_name"`
+    LogoURL      string     `json:"logo_url"`
+    PrimaryColor string     `json:"primary_color"`
+    FooterText   string     `json:"footer_text"`
+    UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+func defaultBranding() Branding {
+    return Branding{PrimaryColor: defaultPrimaryColor}
+}
+
+// loadBranding returns the company's saved branding, or the default when it has none
+func (ns *NotificationService) loadBranding(ctx context.Context, companyID int) (Branding, error) {
+    branding := defaultBranding()
+    if companyID == 0 {
+        return branding, nil
+    }
+    
+    var updatedAt time.Time
+    err := ns.DB.QueryRowContext(ctx, `
+        SELECT company_name, logo_url, primary_color, footer_text, updated_at
+        FROM company_branding WHERE company_id = $1`, companyID).Scan(
+        &branding.CompanyName, &branding.LogoURL, &branding.PrimaryColor, &branding.FooterText, &updatedAt)
+    if err == sql.ErrNoRows {
+        return defaultBranding(), nil
+    }
+    if err != nil {
+        return Branding{}, err
+    }
+    branding.UpdatedAt = &updatedAt
+    return branding, nil
+}
+
+func (ns *NotificationService) getBrandingHandler(w http.ResponseWriter, r *http.Request) {
+    branding, err := ns.loadBranding(r.Context(), ns.GetCompanyIDFromRequest(r))
+    if err != nil {
+        ns.HandleDBError(w, err, "Error loading branding")
+        return
+    }
+    
+    ns.RespondWithJSON(w, http.StatusOK, branding)
+}
+
+// updateBrandingHandler replaces the company's branding. An empty company_name falls back to
+// the name each email is sent with, and an empty primary_color to the default.
+func (ns *NotificationService) updateBrandingHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    var branding Branding
+    if err := service.DecodeJSONBody(w, r, &branding, service.DefaultMaxBodyBytes); err != nil {
+        ns.RespondWithBodyError(w, err)
+        return
+    }
+    if branding.PrimaryColor == "" {
+        branding.PrimaryColor = defaultPrimaryColor
+    }
+    
+    validator := validation.New()
+    validator.MaxLength("company_name", branding.CompanyName, 255)
+    validator.MaxLength("footer_text", branding.FooterText, 1000)
+    if !hexColorPattern.MatchString(branding.PrimaryColor) {
+        validator.AddError("primary_color", "Primary color must be a hex color such as #1976d2")
+    }
+    if branding.LogoURL != "" {
+        logoURL, err := url.Parse(branding.LogoURL)
+        if err != nil || (logoURL.Scheme != "https" && logoURL.Scheme != "http") || logoURL.Host == "" {
+            validator.AddError("logo_url", "Logo URL must be an absolute http or https URL")
+        }
+    }
+    
+    if !validator.IsValid() {
+        ns.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    var updatedAt time.Time
+    err := ns.DB.QueryRowContext(ctx, `
+        INSERT INTO company_branding (company_id, company_name, logo_url, primary_color, footer_text)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (company_id) DO UPDATE
+        SET company_name = EXCLUDED.company_name, logo_url = EXCLUDED.logo_url,
+            primary_color = EXCLUDED.primary_color, footer_text = EXCLUDED.footer_text,
+            updated_at = CURRENT_TIMESTAMP
+        RETURNING updated_at`,
+        ns.GetCompanyIDFromRequest(r), branding.CompanyName, branding.LogoURL, branding.PrimaryColor, branding.FooterText,
+    ).Scan(&updatedAt)
+    if err != nil {
+        ns.HandleDBError(w, err, "Error saving branding")
+        return
+    }
+    branding.UpdatedAt = &updatedAt
+    
+    ns.RespondWithJSON(w, http.StatusOK, branding)
+}
\ No newline at end of file
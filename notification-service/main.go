@@ -4,17 +4,22 @@ package main
 import (
     "bytes"
     "context"
-    "encoding/json"
+    "errors"
     "fmt"
     "html/template"
+    "log"
     "net/http"
     "net/smtp"
     "os"
+    "strconv"
+    "sync"
     "time"
     
     "github.com/gorilla/mux"
     
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/database"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
     "github.com/massehanto/accounting-system-go/shared/service"
@@ -24,21 +29,35 @@ import (
 type NotificationService struct {
     *service.BaseService
     emailService *EmailService
+    queue        *EmailQueue
+    webhooks     *WebhookQueue
+    smsProvider  SMSProvider
+    // allowHTTPWebhooks lets subscriptions use plain http URLs, for local development
+    allowHTTPWebhooks bool
 }
 
 type EmailService struct {
-    SMTPHost  string
-    SMTPPort  string
-    Username  string
-    Password  string
-    templates map[string]*template.Template
+    SMTPHost string
+    SMTPPort string
+    Username string
+    Password string
+    // templates, parsed from the built-in ones and templateDir's, are rendered for companies
+    // without stored templates of their own, which get companyTemplates
+    templateDir      string
+    templatesMu      sync.RWMutex
+    templates        map[string]*template.Template
+    companyTemplates map[int]map[string]*template.Template
+    templateSources  map[string]string
+    // maxAttachmentBytes caps the decoded size of one email's attachments together
+    maxAttachmentBytes int64
 }
 
 type EmailRequest struct {
-    To       string                 `json:"to"`
-    Subject  string                 `json:"subject"`
-    Template string                 `json:"template"`
-    Data     map[string]interface{} `json:"data"`
+    To          string                 `json:"to"`
+    Subject     string                 `json:"subject"`
+    Template    string                 `json:"template"`
+    Data        map[string]interface{} `json:"data"`
+    Attachments []Attachment           `json:"attachments"`
 }
 
 type EmailResponse struct {
@@ -48,88 +67,115 @@ type EmailResponse struct {
 }
 
 func main() {
+    logger.Init("notification-service")
+    
     cfg := config.Load()
+    cfg.Database.Name = "notification_db"
+    
+    db := database.InitDatabase(cfg.Database)
+    defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
     
     emailService := &EmailService{
-        SMTPHost:  getEnv("SMTP_HOST", "smtp.gmail.com"),
-        SMTPPort:  getEnv("SMTP_PORT", "587"),
-        Username:  os.Getenv("SMTP_USER"),
-        Password:  os.Getenv("SMTP_PASSWORD"),
-        templates: make(map[string]*template.Template),
+        SMTPHost:         getEnv("SMTP_HOST", "smtp.gmail.com"),
+        SMTPPort:         getEnv("SMTP_PORT", "587"),
+        Username:         os.Getenv("SMTP_USER"),
+        Password:         os.Getenv("SMTP_PASSWORD"),
+        templateDir:      os.Getenv("EMAIL_TEMPLATE_DIR"),
+        companyTemplates: make(map[int]map[string]*template.Template),
     }
     
-    if err := emailService.loadTemplates(); err != nil {
+    if err := emailService.loadTemplates(emailService.templateDir); err != nil {
         panic(fmt.Sprintf("Failed to load email templates: %v", err))
     }
     
+    maxAttempts, err := strconv.Atoi(getEnv("EMAIL_MAX_ATTEMPTS", "5"))
+    if err != nil || maxAttempts < 1 {
+        log.Fatalf("Invalid EMAIL_MAX_ATTEMPTS: %q", os.Getenv("EMAIL_MAX_ATTEMPTS"))
+    }
+    workers, err := strconv.Atoi(getEnv("EMAIL_WORKERS", "2"))
+    if err != nil || workers < 1 {
+        log.Fatalf("Invalid EMAIL_WORKERS: %q", os.Getenv("EMAIL_WORKERS"))
+    }
+    webhookMaxAttempts, err := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+    if err != nil || webhookMaxAttempts < 1 {
+        log.Fatalf("Invalid WEBHOOK_MAX_ATTEMPTS: %q", os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+    }
+    emailService.maxAttachmentBytes, err = strconv.ParseInt(getEnv("EMAIL_MAX_ATTACHMENT_BYTES", "10485760"), 10, 64)
+    if err != nil || emailService.maxAttachmentBytes < 0 {
+        log.Fatalf("Invalid EMAIL_MAX_ATTACHMENT_BYTES: %q", os.Getenv("EMAIL_MAX_ATTACHMENT_BYTES"))
+    }
+    
     notificationService := &NotificationService{
-        BaseService:  &service.BaseService{DB: nil},
-        emailService: emailService,
+        BaseService:       &service.BaseService{DB: db},
+        emailService:      emailService,
+        queue:             NewEmailQueue(db, emailService, maxAttempts),
+        webhooks:          NewWebhookQueue(db, webhookMaxAttempts),
+        smsProvider:       newSMSProvider(os.Getenv("SMS_PROVIDER")),
+        allowHTTPWebhooks: getEnv("WEBHOOK_ALLOW_HTTP", "false") == "true",
+    }
+    
+    if err := notificationService.loadStoredTemplates(context.Background()); err != nil {
+        log.Printf("Failed to load stored email templates, using the built-in ones: %v", err)
     }
     
+    workerCtx, stopWorkers := context.WithCancel(context.Background())
+    defer stopWorkers()
+    notificationService.queue.Start(workerCtx, workers)
+    notificationService.webhooks.Start(workerCtx, workers)
+    
     r := mux.NewRouter()
     
-    r.Handle("/health", middleware.HealthCheck(nil, "notification-service")).Methods("GET")
+    r.Handle("/health", middleware.HealthCheck(db, "notification-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "notification-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+    })).Methods("GET")
     r.Handle("/send-email", middleware.Chain(
         middleware.SecurityHeaders,
+        // Callers forwarding a user's token get that company's branding
+        middleware.OptionalAuth(cfg.JWT.Secret),
         middleware.RateLimit(50),
         middleware.LoggingMiddleware,
     )(notificationService.sendEmailHandler)).Methods("POST")
+    // Every SMS is billed to the provider account, so only admins, or services acting with an
+    // admin's token, may send one
+    r.Handle("/send-sms", middleware.RoleMiddleware(cfg.JWT.Secret, "admin")(notificationService.sendSMSHandler)).Methods("POST")
+    // Recipients, subjects and SMTP errors are only shown to the company that sent the email
+    emailStatus := middleware.APIMiddleware(cfg.JWT.Secret)(notificationService.getEmailStatusHandler)
+    r.Handle("/emails/{id}", emailStatus).Methods("GET")
+    r.Handle("/notifications/{id}", emailStatus).Methods("GET")
+    r.Handle("/notify", middleware.APIMiddleware(cfg.JWT.Secret)(notificationService.notifyHandler)).Methods("POST")
+    r.Handle("/deliveries/{id}", middleware.APIMiddleware(cfg.JWT.Secret)(notificationService.getDeliveryHandler)).Methods("GET")
+    r.Handle("/subscriptions", middleware.RoleMiddleware(cfg.JWT.Secret, "admin")(notificationService.getSubscriptionsHandler)).Methods("GET")
+    r.Handle("/subscriptions", middleware.RoleMiddleware(cfg.JWT.Secret, "admin")(notificationService.createSubscriptionHandler)).Methods("POST")
+    r.Handle("/subscriptions/{id}", middleware.RoleMiddleware(cfg.JWT.Secret, "admin")(notificationService.deleteSubscriptionHandler)).Methods("DELETE")
+    r.Handle("/email-templates", middleware.APIMiddleware(cfg.JWT.Secret)(notificationService.listTemplatesHandler)).Methods("GET")
+    r.Handle("/templates", middleware.APIMiddleware(cfg.JWT.Secret)(notificationService.getStoredTemplatesHandler)).Methods("GET")
+    r.Handle("/templates", middleware.RoleMiddleware(cfg.JWT.Secret, "admin")(notificationService.createTemplateHandler)).Methods("POST")
+    r.Handle("/templates/refresh", middleware.RoleMiddleware(cfg.JWT.Secret, "admin")(notificationService.refreshTemplatesHandler)).Methods("POST")
+    r.Handle("/templates/{name}", middleware.APIMiddleware(cfg.JWT.Secret)(notificationService.getTemplateHandler)).Methods("GET")
+    r.Handle("/templates/{name}", middleware.RoleMiddleware(cfg.JWT.Secret, "admin")(notificationService.updateTemplateHandler)).Methods("PUT")
+    r.Handle("/branding", middleware.APIMiddleware(cfg.JWT.Secret)(notificationService.getBrandingHandler)).Methods("GET")
+    r.Handle("/branding", middleware.RoleMiddleware(cfg.JWT.Secret, "admin")(notificationService.updateBrandingHandler)).Methods("PUT")
 
     server.SetupServer(r, cfg)
 }
 
-func (es *EmailService) loadTemplates() error {
-    templates := map[string]string{
-        "invoice": `
-<!DOCTYPE html>
-<html>
-<head><style>body{font-family:Arial,sans-serif;margin:0;padding:20px}.header{background:#1976d2;color:white;padding:20px;text-align:center}.content{padding:20px}</style></head>
-<body>
-<div class="header"><h1>{{.CompanyName}}</h1></div>
-<div class="content">
-<h2>Invoice {{.InvoiceNumber}}</h2>
-<p>Dear {{.CustomerName}},</p>
-<p>Please find your invoice details below:</p>
-<p><strong>Invoice Number:</strong> {{.InvoiceNumber}}<br>
-<strong>Date:</strong> {{.InvoiceDate}}<br>
-<strong>Due Date:</strong> {{.DueDate}}<br>
-<strong>Amount:</strong> {{.TotalAmount}}</p>
-<p>Please ensure payment by the due date.</p>
-</div>
-</body>
-</html>`,
-        "payment_reminder": `
-<!DOCTYPE html>
-<html>
-<head><style>body{font-family:Arial,sans-serif;margin:0;padding:20px}</style></head>
-<body>
-<h2>Payment Reminder</h2>
-<p>Dear {{.CustomerName}},</p>
-<p>This is a friendly reminder that invoice {{.InvoiceNumber}} for {{.TotalAmount}} is due on {{.DueDate}}.</p>
-<p>Please process payment at your earliest convenience.</p>
-</body>
-</html>`,
-    }
-    
-    for name, tmplStr := range templates {
-        tmpl, err := template.New(name).Parse(tmplStr)
-        if err != nil {
-            return fmt.Errorf("failed to parse template %s: %v", name, err)
-        }
-        es.templates[name] = tmpl
-    }
-    
-    return nil
-}
-
+// sendEmailHandler queues an email and answers 202 with its tracking ID; workers deliver it
+// and retry failures. With ?sync=true it is sent before answering instead, and an SMTP failure
+// fails the request, for callers that must know the outcome.
 func (ns *NotificationService) sendEmailHandler(w http.ResponseWriter, r *http.Request) {
     ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
     defer cancel()
     
+    // Room for the attachments in base64, which takes 4 bytes for every 3, besides the rest
+    maxBody := ns.emailService.maxAttachmentBytes/3*4 + service.DefaultMaxBodyBytes
+    
     var req EmailRequest
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        ns.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+    if err := service.DecodeJSONBody(w, r, &req, maxBody); err != nil {
+        ns.RespondWithBodyError(w, err)
         return
     }
     
@@ -137,6 +183,7 @@ func (ns *NotificationService) sendEmailHandler(w http.ResponseWriter, r *http.R
     validator.Required("to", req.To)
     validator.Email("to", req.To)
     validator.Required("subject", req.Subject)
+    validateAttachments(validator, req.Attachments, ns.emailService.maxAttachmentBytes)
     
     if !validator.IsValid() {
         ns.RespondValidationError(w, validator.Errors())
@@ -146,9 +193,20 @@ func (ns *NotificationService) sendEmailHandler(w http.ResponseWriter, r *http.R
     var body string
     var err error
     
-    if req.Template != "" && ns.emailService.templates[req.Template] != nil {
-        body, err = ns.emailService.renderTemplate(req.Template, req.Data)
+    if req.Template != "" {
+        branding, err := ns.loadBranding(ctx, ns.GetCompanyIDFromRequest(r))
+        if err != nil {
+            ns.HandleDBError(w, err, "Error loading branding")
+            return
+        }
+        body, err = ns.emailService.renderTemplate(ns.GetCompanyIDFromRequest(r), req.Template, req.Data, branding)
+        var notFound *TemplateNotFoundError
+        if errors.As(err, &notFound) {
+            ns.RespondWithError(w, http.StatusBadRequest, "TEMPLATE_NOT_FOUND", notFound.Error())
+            return
+        }
         if err != nil {
+            log.Printf("Error rendering template %s: %v", req.Template, err)
             ns.RespondWithError(w, http.StatusInternalServerError, "TEMPLATE_ERROR", "Error rendering template")
             return
         }
@@ -159,7 +217,17 @@ func (ns *NotificationService) sendEmailHandler(w http.ResponseWriter, r *http.R
         return
     }
     
-    messageID, err := ns.emailService.SendEmailWithContext(ctx, req.To, req.Subject, body)
+    if r.URL.Query().Get("sync") != "true" {
+        status, err := ns.queue.Enqueue(ctx, ns.GetCompanyIDFromRequest(r), req.To, req.Subject, body, req.Attachments)
+        if err != nil {
+            ns.HandleDBError(w, err, "Failed to queue email")
+            return
+        }
+        ns.RespondWithJSON(w, http.StatusAccepted, status)
+        return
+    }
+    
+    messageID, err := ns.emailService.SendEmailWithContext(ctx, req.To, req.Subject, body, req.Attachments)
     if err != nil {
         ns.RespondWithError(w, http.StatusInternalServerError, "EMAIL_ERROR", fmt.Sprintf("Failed to send email: %v", err))
         return
@@ -174,7 +242,25 @@ func (ns *NotificationService) sendEmailHandler(w http.ResponseWriter, r *http.R
     ns.RespondWithJSON(w, http.StatusOK, response)
 }
 
-func (es *EmailService) SendEmailWithContext(ctx context.Context, to, subject, body string) (string, error) {
+func (ns *NotificationService) listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+    ns.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"templates": ns.emailService.templateNames(ns.GetCompanyIDFromRequest(r))})
+}
+
+func (ns *NotificationService) getEmailStatusHandler(w http.ResponseWriter, r *http.Request) {
+    status, err := ns.queue.Status(r.Context(), ns.GetCompanyIDFromRequest(r), mux.Vars(r)["id"])
+    if errors.Is(err, errEmailNotFound) {
+        ns.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Email not found")
+        return
+    }
+    if err != nil {
+        ns.HandleDBError(w, err, "Failed to load email status")
+        return
+    }
+    
+    ns.RespondWithJSON(w, http.StatusOK, status)
+}
+
+func (es *EmailService) SendEmailWithContext(ctx context.Context, to, subject, body string, attachments []Attachment) (string, error) {
     if es.Username == "" || es.Password == "" {
         return "", fmt.Errorf("SMTP credentials not configured")
     }
@@ -182,20 +268,20 @@ func (es *EmailService) SendEmailWithContext(ctx context.Context, to, subject, b
     messageID := fmt.Sprintf("<%d@accounting-system>", time.Now().UnixNano())
     
     headers := map[string]string{
-        "From":         es.Username,
-        "To":           to,
-        "Subject":      subject,
-        "Message-ID":   messageID,
-        "Date":         time.Now().Format(time.RFC1123Z),
-        "Content-Type": "text/html; charset=UTF-8",
+        "From":       es.Username,
+        "To":         to,
+        "Subject":    subject,
+        "Message-ID": messageID,
+        "Date":       time.Now().Format(time.RFC1123Z),
     }
     
     var msg bytes.Buffer
     for key, value := range headers {
         msg.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
     }
-    msg.WriteString("\r\n")
-    msg.WriteString(body)
+    if err := writeMessageBody(&msg, body, attachments); err != nil {
+        return "", err
+    }
     
     auth := smtp.PlainAuth("", es.Username, es.Password, es.SMTPHost)
     
@@ -215,17 +301,6 @@ func (es *EmailService) SendEmailWithContext(ctx context.Context, to, subject, b
     }
 }
 
-func (es *EmailService) renderTemplate(templateName string, data map[string]interface{}) (string, error) {
-    tmpl, exists := es.templates[templateName]
-    if !exists {
-        return "", fmt.Errorf("template %s not found", templateName)
-    }
-    
-    var body bytes.Buffer
-    err := tmpl.Execute(&body, data)
-    return body.String(), err
-}
-
 func getEnv(key, defaultValue string) string {
     if value := os.Getenv(key); value != "" {
         return value
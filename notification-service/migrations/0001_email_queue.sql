@@ -0,0 +1,21 @@
+-- notification-service/migrations/0001_email_queue.sql
+-- Emails waiting to be sent, and the outcome of those that were. A queued email is due at
+-- next_attempt_at; a worker sending it pushes that forward first, so if the worker dies the
+-- email is picked up again once the lease runs out.
+CREATE TABLE IF NOT EXISTS email_queue (
+    id VARCHAR(32) PRIMARY KEY,
+    recipient VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    message_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_queue_due ON email_queue(next_attempt_at) WHERE status = 'queued';
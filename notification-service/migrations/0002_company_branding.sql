@@ -0,0 +1,10 @@
+-- notification-service/migrations/0002_company_branding.sql
+-- Per-company logo, header color and footer applied to every templated email
+CREATE TABLE IF NOT EXISTS company_branding (
+    company_id INTEGER PRIMARY KEY,
+    company_name VARCHAR(255) NOT NULL DEFAULT '',
+    logo_url TEXT NOT NULL DEFAULT '',
+    primary_color CHAR(7) NOT NULL DEFAULT '#1976d2',
+    footer_text TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
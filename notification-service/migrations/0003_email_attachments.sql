@@ -0,0 +1,3 @@
+-- notification-service/migrations/0003_email_attachments.sql
+-- Attachments of a queued email, as a JSON array of filename, content_type and base64 content
+ALTER TABLE email_queue ADD COLUMN IF NOT EXISTS attachments JSONB;
@@ -0,0 +1,41 @@
+-- notification-service/migrations/0004_subscriptions.sql
+-- Where a company wants each event type delivered: a webhook URL, signed with the
+-- subscription's secret, or an email address. Webhook deliveries are queued like emails.
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    channel VARCHAR(10) NOT NULL CHECK (channel IN ('webhook', 'email')),
+    url TEXT,
+    email VARCHAR(255),
+    secret VARCHAR(64),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_subscription_target CHECK (
+        (channel = 'webhook' AND url IS NOT NULL AND secret IS NOT NULL) OR
+        (channel = 'email' AND email IS NOT NULL)
+    )
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id VARCHAR(32) PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    company_id INTEGER NOT NULL,
+    event_id VARCHAR(32) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'delivered', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    response_status INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_company_event ON subscriptions(company_id, event_type) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries(company_id, event_id);
@@ -0,0 +1,11 @@
+-- notification-service/migrations/0005_email_templates.sql
+-- Templates a company has added or customised. Each replaces the built-in template or
+-- partial of the same name for that company's emails only.
+CREATE TABLE IF NOT EXISTS email_templates (
+    company_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    source TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (company_id, name)
+);
@@ -0,0 +1,4 @@
+-- notification-service/migrations/0006_email_queue_company.sql
+-- The company that queued each email, so only that company can see its status. Emails sent
+-- without a user's token, such as password resets, have none and are not shown to anyone.
+ALTER TABLE email_queue ADD COLUMN IF NOT EXISTS company_id INTEGER;
@@ -0,0 +1,227 @@
+// notification-service/queue.go
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "log"
+    "time"
+)
+
+const (
+    // emailLease is how long a worker has to send an email before another may pick it up
+    emailLease        = 2 * time.Minute
+    emailSendTimeout  = 30 * time.Second
+    emailRetryBackoff = 30 * time.Second
+    emailMaxBackoff   = time.Hour
+    emailPollInterval = 5 * time.Second
+)
+
+var errEmailNotFound = errors.New("email not found")
+
+// EmailStatus is a queued email's delivery state: queued until sent, or failed once it has
+// used up its attempts
+type EmailStatus struct {
+    ID            string     `json:"id"`
+    To            string     `json:"to"`
+    Subject       string     `json:"subject"`
+    Status        string     `json:"status"`
+    Attempts      int        `json:"attempts"`
+    MaxAttempts   int        `json:"max_attempts"`
+    LastError     string     `json:"last_error,omitempty"`
+    MessageID     string     `json:"message_id,omitempty"`
+    NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+    SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// EmailQueue keeps emails in the database until they are sent, so neither an SMTP outage
+// nor a restart loses them. Workers retry failures with exponential backoff.
+type EmailQueue struct {
+    db          *sql.DB
+    sender      *EmailService
+    maxAttempts int
+    wake        chan struct{}
+}
+
+func NewEmailQueue(db *sql.DB, sender *EmailService, maxAttempts int) *EmailQueue {
+    return &EmailQueue{db: db, sender: sender, maxAttempts: maxAttempts, wake: make(chan struct{}, 1)}
+}
+
+// Enqueue stores a rendered email for delivery and returns its tracking status. companyID is
+// the company that may track it, or 0 for emails sent without a user's token.
+func (q *EmailQueue) Enqueue(ctx context.Context, companyID int, to, subject, body string, attachments []Attachment) (EmailStatus, error) {
+    id, err := newMessageID()
+    if err != nil {
+        return EmailStatus{}, err
+    }
+    var attachmentsJSON []byte
+    if len(attachments) > 0 {
+        if attachmentsJSON, err = json.Marshal(attachments); err != nil {
+            return EmailStatus{}, err
+        }
+    }
+
+    status := EmailStatus{ID: id, To: to, Subject: subject, Status: "queued", MaxAttempts: q.maxAttempts}
+    err = q.db.QueryRowContext(ctx, `
+        INSERT INTO email_queue (id, company_id, recipient, subject, body, max_attempts, attachments)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING created_at`,
+        id, sql.NullInt64{Int64: int64(companyID), Valid: companyID != 0},
+        to, subject, body, q.maxAttempts, attachmentsJSON).Scan(&status.CreatedAt)
+    if err != nil {
+        return EmailStatus{}, err
+    }
+
+    // Let an idle worker know instead of waiting for its next poll
+    select {
+    case q.wake <- struct{}{}:
+    default:
+    }
+    return status, nil
+}
+
+// Status reports the delivery state of one of a company's emails
+func (q *EmailQueue) Status(ctx context.Context, companyID int, id string) (EmailStatus, error) {
+    var status EmailStatus
+    var lastError, messageID sql.NullString
+    var nextAttemptAt time.Time
+    err := q.db.QueryRowContext(ctx, `
+        SELECT id, recipient, subject, status, attempts, max_attempts, last_error, message_id,
+               next_attempt_at, created_at, sent_at
+        FROM email_queue WHERE id = $1 AND company_id = $2`, id, companyID).Scan(
+        &status.ID, &status.To, &status.Subject, &status.Status, &status.Attempts, &status.MaxAttempts,
+        &lastError, &messageID, &nextAttemptAt, &status.CreatedAt, &status.SentAt)
+    if err == sql.ErrNoRows {
+        return EmailStatus{}, errEmailNotFound
+    }
+    if err != nil {
+        return EmailStatus{}, err
+    }
+    status.LastError, status.MessageID = lastError.String, messageID.String
+    if status.Status == "queued" {
+        status.NextAttemptAt = &nextAttemptAt
+    }
+    return status, nil
+}
+
+// Start runs workers until ctx is cancelled
+func (q *EmailQueue) Start(ctx context.Context, workers int) {
+    for i := 0; i < workers; i++ {
+        go q.work(ctx)
+    }
+}
+
+func (q *EmailQueue) work(ctx context.Context) {
+    ticker := time.NewTicker(emailPollInterval)
+    defer ticker.Stop()
+
+    for {
+        // Drain everything that is due before waiting again
+        for {
+            delivered, err := q.deliverNext(ctx)
+            if err != nil {
+                log.Printf("Email queue error: %v", err)
+            }
+            if !delivered || err != nil {
+                break
+            }
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        case <-q.wake:
+        }
+    }
+}
+
+// deliverNext claims the next due email and tries to send it. It reports false when nothing
+// was due.
+func (q *EmailQueue) deliverNext(ctx context.Context) (bool, error) {
+    var id, to, subject, body string
+    var attempts, maxAttempts int
+    var attachmentsJSON []byte
+    err := q.db.QueryRowContext(ctx, `
+        UPDATE email_queue
+        SET attempts = attempts + 1,
+            next_attempt_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second',
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = (
+            SELECT id FROM email_queue
+            WHERE status = 'queued' AND next_attempt_at <= CURRENT_TIMESTAMP
+            ORDER BY next_attempt_at
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, recipient, subject, body, attempts, max_attempts, attachments`,
+        int(emailLease.Seconds())).Scan(&id, &to, &subject, &body, &attempts, &maxAttempts, &attachmentsJSON)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    var attachments []Attachment
+    var messageID string
+    var sendErr error
+    if attachmentsJSON != nil {
+        sendErr = json.Unmarshal(attachmentsJSON, &attachments)
+    }
+    if sendErr == nil {
+        sendCtx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+        messageID, sendErr = q.sender.SendEmailWithContext(sendCtx, to, subject, body, attachments)
+        cancel()
+    }
+
+    if sendErr == nil {
+        _, err = q.db.ExecContext(ctx, `
+            UPDATE email_queue
+            SET status = 'sent', message_id = $2, last_error = NULL,
+                sent_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $1`, id, messageID)
+        return true, err
+    }
+
+    if attempts >= maxAttempts {
+        log.Printf("Email %s to %s failed after %d attempts: %v", id, to, attempts, sendErr)
+        _, err = q.db.ExecContext(ctx, `
+            UPDATE email_queue
+            SET status = 'failed', last_error = $2, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $1`, id, sendErr.Error())
+        return true, err
+    }
+
+    _, err = q.db.ExecContext(ctx, `
+        UPDATE email_queue
+        SET last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second',
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1`, id, sendErr.Error(), int(retryBackoff(attempts).Seconds()))
+    return true, err
+}
+
+// retryBackoff doubles the wait after each failed attempt, up to emailMaxBackoff
+func retryBackoff(attempts int) time.Duration {
+    backoff := emailRetryBackoff
+    for i := 1; i < attempts && backoff < emailMaxBackoff; i++ {
+        backoff *= 2
+    }
+    if backoff > emailMaxBackoff {
+        backoff = emailMaxBackoff
+    }
+    return backoff
+}
+
+func newMessageID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
+}
\ No newline at end of file
@@ -0,0 +1,155 @@
+// notification-service/sms.go
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "time"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// maxSMSLength is the longest message providers accept, split into segments on delivery
+const maxSMSLength = 1600
+
+// SMSProvider sends text messages. to is in E.164 form; the returned ID is the provider's.
+type SMSProvider interface {
+    Name() string
+    Send(ctx context.Context, to, message string) (string, error)
+}
+
+type SMSRequest struct {
+    To      string `json:"to"`
+    Message string `json:"message"`
+}
+
+type SMSResponse struct {
+    Status    string    `json:"status"`
+    MessageID string    `json:"message_id"`
+    Provider  string    `json:"provider"`
+    SentAt    time.Time `json:"sent_at"`
+}
+
+// newSMSProvider builds the provider named in SMS_PROVIDER. It returns nil when SMS is not
+// set up, and refuses to start when the provider is unknown or missing its credentials.
+func newSMSProvider(name string) SMSProvider {
+    switch name {
+    case "":
+        return nil
+    case "twilio":
+        provider := &twilioProvider{
+            client:     &http.Client{Timeout: 15 * time.Second},
+            accountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+            authToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+            from:       os.Getenv("TWILIO_FROM"),
+        }
+        if provider.accountSID == "" || provider.authToken == "" || provider.from == "" {
+            log.Fatalf("Invalid SMS_PROVIDER: twilio needs TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM")
+        }
+        return provider
+    default:
+        log.Fatalf("Invalid SMS_PROVIDER: %q", name)
+        return nil
+    }
+}
+
+// twilioProvider sends through Twilio's Messages API
+type twilioProvider struct {
+    client     *http.Client
+    accountSID string
+    authToken  string
+    from       string
+}
+
+func (p *twilioProvider) Name() string { return "twilio" }
+
+func (p *twilioProvider) Send(ctx context.Context, to, message string) (string, error) {
+    endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", url.PathEscape(p.accountSID))
+    form := url.Values{"To": {to}, "From": {p.from}, "Body": {message}}
+    
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.SetBasicAuth(p.accountSID, p.authToken)
+    
+    resp, err := p.client.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+    
+    var result struct {
+        SID     string `json:"sid"`
+        Message string `json:"message"`
+    }
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+    if err != nil {
+        return "", err
+    }
+    if err := json.Unmarshal(body, &result); err != nil {
+        return "", fmt.Errorf("twilio returned %d with an unreadable body", resp.StatusCode)
+    }
+    if resp.StatusCode >= 300 {
+        return "", fmt.Errorf("twilio returned %d: %s", resp.StatusCode, result.Message)
+    }
+    return result.SID, nil
+}
+
+// sendSMSHandler sends a text message to an Indonesian mobile number straight away
+func (ns *NotificationService) sendSMSHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+    
+    if ns.smsProvider == nil {
+        ns.RespondWithError(w, http.StatusServiceUnavailable, "SMS_NOT_CONFIGURED", "SMS is not configured; set SMS_PROVIDER")
+        return
+    }
+    
+    var req SMSRequest
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        ns.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validator.Required("to", req.To)
+    validator.IndonesianPhone("to", req.To)
+    validator.Required("message", req.Message)
+    if len([]rune(req.Message)) > maxSMSLength {
+        validator.AddError("message", fmt.Sprintf("Message must be at most %d characters", maxSMSLength))
+    }
+    to := validation.NormalizeIndonesianPhone(req.To)
+    // Landlines cannot receive SMS; Indonesian mobile numbers start with 08
+    if to != "" && !strings.HasPrefix(to, "+628") {
+        validator.AddError("to", "SMS can only be sent to a mobile number")
+    }
+    
+    if !validator.IsValid() {
+        ns.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    messageID, err := ns.smsProvider.Send(ctx, to, req.Message)
+    if err != nil {
+        log.Printf("Failed to send SMS via %s: %v", ns.smsProvider.Name(), err)
+        ns.RespondWithError(w, http.StatusBadGateway, "SMS_ERROR", fmt.Sprintf("Failed to send SMS: %v", err))
+        return
+    }
+    
+    ns.RespondWithJSON(w, http.StatusOK, SMSResponse{
+        Status:    "sent",
+        MessageID: messageID,
+        Provider:  ns.smsProvider.Name(),
+        SentAt:    time.Now(),
+    })
+}
\ No newline at end of file
@@ -0,0 +1,321 @@
+// notification-service/subscriptions.go
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strconv"
+    "time"
+    
+    "github.com/gorilla/mux"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// Event types are lower-case dotted names such as invoice.sent or transaction.posted
+var eventTypePattern = regexp.MustCompile(`^[a-z_]+(\.[a-z_]+)+$`)
+
+// Subscription sends a company's events of one type to a webhook URL or an email address.
+// Secret is only returned when the subscription is created.
+type Subscription struct {
+    ID        int       `json:"id"`
+    EventType string    `json:"event_type"`
+    Channel   string    `json:"channel"`
+    URL       string    `json:"url,omitempty"`
+    Email     string    `json:"email,omitempty"`
+    Secret    string    `json:"secret,omitempty"`
+    IsActive  bool      `json:"is_active"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Event is the JSON payload webhooks receive
+type Event struct {
+    ID        string                 `json:"id"`
+    Type      string                 `json:"type"`
+    CompanyID int                    `json:"company_id"`
+    CreatedAt time.Time              `json:"created_at"`
+    Data      map[string]interface{} `json:"data"`
+}
+
+// Dispatch is where one event went: a webhook delivery, tracked at /deliveries/{id}, or a
+// queued email, tracked at /emails/{id}
+type Dispatch struct {
+    ID             string `json:"id"`
+    SubscriptionID int    `json:"subscription_id"`
+    Channel        string `json:"channel"`
+    Status         string `json:"status"`
+}
+
+func (ns *NotificationService) getSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+    rows, err := ns.DB.QueryContext(r.Context(), `
+        SELECT id, event_type, channel, COALESCE(url, ''), COALESCE(email, ''), is_active, created_at
+        FROM subscriptions WHERE company_id = $1 ORDER BY event_type, id`, ns.GetCompanyIDFromRequest(r))
+    if err != nil {
+        ns.HandleDBError(w, err, "Error fetching subscriptions")
+        return
+    }
+    defer rows.Close()
+    
+    subscriptions := []Subscription{}
+    for rows.Next() {
+        var subscription Subscription
+        if err := rows.Scan(&subscription.ID, &subscription.EventType, &subscription.Channel, &subscription.URL,
+            &subscription.Email, &subscription.IsActive, &subscription.CreatedAt); err != nil {
+            ns.HandleDBError(w, err, "Error fetching subscriptions")
+            return
+        }
+        subscriptions = append(subscriptions, subscription)
+    }
+    if err := rows.Err(); err != nil {
+        ns.HandleDBError(w, err, "Error fetching subscriptions")
+        return
+    }
+    
+    ns.RespondWithJSON(w, http.StatusOK, subscriptions)
+}
+
+// createSubscriptionHandler registers a webhook URL or email address for an event type. A
+// webhook gets a generated signing secret, returned only in this response.
+func (ns *NotificationService) createSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    var req Subscription
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        ns.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validator.Required("event_type", req.EventType)
+    if req.EventType != "" && !eventTypePattern.MatchString(req.EventType) {
+        validator.AddError("event_type", "Event type must be a dotted name such as invoice.sent")
+    }
+    validator.Required("channel", req.Channel)
+    validator.OneOf("channel", req.Channel, []string{"webhook", "email"})
+    switch req.Channel {
+    case "webhook":
+        req.Email = ""
+        validator.Required("url", req.URL)
+        if req.URL != "" {
+            target, err := url.Parse(req.URL)
+            if err != nil || target.Host == "" || (target.Scheme != "https" && !(ns.allowHTTPWebhooks && target.Scheme == "http")) {
+                validator.AddError("url", "URL must be an absolute https URL")
+            }
+        }
+    case "email":
+        req.URL = ""
+        validator.Required("email", req.Email)
+        validator.Email("email", req.Email)
+    }
+    
+    if !validator.IsValid() {
+        ns.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    var secret sql.NullString
+    if req.Channel == "webhook" {
+        b := make([]byte, 32)
+        if _, err := rand.Read(b); err != nil {
+            ns.RespondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Error generating webhook secret")
+            return
+        }
+        secret = sql.NullString{String: hex.EncodeToString(b), Valid: true}
+    }
+    
+    subscription := Subscription{
+        EventType: req.EventType,
+        Channel:   req.Channel,
+        URL:       req.URL,
+        Email:     req.Email,
+        Secret:    secret.String,
+        IsActive:  true,
+    }
+    err := ns.DB.QueryRowContext(ctx, `
+        INSERT INTO subscriptions (company_id, event_type, channel, url, email, secret)
+        VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6)
+        RETURNING id, created_at`,
+        ns.GetCompanyIDFromRequest(r), req.EventType, req.Channel, req.URL, req.Email, secret,
+    ).Scan(&subscription.ID, &subscription.CreatedAt)
+    if err != nil {
+        ns.HandleDBError(w, err, "Error creating subscription")
+        return
+    }
+    
+    ns.RespondWithJSON(w, http.StatusCreated, subscription)
+}
+
+// deleteSubscriptionHandler deactivates a subscription; deliveries still queued for it fail
+func (ns *NotificationService) deleteSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        ns.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid subscription ID")
+        return
+    }
+    
+    result, err := ns.DB.ExecContext(r.Context(), `
+        UPDATE subscriptions SET is_active = false, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND company_id = $2`, id, ns.GetCompanyIDFromRequest(r))
+    if err != nil {
+        ns.HandleDBError(w, err, "Error deleting subscription")
+        return
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        ns.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
+        return
+    }
+    
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// notifyHandler publishes an event to every active subscription of the caller's company for
+// its type: webhooks get the signed JSON event, email subscribers a rendered summary. It
+// answers 202 with where the event went; an event nobody subscribes to goes nowhere.
+func (ns *NotificationService) notifyHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+    
+    var req struct {
+        EventType string                 `json:"event_type"`
+        Data      map[string]interface{} `json:"data"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        ns.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validator.Required("event_type", req.EventType)
+    if req.EventType != "" && !eventTypePattern.MatchString(req.EventType) {
+        validator.AddError("event_type", "Event type must be a dotted name such as invoice.sent")
+    }
+    if !validator.IsValid() {
+        ns.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    eventID, err := newMessageID()
+    if err != nil {
+        ns.RespondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Error creating event")
+        return
+    }
+    event := Event{
+        ID:        eventID,
+        Type:      req.EventType,
+        CompanyID: ns.GetCompanyIDFromRequest(r),
+        CreatedAt: time.Now(),
+        Data:      req.Data,
+    }
+    payload, err := json.Marshal(event)
+    if err != nil {
+        ns.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Event data cannot be encoded")
+        return
+    }
+    
+    rows, err := ns.DB.QueryContext(ctx, `
+        SELECT id, channel, COALESCE(email, '') FROM subscriptions
+        WHERE company_id = $1 AND event_type = $2 AND is_active = true ORDER BY id`,
+        event.CompanyID, event.Type)
+    if err != nil {
+        ns.HandleDBError(w, err, "Error fetching subscriptions")
+        return
+    }
+    var webhooks, emails []Subscription
+    for rows.Next() {
+        var subscription Subscription
+        if err := rows.Scan(&subscription.ID, &subscription.Channel, &subscription.Email); err != nil {
+            rows.Close()
+            ns.HandleDBError(w, err, "Error fetching subscriptions")
+            return
+        }
+        if subscription.Channel == "email" {
+            emails = append(emails, subscription)
+        } else {
+            webhooks = append(webhooks, subscription)
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        ns.HandleDBError(w, err, "Error fetching subscriptions")
+        return
+    }
+    
+    var emailBody string
+    if len(emails) > 0 {
+        branding, err := ns.loadBranding(ctx, event.CompanyID)
+        if err != nil {
+            ns.HandleDBError(w, err, "Error loading branding")
+            return
+        }
+        emailBody, err = ns.emailService.renderTemplate(event.CompanyID, "event", map[string]interface{}{
+            "EventType": event.Type,
+            "EventID":   event.ID,
+            "Data":      event.Data,
+        }, branding)
+        if err != nil {
+            ns.RespondWithError(w, http.StatusInternalServerError, "TEMPLATE_ERROR", "Error rendering template")
+            return
+        }
+    }
+    
+    tx, err := ns.DB.BeginTx(ctx, nil)
+    if err != nil {
+        ns.HandleDBError(w, err, "Error queueing notifications")
+        return
+    }
+    defer tx.Rollback()
+    
+    dispatches := []Dispatch{}
+    for _, subscription := range webhooks {
+        delivery, err := ns.webhooks.Enqueue(ctx, tx, subscription.ID, event.CompanyID, event.ID, event.Type, string(payload))
+        if err != nil {
+            ns.HandleDBError(w, err, "Error queueing notifications")
+            return
+        }
+        dispatches = append(dispatches, Dispatch{delivery.ID, subscription.ID, "webhook", delivery.Status})
+    }
+    if err := tx.Commit(); err != nil {
+        ns.HandleDBError(w, err, "Error queueing notifications")
+        return
+    }
+    ns.webhooks.Notify()
+    
+    // Emails go through the email queue, which commits each on its own
+    for _, subscription := range emails {
+        status, err := ns.queue.Enqueue(ctx, event.CompanyID, subscription.Email, "Notification: "+event.Type, emailBody, nil)
+        if err != nil {
+            ns.HandleDBError(w, err, "Error queueing notifications")
+            return
+        }
+        dispatches = append(dispatches, Dispatch{status.ID, subscription.ID, "email", status.Status})
+    }
+    
+    ns.RespondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+        "event_id":   event.ID,
+        "event_type": event.Type,
+        "dispatches": dispatches,
+    })
+}
+
+func (ns *NotificationService) getDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+    delivery, err := ns.webhooks.Status(r.Context(), ns.GetCompanyIDFromRequest(r), mux.Vars(r)["id"])
+    if errors.Is(err, errDeliveryNotFound) {
+        ns.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Delivery not found")
+        return
+    }
+    if err != nil {
+        ns.HandleDBError(w, err, "Failed to load delivery status")
+        return
+    }
+    
+    ns.RespondWithJSON(w, http.StatusOK, delivery)
+}
\ No newline at end of file
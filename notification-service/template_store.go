@@ -0,0 +1,301 @@
+// notification-service/template_store.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "html/template"
+    "log"
+    "net/http"
+    "regexp"
+    "sort"
+    "time"
+    
+    "github.com/gorilla/mux"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// templateStoreLock is the advisory lock namespace serialising template changes per company
+const templateStoreLock = 72657003
+
+// maxTemplateBytes caps the source of a stored template
+const maxTemplateBytes = 100000
+
+// templateNamePattern allows names usable as file names; a leading underscore makes a partial
+var templateNamePattern = regexp.MustCompile(`^_?[a-z0-9][a-z0-9_-]*$`)
+
+// EmailTemplate is a template available to the company. Custom ones are stored for the
+// company; the rest are built in or come from EMAIL_TEMPLATE_DIR.
+type EmailTemplate struct {
+    Name      string     `json:"name"`
+    Source    string     `json:"source,omitempty"`
+    Custom    bool       `json:"custom"`
+    UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// loadStoredTemplates compiles every company's stored templates, replacing those in use. A
+// company whose templates no longer compile, e.g. after a built-in partial they rely on
+// changed, keeps the built-in ones and the error is logged.
+func (ns *NotificationService) loadStoredTemplates(ctx context.Context) error {
+    rows, err := ns.DB.QueryContext(ctx, "SELECT company_id, name, source FROM email_templates")
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    
+    stored := make(map[int]map[string]string)
+    for rows.Next() {
+        var companyID int
+        var name, source string
+        if err := rows.Scan(&companyID, &name, &source); err != nil {
+            return err
+        }
+        if stored[companyID] == nil {
+            stored[companyID] = make(map[string]string)
+        }
+        stored[companyID][name] = source
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    
+    compiled := make(map[int]map[string]*template.Template, len(stored))
+    for companyID, sources := range stored {
+        templates, err := ns.emailService.compileCompanyTemplates(sources)
+        if err != nil {
+            log.Printf("Stored email templates of company %d do not compile, using the built-in ones: %v", companyID, err)
+            continue
+        }
+        compiled[companyID] = templates
+    }
+    
+    ns.emailService.templatesMu.Lock()
+    ns.emailService.companyTemplates = compiled
+    ns.emailService.templatesMu.Unlock()
+    return nil
+}
+
+// getStoredTemplatesHandler lists the templates and partials the company's emails use, marking
+// the ones it has customised
+func (ns *NotificationService) getStoredTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    rows, err := ns.DB.QueryContext(ctx,
+        "SELECT name, updated_at FROM email_templates WHERE company_id = $1", ns.GetCompanyIDFromRequest(r))
+    if err != nil {
+        ns.HandleDBError(w, err, "Error fetching email templates")
+        return
+    }
+    defer rows.Close()
+    
+    byName := make(map[string]EmailTemplate)
+    for rows.Next() {
+        var tmpl EmailTemplate
+        var updatedAt time.Time
+        if err := rows.Scan(&tmpl.Name, &updatedAt); err != nil {
+            ns.HandleDBError(w, err, "Error fetching email templates")
+            return
+        }
+        tmpl.Custom = true
+        tmpl.UpdatedAt = &updatedAt
+        byName[tmpl.Name] = tmpl
+    }
+    if err := rows.Err(); err != nil {
+        ns.HandleDBError(w, err, "Error fetching email templates")
+        return
+    }
+    
+    ns.emailService.templatesMu.RLock()
+    for name := range ns.emailService.templateSources {
+        if _, ok := byName[name]; !ok {
+            byName[name] = EmailTemplate{Name: name}
+        }
+    }
+    ns.emailService.templatesMu.RUnlock()
+    
+    templates := make([]EmailTemplate, 0, len(byName))
+    for _, tmpl := range byName {
+        templates = append(templates, tmpl)
+    }
+    sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+    
+    ns.RespondWithJSON(w, http.StatusOK, templates)
+}
+
+// getTemplateHandler returns a template's source: the company's own if it has one, otherwise
+// the built-in one
+func (ns *NotificationService) getTemplateHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    tmpl := EmailTemplate{Name: mux.Vars(r)["name"]}
+    var updatedAt time.Time
+    err := ns.DB.QueryRowContext(ctx,
+        "SELECT source, updated_at FROM email_templates WHERE company_id = $1 AND name = $2",
+        ns.GetCompanyIDFromRequest(r), tmpl.Name).Scan(&tmpl.Source, &updatedAt)
+    if err == nil {
+        tmpl.Custom = true
+        tmpl.UpdatedAt = &updatedAt
+        ns.RespondWithJSON(w, http.StatusOK, tmpl)
+        return
+    }
+    if err != sql.ErrNoRows {
+        ns.HandleDBError(w, err, "Error fetching email template")
+        return
+    }
+    
+    ns.emailService.templatesMu.RLock()
+    source, ok := ns.emailService.templateSources[tmpl.Name]
+    ns.emailService.templatesMu.RUnlock()
+    if !ok {
+        ns.RespondWithError(w, http.StatusNotFound, "TEMPLATE_NOT_FOUND", "Email template not found")
+        return
+    }
+    tmpl.Source = source
+    
+    ns.RespondWithJSON(w, http.StatusOK, tmpl)
+}
+
+// createTemplateHandler adds a template for the company. Naming it after a built-in one
+// customises that template; a name the company has already stored is a conflict.
+func (ns *NotificationService) createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Name   string `json:"name"`
+        Source string `json:"source"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, maxTemplateBytes+service.DefaultMaxBodyBytes); err != nil {
+        ns.RespondWithBodyError(w, err)
+        return
+    }
+    ns.saveTemplate(w, r, req.Name, req.Source, true)
+}
+
+// updateTemplateHandler replaces the company's template, storing it if it was built in
+func (ns *NotificationService) updateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Source string `json:"source"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, maxTemplateBytes+service.DefaultMaxBodyBytes); err != nil {
+        ns.RespondWithBodyError(w, err)
+        return
+    }
+    ns.saveTemplate(w, r, mux.Vars(r)["name"], req.Source, false)
+}
+
+// saveTemplate stores a template once the company's templates compile with it, then puts it
+// in use. Pages must define content and may use the partials; partials must keep the layout.
+func (ns *NotificationService) saveTemplate(w http.ResponseWriter, r *http.Request, name, source string, create bool) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    validator := validation.New()
+    validator.Required("name", name)
+    validator.MaxLength("name", name, 100)
+    if name != "" && !templateNamePattern.MatchString(name) {
+        validator.AddError("name", "Name may only contain lowercase letters, digits, hyphens and underscores")
+    }
+    validator.Required("source", source)
+    validator.MaxLength("source", source, maxTemplateBytes)
+    if !validator.IsValid() {
+        ns.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    companyID := ns.GetCompanyIDFromRequest(r)
+    
+    tx, err := ns.DB.BeginTx(ctx, nil)
+    if err != nil {
+        ns.HandleDBError(w, err, "Error saving email template")
+        return
+    }
+    defer tx.Rollback()
+    
+    if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, $2)", templateStoreLock, companyID); err != nil {
+        ns.HandleDBError(w, err, "Error saving email template")
+        return
+    }
+    
+    rows, err := tx.QueryContext(ctx, "SELECT name, source FROM email_templates WHERE company_id = $1", companyID)
+    if err != nil {
+        ns.HandleDBError(w, err, "Error saving email template")
+        return
+    }
+    stored := make(map[string]string)
+    for rows.Next() {
+        var storedName, storedSource string
+        if err := rows.Scan(&storedName, &storedSource); err != nil {
+            rows.Close()
+            ns.HandleDBError(w, err, "Error saving email template")
+            return
+        }
+        stored[storedName] = storedSource
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        ns.HandleDBError(w, err, "Error saving email template")
+        return
+    }
+    
+    if _, exists := stored[name]; exists && create {
+        ns.RespondWithError(w, http.StatusConflict, "TEMPLATE_EXISTS", "Email template already exists; update it instead")
+        return
+    }
+    stored[name] = source
+    if _, err := ns.emailService.compileCompanyTemplates(stored); err != nil {
+        validator.AddError("source", err.Error())
+        ns.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    tmpl := EmailTemplate{Name: name, Source: source, Custom: true}
+    var updatedAt time.Time
+    err = tx.QueryRowContext(ctx, `
+        INSERT INTO email_templates (company_id, name, source)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (company_id, name) DO UPDATE
+        SET source = EXCLUDED.source, updated_at = CURRENT_TIMESTAMP
+        RETURNING updated_at`, companyID, name, source).Scan(&updatedAt)
+    if err != nil {
+        ns.HandleDBError(w, err, "Error saving email template")
+        return
+    }
+    tmpl.UpdatedAt = &updatedAt
+    
+    if err := tx.Commit(); err != nil {
+        ns.HandleDBError(w, err, "Error saving email template")
+        return
+    }
+    if err := ns.emailService.setCompanyTemplates(companyID, stored); err != nil {
+        log.Printf("Failed to apply email templates of company %d: %v", companyID, err)
+    }
+    
+    status := http.StatusOK
+    if create {
+        status = http.StatusCreated
+    }
+    ns.RespondWithJSON(w, status, tmpl)
+}
+
+// refreshTemplatesHandler reloads EMAIL_TEMPLATE_DIR and the stored templates, picking up
+// files changed on disk and templates saved through another instance
+func (ns *NotificationService) refreshTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+    
+    if err := ns.emailService.loadTemplates(ns.emailService.templateDir); err != nil {
+        log.Printf("Failed to reload email templates: %v", err)
+        ns.RespondWithError(w, http.StatusInternalServerError, "TEMPLATE_ERROR", "Error reloading email templates")
+        return
+    }
+    if err := ns.loadStoredTemplates(ctx); err != nil {
+        ns.HandleDBError(w, err, "Error reloading email templates")
+        return
+    }
+    
+    ns.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+        "templates": ns.emailService.templateNames(ns.GetCompanyIDFromRequest(r)),
+    })
+}
\ No newline at end of file
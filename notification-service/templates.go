@@ -0,0 +1,245 @@
+// notification-service/templates.go
+package main
+
+import (
+    "embed"
+    "fmt"
+    "html/template"
+    "io/fs"
+    "os"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+// embeddedTemplates are the built-in emails. Each page defines "content", which the "layout"
+// from _layout.html wraps in the company's branding; files starting with an underscore are
+// partials shared by every page rather than templates of their own.
+//
+//go:embed templates/*.html
+var embeddedTemplates embed.FS
+
+// templateFuncs are available to every template, e.g. {{rupiah .TotalAmount}} for
+// "Rp 15.000.000" and {{idDate .DueDate}} for "31/12/2024"
+var templateFuncs = template.FuncMap{
+    "rupiah": templateRupiah,
+    "idDate": templateIndonesianDate,
+}
+
+// templateRupiah formats a number, or a string holding one, as Rupiah. Anything else, such as
+// an amount the caller already formatted, is shown as it is.
+func templateRupiah(value interface{}) string {
+    switch v := value.(type) {
+    case nil:
+        return ""
+    case float64:
+        return service.FormatRupiah(v)
+    case int:
+        return service.FormatRupiah(float64(v))
+    case int64:
+        return service.FormatRupiah(float64(v))
+    case service.Rupiah:
+        return v.String()
+    case string:
+        if amount, err := strconv.ParseFloat(v, 64); err == nil {
+            return service.FormatRupiah(amount)
+        }
+        return v
+    }
+    return fmt.Sprint(value)
+}
+
+// templateIndonesianDate formats a time, or an RFC 3339 or YYYY-MM-DD string, as DD/MM/YYYY
+// in Jakarta time. Other strings are shown as they are.
+func templateIndonesianDate(value interface{}) string {
+    switch v := value.(type) {
+    case nil:
+        return ""
+    case time.Time:
+        return service.NewJakartaTime(v).String()
+    case service.JakartaTime:
+        return v.String()
+    case string:
+        if t, err := time.Parse(time.RFC3339, v); err == nil {
+            return service.NewJakartaTime(t).String()
+        }
+        if t, err := time.Parse("2006-01-02", v); err == nil {
+            return service.FormatIndonesianDate(t)
+        }
+        return v
+    }
+    return fmt.Sprint(value)
+}
+
+// TemplateNotFoundError names a template that does not exist and the ones that do
+type TemplateNotFoundError struct {
+    Name      string
+    Available []string
+}
+
+func (e *TemplateNotFoundError) Error() string {
+    return fmt.Sprintf("template %q not found; available templates: %s", e.Name, strings.Join(e.Available, ", "))
+}
+
+// loadTemplates parses the embedded templates, then those in dir if one is given. A file in
+// dir replaces the built-in template or partial of the same name, so templates can be added
+// or restyled without rebuilding the service.
+func (es *EmailService) loadTemplates(dir string) error {
+    sources := make(map[string]string)
+    if err := readTemplateSources(embeddedTemplates, "templates", sources); err != nil {
+        return err
+    }
+    if dir != "" {
+        if err := readTemplateSources(os.DirFS(dir), ".", sources); err != nil {
+            return err
+        }
+    }
+    
+    templates, err := compileTemplates(sources)
+    if err != nil {
+        return err
+    }
+    es.templatesMu.Lock()
+    defer es.templatesMu.Unlock()
+    es.templateSources = sources
+    es.templates = templates
+    return nil
+}
+
+// setCompanyTemplates compiles a company's stored templates over the service's own, which
+// they replace by name. With no stored templates the company goes back to the service's.
+func (es *EmailService) setCompanyTemplates(companyID int, stored map[string]string) error {
+    if len(stored) == 0 {
+        es.templatesMu.Lock()
+        delete(es.companyTemplates, companyID)
+        es.templatesMu.Unlock()
+        return nil
+    }
+    
+    templates, err := es.compileCompanyTemplates(stored)
+    if err != nil {
+        return err
+    }
+    es.templatesMu.Lock()
+    defer es.templatesMu.Unlock()
+    es.companyTemplates[companyID] = templates
+    return nil
+}
+
+// compileCompanyTemplates parses stored templates together with the service's own, so a
+// stored page can use the built-in layout and a stored layout applies to built-in pages
+func (es *EmailService) compileCompanyTemplates(stored map[string]string) (map[string]*template.Template, error) {
+    es.templatesMu.RLock()
+    sources := make(map[string]string, len(es.templateSources)+len(stored))
+    for name, source := range es.templateSources {
+        sources[name] = source
+    }
+    es.templatesMu.RUnlock()
+    for name, source := range stored {
+        sources[name] = source
+    }
+    return compileTemplates(sources)
+}
+
+// compileTemplates parses each page in sources with all of the partials
+func compileTemplates(sources map[string]string) (map[string]*template.Template, error) {
+    base := template.New("").Funcs(templateFuncs)
+    for name, source := range sources {
+        if !strings.HasPrefix(name, "_") {
+            continue
+        }
+        if _, err := base.New(name).Parse(source); err != nil {
+            return nil, fmt.Errorf("failed to parse template %s: %v", name, err)
+        }
+    }
+    if base.Lookup("layout") == nil {
+        return nil, fmt.Errorf("no template defines the layout")
+    }
+    
+    templates := make(map[string]*template.Template)
+    for name, source := range sources {
+        if strings.HasPrefix(name, "_") {
+            continue
+        }
+        page, err := base.Clone()
+        if err != nil {
+            return nil, err
+        }
+        if _, err := page.New(name).Parse(source); err != nil {
+            return nil, fmt.Errorf("failed to parse template %s: %v", name, err)
+        }
+        if page.Lookup("content") == nil {
+            return nil, fmt.Errorf("template %s does not define content", name)
+        }
+        templates[name] = page
+    }
+    
+    return templates, nil
+}
+
+// readTemplateSources adds the .html files directly in dir to sources, keyed by name without
+// the extension
+func readTemplateSources(fsys fs.FS, dir string, sources map[string]string) error {
+    entries, err := fs.ReadDir(fsys, dir)
+    if err != nil {
+        return fmt.Errorf("failed to read templates: %v", err)
+    }
+    for _, entry := range entries {
+        if entry.IsDir() || path.Ext(entry.Name()) != ".html" {
+            continue
+        }
+        content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+        if err != nil {
+            return fmt.Errorf("failed to read template %s: %v", entry.Name(), err)
+        }
+        sources[strings.TrimSuffix(entry.Name(), ".html")] = string(content)
+    }
+    return nil
+}
+
+// companyTemplateSet is the templates the company's emails are rendered with
+func (es *EmailService) companyTemplateSet(companyID int) map[string]*template.Template {
+    es.templatesMu.RLock()
+    defer es.templatesMu.RUnlock()
+    if templates, ok := es.companyTemplates[companyID]; ok {
+        return templates
+    }
+    return es.templates
+}
+
+// templateNames lists the templates the company can request, sorted
+func (es *EmailService) templateNames(companyID int) []string {
+    templates := es.companyTemplateSet(companyID)
+    names := make([]string, 0, len(templates))
+    for name := range templates {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// renderTemplate renders one of the company's templates with the request data and the
+// company's branding, which the templates read as .Branding
+func (es *EmailService) renderTemplate(companyID int, templateName string, data map[string]interface{}, branding Branding) (string, error) {
+    tmpl, exists := es.companyTemplateSet(companyID)[templateName]
+    if !exists {
+        return "", &TemplateNotFoundError{Name: templateName, Available: es.templateNames(companyID)}
+    }
+    
+    values := make(map[string]interface{}, len(data)+1)
+    for key, value := range data {
+        values[key] = value
+    }
+    if branding.CompanyName == "" {
+        branding.CompanyName, _ = data["CompanyName"].(string)
+    }
+    values["Branding"] = branding
+    
+    var body strings.Builder
+    err := tmpl.ExecuteTemplate(&body, "layout", values)
+    return body.String(), err
+}
\ No newline at end of file
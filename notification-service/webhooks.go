@@ -0,0 +1,255 @@
+// notification-service/webhooks.go
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+const webhookTimeout = 15 * time.Second
+
+var errDeliveryNotFound = errors.New("delivery not found")
+
+// WebhookDelivery is the state of one event sent to one webhook subscription
+type WebhookDelivery struct {
+    ID             string     `json:"id"`
+    SubscriptionID int        `json:"subscription_id"`
+    EventID        string     `json:"event_id"`
+    EventType      string     `json:"event_type"`
+    Status         string     `json:"status"`
+    Attempts       int        `json:"attempts"`
+    MaxAttempts    int        `json:"max_attempts"`
+    ResponseStatus *int       `json:"response_status,omitempty"`
+    LastError      string     `json:"last_error,omitempty"`
+    NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+    DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookQueue posts event payloads to subscribers' URLs, retrying failures with the same
+// backoff as emails. Each request is signed so subscribers can tell it came from us.
+type WebhookQueue struct {
+    db          *sql.DB
+    client      *http.Client
+    maxAttempts int
+    wake        chan struct{}
+}
+
+func NewWebhookQueue(db *sql.DB, maxAttempts int) *WebhookQueue {
+    return &WebhookQueue{
+        db:          db,
+        client:      &http.Client{Timeout: webhookTimeout},
+        maxAttempts: maxAttempts,
+        wake:        make(chan struct{}, 1),
+    }
+}
+
+// Enqueue stores a delivery of payload to a subscription within tx
+func (q *WebhookQueue) Enqueue(ctx context.Context, tx *sql.Tx, subscriptionID, companyID int, eventID, eventType, payload string) (WebhookDelivery, error) {
+    id, err := newMessageID()
+    if err != nil {
+        return WebhookDelivery{}, err
+    }
+    
+    delivery := WebhookDelivery{
+        ID:             id,
+        SubscriptionID: subscriptionID,
+        EventID:        eventID,
+        EventType:      eventType,
+        Status:         "queued",
+        MaxAttempts:    q.maxAttempts,
+    }
+    err = tx.QueryRowContext(ctx, `
+        INSERT INTO webhook_deliveries (id, subscription_id, company_id, event_id, event_type, payload, max_attempts)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING created_at`,
+        id, subscriptionID, companyID, eventID, eventType, payload, q.maxAttempts).Scan(&delivery.CreatedAt)
+    return delivery, err
+}
+
+// Notify wakes an idle worker once queued deliveries are committed
+func (q *WebhookQueue) Notify() {
+    select {
+    case q.wake <- struct{}{}:
+    default:
+    }
+}
+
+// Status returns a delivery belonging to the company
+func (q *WebhookQueue) Status(ctx context.Context, companyID int, id string) (WebhookDelivery, error) {
+    var delivery WebhookDelivery
+    var responseStatus sql.NullInt64
+    var lastError sql.NullString
+    var nextAttemptAt time.Time
+    err := q.db.QueryRowContext(ctx, `
+        SELECT id, subscription_id, event_id, event_type, status, attempts, max_attempts,
+               response_status, last_error, next_attempt_at, created_at, delivered_at
+        FROM webhook_deliveries WHERE id = $1 AND company_id = $2`, id, companyID).Scan(
+        &delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Status,
+        &delivery.Attempts, &delivery.MaxAttempts, &responseStatus, &lastError, &nextAttemptAt,
+        &delivery.CreatedAt, &delivery.DeliveredAt)
+    if err == sql.ErrNoRows {
+        return WebhookDelivery{}, errDeliveryNotFound
+    }
+    if err != nil {
+        return WebhookDelivery{}, err
+    }
+    if responseStatus.Valid {
+        status := int(responseStatus.Int64)
+        delivery.ResponseStatus = &status
+    }
+    delivery.LastError = lastError.String
+    if delivery.Status == "queued" {
+        delivery.NextAttemptAt = &nextAttemptAt
+    }
+    return delivery, nil
+}
+
+// Start runs workers until ctx is cancelled
+func (q *WebhookQueue) Start(ctx context.Context, workers int) {
+    for i := 0; i < workers; i++ {
+        go q.work(ctx)
+    }
+}
+
+func (q *WebhookQueue) work(ctx context.Context) {
+    ticker := time.NewTicker(emailPollInterval)
+    defer ticker.Stop()
+
+    for {
+        for {
+            delivered, err := q.deliverNext(ctx)
+            if err != nil {
+                log.Printf("Webhook queue error: %v", err)
+            }
+            if !delivered || err != nil {
+                break
+            }
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        case <-q.wake:
+        }
+    }
+}
+
+// deliverNext claims the next due delivery and posts it. It reports false when nothing was
+// due. A subscription deactivated since the event fails its pending deliveries.
+func (q *WebhookQueue) deliverNext(ctx context.Context) (bool, error) {
+    var id, eventID, eventType, payload string
+    var attempts, maxAttempts int
+    var url, secret sql.NullString
+    var active bool
+    err := q.db.QueryRowContext(ctx, `
+        WITH claimed AS (
+            UPDATE webhook_deliveries
+            SET attempts = attempts + 1,
+                next_attempt_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second',
+                updated_at = CURRENT_TIMESTAMP
+            WHERE id = (
+                SELECT id FROM webhook_deliveries
+                WHERE status = 'queued' AND next_attempt_at <= CURRENT_TIMESTAMP
+                ORDER BY next_attempt_at
+                LIMIT 1
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING id, subscription_id, event_id, event_type, payload, attempts, max_attempts
+        )
+        SELECT c.id, c.event_id, c.event_type, c.payload, c.attempts, c.max_attempts, s.url, s.secret, s.is_active
+        FROM claimed c JOIN subscriptions s ON s.id = c.subscription_id`,
+        int(emailLease.Seconds())).Scan(&id, &eventID, &eventType, &payload, &attempts, &maxAttempts, &url, &secret, &active)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    if !active {
+        _, err = q.db.ExecContext(ctx, `
+            UPDATE webhook_deliveries
+            SET status = 'failed', last_error = 'subscription is inactive', updated_at = CURRENT_TIMESTAMP
+            WHERE id = $1`, id)
+        return true, err
+    }
+
+    responseStatus, sendErr := q.post(ctx, url.String, secret.String, id, eventType, payload)
+    status := sql.NullInt64{Int64: int64(responseStatus), Valid: responseStatus != 0}
+
+    if sendErr == nil {
+        _, err = q.db.ExecContext(ctx, `
+            UPDATE webhook_deliveries
+            SET status = 'delivered', response_status = $2, last_error = NULL,
+                delivered_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $1`, id, status)
+        return true, err
+    }
+
+    if attempts >= maxAttempts {
+        log.Printf("Webhook delivery %s of event %s failed after %d attempts: %v", id, eventID, attempts, sendErr)
+        _, err = q.db.ExecContext(ctx, `
+            UPDATE webhook_deliveries
+            SET status = 'failed', response_status = $2, last_error = $3, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $1`, id, status, sendErr.Error())
+        return true, err
+    }
+
+    _, err = q.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET response_status = $2, last_error = $3,
+            next_attempt_at = CURRENT_TIMESTAMP + $4 * INTERVAL '1 second', updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1`, id, status, sendErr.Error(), int(retryBackoff(attempts).Seconds()))
+    return true, err
+}
+
+// post sends the payload and returns the response status. Anything but a 2xx is a failure.
+func (q *WebhookQueue) post(ctx context.Context, url, secret, deliveryID, eventType, payload string) (int, error) {
+    ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+    defer cancel()
+    
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBufferString(payload))
+    if err != nil {
+        return 0, err
+    }
+    timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "accounting-system-webhooks")
+    req.Header.Set("X-Webhook-ID", deliveryID)
+    req.Header.Set("X-Webhook-Event", eventType)
+    req.Header.Set("X-Webhook-Timestamp", timestamp)
+    req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(secret, timestamp, payload))
+    
+    resp, err := q.client.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+    
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return resp.StatusCode, fmt.Errorf("subscriber answered %d", resp.StatusCode)
+    }
+    return resp.StatusCode, nil
+}
+
+// signWebhook is the hex HMAC-SHA256 of "timestamp.payload" under the subscription secret.
+// Signing the timestamp lets subscribers reject replays of old deliveries.
+func signWebhook(secret, timestamp, payload string) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(timestamp + "." + payload))
+    return hex.EncodeToString(mac.Sum(nil))
+}
\ No newline at end of file
@@ -1,15 +1,20 @@
-// report-service/main.go - DECOUPLED VERSION
+// report-service/main.go
 package main
 
 import (
     "context"
     "encoding/json"
     "net/http"
+    "net/url"
+    "os"
+    "sort"
     "time"
     
     "github.com/gorilla/mux"
     
+    "github.com/massehanto/accounting-system-go/shared/client"
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
     "github.com/massehanto/accounting-system-go/shared/service"
@@ -18,12 +23,85 @@ import (
 
 type ReportService struct {
     *service.BaseService
+    accountClient *client.Client
+    invoiceClient *client.Client
+    vendorClient  *client.Client
+}
+
+type Account struct {
+    ID          int     `json:"id"`
+    AccountCode string  `json:"account_code"`
+    AccountName string  `json:"account_name"`
+    AccountType string  `json:"account_type"`
+    IsActive    bool    `json:"is_active"`
+    Balance     float64 `json:"balance"`
+}
+
+type ReportLine struct {
+    AccountID     int      `json:"account_id"`
+    AccountCode   string   `json:"account_code"`
+    AccountName   string   `json:"account_name"`
+    Amount        float64  `json:"amount"`
+    PriorAmount   *float64 `json:"prior_amount,omitempty"`
+    Change        *float64 `json:"change,omitempty"`
+    ChangePercent *float64 `json:"change_percent,omitempty"`
+}
+
+// Comparison is a report total for the current period next to the comparative period
+type Comparison struct {
+    Current       float64  `json:"current"`
+    Prior         float64  `json:"prior"`
+    Change        float64  `json:"change"`
+    ChangePercent *float64 `json:"change_percent"`
+}
+
+type Invoice struct {
+    ID            int       `json:"id"`
+    CustomerID    int       `json:"customer_id"`
+    InvoiceNumber string    `json:"invoice_number"`
+    InvoiceDate   time.Time `json:"invoice_date"`
+    DueDate       time.Time `json:"due_date"`
+    Subtotal      float64   `json:"subtotal"`
+    TaxAmount     float64   `json:"tax_amount"`
+    TotalAmount   float64   `json:"total_amount"`
+    AmountPaid    float64   `json:"amount_paid"`
+    Status        string    `json:"status"`
+    Customer      *struct {
+        Name string `json:"name"`
+    } `json:"customer,omitempty"`
+}
+
+// AgingBuckets splits outstanding balances by days past due
+type AgingBuckets struct {
+    Current    float64 `json:"current"`
+    Days1To30  float64 `json:"days_1_30"`
+    Days31To60 float64 `json:"days_31_60"`
+    Days61To90 float64 `json:"days_61_90"`
+    Over90     float64 `json:"over_90"`
+    Total      float64 `json:"total"`
+}
+
+type CustomerAging struct {
+    CustomerID   int    `json:"customer_id"`
+    CustomerName string `json:"customer_name"`
+    InvoiceCount int    `json:"invoice_count"`
+    AgingBuckets
+}
+
+type AgedReceivablesReport struct {
+    CompanyID   int             `json:"company_id"`
+    AsOf        string          `json:"as_of"`
+    Customers   []CustomerAging `json:"customers"`
+    Totals      AgingBuckets    `json:"totals"`
+    GeneratedAt time.Time       `json:"generated_at"`
 }
 
 type ReportRequest struct {
-    ReportType string `json:"report_type"`
-    StartDate  string `json:"start_date"`
-    EndDate    string `json:"end_date"`
+    ReportType   string `json:"report_type"`
+    StartDate    string `json:"start_date"`
+    EndDate      string `json:"end_date"`
+    CompareStart string `json:"compare_start,omitempty"`
+    CompareEnd   string `json:"compare_end,omitempty"`
 }
 
 type FinancialReport struct {
@@ -32,21 +110,36 @@ type FinancialReport struct {
     Period      string                 `json:"period"`
     Data        map[string]interface{} `json:"data"`
     GeneratedAt time.Time              `json:"generated_at"`
-    Message     string                 `json:"message"`
+    Message     string                 `json:"message,omitempty"`
 }
 
 func main() {
+    logger.Init("report-service")
+    
     cfg := config.Load()
     
     reportService := &ReportService{
-        BaseService: &service.BaseService{DB: nil},
+        BaseService:   &service.BaseService{DB: nil},
+        accountClient: client.New(getEnv("ACCOUNT_SERVICE_URL", "http://localhost:8002")),
+        invoiceClient: client.New(getEnv("INVOICE_SERVICE_URL", "http://localhost:8004")),
+        vendorClient:  client.New(getEnv("VENDOR_SERVICE_URL", "http://localhost:8005")),
     }
     
     r := mux.NewRouter()
     authMiddleware := middleware.NewAuthMiddleware(cfg.JWT.Secret)
     
     r.Handle("/health", middleware.HealthCheck(nil, "report-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName: "report-service",
+        Dependencies: map[string]middleware.Pinger{
+            "account-service": reportService.accountClient,
+            "invoice-service": reportService.invoiceClient,
+            "vendor-service":  reportService.vendorClient,
+        },
+    })).Methods("GET")
     r.Handle("/reports/generate", authMiddleware(reportService.generateReportHandler)).Methods("POST")
+    r.Handle("/reports/aged-receivables", authMiddleware(reportService.agedReceivablesHandler)).Methods("GET")
+    r.Handle("/reports/tax-summary", authMiddleware(reportService.taxSummaryHandler)).Methods("GET")
 
     server.SetupServer(r, cfg)
 }
@@ -66,6 +159,15 @@ func (s *ReportService) generateReportHandler(w http.ResponseWriter, r *http.Req
     validTypes := []string{"balance_sheet", "income_statement", "trial_balance"}
     validator.OneOf("report_type", req.ReportType, validTypes)
 
+    comparing := req.CompareStart != "" || req.CompareEnd != ""
+    if comparing {
+        validator.Required("compare_start", req.CompareStart)
+        validator.Required("compare_end", req.CompareEnd)
+        if req.ReportType == "trial_balance" {
+            validator.AddError("compare_start", "Comparative periods are not supported for trial balance")
+        }
+    }
+
     if !validator.IsValid() {
         s.RespondValidationError(w, validator.Errors())
         return
@@ -73,23 +175,331 @@ func (s *ReportService) generateReportHandler(w http.ResponseWriter, r *http.Req
 
     companyID := s.GetCompanyIDFromRequest(r)
 
-    // In a properly decoupled architecture, this would:
-    // 1. Query a read-only reporting database
-    // 2. Use cached/materialized views
-    // 3. Consume events from other services
-    
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+
+    // Income statements cover the period; balance sheets and trial balances are as of its end
+    periodStart, compareStart := "", ""
+    if req.ReportType == "income_statement" {
+        periodStart, compareStart = req.StartDate, req.CompareStart
+    }
+
+    accounts, err := s.fetchAccountData(ctx, r, periodStart, req.EndDate)
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadGateway, "UPSTREAM_ERROR", "Error fetching account data")
+        return
+    }
+
+    var prior []Account
+    if comparing {
+        prior, err = s.fetchAccountData(ctx, r, compareStart, req.CompareEnd)
+        if err != nil {
+            s.RespondWithError(w, http.StatusBadGateway, "UPSTREAM_ERROR", "Error fetching comparative account data")
+            return
+        }
+        // A prior period without accounts decodes to nil, which would drop the comparison;
+        // it is compared against zero like any account missing from the prior period
+        if prior == nil {
+            prior = []Account{}
+        }
+    }
+
+    var data map[string]interface{}
+    switch req.ReportType {
+    case "balance_sheet":
+        data = generateBalanceSheet(accounts, prior)
+    case "income_statement":
+        data = generateIncomeStatement(accounts, prior)
+    case "trial_balance":
+        data = generateTrialBalance(accounts)
+    }
+    if comparing {
+        data["compare_period"] = req.CompareStart + " to " + req.CompareEnd
+    }
+
     report := &FinancialReport{
         ReportType:  req.ReportType,
         CompanyID:   companyID,
         Period:      req.StartDate + " to " + req.EndDate,
         GeneratedAt: time.Now(),
-        Message:     "This is a sample report. In production, this would contain real financial data from a dedicated reporting database.",
-        Data: map[string]interface{}{
-            "sample_data": true,
-            "explanation": "Reports should be generated from read-only replicas or materialized views, not by calling other services directly",
-            "architecture_note": "Consider implementing CQRS pattern with dedicated read models for reporting",
-        },
+        Data:        data,
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// fetchAccountData loads the caller's chart of accounts from account-service, with balances
+// limited to ledger entries between startDate and endDate. Either bound may be empty.
+func (s *ReportService) fetchAccountData(ctx context.Context, r *http.Request, startDate, endDate string) ([]Account, error) {
+    query := url.Values{}
+    query.Set("active_only", "true")
+    if startDate != "" {
+        query.Set("start_date", startDate)
+    }
+    if endDate != "" {
+        query.Set("end_date", endDate)
+    }
+
+    var accounts []Account
+    err := s.accountClient.Do(ctx, http.MethodGet, "/accounts?"+query.Encode(), client.ForwardHeaders(r), nil, &accounts)
+    if err != nil {
+        return nil, err
+    }
+    return accounts, nil
+}
+
+func (s *ReportService) agedReceivablesHandler(w http.ResponseWriter, r *http.Request) {
+    asOf := time.Now()
+    if value := r.URL.Query().Get("as_of"); value != "" {
+        parsed, err := time.Parse("2006-01-02", value)
+        if err != nil {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_DATE", "as_of must use YYYY-MM-DD format")
+            return
+        }
+        asOf = parsed
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+
+    var invoices []Invoice
+    if err := s.invoiceClient.Do(ctx, http.MethodGet, "/invoices", client.ForwardHeaders(r), nil, &invoices); err != nil {
+        s.RespondWithError(w, http.StatusBadGateway, "UPSTREAM_ERROR", "Error fetching invoice data")
+        return
     }
 
+    report := generateAgedReceivables(invoices, asOf)
+    report.CompanyID = s.GetCompanyIDFromRequest(r)
     s.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// generateAgedReceivables buckets the open balance of each invoice, its total less amount_paid,
+// by days past its due date.
+func generateAgedReceivables(invoices []Invoice, asOf time.Time) *AgedReceivablesReport {
+    asOfDate := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+    byCustomer := make(map[int]*CustomerAging)
+    report := &AgedReceivablesReport{
+        AsOf:        asOfDate.Format("2006-01-02"),
+        Customers:   []CustomerAging{},
+        GeneratedAt: time.Now(),
+    }
+
+    for _, invoice := range invoices {
+        // Drafts have not been issued and cancelled invoices are not owed
+        if invoice.Status == "paid" || invoice.Status == "draft" || invoice.Status == "cancelled" {
+            continue
+        }
+        outstanding := invoice.TotalAmount - invoice.AmountPaid
+        if outstanding <= 0 {
+            continue
+        }
+
+        customer, ok := byCustomer[invoice.CustomerID]
+        if !ok {
+            customer = &CustomerAging{CustomerID: invoice.CustomerID}
+            if invoice.Customer != nil {
+                customer.CustomerName = invoice.Customer.Name
+            }
+            byCustomer[invoice.CustomerID] = customer
+        }
+        customer.InvoiceCount++
+
+        dueDate := time.Date(invoice.DueDate.Year(), invoice.DueDate.Month(), invoice.DueDate.Day(), 0, 0, 0, 0, time.UTC)
+        daysPastDue := int(asOfDate.Sub(dueDate).Hours() / 24)
+        customer.add(daysPastDue, outstanding)
+        report.Totals.add(daysPastDue, outstanding)
+    }
+
+    for _, customer := range byCustomer {
+        report.Customers = append(report.Customers, *customer)
+    }
+    sort.Slice(report.Customers, func(i, j int) bool {
+        return report.Customers[i].CustomerName < report.Customers[j].CustomerName
+    })
+
+    return report
+}
+
+func (b *AgingBuckets) add(daysPastDue int, amount float64) {
+    switch {
+    case daysPastDue <= 0:
+        b.Current += amount
+    case daysPastDue <= 30:
+        b.Days1To30 += amount
+    case daysPastDue <= 60:
+        b.Days31To60 += amount
+    case daysPastDue <= 90:
+        b.Days61To90 += amount
+    default:
+        b.Over90 += amount
+    }
+    b.Total += amount
+}
+
+func generateTrialBalance(accounts []Account) map[string]interface{} {
+    var lines []map[string]interface{}
+    var totalDebit, totalCredit float64
+
+    for _, account := range accounts {
+        debit, credit := 0.0, 0.0
+        if isDebitNormal(account.AccountType) == (account.Balance >= 0) {
+            debit = abs(account.Balance)
+        } else {
+            credit = abs(account.Balance)
+        }
+        totalDebit += debit
+        totalCredit += credit
+
+        lines = append(lines, map[string]interface{}{
+            "account_id":   account.ID,
+            "account_code": account.AccountCode,
+            "account_name": account.AccountName,
+            "account_type": account.AccountType,
+            "debit":        debit,
+            "credit":       credit,
+        })
+    }
+
+    return map[string]interface{}{
+        "accounts":     lines,
+        "total_debit":  totalDebit,
+        "total_credit": totalCredit,
+        "balanced":     abs(totalDebit-totalCredit) < 0.01,
+    }
+}
+
+// generateBalanceSheet builds the balance sheet. When prior is non-nil each line and
+// total is also reported against the comparative period.
+func generateBalanceSheet(accounts, prior []Account) map[string]interface{} {
+    priorBalances := balancesByAccount(prior)
+
+    assets, totalAssets := linesOfType(accounts, priorBalances, "Asset")
+    liabilities, totalLiabilities := linesOfType(accounts, priorBalances, "Liability")
+    equity, totalEquity := linesOfType(accounts, priorBalances, "Equity")
+
+    // Net income for the period has not been closed to retained earnings yet
+    _, totalRevenue := linesOfType(accounts, nil, "Revenue")
+    _, totalExpenses := linesOfType(accounts, nil, "Expense")
+    currentEarnings := totalRevenue - totalExpenses
+
+    data := map[string]interface{}{
+        "assets":                       assets,
+        "liabilities":                  liabilities,
+        "equity":                       equity,
+        "total_assets":                 totalAssets,
+        "total_liabilities":            totalLiabilities,
+        "total_equity":                 totalEquity + currentEarnings,
+        "current_earnings":             currentEarnings,
+        "total_liabilities_and_equity": totalLiabilities + totalEquity + currentEarnings,
+    }
+
+    if prior != nil {
+        priorData := generateBalanceSheet(prior, nil)
+        data["comparison"] = compareTotals(data, priorData,
+            "total_assets", "total_liabilities", "total_equity", "current_earnings", "total_liabilities_and_equity")
+    }
+    return data
+}
+
+// generateIncomeStatement builds the income statement. When prior is non-nil each line and
+// total is also reported against the comparative period.
+func generateIncomeStatement(accounts, prior []Account) map[string]interface{} {
+    priorBalances := balancesByAccount(prior)
+
+    revenue, totalRevenue := linesOfType(accounts, priorBalances, "Revenue")
+    expenses, totalExpenses := linesOfType(accounts, priorBalances, "Expense")
+
+    data := map[string]interface{}{
+        "revenue":        revenue,
+        "expenses":       expenses,
+        "total_revenue":  totalRevenue,
+        "total_expenses": totalExpenses,
+        "net_income":     totalRevenue - totalExpenses,
+    }
+
+    if prior != nil {
+        priorData := generateIncomeStatement(prior, nil)
+        data["comparison"] = compareTotals(data, priorData, "total_revenue", "total_expenses", "net_income")
+    }
+    return data
+}
+
+// linesOfType collects the lines for one account type. If prior is non-nil, lines carry the
+// comparative amount and variance; accounts absent from the prior period compare against zero.
+func linesOfType(accounts []Account, prior map[int]float64, accountType string) ([]ReportLine, float64) {
+    var lines []ReportLine
+    var total float64
+    for _, account := range accounts {
+        if account.AccountType != accountType {
+            continue
+        }
+        line := ReportLine{
+            AccountID:   account.ID,
+            AccountCode: account.AccountCode,
+            AccountName: account.AccountName,
+            Amount:      account.Balance,
+        }
+        if prior != nil {
+            c := compare(account.Balance, prior[account.ID])
+            line.PriorAmount = &c.Prior
+            line.Change = &c.Change
+            line.ChangePercent = c.ChangePercent
+        }
+        lines = append(lines, line)
+        total += account.Balance
+    }
+    return lines, total
+}
+
+func balancesByAccount(accounts []Account) map[int]float64 {
+    if accounts == nil {
+        return nil
+    }
+    balances := make(map[int]float64, len(accounts))
+    for _, account := range accounts {
+        balances[account.ID] = account.Balance
+    }
+    return balances
+}
+
+func compareTotals(current, prior map[string]interface{}, keys ...string) map[string]Comparison {
+    comparison := make(map[string]Comparison, len(keys))
+    for _, key := range keys {
+        comparison[key] = compare(current[key].(float64), prior[key].(float64))
+    }
+    return comparison
+}
+
+// compare computes the variance between two periods. The percentage is omitted when the
+// prior amount is zero, since growth from nothing has no meaningful ratio.
+func compare(current, prior float64) Comparison {
+    c := Comparison{
+        Current: current,
+        Prior:   prior,
+        Change:  current - prior,
+    }
+    if prior != 0 {
+        pct := c.Change / abs(prior) * 100
+        c.ChangePercent = &pct
+    }
+    return c
+}
+
+// Account balances from account-service are already signed by the account's normal side
+func isDebitNormal(accountType string) bool {
+    return accountType == "Asset" || accountType == "Expense"
+}
+
+func abs(x float64) float64 {
+    if x < 0 {
+        return -x
+    }
+    return x
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
 }
\ No newline at end of file
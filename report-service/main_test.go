@@ -0,0 +1,138 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/massehanto/accounting-system-go/shared/client"
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+// accountsFixture reads a response of account-service's GET /accounts, recorded from its real
+// handler by account-service's contract test
+func accountsFixture(t *testing.T, name string) []byte {
+    t.Helper()
+    body, err := os.ReadFile(filepath.Join("..", "shared", "testdata", "contracts", "account-service", name))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return body
+}
+
+// accountsUpstream stands in for account-service's GET /accounts, answering with a fixture
+func accountsUpstream(t *testing.T, fixture string) *httptest.Server {
+    t.Helper()
+    body := accountsFixture(t, fixture)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/accounts" {
+            t.Errorf("path = %s, want /accounts", r.URL.Path)
+        }
+        query := r.URL.Query()
+        if query.Get("active_only") != "true" || query.Get("start_date") != "2026-01-01" || query.Get("end_date") != "2026-03-31" {
+            t.Errorf("query = %s, want active_only and both period dates", r.URL.RawQuery)
+        }
+        if r.Header.Get("Authorization") != "Bearer user-token" {
+            t.Errorf("Authorization = %q, want the caller's token forwarded", r.Header.Get("Authorization"))
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.Write(body)
+    }))
+    t.Cleanup(server.Close)
+    return server
+}
+
+func TestFetchAccountDataDecodesAccountService(t *testing.T) {
+    upstream := accountsUpstream(t, "accounts.json")
+    s := &ReportService{BaseService: &service.BaseService{}, accountClient: client.New(upstream.URL)}
+
+    req := httptest.NewRequest("GET", "/reports/trial-balance", nil)
+    req.Header.Set("Authorization", "Bearer user-token")
+    got, err := s.fetchAccountData(context.Background(), req, "2026-01-01", "2026-03-31")
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Account{
+        {ID: 1, AccountCode: "1-1000", AccountName: "Kas", AccountType: "Asset", IsActive: true, Balance: 600000},
+        {ID: 2, AccountCode: "4-1000", AccountName: "Pendapatan", AccountType: "Revenue", IsActive: true, Balance: 1000000},
+        {ID: 3, AccountCode: "5-1000", AccountName: "Beban Gaji", AccountType: "Expense", IsActive: true, Balance: 400000},
+    }
+    if len(got) != len(want) {
+        t.Fatalf("got %d accounts, want %d", len(got), len(want))
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Errorf("account %d = %+v, want %+v", i, got[i], want[i])
+        }
+    }
+}
+
+func TestFetchAccountDataWithoutAccounts(t *testing.T) {
+    // A company without accounts gets a null list from account-service
+    upstream := accountsUpstream(t, "accounts_empty.json")
+    s := &ReportService{BaseService: &service.BaseService{}, accountClient: client.New(upstream.URL)}
+
+    req := httptest.NewRequest("GET", "/reports/trial-balance", nil)
+    req.Header.Set("Authorization", "Bearer user-token")
+    got, err := s.fetchAccountData(context.Background(), req, "2026-01-01", "2026-03-31")
+    if err != nil || len(got) != 0 {
+        t.Errorf("got %v, %v; want no accounts and no error", got, err)
+    }
+}
+
+// When the prior period comes back as a null list the report still carries its comparison,
+// against zero, instead of silently leaving it out
+func TestGenerateReportComparesAgainstEmptyPriorPeriod(t *testing.T) {
+    current, prior := accountsFixture(t, "accounts.json"), accountsFixture(t, "accounts_empty.json")
+    upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        if r.URL.Query().Get("end_date") == "2025-12-31" {
+            w.Write(prior)
+            return
+        }
+        w.Write(current)
+    }))
+    defer upstream.Close()
+    s := &ReportService{BaseService: &service.BaseService{}, accountClient: client.New(upstream.URL)}
+
+    for reportType, section := range map[string]string{"income_statement": "revenue", "balance_sheet": "assets"} {
+        body := `{"report_type":"` + reportType + `","start_date":"2026-01-01","end_date":"2026-12-31",
+                  "compare_start":"2025-01-01","compare_end":"2025-12-31"}`
+        rec := httptest.NewRecorder()
+        s.generateReportHandler(rec, httptest.NewRequest("POST", "/reports/generate", strings.NewReader(body)))
+        if rec.Code != http.StatusOK {
+            t.Fatalf("%s: status = %d, body = %s", reportType, rec.Code, rec.Body.String())
+        }
+
+        var response struct {
+            Data struct {
+                Data map[string]json.RawMessage `json:"data"`
+            } `json:"data"`
+        }
+        if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+            t.Fatalf("%s: decode: %v", reportType, err)
+        }
+        report := response.Data.Data
+
+        var comparison map[string]Comparison
+        if err := json.Unmarshal(report["comparison"], &comparison); err != nil || len(comparison) == 0 {
+            t.Errorf("%s: comparison = %s, want totals compared against zero", reportType, report["comparison"])
+        }
+        for key, c := range comparison {
+            if c.Prior != 0 || c.Change != c.Current {
+                t.Errorf("%s: %s = %+v, want a zero prior", reportType, key, c)
+            }
+        }
+
+        var lines []ReportLine
+        if err := json.Unmarshal(report[section], &lines); err != nil || len(lines) != 1 ||
+            lines[0].PriorAmount == nil || *lines[0].PriorAmount != 0 {
+            t.Errorf("%s: %s lines = %s, want one line with a zero prior_amount", reportType, section, report[section])
+        }
+    }
+}
@@ -0,0 +1,144 @@
+// report-service/tax_summary.go
+package main
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "time"
+    
+    "github.com/massehanto/accounting-system-go/shared/client"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// VendorBill is the part of a vendor-service bill the tax summary reads
+type VendorBill struct {
+    ID        int       `json:"id"`
+    BillDate  time.Time `json:"bill_date"`
+    Subtotal  float64   `json:"subtotal"`
+    TaxAmount float64   `json:"tax_amount"`
+    Status    string    `json:"status"`
+}
+
+// TaxSummarySide totals the documents with PPN on one side of the return
+type TaxSummarySide struct {
+    Available     bool    `json:"available"`
+    DocumentCount int     `json:"document_count"`
+    TaxableAmount float64 `json:"taxable_amount"`
+    TaxAmount     float64 `json:"tax_amount"`
+}
+
+// TaxSummaryReport is PPN output tax on sales against input tax on purchases for a period.
+// NetPayable is output minus input; a negative value is an overpayment (lebih bayar) to carry
+// forward. It is left out when either side could not be fetched.
+type TaxSummaryReport struct {
+    CompanyID   int            `json:"company_id"`
+    StartDate   string         `json:"start_date"`
+    EndDate     string         `json:"end_date"`
+    OutputTax   TaxSummarySide `json:"output_tax"`
+    InputTax    TaxSummarySide `json:"input_tax"`
+    NetPayable  *float64       `json:"net_payable"`
+    Warnings    []string       `json:"warnings,omitempty"`
+    GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// taxSummaryHandler reports the PPN collected on invoices and paid on vendor bills dated in
+// the period. Purchase orders are not tax documents, and billed orders would be counted twice,
+// so only bills make up the input side. An upstream that cannot be reached leaves its side
+// unavailable rather than failing the report, unless neither can be reached.
+func (s *ReportService) taxSummaryHandler(w http.ResponseWriter, r *http.Request) {
+    startDate := r.URL.Query().Get("start_date")
+    endDate := r.URL.Query().Get("end_date")
+    
+    validator := validation.New()
+    validator.Required("start_date", startDate)
+    validator.Required("end_date", endDate)
+    start, startErr := time.Parse("2006-01-02", startDate)
+    end, endErr := time.Parse("2006-01-02", endDate)
+    if startDate != "" && startErr != nil {
+        validator.AddError("start_date", "Start date must use YYYY-MM-DD format")
+    }
+    if endDate != "" && endErr != nil {
+        validator.AddError("end_date", "End date must use YYYY-MM-DD format")
+    }
+    if startErr == nil && endErr == nil && end.Before(start) {
+        validator.AddError("end_date", "End date must not be before the start date")
+    }
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+    
+    report := &TaxSummaryReport{
+        CompanyID:   s.GetCompanyIDFromRequest(r),
+        StartDate:   startDate,
+        EndDate:     endDate,
+        GeneratedAt: time.Now(),
+    }
+    
+    var invoices []Invoice
+    if err := s.invoiceClient.Do(ctx, http.MethodGet, "/invoices", client.ForwardHeaders(r), nil, &invoices); err != nil {
+        log.Printf("Tax summary without output tax, fetching invoices failed: %v", err)
+        report.Warnings = append(report.Warnings, "Invoice data is unavailable; output tax is not included")
+    } else {
+        report.OutputTax = summarizeOutputTax(invoices, startDate, endDate)
+    }
+    
+    var bills []VendorBill
+    if err := s.vendorClient.Do(ctx, http.MethodGet, "/vendor-bills", client.ForwardHeaders(r), nil, &bills); err != nil {
+        log.Printf("Tax summary without input tax, fetching vendor bills failed: %v", err)
+        report.Warnings = append(report.Warnings, "Vendor bill data is unavailable; input tax is not included")
+    } else {
+        report.InputTax = summarizeInputTax(bills, startDate, endDate)
+    }
+    
+    if !report.OutputTax.Available && !report.InputTax.Available {
+        s.RespondWithError(w, http.StatusBadGateway, "UPSTREAM_ERROR", "Error fetching invoice and vendor bill data")
+        return
+    }
+    if report.OutputTax.Available && report.InputTax.Available {
+        net := report.OutputTax.TaxAmount - report.InputTax.TaxAmount
+        report.NetPayable = &net
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// summarizeOutputTax totals the PPN on issued invoices dated from start to end, inclusive.
+// Dates are compared as the calendar date the invoice carries.
+func summarizeOutputTax(invoices []Invoice, start, end string) TaxSummarySide {
+    side := TaxSummarySide{Available: true}
+    for _, invoice := range invoices {
+        // Drafts have not been issued and cancelled invoices carry no tax
+        if invoice.Status == "draft" || invoice.Status == "cancelled" || invoice.TaxAmount == 0 {
+            continue
+        }
+        if date := invoice.InvoiceDate.Format("2006-01-02"); date < start || date > end {
+            continue
+        }
+        side.DocumentCount++
+        side.TaxableAmount += invoice.Subtotal
+        side.TaxAmount += invoice.TaxAmount
+    }
+    return side
+}
+
+// summarizeInputTax totals the PPN on vendor bills dated from start to end, inclusive
+func summarizeInputTax(bills []VendorBill, start, end string) TaxSummarySide {
+    side := TaxSummarySide{Available: true}
+    for _, bill := range bills {
+        if bill.Status == "cancelled" || bill.TaxAmount == 0 {
+            continue
+        }
+        if date := bill.BillDate.Format("2006-01-02"); date < start || date > end {
+            continue
+        }
+        side.DocumentCount++
+        side.TaxableAmount += bill.Subtotal
+        side.TaxAmount += bill.TaxAmount
+    }
+    return side
+}
\ No newline at end of file
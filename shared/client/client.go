@@ -0,0 +1,148 @@
+// shared/client/client.go
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "reflect"
+    "strings"
+    "time"
+)
+
+// Client performs JSON calls against another service in the system.
+type Client struct {
+    BaseURL    string
+    HTTPClient *http.Client
+}
+
+// StatusError is returned when the upstream service answers with a non-2xx status.
+type StatusError struct {
+    StatusCode int
+    Message    string
+}
+
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("upstream returned %d: %s", e.StatusCode, e.Message)
+}
+
+func New(baseURL string) *Client {
+    return &Client{
+        BaseURL:    strings.TrimRight(baseURL, "/"),
+        HTTPClient: &http.Client{Timeout: 10 * time.Second},
+    }
+}
+
+// ForwardHeaders copies the caller identity from an inbound request so the
+// downstream service authenticates the call as the same user, along with the
+// trace ID so both services log under the same trace.
+func ForwardHeaders(r *http.Request) http.Header {
+    headers := http.Header{}
+    if auth := r.Header.Get("Authorization"); auth != "" {
+        headers.Set("Authorization", auth)
+    }
+    if traceID := r.Header.Get("X-Trace-ID"); traceID != "" {
+        headers.Set("X-Trace-ID", traceID)
+    }
+    return headers
+}
+
+// Do sends body (if any) as JSON and decodes the response payload into out (if any).
+func (c *Client) Do(ctx context.Context, method, path string, headers http.Header, body, out interface{}) error {
+    var reader io.Reader
+    if body != nil {
+        payload, err := json.Marshal(body)
+        if err != nil {
+            return err
+        }
+        reader = bytes.NewReader(payload)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+    if err != nil {
+        return err
+    }
+    for key, values := range headers {
+        for _, value := range values {
+            req.Header.Add(key, value)
+        }
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    req.Header.Set("Accept", "application/json")
+
+    resp, err := c.HTTPClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    respBody, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return err
+    }
+
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        var errResp struct {
+            Error string `json:"error"`
+        }
+        json.Unmarshal(respBody, &errResp)
+        return &StatusError{StatusCode: resp.StatusCode, Message: errResp.Error}
+    }
+
+    if out == nil {
+        return nil
+    }
+    return DecodeData(respBody, out)
+}
+
+// Ping checks the service is up through its liveness endpoint
+func (c *Client) Ping(ctx context.Context) error {
+    return c.Do(ctx, http.MethodGet, "/health", nil, nil, nil)
+}
+
+// DecodeData decodes a service response into dst. Responses written through
+// BaseService.RespondWithJSON arrive as {"data": ..., "timestamp": ...}, but
+// bare payloads are accepted too so callers don't depend on the envelope.
+// When dst is a slice, nested data envelopes are unwrapped until an array is found.
+func DecodeData(body []byte, dst interface{}) error {
+    payload := bytes.TrimSpace(body)
+    wantsList := isList(dst)
+
+    for len(payload) > 0 && payload[0] == '{' {
+        var envelope map[string]json.RawMessage
+        if err := json.Unmarshal(payload, &envelope); err != nil {
+            return err
+        }
+        data, ok := envelope["data"]
+        if !ok || !(wantsList || isResponseEnvelope(envelope)) {
+            break
+        }
+        payload = bytes.TrimSpace(data)
+        if !wantsList {
+            break
+        }
+    }
+
+    if len(payload) == 0 || bytes.Equal(payload, []byte("null")) {
+        return nil
+    }
+    return json.Unmarshal(payload, dst)
+}
+
+func isList(dst interface{}) bool {
+    t := reflect.TypeOf(dst)
+    for t != nil && t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    return t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array)
+}
+
+func isResponseEnvelope(envelope map[string]json.RawMessage) bool {
+    _, hasTimestamp := envelope["timestamp"]
+    return hasTimestamp && len(envelope) == 2
+}
@@ -0,0 +1,50 @@
+package client
+
+import "testing"
+
+func TestDecodeDataAcceptsEnvelopeAndBarePayloads(t *testing.T) {
+    lists := map[string]string{
+        "bare array":      `[{"id":1},{"id":2}]`,
+        "data envelope":   `{"data":[{"id":1},{"id":2}],"timestamp":"2026-10-16T00:00:00Z"}`,
+        "nested envelope": `{"data":{"data":[{"id":1},{"id":2}]},"timestamp":"2026-10-16T00:00:00Z"}`,
+    }
+    for name, body := range lists {
+        var items []struct {
+            ID int `json:"id"`
+        }
+        if err := DecodeData([]byte(body), &items); err != nil {
+            t.Errorf("%s: %v", name, err)
+            continue
+        }
+        if len(items) != 2 || items[0].ID != 1 || items[1].ID != 2 {
+            t.Errorf("%s: decoded %+v", name, items)
+        }
+    }
+
+    var empty []int
+    if err := DecodeData([]byte(`{"data":null,"timestamp":"2026-10-16T00:00:00Z"}`), &empty); err != nil || empty != nil {
+        t.Errorf("null data: got %v, %v; want an empty list", empty, err)
+    }
+}
+
+func TestDecodeDataKeepsObjectsWithTheirOwnDataField(t *testing.T) {
+    // Only the response envelope is unwrapped; a payload that happens to have a data field is
+    // decoded as it is
+    var payload struct {
+        Name string `json:"name"`
+        Data string `json:"data"`
+    }
+    if err := DecodeData([]byte(`{"name":"export","data":"csv"}`), &payload); err != nil {
+        t.Fatal(err)
+    }
+    if payload.Name != "export" || payload.Data != "csv" {
+        t.Errorf("decoded %+v", payload)
+    }
+
+    if err := DecodeData([]byte(`{"data":{"name":"export","data":"csv"},"timestamp":"2026-10-16T00:00:00Z"}`), &payload); err != nil {
+        t.Fatal(err)
+    }
+    if payload.Name != "export" || payload.Data != "csv" {
+        t.Errorf("enveloped: decoded %+v", payload)
+    }
+}
@@ -2,10 +2,10 @@
 package config
 
 import (
-    "fmt"
     "log"
     "os"
     "strconv"
+    "strings"
     "time"
 )
 
@@ -14,6 +14,7 @@ type Config struct {
     Server   ServerConfig
     JWT      JWTConfig
     CORS     CORSConfig
+    Security SecurityConfig
 }
 
 type DatabaseConfig struct {
@@ -23,22 +24,46 @@ type DatabaseConfig struct {
     Password string
     Name     string
     SSLMode  string
+
+    // Pool settings apply per service, so the database sees up to MaxOpenConns times the
+    // number of service instances
+    MaxOpenConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
 }
 
+// Pool defaults, used when the DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and DB_CONN_MAX_LIFETIME
+// variables are unset
+const (
+    DefaultMaxOpenConns    = 25
+    DefaultMaxIdleConns    = 5
+    DefaultConnMaxLifetime = 5 * time.Minute
+)
+
 type ServerConfig struct {
     Port string
     Host string
+
+    ReadTimeout  time.Duration
+    WriteTimeout time.Duration
+    IdleTimeout  time.Duration
 }
 
 type JWTConfig struct {
-    Secret     string
-    Expiration time.Duration
+    Secret            string
+    Expiration        time.Duration
+    RefreshExpiration time.Duration
+}
+
+type SecurityConfig struct {
+    BCryptCost int
 }
 
 type CORSConfig struct {
     AllowedOrigins []string
     AllowedMethods []string
     AllowedHeaders []string
+    ExposedHeaders []string
 }
 
 func Load() *Config {
@@ -54,6 +79,16 @@ func Load() *Config {
         log.Fatalf("JWT_SECRET must be at least 32 characters long")
     }
     
+    bcryptCost := getEnvInt("BCRYPT_COST", 12)
+    if bcryptCost < 10 || bcryptCost > 31 {
+        log.Fatalf("BCRYPT_COST must be between 10 and 31")
+    }
+    
+    if errs := databasePoolErrors(); len(errs) > 0 {
+        log.Fatalf("Invalid database pool configuration: %s", strings.Join(errs, "; "))
+    }
+    connMaxLifetime, _ := time.ParseDuration(getEnv("DB_CONN_MAX_LIFETIME", DefaultConnMaxLifetime.String()))
+    
     return &Config{
         Database: DatabaseConfig{
             Host:     getEnv("DB_HOST", "localhost"),
@@ -62,19 +97,32 @@ func Load() *Config {
             Password: os.Getenv("DB_PASSWORD"),
             Name:     getEnv("DB_NAME", ""),
             SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+
+            MaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", DefaultMaxOpenConns),
+            MaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", DefaultMaxIdleConns),
+            ConnMaxLifetime: connMaxLifetime,
         },
         Server: ServerConfig{
             Port: getEnv("PORT", "8000"),
             Host: getEnv("HOST", "0.0.0.0"),
+
+            ReadTimeout:  time.Duration(getEnvInt("SERVER_READ_TIMEOUT", 15)) * time.Second,
+            WriteTimeout: time.Duration(getEnvInt("SERVER_WRITE_TIMEOUT", 15)) * time.Second,
+            IdleTimeout:  time.Duration(getEnvInt("SERVER_IDLE_TIMEOUT", 60)) * time.Second,
         },
         JWT: JWTConfig{
-            Secret:     os.Getenv("JWT_SECRET"),
-            Expiration: time.Duration(getEnvInt("JWT_EXPIRATION", 86400)) * time.Second,
+            Secret:            os.Getenv("JWT_SECRET"),
+            Expiration:        time.Duration(getEnvInt("JWT_EXPIRATION", 86400)) * time.Second,
+            RefreshExpiration: time.Duration(getEnvInt("JWT_REFRESH_EXPIRATION", 2592000)) * time.Second,
         },
         CORS: CORSConfig{
-            AllowedOrigins: []string{getEnv("FRONTEND_URL", "http://localhost:3000")},
+            AllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", getEnv("FRONTEND_URL", "http://localhost:3000")),
             AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-            AllowedHeaders: []string{"*"},
+            AllowedHeaders: []string{"Authorization", "Content-Type", "Accept", "X-Requested-With", "Idempotency-Key", "X-CSRF-Token"},
+            ExposedHeaders: []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After", "Idempotent-Replayed"},
+        },
+        Security: SecurityConfig{
+            BCryptCost: bcryptCost,
         },
     }
 }
@@ -86,6 +134,17 @@ func getEnv(key, defaultValue string) string {
     return defaultValue
 }
 
+// getEnvList splits a comma-separated variable, ignoring blank entries
+func getEnvList(key, defaultValue string) []string {
+    var values []string
+    for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+        if value = strings.TrimSpace(value); value != "" {
+            values = append(values, value)
+        }
+    }
+    return values
+}
+
 func getEnvInt(key string, defaultValue int) int {
     if value := os.Getenv(key); value != "" {
         if intValue, err := strconv.Atoi(value); err == nil {
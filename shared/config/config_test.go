@@ -0,0 +1,32 @@
+package config
+
+import (
+    "reflect"
+    "testing"
+)
+
+func loadWithOrigins(t *testing.T, origins, frontendURL string) []string {
+    t.Helper()
+    t.Setenv("JWT_SECRET", "test-secret-that-is-at-least-32-characters")
+    t.Setenv("DB_PASSWORD", "secret")
+    t.Setenv("CORS_ALLOWED_ORIGINS", origins)
+    t.Setenv("FRONTEND_URL", frontendURL)
+    return Load().CORS.AllowedOrigins
+}
+
+func TestCORSAllowedOriginsParsing(t *testing.T) {
+    cases := []struct {
+        name, origins, frontendURL string
+        want                       []string
+    }{
+        {"comma separated", "https://app.example.co.id,https://admin.example.co.id", "", []string{"https://app.example.co.id", "https://admin.example.co.id"}},
+        {"spaces and empty entries", " https://app.example.co.id , ,https://admin.example.co.id, ", "", []string{"https://app.example.co.id", "https://admin.example.co.id"}},
+        {"falls back to FRONTEND_URL", "", "https://app.example.co.id", []string{"https://app.example.co.id"}},
+        {"default", "", "", []string{"http://localhost:3000"}},
+    }
+    for _, tc := range cases {
+        if got := loadWithOrigins(t, tc.origins, tc.frontendURL); !reflect.DeepEqual(got, tc.want) {
+            t.Errorf("%s: origins = %q, want %q", tc.name, got, tc.want)
+        }
+    }
+}
@@ -4,7 +4,9 @@ package config
 import (
     "fmt"
     "os"
+    "strconv"
     "strings"
+    "time"
 )
 
 func ValidateEnvironment() error {
@@ -29,6 +31,8 @@ func ValidateEnvironment() error {
         }
     }
     
+    errors = append(errors, databasePoolErrors()...)
+    
     // Validate optional but recommended variables
     optional := map[string]string{
         "SMTP_HOST":     "Email service configuration",
@@ -54,6 +58,38 @@ func ValidateEnvironment() error {
     return nil
 }
 
+// databasePoolErrors checks the DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and DB_CONN_MAX_LIFETIME
+// variables that are set
+func databasePoolErrors() []string {
+    var errors []string
+    
+    maxOpen, maxIdle := DefaultMaxOpenConns, DefaultMaxIdleConns
+    if value := os.Getenv("DB_MAX_OPEN_CONNS"); value != "" {
+        parsed, err := strconv.Atoi(value)
+        if err != nil || parsed < 1 {
+            errors = append(errors, fmt.Sprintf("DB_MAX_OPEN_CONNS must be a positive integer, got %q", value))
+        }
+        maxOpen = parsed
+    }
+    if value := os.Getenv("DB_MAX_IDLE_CONNS"); value != "" {
+        parsed, err := strconv.Atoi(value)
+        if err != nil || parsed < 0 {
+            errors = append(errors, fmt.Sprintf("DB_MAX_IDLE_CONNS must be a non-negative integer, got %q", value))
+        }
+        maxIdle = parsed
+    }
+    if len(errors) == 0 && maxIdle > maxOpen {
+        errors = append(errors, fmt.Sprintf("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", maxIdle, maxOpen))
+    }
+    if value := os.Getenv("DB_CONN_MAX_LIFETIME"); value != "" {
+        if lifetime, err := time.ParseDuration(value); err != nil || lifetime <= 0 {
+            errors = append(errors, fmt.Sprintf("DB_CONN_MAX_LIFETIME must be a positive duration such as 5m, got %q", value))
+        }
+    }
+    
+    return errors
+}
+
 func ValidateBusinessRules() error {
     var errors []string
     
@@ -17,15 +17,26 @@ func InitDatabase(cfg config.DatabaseConfig) *sql.DB {
         "host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
         cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
     
-    db, err := sql.Open("postgres", dsn)
+    db, err := openPool("postgres", dsn, cfg)
     if err != nil {
-        log.Fatalf("Failed to create database connection: %v", err)
+        log.Fatalf("Database connection failed: %v", err)
+    }
+
+    log.Printf("Database connected: %s:%s/%s (max %d open, %d idle connections)", cfg.Host, cfg.Port, cfg.Name, cfg.MaxOpenConns, cfg.MaxIdleConns)
+    return db
+}
+
+// openPool opens a pool on the named driver, applies the pool settings and checks the connection
+func openPool(driverName, dsn string, cfg config.DatabaseConfig) (*sql.DB, error) {
+    db, err := sql.Open(driverName, dsn)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create database connection: %w", err)
     }
 
-    // Basic connection pool settings
-    db.SetMaxOpenConns(25)
-    db.SetMaxIdleConns(5)
-    db.SetConnMaxLifetime(5 * time.Minute)
+    // Connection pool settings from DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and DB_CONN_MAX_LIFETIME
+    db.SetMaxOpenConns(cfg.MaxOpenConns)
+    db.SetMaxIdleConns(cfg.MaxIdleConns)
+    db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
     // Test connection
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -33,11 +44,9 @@ func InitDatabase(cfg config.DatabaseConfig) *sql.DB {
     
     if err := db.PingContext(ctx); err != nil {
         db.Close()
-        log.Fatalf("Database connection failed: %v", err)
+        return nil, err
     }
-
-    log.Printf("Database connected: %s:%s/%s", cfg.Host, cfg.Port, cfg.Name)
-    return db
+    return db, nil
 }
 
 func HealthCheck(db *sql.DB) error {
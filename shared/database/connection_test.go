@@ -0,0 +1,56 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "testing"
+    "time"
+
+    "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/database/dbtest"
+)
+
+// The pool only needs connections it can open, park and expire, which any stub connection
+// allows
+func init() {
+    sql.Register("pooltest", &dbtest.Driver{})
+}
+
+func TestOpenPoolAppliesPoolSettings(t *testing.T) {
+    cfg := config.DatabaseConfig{MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: 50 * time.Millisecond}
+    db, err := openPool("pooltest", "", cfg)
+    if err != nil {
+        t.Fatalf("openPool: %v", err)
+    }
+    defer db.Close()
+
+    if got := db.Stats().MaxOpenConnections; got != cfg.MaxOpenConns {
+        t.Errorf("MaxOpenConnections = %d, want %d", got, cfg.MaxOpenConns)
+    }
+
+    // Check out every allowed connection, then hand them back: only MaxIdleConns stay parked
+    ctx := context.Background()
+    conns := make([]*sql.Conn, cfg.MaxOpenConns)
+    for i := range conns {
+        if conns[i], err = db.Conn(ctx); err != nil {
+            t.Fatalf("db.Conn: %v", err)
+        }
+    }
+    for _, conn := range conns {
+        conn.Close()
+    }
+    if got := db.Stats().Idle; got != cfg.MaxIdleConns {
+        t.Errorf("idle connections = %d, want %d", got, cfg.MaxIdleConns)
+    }
+
+    // Once the lifetime has passed, reusing a parked connection closes it instead
+    time.Sleep(2 * cfg.ConnMaxLifetime)
+    conn, err := db.Conn(ctx)
+    if err != nil {
+        t.Fatalf("db.Conn: %v", err)
+    }
+    conn.Close()
+    if got := db.Stats().MaxLifetimeClosed; got == 0 {
+        t.Error("expected connections past ConnMaxLifetime to be closed")
+    }
+}
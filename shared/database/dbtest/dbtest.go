@@ -0,0 +1,114 @@
+// shared/database/dbtest/dbtest.go
+package dbtest
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "fmt"
+    "io"
+)
+
+// Driver is an in-memory database/sql driver for handler tests. Each statement is answered
+// by Query or Exec, which see the SQL text, its arguments and the transaction it runs in; a
+// statement neither of them handles fails. Pings always succeed.
+type Driver struct {
+    Query func(tx *Tx, query string, args []driver.Value) (driver.Rows, error)
+    Exec  func(tx *Tx, query string, args []driver.Value) (driver.Result, error)
+}
+
+// Open returns a pool backed by d
+func Open(d *Driver) *sql.DB {
+    return sql.OpenDB(d)
+}
+
+// Tx is the transaction a statement runs in, or nil for one outside a transaction. State
+// holds whatever the test keeps per transaction, such as writes not yet committed.
+type Tx struct {
+    State interface{}
+    onEnd []func(commit bool)
+}
+
+// OnEnd registers fn to run when the transaction commits or rolls back
+func (tx *Tx) OnEnd(fn func(commit bool)) {
+    tx.onEnd = append(tx.onEnd, fn)
+}
+
+func (tx *Tx) end(commit bool) {
+    for _, fn := range tx.onEnd {
+        fn(commit)
+    }
+}
+
+func (d *Driver) Open(string) (driver.Conn, error)              { return &conn{d: d}, nil }
+func (d *Driver) Connect(context.Context) (driver.Conn, error) { return &conn{d: d}, nil }
+func (d *Driver) Driver() driver.Driver                         { return d }
+
+type conn struct {
+    d  *Driver
+    tx *Tx
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{c, query}, nil }
+func (c *conn) Close() error                              { return nil }
+func (c *conn) Ping(context.Context) error                { return nil }
+func (c *conn) Begin() (driver.Tx, error) {
+    c.tx = &Tx{}
+    return c, nil
+}
+
+// Commit and Rollback end the connection's transaction; conn is its own driver.Tx
+func (c *conn) Commit() error   { return c.finish(true) }
+func (c *conn) Rollback() error { return c.finish(false) }
+
+func (c *conn) finish(commit bool) error {
+    tx := c.tx
+    c.tx = nil
+    if tx != nil {
+        tx.end(commit)
+    }
+    return nil
+}
+
+type stmt struct {
+    c     *conn
+    query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+    if s.c.d.Query == nil {
+        return nil, fmt.Errorf("unexpected query: %s", s.query)
+    }
+    return s.c.d.Query(s.c.tx, s.query, args)
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+    if s.c.d.Exec == nil {
+        return nil, fmt.Errorf("unexpected statement: %s", s.query)
+    }
+    return s.c.d.Exec(s.c.tx, s.query, args)
+}
+
+// Rows returns a result set with the given columns and one row for each of values
+func Rows(columns []string, values ...[]driver.Value) driver.Rows {
+    return &rows{columns, values}
+}
+
+type rows struct {
+    columns []string
+    values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+func (r *rows) Next(dest []driver.Value) error {
+    if len(r.values) == 0 {
+        return io.EOF
+    }
+    copy(dest, r.values[0])
+    r.values = r.values[1:]
+    return nil
+}
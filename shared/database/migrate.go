@@ -0,0 +1,189 @@
+// shared/database/migrate.go
+package database
+
+import (
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "fmt"
+    "io/fs"
+    "log"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// MigrationsDir is where a service keeps its migrations, embedded with
+//
+//    //go:embed migrations/*.sql
+//    var migrations embed.FS
+const MigrationsDir = "migrations"
+
+// migrationLockID keys the advisory lock that keeps replicas starting together from applying
+// the same migration twice. Each service has its own database, so one key serves them all.
+const migrationLockID = 72657001
+
+const migrationTimeout = 5 * time.Minute
+
+// Migration is one SQL file, named <version>_<name>.sql, such as 0002_add_invoice_notes.sql
+type Migration struct {
+    Version  int
+    Name     string
+    SQL      string
+    Checksum string
+}
+
+// LoadMigrations reads the migrations in MigrationsDir of fsys, ordered by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+    files, err := fs.Glob(fsys, path.Join(MigrationsDir, "*.sql"))
+    if err != nil {
+        return nil, err
+    }
+
+    migrations := make([]Migration, 0, len(files))
+    seen := make(map[int]string, len(files))
+    for _, file := range files {
+        base := strings.TrimSuffix(path.Base(file), ".sql")
+        prefix, name, ok := strings.Cut(base, "_")
+        version, err := strconv.Atoi(prefix)
+        if !ok || err != nil || version <= 0 {
+            return nil, fmt.Errorf("migration %s: name must be <version>_<name>.sql", file)
+        }
+        if other, exists := seen[version]; exists {
+            return nil, fmt.Errorf("migrations %s and %s share version %d", other, file, version)
+        }
+        seen[version] = file
+
+        content, err := fs.ReadFile(fsys, file)
+        if err != nil {
+            return nil, err
+        }
+        sum := sha256.Sum256(content)
+        migrations = append(migrations, Migration{
+            Version:  version,
+            Name:     name,
+            SQL:      string(content),
+            Checksum: hex.EncodeToString(sum[:]),
+        })
+    }
+
+    sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+    return migrations, nil
+}
+
+// Migrate applies the migrations in fsys that db has not seen yet, each in its own
+// transaction, recording them in schema_migrations. Migrations only go up; an applied one
+// whose file has changed since is drift, and Migrate refuses to go further rather than run
+// code against a schema it does not describe. It returns the schema version db is now at.
+func Migrate(db *sql.DB, fsys fs.FS) (int, error) {
+    migrations, err := LoadMigrations(fsys)
+    if err != nil {
+        return 0, err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+    defer cancel()
+
+    // The advisory lock belongs to a session, so everything runs on one connection
+    conn, err := db.Conn(ctx)
+    if err != nil {
+        return 0, err
+    }
+    defer conn.Close()
+
+    if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+        return 0, fmt.Errorf("acquiring migration lock: %w", err)
+    }
+    defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+    if _, err := conn.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name VARCHAR(255) NOT NULL,
+            checksum CHAR(64) NOT NULL,
+            applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`); err != nil {
+        return 0, fmt.Errorf("creating schema_migrations: %w", err)
+    }
+
+    applied, err := appliedChecksums(ctx, conn)
+    if err != nil {
+        return 0, err
+    }
+
+    version := 0
+    for _, migration := range migrations {
+        if checksum, ok := applied[migration.Version]; ok {
+            if checksum != migration.Checksum {
+                return 0, fmt.Errorf("migration %d_%s has changed since it was applied (checksum %s, applied %s); add a new migration instead of editing it",
+                    migration.Version, migration.Name, migration.Checksum, checksum)
+            }
+            version = migration.Version
+            continue
+        }
+
+        if err := applyMigration(ctx, conn, migration); err != nil {
+            return 0, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+        }
+        log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+        version = migration.Version
+    }
+
+    // A database migrated by a newer release keeps its higher version
+    for applied := range applied {
+        if applied > version {
+            version = applied
+        }
+    }
+    return version, nil
+}
+
+// MustMigrate runs Migrate and stops the service on failure, logging the resulting version
+func MustMigrate(db *sql.DB, fsys fs.FS) int {
+    version, err := Migrate(db, fsys)
+    if err != nil {
+        log.Fatalf("Database migration failed: %v", err)
+    }
+    log.Printf("Database schema at version %d", version)
+    return version
+}
+
+func appliedChecksums(ctx context.Context, conn *sql.Conn) (map[int]string, error) {
+    rows, err := conn.QueryContext(ctx, "SELECT version, checksum FROM schema_migrations")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    applied := make(map[int]string)
+    for rows.Next() {
+        var version int
+        var checksum string
+        if err := rows.Scan(&version, &checksum); err != nil {
+            return nil, err
+        }
+        applied[version] = checksum
+    }
+    return applied, rows.Err()
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, migration Migration) error {
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+        return err
+    }
+    if _, err := tx.ExecContext(ctx,
+        "INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+        migration.Version, migration.Name, migration.Checksum); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
\ No newline at end of file
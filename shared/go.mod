@@ -7,7 +7,13 @@ require (
     github.com/dgrijalva/jwt-go v3.2.0+incompatible
     github.com/gorilla/mux v1.8.0
     github.com/lib/pq v1.10.9
+    github.com/redis/go-redis/v9 v9.5.1
     github.com/rs/cors v1.8.3
     golang.org/x/time v0.5.0
     golang.org/x/crypto v0.17.0
+)
+
+require (
+    github.com/cespare/xxhash/v2 v2.2.0 // indirect
+    github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 )
\ No newline at end of file
@@ -0,0 +1,256 @@
+// shared/i18n/messages.go
+package i18n
+
+import (
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Supported response languages. Indonesian is the default for clients that ask for neither.
+const (
+    Indonesian = "id-ID"
+    English    = "en-US"
+)
+
+// NegotiateLanguage picks the supported language the client prefers from an Accept-Language
+// header, honouring q-values and matching on the primary tag, so "en-GB" gets English.
+func NegotiateLanguage(acceptLanguage string) string {
+    type candidate struct {
+        tag     string
+        quality float64
+    }
+
+    var candidates []candidate
+    for _, part := range strings.Split(acceptLanguage, ",") {
+        tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+        if tag == "" {
+            continue
+        }
+        quality := 1.0
+        if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            parsed, err := strconv.ParseFloat(q, 64)
+            if err != nil {
+                continue
+            }
+            quality = parsed
+        }
+        if quality > 0 {
+            candidates = append(candidates, candidate{tag: strings.ToLower(tag), quality: quality})
+        }
+    }
+    sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+
+    for _, c := range candidates {
+        primary, _, _ := strings.Cut(c.tag, "-")
+        switch primary {
+        case "id", "in":
+            return Indonesian
+        case "en":
+            return English
+        }
+    }
+    return Indonesian
+}
+
+// Supported reports whether language is one of the response languages
+func Supported(language string) bool {
+    return language == Indonesian || language == English
+}
+
+// messages is the catalog of user-facing error text, by error code and language
+var messages = map[string]map[string]string{
+    "VALIDATION_ERROR": {
+        Indonesian: "Data yang dikirim tidak valid. Periksa kembali isian Anda.",
+        English:    "The submitted data is invalid. Please check your input.",
+    },
+    "INVALID_JSON": {
+        Indonesian: "Format permintaan tidak valid.",
+        English:    "The request format is invalid.",
+    },
+    "UNKNOWN_FIELD": {
+        Indonesian: "Permintaan berisi isian yang tidak dikenal.",
+        English:    "The request contains an unknown field.",
+    },
+    "PAYLOAD_TOO_LARGE": {
+        Indonesian: "Data yang dikirim terlalu besar.",
+        English:    "The submitted data is too large.",
+    },
+    "INVALID_ID": {
+        Indonesian: "ID tidak valid.",
+        English:    "The ID is invalid.",
+    },
+    "INVALID_PARAMETER": {
+        Indonesian: "Parameter permintaan tidak valid.",
+        English:    "A request parameter is invalid.",
+    },
+    "INVALID_DATE": {
+        Indonesian: "Format tanggal tidak valid.",
+        English:    "The date format is invalid.",
+    },
+    "NOT_FOUND": {
+        Indonesian: "Data tidak ditemukan.",
+        English:    "The requested data was not found.",
+    },
+    "USER_NOT_FOUND": {
+        Indonesian: "Pengguna tidak ditemukan.",
+        English:    "User not found.",
+    },
+    "COMPANY_NOT_FOUND": {
+        Indonesian: "Perusahaan tidak ditemukan.",
+        English:    "Company not found.",
+    },
+    "COMPANY_ACCESS_DENIED": {
+        Indonesian: "Anda tidak memiliki akses ke perusahaan ini.",
+        English:    "You do not have access to this company.",
+    },
+    "CSRF_INVALID": {
+        Indonesian: "Sesi formulir tidak valid atau kedaluwarsa. Muat ulang halaman dan coba lagi.",
+        English:    "Your form session is invalid or has expired. Reload the page and try again.",
+    },
+    "SETTING_NOT_FOUND": {
+        Indonesian: "Pengaturan tidak ditemukan.",
+        English:    "Setting not found.",
+    },
+    "INVALID_CREDENTIALS": {
+        Indonesian: "Email atau kata sandi salah.",
+        English:    "Incorrect email or password.",
+    },
+    "UNAUTHORIZED": {
+        Indonesian: "Sesi Anda tidak valid atau telah berakhir. Silakan masuk kembali.",
+        English:    "Your session is invalid or has expired. Please sign in again.",
+    },
+    "INSUFFICIENT_ROLE": {
+        Indonesian: "Anda tidak memiliki hak akses untuk tindakan ini.",
+        English:    "You do not have permission to perform this action.",
+    },
+    "EMAIL_EXISTS": {
+        Indonesian: "Email sudah terdaftar.",
+        English:    "This email is already registered.",
+    },
+    "DUPLICATE_CODE": {
+        Indonesian: "Kode sudah digunakan.",
+        English:    "This code is already in use.",
+    },
+    "INVALID_STATUS": {
+        Indonesian: "Tindakan ini tidak dapat dilakukan pada status data saat ini.",
+        English:    "This action is not allowed in the current status.",
+    },
+    "FAKTUR_SERIES_EXHAUSTED": {
+        Indonesian: "Nomor seri faktur pajak sudah habis. Daftarkan rentang nomor seri baru.",
+        English:    "There are no faktur pajak serials left. Register a new serial range.",
+    },
+    "FAKTUR_SERIES_OVERLAP": {
+        Indonesian: "Rentang nomor seri faktur pajak tumpang tindih dengan rentang yang sudah terdaftar.",
+        English:    "The faktur pajak serial range overlaps one already registered.",
+    },
+    "SMS_NOT_CONFIGURED": {
+        Indonesian: "Pengiriman SMS belum dikonfigurasi.",
+        English:    "SMS sending is not configured.",
+    },
+    "FISCAL_PERIODS_EXIST": {
+        Indonesian: "Periode fiskal untuk tahun tersebut sudah dibuat.",
+        English:    "Fiscal periods for that year have already been generated.",
+    },
+    "FISCAL_PERIOD_NOT_FOUND": {
+        Indonesian: "Periode fiskal tidak ditemukan.",
+        English:    "Fiscal period not found.",
+    },
+    "INVALID_FISCAL_YEAR_START": {
+        Indonesian: "Pengaturan awal tahun fiskal tidak valid.",
+        English:    "The fiscal year start setting is invalid.",
+    },
+    "WITHHOLDING_CATEGORY_NOT_FOUND": {
+        Indonesian: "Kategori pemotongan PPh tidak ditemukan.",
+        English:    "Withholding category not found.",
+    },
+    "FAKTUR_OUT_OF_RANGE": {
+        Indonesian: "Nomor faktur pajak tidak termasuk dalam rentang nomor seri yang terdaftar.",
+        English:    "The faktur pajak number is not in a registered serial range.",
+    },
+    "FAKTUR_NUMBER_USED": {
+        Indonesian: "Nomor faktur pajak sudah digunakan.",
+        English:    "The faktur pajak number has already been used.",
+    },
+    "TEMPLATE_EXISTS": {
+        Indonesian: "Template email sudah ada; perbarui template tersebut.",
+        English:    "The email template already exists; update it instead.",
+    },
+    "TEMPLATE_NOT_FOUND": {
+        Indonesian: "Template email tidak ditemukan.",
+        English:    "The email template does not exist.",
+    },
+    "TAX_RATE_IN_USE": {
+        Indonesian: "Tarif pajak sudah digunakan dalam perhitungan pajak dan hanya dapat dinonaktifkan.",
+        English:    "This tax rate has been used in tax calculations and can only be deactivated.",
+    },
+    "INSUFFICIENT_STOCK": {
+        Indonesian: "Stok tidak mencukupi.",
+        English:    "There is not enough stock.",
+    },
+    "PAYMENT_EXCEEDS_BALANCE": {
+        Indonesian: "Jumlah pembayaran melebihi sisa tagihan.",
+        English:    "The payment exceeds the remaining balance.",
+    },
+    "INVALID_CURRENCY": {
+        Indonesian: "Kode mata uang tidak dikenal.",
+        English:    "The currency code is not recognised.",
+    },
+    "RATE_STALE": {
+        Indonesian: "Kurs belum diperbarui. Silakan coba beberapa saat lagi.",
+        English:    "Exchange rates are out of date. Please try again shortly.",
+    },
+    "RATE_LIMITED": {
+        Indonesian: "Terlalu banyak permintaan. Silakan coba beberapa saat lagi.",
+        English:    "Too many requests. Please try again shortly.",
+    },
+    "DB_ERROR": {
+        Indonesian: "Terjadi kesalahan pada server. Silakan coba lagi.",
+        English:    "A server error occurred. Please try again.",
+    },
+    "DATABASE_ERROR": {
+        Indonesian: "Terjadi kesalahan pada server. Silakan coba lagi.",
+        English:    "A server error occurred. Please try again.",
+    },
+}
+
+// statusMessages cover codes without their own catalog entry
+var statusMessages = map[int]map[string]string{
+    http.StatusBadRequest: {
+        Indonesian: "Permintaan tidak valid.",
+        English:    "The request is invalid.",
+    },
+    http.StatusUnauthorized: messages["UNAUTHORIZED"],
+    http.StatusForbidden: messages["INSUFFICIENT_ROLE"],
+    http.StatusNotFound: messages["NOT_FOUND"],
+    http.StatusConflict: {
+        Indonesian: "Permintaan bertentangan dengan data yang ada.",
+        English:    "The request conflicts with existing data.",
+    },
+    http.StatusRequestEntityTooLarge: messages["PAYLOAD_TOO_LARGE"],
+    http.StatusTooManyRequests: messages["RATE_LIMITED"],
+}
+
+var serverErrorMessage = map[string]string{
+    Indonesian: "Layanan sedang mengalami gangguan. Silakan coba lagi.",
+    English:    "The service is having problems. Please try again.",
+}
+
+// Message returns the user-facing text for an error in language: the catalog entry for code,
+// else a generic one for the status. Unsupported languages get Indonesian.
+func Message(language, code string, status int) string {
+    if !Supported(language) {
+        language = Indonesian
+    }
+    if text, ok := messages[code][language]; ok {
+        return text
+    }
+    if text, ok := statusMessages[status][language]; ok {
+        return text
+    }
+    if status >= 500 {
+        return serverErrorMessage[language]
+    }
+    return statusMessages[http.StatusBadRequest][language]
+}
\ No newline at end of file
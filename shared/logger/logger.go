@@ -0,0 +1,45 @@
+// shared/logger/logger.go
+package logger
+
+import (
+    "context"
+    "log/slog"
+    "os"
+    "strings"
+)
+
+// Init installs a JSON logger tagged with the service name as the process default. Output
+// from the standard log package goes through the same handler.
+func Init(service string) *slog.Logger {
+    handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: getLogLevel()})
+    logger := slog.New(handler).With("service", service)
+    slog.SetDefault(logger)
+    return logger
+}
+
+// getLogLevel maps LOG_LEVEL (debug, info, warn or error) to a slog level, defaulting to info
+func getLogLevel() slog.Level {
+    switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+    case "debug":
+        return slog.LevelDebug
+    case "warn", "warning":
+        return slog.LevelWarn
+    case "error":
+        return slog.LevelError
+    default:
+        return slog.LevelInfo
+    }
+}
+
+// FromContext returns the default logger annotated with the request and trace IDs stored in
+// ctx by the logging middleware, if any
+func FromContext(ctx context.Context) *slog.Logger {
+    logger := slog.Default()
+    if requestID, ok := ctx.Value("request_id").(string); ok && requestID != "" {
+        logger = logger.With("request_id", requestID)
+    }
+    if traceID, ok := ctx.Value("trace_id").(string); ok && traceID != "" {
+        logger = logger.With("trace_id", traceID)
+    }
+    return logger
+}
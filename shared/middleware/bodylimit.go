@@ -0,0 +1,34 @@
+// shared/middleware/bodylimit.go
+package middleware
+
+import (
+    "fmt"
+    "net/http"
+)
+
+// MaxBodySize rejects request bodies larger than limit bytes with 413 PAYLOAD_TOO_LARGE. A
+// declared Content-Length is checked up front; a body of unknown length is cut off by
+// http.MaxBytesReader once it passes the limit, and whoever reads it gets an
+// *http.MaxBytesError to answer with 413 themselves. A non-positive limit disables it.
+func MaxBodySize(limit int64) Middleware {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        if limit <= 0 {
+            return next
+        }
+        return func(w http.ResponseWriter, r *http.Request) {
+            if r.ContentLength > limit {
+                RespondPayloadTooLarge(w, limit)
+                return
+            }
+            r.Body = http.MaxBytesReader(w, r.Body, limit)
+            next(w, r)
+        }
+    }
+}
+
+// RespondPayloadTooLarge writes the 413 MaxBodySize answers with
+func RespondPayloadTooLarge(w http.ResponseWriter, limit int64) {
+    w.Header().Set("Connection", "close")
+    respondWithErrorCode(w, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE",
+        fmt.Sprintf("Request body must not exceed %d bytes", limit))
+}
\ No newline at end of file
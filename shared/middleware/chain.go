@@ -19,15 +19,28 @@ func Chain(middlewares ...Middleware) func(http.HandlerFunc) http.HandlerFunc {
 func APIMiddleware(jwtSecret string) func(http.HandlerFunc) http.HandlerFunc {
     return Chain(
         SecurityHeaders,
+        LoggingMiddleware,
+        NewAuthMiddleware(jwtSecret),
+        // After auth so limits key on the authenticated user and company
         RateLimit(60),
+    )
+}
+
+// RoleMiddleware is APIMiddleware restricted to users holding at least minRole
+func RoleMiddleware(jwtSecret, minRole string) func(http.HandlerFunc) http.HandlerFunc {
+    return Chain(
+        SecurityHeaders,
         LoggingMiddleware,
         NewAuthMiddleware(jwtSecret),
+        RequireRole(minRole),
+        RateLimit(60),
     )
 }
 
 func PublicMiddleware() func(http.HandlerFunc) http.HandlerFunc {
     return Chain(
         SecurityHeaders,
+        StripIdentityHeaders,
         RateLimit(20),
         LoggingMiddleware,
     )
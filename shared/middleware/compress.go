@@ -0,0 +1,172 @@
+// shared/middleware/compress.go
+package middleware
+
+import (
+    "compress/gzip"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+var gzipWriterPool = sync.Pool{
+    New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// Content types that are already compressed and gain nothing from gzip, or are streamed
+var incompressibleTypes = []string{
+    "image/", "video/", "audio/", "font/woff", "text/event-stream",
+    "application/gzip", "application/zip", "application/pdf", "application/octet-stream",
+}
+
+// Gzip compresses responses for clients that accept gzip. Bodies shorter than minSize, bodies
+// already carrying a Content-Encoding and already-compressed content types are sent as is.
+// The status is passed on unchanged, so a LoggingMiddleware wrapped around it still records it.
+func Gzip(minSize int) Middleware {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            w.Header().Add("Vary", "Accept-Encoding")
+            if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+                next(w, r)
+                return
+            }
+
+            gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, status: http.StatusOK}
+            defer gw.close()
+            next(gw, r)
+        }
+    }
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, honouring q=0
+func acceptsGzip(acceptEncoding string) bool {
+    for _, part := range strings.Split(acceptEncoding, ",") {
+        coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+        if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "gzip" && coding != "*" {
+            continue
+        }
+        if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            if quality, err := strconv.ParseFloat(q, 64); err == nil && quality == 0 {
+                return false
+            }
+        }
+        return true
+    }
+    return false
+}
+
+// gzipResponseWriter holds the status and the first minSize bytes back until it can tell
+// whether the response is worth compressing
+type gzipResponseWriter struct {
+    http.ResponseWriter
+    minSize     int
+    status      int
+    wroteHeader bool
+    decided     bool
+    buf         []byte
+    gz          *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+    if gw.wroteHeader {
+        return
+    }
+    gw.wroteHeader = true
+    gw.status = status
+    // Informational and body-less responses have nothing to compress
+    if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+        gw.decided = true
+        gw.ResponseWriter.WriteHeader(status)
+    }
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+    if !gw.wroteHeader {
+        gw.WriteHeader(http.StatusOK)
+    }
+    if gw.decided {
+        if gw.gz != nil {
+            return gw.gz.Write(b)
+        }
+        return gw.ResponseWriter.Write(b)
+    }
+
+    gw.buf = append(gw.buf, b...)
+    if len(gw.buf) >= gw.minSize {
+        if err := gw.decide(); err != nil {
+            return 0, err
+        }
+    }
+    return len(b), nil
+}
+
+// decide picks compressed or plain output, sends the header and writes out the buffer
+func (gw *gzipResponseWriter) decide() error {
+    gw.decided = true
+    header := gw.Header()
+    if header.Get("Content-Type") == "" && len(gw.buf) > 0 {
+        header.Set("Content-Type", http.DetectContentType(gw.buf))
+    }
+
+    if len(gw.buf) >= gw.minSize && header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type")) {
+        header.Set("Content-Encoding", "gzip")
+        header.Del("Content-Length")
+        gw.gz = gzipWriterPool.Get().(*gzip.Writer)
+        gw.gz.Reset(gw.ResponseWriter)
+    }
+
+    gw.ResponseWriter.WriteHeader(gw.status)
+    buf := gw.buf
+    gw.buf = nil
+    if len(buf) == 0 {
+        return nil
+    }
+    if gw.gz != nil {
+        _, err := gw.gz.Write(buf)
+        return err
+    }
+    _, err := gw.ResponseWriter.Write(buf)
+    return err
+}
+
+// Flush sends what has been written so far. ReverseProxy flushes after every read of a body
+// of unknown length, so a short buffer is held back rather than settling on plain output;
+// event streams, which need each event delivered, are never held.
+func (gw *gzipResponseWriter) Flush() {
+    if !gw.wroteHeader {
+        gw.WriteHeader(http.StatusOK)
+    }
+    if !gw.decided {
+        if len(gw.buf) < gw.minSize && !strings.HasPrefix(gw.Header().Get("Content-Type"), "text/event-stream") {
+            return
+        }
+        gw.decide()
+    }
+    if gw.gz != nil {
+        gw.gz.Flush()
+    }
+    if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
+
+func (gw *gzipResponseWriter) close() {
+    if !gw.decided && gw.wroteHeader {
+        gw.decide()
+    }
+    if gw.gz != nil {
+        gw.gz.Close()
+        gzipWriterPool.Put(gw.gz)
+        gw.gz = nil
+    }
+}
+
+func compressible(contentType string) bool {
+    contentType = strings.ToLower(contentType)
+    for _, prefix := range incompressibleTypes {
+        if strings.HasPrefix(contentType, prefix) {
+            return false
+        }
+    }
+    return true
+}
\ No newline at end of file
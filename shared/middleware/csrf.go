@@ -0,0 +1,109 @@
+// shared/middleware/csrf.go
+package middleware
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    csrfCookieName = "csrf_session"
+    csrfHeaderName = "X-CSRF-Token"
+)
+
+// CSRF issues and verifies signed tokens for cookie-based requests. A token is bound to the
+// random session value in the csrf_session cookie and carries its own expiry, so a token
+// cannot be replayed from another browser or after it expires.
+type CSRF struct {
+    secret []byte
+    ttl    time.Duration
+}
+
+func NewCSRF(secret string, ttl time.Duration) *CSRF {
+    return &CSRF{secret: []byte(secret), ttl: ttl}
+}
+
+// TokenHandler serves GET /csrf-token, starting a CSRF session when the browser has none
+func (c *CSRF) TokenHandler(w http.ResponseWriter, r *http.Request) {
+    session := ""
+    if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+        session = cookie.Value
+    } else {
+        buf := make([]byte, 32)
+        if _, err := rand.Read(buf); err != nil {
+            respondWithError(w, http.StatusInternalServerError, "Error generating CSRF session")
+            return
+        }
+        session = base64.RawURLEncoding.EncodeToString(buf)
+        http.SetCookie(w, &http.Cookie{
+            Name:     csrfCookieName,
+            Value:    session,
+            Path:     "/",
+            HttpOnly: true,
+            Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+            SameSite: http.SameSiteStrictMode,
+        })
+    }
+
+    expiresAt := time.Now().Add(c.ttl)
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "csrf_token": c.sign(session, expiresAt.Unix()),
+        "expires_at": expiresAt,
+    })
+}
+
+// Protect rejects state-changing requests without a valid token in the X-CSRF-Token header.
+// Requests authenticated with a Bearer token are exempt since browsers never attach those
+// automatically.
+func (c *CSRF) Protect(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case http.MethodGet, http.MethodHead, http.MethodOptions:
+            next(w, r)
+            return
+        }
+        if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+            next(w, r)
+            return
+        }
+
+        cookie, err := r.Cookie(csrfCookieName)
+        if err != nil || !c.valid(r.Header.Get(csrfHeaderName), cookie.Value, time.Now()) {
+            respondWithErrorCode(w, http.StatusForbidden, "CSRF_INVALID", "Missing or invalid CSRF token")
+            return
+        }
+        next(w, r)
+    }
+}
+
+// sign returns "<expiry>.<signature>" where the signature covers the session and expiry
+func (c *CSRF) sign(session string, expiresAt int64) string {
+    expiry := strconv.FormatInt(expiresAt, 10)
+    mac := hmac.New(sha256.New, c.secret)
+    mac.Write([]byte(session + "|" + expiry))
+    return expiry + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *CSRF) valid(token, session string, now time.Time) bool {
+    if token == "" || session == "" {
+        return false
+    }
+    expiry, _, ok := strings.Cut(token, ".")
+    if !ok {
+        return false
+    }
+    expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+    if err != nil || now.Unix() > expiresAt {
+        return false
+    }
+    return hmac.Equal([]byte(token), []byte(c.sign(session, expiresAt)))
+}
\ No newline at end of file
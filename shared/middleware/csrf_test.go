@@ -0,0 +1,120 @@
+package middleware
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+const testCSRFSecret = "csrf-test-secret-that-is-at-least-32-chars"
+
+// issueCSRFToken fetches a token from TokenHandler and returns it with the session cookie
+func issueCSRFToken(t *testing.T, c *CSRF) (string, *http.Cookie) {
+    t.Helper()
+    rec := httptest.NewRecorder()
+    c.TokenHandler(rec, httptest.NewRequest("GET", "/csrf-token", nil))
+
+    var body struct {
+        CSRFToken string `json:"csrf_token"`
+    }
+    if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+        t.Fatalf("decode token response: %v", err)
+    }
+    for _, cookie := range rec.Result().Cookies() {
+        if cookie.Name == csrfCookieName {
+            return body.CSRFToken, cookie
+        }
+    }
+    t.Fatal("TokenHandler did not set the session cookie")
+    return "", nil
+}
+
+func protectedStatus(c *CSRF, token string, cookie *http.Cookie) int {
+    req := httptest.NewRequest("POST", "/auth/login", strings.NewReader("{}"))
+    if token != "" {
+        req.Header.Set(csrfHeaderName, token)
+    }
+    if cookie != nil {
+        req.AddCookie(cookie)
+    }
+    rec := httptest.NewRecorder()
+    c.Protect(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNoContent)
+    })(rec, req)
+    return rec.Code
+}
+
+func TestCSRFValidToken(t *testing.T) {
+    c := NewCSRF(testCSRFSecret, time.Hour)
+    token, cookie := issueCSRFToken(t, c)
+
+    if got := protectedStatus(c, token, cookie); got != http.StatusNoContent {
+        t.Errorf("valid token: status = %d, want 204", got)
+    }
+}
+
+func TestCSRFTamperedToken(t *testing.T) {
+    c := NewCSRF(testCSRFSecret, time.Hour)
+    token, cookie := issueCSRFToken(t, c)
+    expiry, signature, _ := strings.Cut(token, ".")
+
+    // Swap the first signature character for another valid base64url one
+    first := "A"
+    if strings.HasPrefix(signature, "A") {
+        first = "B"
+    }
+    otherSession := *cookie
+    otherSession.Value = "another-browser-session"
+
+    cases := map[string]struct {
+        token  string
+        cookie *http.Cookie
+    }{
+        "altered signature": {expiry + "." + first + signature[1:], cookie},
+        "extended expiry":   {"9999999999." + signature, cookie},
+        "other session":     {token, &otherSession},
+        "no session cookie": {token, nil},
+        "missing token":     {"", cookie},
+        "wrong secret":      {NewCSRF(strings.Repeat("x", 40), time.Hour).sign(cookie.Value, time.Now().Add(time.Hour).Unix()), cookie},
+    }
+    for name, tc := range cases {
+        if got := protectedStatus(c, tc.token, tc.cookie); got != http.StatusForbidden {
+            t.Errorf("%s: status = %d, want 403", name, got)
+        }
+    }
+}
+
+func TestCSRFExpiredToken(t *testing.T) {
+    c := NewCSRF(testCSRFSecret, time.Hour)
+    _, cookie := issueCSRFToken(t, c)
+    expired := c.sign(cookie.Value, time.Now().Add(-time.Second).Unix())
+
+    if got := protectedStatus(c, expired, cookie); got != http.StatusForbidden {
+        t.Errorf("expired token: status = %d, want 403", got)
+    }
+    if c.valid(c.sign(cookie.Value, time.Now().Unix()+60), cookie.Value, time.Now().Add(2*time.Minute)) {
+        t.Error("token accepted after its expiry")
+    }
+}
+
+func TestCSRFSkipsSafeAndBearerRequests(t *testing.T) {
+    c := NewCSRF(testCSRFSecret, time.Hour)
+    next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+    get := httptest.NewRecorder()
+    c.Protect(next)(get, httptest.NewRequest("GET", "/auth/login", nil))
+    if get.Code != http.StatusNoContent {
+        t.Errorf("GET: status = %d, want 204", get.Code)
+    }
+
+    req := httptest.NewRequest("POST", "/auth/logout", nil)
+    req.Header.Set("Authorization", "Bearer token")
+    bearer := httptest.NewRecorder()
+    c.Protect(next)(bearer, req)
+    if bearer.Code != http.StatusNoContent {
+        t.Errorf("bearer POST: status = %d, want 204", bearer.Code)
+    }
+}
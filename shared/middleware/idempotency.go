@@ -0,0 +1,153 @@
+// shared/middleware/idempotency.go
+package middleware
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "io"
+    "log"
+    "net/http"
+    "time"
+)
+
+const (
+    idempotencyKeyHeader = "Idempotency-Key"
+    maxIdempotencyKeyLen = 255
+    maxIdempotentBody    = 1 << 20
+)
+
+// idempotentRecorder keeps a copy of the response so it can be stored for replays
+type idempotentRecorder struct {
+    http.ResponseWriter
+    status int
+    body   bytes.Buffer
+}
+
+func (rec *idempotentRecorder) WriteHeader(status int) {
+    rec.status = status
+    rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotentRecorder) Write(b []byte) (int, error) {
+    rec.body.Write(b)
+    return rec.ResponseWriter.Write(b)
+}
+
+// Idempotency makes requests carrying an Idempotency-Key header safe to retry. The first
+// request with a key runs normally and its response is stored in the service's
+// idempotency_keys table for ttl; later requests with the same key, company and endpoint get
+// the stored response back instead of running the handler again. A retry that arrives while
+// the first request is still running is rejected with 409 IN_PROGRESS, and reusing a key
+// with a different body is rejected with 422. Server errors are not stored so the client can
+// retry them. Requests without the header are passed through unchanged.
+//
+// It must run after NewAuthMiddleware, which supplies the company the key is scoped to.
+func Idempotency(db *sql.DB, ttl time.Duration) Middleware {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            key := r.Header.Get(idempotencyKeyHeader)
+            if key == "" {
+                next(w, r)
+                return
+            }
+            if len(key) > maxIdempotencyKeyLen {
+                respondWithErrorCode(w, http.StatusBadRequest, "INVALID_IDEMPOTENCY_KEY", "Idempotency-Key is too long")
+                return
+            }
+
+            companyID, _ := r.Context().Value("company_id").(int)
+            endpoint := r.Method + " " + r.URL.Path
+
+            body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+            if err != nil {
+                respondWithErrorCode(w, http.StatusBadRequest, "INVALID_BODY", "Error reading request body")
+                return
+            }
+            if len(body) > maxIdempotentBody {
+                respondWithErrorCode(w, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", "Request body is too large")
+                return
+            }
+            r.Body = io.NopCloser(bytes.NewReader(body))
+            sum := sha256.Sum256(body)
+            requestHash := hex.EncodeToString(sum[:])
+
+            ctx := r.Context()
+            _, err = db.ExecContext(ctx, `DELETE FROM idempotency_keys
+                                          WHERE company_id = $1 AND endpoint = $2 AND idempotency_key = $3
+                                            AND expires_at < CURRENT_TIMESTAMP`, companyID, endpoint, key)
+            if err != nil {
+                respondWithErrorCode(w, http.StatusInternalServerError, "DB_ERROR", "Error checking idempotency key")
+                return
+            }
+
+            // Claiming the key with an insert serializes concurrent requests: only one wins
+            result, err := db.ExecContext(ctx, `INSERT INTO idempotency_keys (company_id, endpoint, idempotency_key, request_hash, expires_at)
+                                                VALUES ($1, $2, $3, $4, $5)
+                                                ON CONFLICT (company_id, endpoint, idempotency_key) DO NOTHING`,
+                companyID, endpoint, key, requestHash, time.Now().Add(ttl))
+            if err != nil {
+                respondWithErrorCode(w, http.StatusInternalServerError, "DB_ERROR", "Error storing idempotency key")
+                return
+            }
+            if claimed, _ := result.RowsAffected(); claimed == 0 {
+                replayIdempotentResponse(w, r, db, companyID, endpoint, key, requestHash)
+                return
+            }
+
+            rec := &idempotentRecorder{ResponseWriter: w, status: http.StatusOK}
+            next(rec, r)
+
+            if rec.status >= 500 {
+                _, err = db.Exec("DELETE FROM idempotency_keys WHERE company_id = $1 AND endpoint = $2 AND idempotency_key = $3",
+                    companyID, endpoint, key)
+            } else {
+                _, err = db.Exec(`UPDATE idempotency_keys
+                                  SET response_status = $1, response_body = $2, content_type = $3, completed_at = CURRENT_TIMESTAMP
+                                  WHERE company_id = $4 AND endpoint = $5 AND idempotency_key = $6`,
+                    rec.status, rec.body.Bytes(), rec.Header().Get("Content-Type"), companyID, endpoint, key)
+            }
+            if err != nil {
+                log.Printf("Failed to store response for idempotency key %q: %v", key, err)
+            }
+        }
+    }
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, r *http.Request, db *sql.DB, companyID int, endpoint, key, requestHash string) {
+    var storedHash string
+    var status sql.NullInt64
+    var body []byte
+    var contentType sql.NullString
+    err := db.QueryRowContext(r.Context(), `SELECT request_hash, response_status, response_body, content_type
+                                            FROM idempotency_keys
+                                            WHERE company_id = $1 AND endpoint = $2 AND idempotency_key = $3`,
+        companyID, endpoint, key).Scan(&storedHash, &status, &body, &contentType)
+    if err == sql.ErrNoRows {
+        // The first request failed and released the key in the meantime
+        respondWithErrorCode(w, http.StatusConflict, "IN_PROGRESS", "A request with this Idempotency-Key is being processed, retry shortly")
+        return
+    }
+    if err != nil {
+        respondWithErrorCode(w, http.StatusInternalServerError, "DB_ERROR", "Error reading idempotency key")
+        return
+    }
+
+    if storedHash != requestHash {
+        respondWithErrorCode(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED",
+            "Idempotency-Key was already used with a different request body")
+        return
+    }
+    if !status.Valid {
+        respondWithErrorCode(w, http.StatusConflict, "IN_PROGRESS", "A request with this Idempotency-Key is being processed, retry shortly")
+        return
+    }
+
+    if contentType.Valid && contentType.String != "" {
+        w.Header().Set("Content-Type", contentType.String)
+    }
+    w.Header().Set("Idempotent-Replayed", "true")
+    w.WriteHeader(int(status.Int64))
+    w.Write(body)
+}
\ No newline at end of file
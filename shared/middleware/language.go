@@ -0,0 +1,18 @@
+// shared/middleware/language.go
+package middleware
+
+import (
+    "net/http"
+
+    "github.com/massehanto/accounting-system-go/shared/i18n"
+)
+
+// Localization negotiates the response language from Accept-Language and declares it in
+// Content-Language before any handler runs, which is where error responses read it from.
+func Localization(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Language", i18n.NegotiateLanguage(r.Header.Get("Accept-Language")))
+        w.Header().Add("Vary", "Accept-Language")
+        next(w, r)
+    }
+}
\ No newline at end of file
@@ -3,15 +3,20 @@ package middleware
 
 import (
     "context"
+    "crypto/rand"
     "database/sql"
+    "encoding/hex"
     "encoding/json"
+    "errors"
     "fmt"
-    "log"
+    "log/slog"
     "net/http"
     "strings"
     "time"
     
     "github.com/dgrijalva/jwt-go"
+
+    "github.com/massehanto/accounting-system-go/shared/i18n"
 )
 
 type Claims struct {
@@ -30,11 +35,114 @@ func SecurityHeaders(next http.HandlerFunc) http.HandlerFunc {
     }
 }
 
+// statusRecorder captures the response status for request logging
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+    rec.status = status
+    rec.ResponseWriter.WriteHeader(status)
+}
+
+// LoggingMiddleware writes one structured log line per request. Every hop gets its own
+// X-Request-ID, while the X-Trace-ID minted at the gateway is carried through so one request
+// can be followed across every service it reaches.
 func LoggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         start := time.Now()
+
+        requestID := newRequestID()
+        traceID := r.Header.Get("X-Trace-ID")
+        if traceID == "" || len(traceID) > 128 {
+            traceID = newRequestID()
+        }
+        r.Header.Set("X-Request-ID", requestID)
+        r.Header.Set("X-Trace-ID", traceID)
+        w.Header().Set("X-Request-ID", requestID)
+        w.Header().Set("X-Trace-ID", traceID)
+
+        ctx := context.WithValue(r.Context(), "request_id", requestID)
+        ctx = context.WithValue(ctx, "trace_id", traceID)
+
+        rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+        next(rec, r.WithContext(ctx))
+
+        level := slog.LevelInfo
+        switch {
+        case rec.status >= 500:
+            level = slog.LevelError
+        case rec.status >= 400:
+            level = slog.LevelWarn
+        }
+
+        // Auth runs inside this middleware and sets the identity headers on the shared header map
+        slog.Default().LogAttrs(r.Context(), level, "request",
+            slog.String("request_id", requestID),
+            slog.String("trace_id", traceID),
+            slog.String("method", r.Method),
+            slog.String("path", r.URL.Path),
+            slog.Int("status", rec.status),
+            slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+            slog.String("remote_ip", ClientIP(r)),
+            slog.String("user_id", r.Header.Get("User-ID")),
+            slog.String("company_id", r.Header.Get("Company-ID")),
+        )
+    }
+}
+
+func newRequestID() string {
+    buf := make([]byte, 16)
+    if _, err := rand.Read(buf); err != nil {
+        return fmt.Sprintf("%d", time.Now().UnixNano())
+    }
+    return hex.EncodeToString(buf)
+}
+
+// IdentityHeaders carry the caller's identity to handlers and downstream services. They are
+// only trusted when set from a validated token, never as sent by a client.
+var IdentityHeaders = []string{"User-ID", "Company-ID", "User-Role"}
+
+// ParseToken validates a signed access token and returns its claims
+func ParseToken(tokenString string, jwtKey []byte) (*Claims, error) {
+    claims := &Claims{}
+    token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+            return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+        }
+        return jwtKey, nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    if !token.Valid {
+        return nil, errors.New("invalid token")
+    }
+    return claims, nil
+}
+
+// SignToken issues an access token for claims. Services use it to act for a user in a company
+// the token they were called with does not cover, such as one the user has just created.
+func SignToken(claims *Claims, jwtKey []byte) (string, error) {
+    return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+}
+
+// SetIdentityHeaders replaces any identity headers in h with the values from validated claims
+func SetIdentityHeaders(h http.Header, claims *Claims) {
+    h.Set("User-ID", fmt.Sprintf("%d", claims.UserID))
+    h.Set("Company-ID", fmt.Sprintf("%d", claims.CompanyID))
+    h.Set("User-Role", claims.Role)
+}
+
+// StripIdentityHeaders removes identity headers on routes that do not authenticate, so a
+// handler never acts on an identity nobody verified.
+func StripIdentityHeaders(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        for _, header := range IdentityHeaders {
+            r.Header.Del(header)
+        }
         next(w, r)
-        log.Printf("%s %s %v", r.Method, r.URL.Path, time.Since(start))
     }
 }
 
@@ -54,31 +162,60 @@ func NewAuthMiddleware(jwtSecret string) func(http.HandlerFunc) http.HandlerFunc
                 return
             }
 
-            tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-            claims := &Claims{}
-            
-            token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-                return jwtKey, nil
-            })
-
-            if err != nil || !token.Valid {
+            claims, err := ParseToken(strings.TrimPrefix(authHeader, "Bearer "), jwtKey)
+            if err != nil {
                 respondWithError(w, http.StatusUnauthorized, "Invalid token")
                 return
             }
 
-            // Add claims to request headers
-            r.Header.Set("User-ID", fmt.Sprintf("%d", claims.UserID))
-            r.Header.Set("Company-ID", fmt.Sprintf("%d", claims.CompanyID))
-            r.Header.Set("User-Role", claims.Role)
+            // Drop whatever identity the client sent before adding the verified claims, so
+            // downstream code never sees a forged value
+            for _, header := range IdentityHeaders {
+                r.Header.Del(header)
+            }
+            SetIdentityHeaders(r.Header, claims)
             
             ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
             ctx = context.WithValue(ctx, "company_id", claims.CompanyID)
+            ctx = context.WithValue(ctx, "role", claims.Role)
             
             next(w, r.WithContext(ctx))
         }
     }
 }
 
+// OptionalAuth is NewAuthMiddleware for routes that also serve anonymous callers: a valid
+// bearer token sets the identity as usual, while a missing or invalid one leaves the request
+// anonymous instead of rejecting it.
+func OptionalAuth(jwtSecret string) func(http.HandlerFunc) http.HandlerFunc {
+    jwtKey := []byte(jwtSecret)
+    
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            for _, header := range IdentityHeaders {
+                r.Header.Del(header)
+            }
+
+            authHeader := r.Header.Get("Authorization")
+            if !strings.HasPrefix(authHeader, "Bearer ") {
+                next(w, r)
+                return
+            }
+            claims, err := ParseToken(strings.TrimPrefix(authHeader, "Bearer "), jwtKey)
+            if err != nil {
+                next(w, r)
+                return
+            }
+
+            SetIdentityHeaders(r.Header, claims)
+            ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+            ctx = context.WithValue(ctx, "company_id", claims.CompanyID)
+            ctx = context.WithValue(ctx, "role", claims.Role)
+            next(w, r.WithContext(ctx))
+        }
+    }
+}
+
 func HealthCheck(db *sql.DB, serviceName string) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         status := map[string]interface{}{
@@ -100,6 +237,10 @@ func HealthCheck(db *sql.DB, serviceName string) http.HandlerFunc {
 }
 
 func respondWithError(w http.ResponseWriter, statusCode int, message string) {
+    respondWithErrorCode(w, statusCode, "", message)
+}
+
+func respondWithErrorCode(w http.ResponseWriter, statusCode int, code, message string) {
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(statusCode)
     
@@ -107,6 +248,16 @@ func respondWithError(w http.ResponseWriter, statusCode int, message string) {
         "error":     message,
         "timestamp": time.Now(),
     }
+    if code != "" {
+        response["code"] = code
+    }
+    if traceID := w.Header().Get("X-Trace-ID"); traceID != "" {
+        response["trace_id"] = traceID
+    }
+    if code == "" && statusCode == http.StatusTooManyRequests {
+        code = "RATE_LIMITED"
+    }
+    response["user_message"] = i18n.Message(w.Header().Get("Content-Language"), code, statusCode)
     
     json.NewEncoder(w).Encode(response)
 }
\ No newline at end of file
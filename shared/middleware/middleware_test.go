@@ -0,0 +1,63 @@
+package middleware
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+const testJWTSecret = "test-secret-that-is-at-least-32-characters"
+
+func spoofedRequest() *http.Request {
+    req := httptest.NewRequest("GET", "/accounts", nil)
+    req.Header.Set("User-ID", "1")
+    req.Header.Set("Company-ID", "99")
+    req.Header.Set("User-Role", "admin")
+    return req
+}
+
+func TestAuthMiddlewareReplacesSpoofedIdentity(t *testing.T) {
+    token, err := SignToken(&Claims{UserID: 7, CompanyID: 3, Role: "user"}, []byte(testJWTSecret))
+    if err != nil {
+        t.Fatalf("SignToken: %v", err)
+    }
+
+    var headers http.Header
+    var companyID interface{}
+    handler := NewAuthMiddleware(testJWTSecret)(func(w http.ResponseWriter, r *http.Request) {
+        headers, companyID = r.Header, r.Context().Value("company_id")
+    })
+
+    req := spoofedRequest()
+    req.Header.Set("Authorization", "Bearer "+token)
+    handler(httptest.NewRecorder(), req)
+
+    if headers.Get("User-ID") != "7" || headers.Get("Company-ID") != "3" || headers.Get("User-Role") != "user" {
+        t.Errorf("identity headers = %q/%q/%q, want the token's 7/3/user",
+            headers.Get("User-ID"), headers.Get("Company-ID"), headers.Get("User-Role"))
+    }
+    if companyID != 3 {
+        t.Errorf("company_id in context = %v, want 3", companyID)
+    }
+
+    // Without a token the spoofed identity never reaches the handler
+    headers = nil
+    rec := httptest.NewRecorder()
+    handler(rec, spoofedRequest())
+    if rec.Code != http.StatusUnauthorized || headers != nil {
+        t.Errorf("no token: status = %d, handler called = %v; want 401 and not called", rec.Code, headers != nil)
+    }
+}
+
+func TestStripIdentityHeaders(t *testing.T) {
+    var headers http.Header
+    StripIdentityHeaders(func(w http.ResponseWriter, r *http.Request) {
+        headers = r.Header
+    })(httptest.NewRecorder(), spoofedRequest())
+
+    for _, header := range IdentityHeaders {
+        if value := headers.Get(header); value != "" {
+            t.Errorf("%s = %q reached an unauthenticated handler", header, value)
+        }
+    }
+}
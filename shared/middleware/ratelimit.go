@@ -0,0 +1,375 @@
+// shared/middleware/ratelimit.go
+package middleware
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+    "github.com/redis/go-redis/v9"
+    "golang.org/x/time/rate"
+)
+
+// Idle in-memory limiters are evicted after this long; a client idle that long has a full bucket anyway
+const rateLimitIdleTTL = 10 * time.Minute
+
+// RateLimitTiers sets per-minute limits for each kind of caller. Authenticated requests are
+// counted against both their user and their company; anonymous requests against their IP.
+// A zero limit turns that tier off.
+type RateLimitTiers struct {
+    IP      int
+    User    int
+    Company int
+}
+
+type rateDecision struct {
+    allowed   bool
+    limit     int
+    remaining int
+    reset     time.Duration
+}
+
+type rateLimiter interface {
+    // allow counts a request against key and reports whether it may proceed
+    allow(ctx context.Context, key string) rateDecision
+}
+
+// RateLimit applies requestsPerMinute to each client IP and each user, and a multiple of it
+// (RATE_LIMIT_COMPANY_FACTOR, default 10) to each company, so one office behind a NAT does not
+// share a single user's allowance. Limits are shared through Redis when REDIS_URL is set,
+// otherwise they are kept in process memory. A non-positive limit disables limiting.
+func RateLimit(requestsPerMinute int) Middleware {
+    return RateLimitByTier(RateLimitTiers{
+        IP:      requestsPerMinute,
+        User:    requestsPerMinute,
+        Company: requestsPerMinute * companyRateLimitFactor(),
+    })
+}
+
+// RateLimitByTier keys limits per route on the authenticated user and company, falling back
+// to client IP when auth middleware has not run. Identity is read from the request context
+// set by NewAuthMiddleware, not from headers a client could send on public routes.
+// X-RateLimit-* headers describe the tightest tier on both allowed and denied responses.
+func RateLimitByTier(tiers RateLimitTiers) Middleware {
+    ipLimiter := newRateLimiter("ip", tiers.IP)
+    userLimiter := newRateLimiter("user", tiers.User)
+    companyLimiter := newRateLimiter("company", tiers.Company)
+
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            route := routeKey(r)
+
+            var decisions []rateDecision
+            userID, _ := r.Context().Value("user_id").(int)
+            companyID, _ := r.Context().Value("company_id").(int)
+            if userID != 0 {
+                if companyLimiter != nil && companyID != 0 {
+                    decisions = append(decisions, companyLimiter.allow(r.Context(), fmt.Sprintf("%d|%s", companyID, route)))
+                }
+                if userLimiter != nil {
+                    decisions = append(decisions, userLimiter.allow(r.Context(), fmt.Sprintf("%d|%s", userID, route)))
+                }
+            } else if ipLimiter != nil {
+                decisions = append(decisions, ipLimiter.allow(r.Context(), ClientIP(r)+"|"+route))
+            }
+
+            if len(decisions) == 0 {
+                next(w, r)
+                return
+            }
+
+            // Report the denied tier if any, otherwise the one closest to its limit
+            applied := decisions[0]
+            for _, decision := range decisions[1:] {
+                if (!decision.allowed && applied.allowed) ||
+                    (decision.allowed == applied.allowed && decision.remaining < applied.remaining) {
+                    applied = decision
+                }
+            }
+
+            resetSeconds := strconv.Itoa(ceilSeconds(applied.reset))
+            w.Header().Set("X-RateLimit-Limit", strconv.Itoa(applied.limit))
+            w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(applied.remaining))
+            w.Header().Set("X-RateLimit-Reset", resetSeconds)
+
+            if !applied.allowed {
+                w.Header().Set("Retry-After", resetSeconds)
+                respondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+                return
+            }
+            next(w, r)
+        }
+    }
+}
+
+// newRateLimiter returns nil for a disabled tier
+func newRateLimiter(tier string, requestsPerMinute int) rateLimiter {
+    if requestsPerMinute <= 0 {
+        return nil
+    }
+
+    memory := newMemoryLimiter(requestsPerMinute, rateLimitIdleTTL)
+    if client := sharedRedisClient(); client != nil {
+        return &redisLimiter{
+            client:   client,
+            prefix:   fmt.Sprintf("ratelimit:%s:%d", tier, requestsPerMinute),
+            limit:    requestsPerMinute,
+            window:   time.Minute,
+            fallback: memory,
+        }
+    }
+    return memory
+}
+
+func companyRateLimitFactor() int {
+    factor, err := strconv.Atoi(os.Getenv("RATE_LIMIT_COMPANY_FACTOR"))
+    if err != nil || factor <= 0 {
+        return 10
+    }
+    return factor
+}
+
+func ceilSeconds(d time.Duration) int {
+    seconds := int((d + time.Second - 1) / time.Second)
+    if seconds < 1 {
+        return 1
+    }
+    return seconds
+}
+
+type visitor struct {
+    limiter  *rate.Limiter
+    lastSeen time.Time
+}
+
+// memoryLimiter is a token bucket per key, local to this process. Keys idle for longer than
+// ttl are evicted by a background sweeper, so memory stays bounded by recent traffic rather
+// than by every client ever seen.
+type memoryLimiter struct {
+    mu       sync.Mutex
+    visitors map[string]*visitor
+    limit    rate.Limit
+    burst    int
+    interval time.Duration
+    ttl      time.Duration
+}
+
+// newMemoryLimiter starts the limiter's sweeper, which runs for the life of the process like
+// the middleware holding the limiter
+func newMemoryLimiter(requestsPerMinute int, ttl time.Duration) *memoryLimiter {
+    interval := time.Minute / time.Duration(requestsPerMinute)
+    m := &memoryLimiter{
+        visitors: make(map[string]*visitor),
+        limit:    rate.Every(interval),
+        burst:    requestsPerMinute,
+        interval: interval,
+        ttl:      ttl,
+    }
+    go func() {
+        ticker := time.NewTicker(ttl)
+        defer ticker.Stop()
+        for now := range ticker.C {
+            m.evictIdle(now)
+        }
+    }()
+    return m
+}
+
+// evictIdle drops the keys not seen for longer than ttl before now
+func (m *memoryLimiter) evictIdle(now time.Time) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for key, v := range m.visitors {
+        if now.Sub(v.lastSeen) > m.ttl {
+            delete(m.visitors, key)
+        }
+    }
+}
+
+func (m *memoryLimiter) allow(ctx context.Context, key string) rateDecision {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := time.Now()
+    v, ok := m.visitors[key]
+    if !ok {
+        v = &visitor{limiter: rate.NewLimiter(m.limit, m.burst)}
+        m.visitors[key] = v
+    }
+    v.lastSeen = now
+
+    allowed := v.limiter.AllowN(now, 1)
+    tokens := v.limiter.TokensAt(now)
+
+    decision := rateDecision{allowed: allowed, limit: m.burst, remaining: int(tokens)}
+    if decision.remaining < 0 {
+        decision.remaining = 0
+    }
+    if allowed {
+        // Time until the bucket is full again
+        decision.reset = time.Duration((float64(m.burst) - tokens) * float64(m.interval))
+    } else {
+        // Time until the next token
+        decision.reset = time.Duration((1 - tokens) * float64(m.interval))
+    }
+    return decision
+}
+
+// Counts requests in a fixed window; the expiry is only set by the request that opens the window
+var rateLimitScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+    redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+// redisLimiter counts requests per key in Redis so every replica enforces the same limit.
+// When Redis cannot be reached it falls back to the in-memory limiter rather than failing requests.
+type redisLimiter struct {
+    client   *redis.Client
+    prefix   string
+    limit    int
+    window   time.Duration
+    fallback *memoryLimiter
+}
+
+func (l *redisLimiter) allow(ctx context.Context, key string) rateDecision {
+    ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+    defer cancel()
+
+    result, err := rateLimitScript.Run(ctx, l.client, []string{l.prefix + ":" + key}, l.window.Milliseconds()).Int64Slice()
+    if err != nil || len(result) != 2 {
+        log.Printf("Rate limit store unavailable, using in-memory limiter: %v", err)
+        return l.fallback.allow(ctx, key)
+    }
+
+    count, ttl := int(result[0]), time.Duration(result[1])*time.Millisecond
+    decision := rateDecision{allowed: count <= l.limit, limit: l.limit, remaining: l.limit - count, reset: ttl}
+    if decision.remaining < 0 {
+        decision.remaining = 0
+    }
+    return decision
+}
+
+var (
+    redisOnce   sync.Once
+    redisClient *redis.Client
+)
+
+// sharedRedisClient returns one client per process built from REDIS_URL, or nil when unset
+func sharedRedisClient() *redis.Client {
+    redisOnce.Do(func() {
+        redisURL := os.Getenv("REDIS_URL")
+        if redisURL == "" {
+            return
+        }
+        options, err := redis.ParseURL(redisURL)
+        if err != nil {
+            log.Fatalf("Invalid REDIS_URL: %v", err)
+        }
+        redisClient = redis.NewClient(options)
+    })
+    return redisClient
+}
+
+var (
+    trustedProxiesOnce sync.Once
+    trustedProxyNets   []*net.IPNet
+)
+
+// trustedProxies parses TRUSTED_PROXIES, a comma-separated list of IPs and CIDR ranges, once
+// per process. Unset, no proxy is trusted.
+func trustedProxies() []*net.IPNet {
+    trustedProxiesOnce.Do(func() {
+        nets, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+        if err != nil {
+            log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+        }
+        trustedProxyNets = nets
+    })
+    return trustedProxyNets
+}
+
+func parseTrustedProxies(value string) ([]*net.IPNet, error) {
+    var nets []*net.IPNet
+    for _, entry := range strings.Split(value, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if !strings.Contains(entry, "/") {
+            ip := net.ParseIP(entry)
+            if ip == nil {
+                return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+            }
+            bits := 8 * net.IPv4len
+            if ip.To4() == nil {
+                bits = 8 * net.IPv6len
+            }
+            entry = fmt.Sprintf("%s/%d", entry, bits)
+        }
+        _, ipNet, err := net.ParseCIDR(entry)
+        if err != nil {
+            return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+        }
+        nets = append(nets, ipNet)
+    }
+    return nets, nil
+}
+
+// ClientIP is the peer address, or when the peer is a proxy listed in TRUSTED_PROXIES, the
+// last X-Forwarded-For entry, which is the address that proxy saw. Anything else in the
+// header comes from the client and could be forged, so it is never used.
+func ClientIP(r *http.Request) string {
+    return clientIP(r, trustedProxies())
+}
+
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    if !isTrustedProxy(host, trusted) {
+        return host
+    }
+    if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+        parts := strings.Split(forwarded, ",")
+        if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+            return ip
+        }
+    }
+    return host
+}
+
+func isTrustedProxy(host string, trusted []*net.IPNet) bool {
+    ip := net.ParseIP(host)
+    if ip == nil {
+        return false
+    }
+    for _, ipNet := range trusted {
+        if ipNet.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// routeKey prefers the mux route template so /products/1 and /products/2 share a limit
+func routeKey(r *http.Request) string {
+    if route := mux.CurrentRoute(r); route != nil {
+        if template, err := route.GetPathTemplate(); err == nil {
+            return r.Method + " " + template
+        }
+    }
+    return r.Method + " " + r.URL.Path
+}
\ No newline at end of file
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+    "context"
+    "fmt"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestClientIPOnlyTrustsConfiguredProxies(t *testing.T) {
+    trusted, err := parseTrustedProxies("172.20.0.0/16, 10.0.0.5")
+    if err != nil {
+        t.Fatalf("parseTrustedProxies: %v", err)
+    }
+
+    cases := []struct {
+        name, remoteAddr, forwarded, want string
+    }{
+        {"direct client", "203.0.113.7:5000", "", "203.0.113.7"},
+        {"direct client forging the header", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+        {"trusted proxy range", "172.20.0.4:5000", "198.51.100.1, 203.0.113.7", "203.0.113.7"},
+        {"trusted proxy address", "10.0.0.5:5000", "203.0.113.7", "203.0.113.7"},
+        {"trusted proxy without the header", "10.0.0.5:5000", "", "10.0.0.5"},
+        {"untrusted neighbour", "10.0.0.6:5000", "203.0.113.7", "10.0.0.6"},
+    }
+    for _, tc := range cases {
+        req := httptest.NewRequest("GET", "/", nil)
+        req.RemoteAddr = tc.remoteAddr
+        if tc.forwarded != "" {
+            req.Header.Set("X-Forwarded-For", tc.forwarded)
+        }
+        if got := clientIP(req, trusted); got != tc.want {
+            t.Errorf("%s: clientIP = %q, want %q", tc.name, got, tc.want)
+        }
+    }
+
+    // With nothing trusted, as at the gateway, the header never matters
+    req := httptest.NewRequest("GET", "/", nil)
+    req.RemoteAddr = "172.20.0.4:5000"
+    req.Header.Set("X-Forwarded-For", "198.51.100.1")
+    if got := clientIP(req, nil); got != "172.20.0.4" {
+        t.Errorf("no trusted proxies: clientIP = %q, want 172.20.0.4", got)
+    }
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+    for _, value := range []string{"gateway", "10.0.0.0/99", "10.0.0.1, nope"} {
+        if _, err := parseTrustedProxies(value); err == nil {
+            t.Errorf("parseTrustedProxies(%q) succeeded, want an error", value)
+        }
+    }
+}
+
+func TestMemoryLimiterEvictsIdleKeys(t *testing.T) {
+    m := newMemoryLimiter(2, time.Hour)
+    ctx := context.Background()
+
+    m.allow(ctx, "idle")
+    m.allow(ctx, "idle")
+    if m.allow(ctx, "idle").allowed {
+        t.Fatal("third request within the minute allowed")
+    }
+    m.allow(ctx, "active")
+
+    m.mu.Lock()
+    m.visitors["idle"].lastSeen = time.Now().Add(-2 * time.Hour)
+    m.mu.Unlock()
+    m.evictIdle(time.Now())
+
+    m.mu.Lock()
+    _, idleKept := m.visitors["idle"]
+    _, activeKept := m.visitors["active"]
+    m.mu.Unlock()
+    if idleKept || !activeKept {
+        t.Fatalf("after eviction: idle kept = %v, active kept = %v; want false, true", idleKept, activeKept)
+    }
+
+    // An evicted key starts again with a full bucket, as it would have had by now anyway
+    if decision := m.allow(ctx, "idle"); !decision.allowed || decision.remaining != 1 {
+        t.Errorf("returning key: allowed = %v, remaining = %d; want true, 1", decision.allowed, decision.remaining)
+    }
+}
+
+func TestMemoryLimiterSweeperBoundsKeys(t *testing.T) {
+    m := newMemoryLimiter(60, 20*time.Millisecond)
+    ctx := context.Background()
+
+    // Many one-off clients at once, as a gateway sees them; run with -race for the locking
+    var wg sync.WaitGroup
+    for i := 0; i < 100; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            m.allow(ctx, fmt.Sprintf("198.51.100.%d|GET /accounts", i))
+        }(i)
+    }
+    wg.Wait()
+
+    deadline := time.Now().Add(2 * time.Second)
+    for {
+        m.mu.Lock()
+        remaining := len(m.visitors)
+        m.mu.Unlock()
+        if remaining == 0 {
+            return
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("%d idle keys still held after the sweeper should have run", remaining)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
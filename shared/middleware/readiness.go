@@ -0,0 +1,137 @@
+// shared/middleware/readiness.go
+package middleware
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "sync"
+    "time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// Pinger is a dependency whose reachability readiness reports, such as a client.Client
+type Pinger interface {
+    Ping(ctx context.Context) error
+}
+
+// ReadinessConfig describes what a service needs before it can take traffic
+type ReadinessConfig struct {
+    ServiceName string
+    DB          *sql.DB
+    // SchemaVersion is the migration version the code expects; zero skips the check
+    SchemaVersion int
+    // Dependencies are other services, by name. They are reported but do not fail the check,
+    // so one service going down does not take every caller out of rotation with it.
+    Dependencies map[string]Pinger
+}
+
+type dependencyStatus struct {
+    Status string `json:"status"`
+    Error  string `json:"error,omitempty"`
+}
+
+// Readiness serves the readiness probe. Unlike HealthCheck, which only says the process is
+// alive, it reports connection pool stats, the schema version and dependency reachability,
+// and answers 503 when the database is unreachable, the pool is exhausted or the schema is
+// behind the code.
+func Readiness(cfg ReadinessConfig) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+        defer cancel()
+
+        ready := true
+        response := map[string]interface{}{
+            "service":   cfg.ServiceName,
+            "timestamp": time.Now().Format(time.RFC3339),
+        }
+
+        if cfg.DB != nil {
+            stats := cfg.DB.Stats()
+            database := map[string]interface{}{
+                "status":               "up",
+                "open_connections":     stats.OpenConnections,
+                "in_use":               stats.InUse,
+                "idle":                 stats.Idle,
+                "max_open_connections": stats.MaxOpenConnections,
+                "wait_count":           stats.WaitCount,
+                "wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+            }
+            // Checked before pinging, which would itself wait for a free connection
+            if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+                database["status"] = "exhausted"
+                ready = false
+            } else if err := cfg.DB.PingContext(ctx); err != nil {
+                database["status"] = "down"
+                ready = false
+            } else {
+                version, err := currentSchemaVersion(ctx, cfg.DB)
+                schema := map[string]interface{}{"version": version, "required": cfg.SchemaVersion}
+                switch {
+                case err != nil:
+                    schema["status"] = "unknown"
+                    ready = false
+                case version < cfg.SchemaVersion:
+                    schema["status"] = "behind"
+                    ready = false
+                default:
+                    schema["status"] = "current"
+                }
+                response["schema"] = schema
+            }
+            response["database"] = database
+        }
+
+        if len(cfg.Dependencies) > 0 {
+            response["dependencies"] = checkDependencies(ctx, cfg.Dependencies)
+        }
+
+        statusCode := http.StatusOK
+        response["status"] = "ready"
+        if !ready {
+            statusCode = http.StatusServiceUnavailable
+            response["status"] = "not_ready"
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Cache-Control", "no-store")
+        w.WriteHeader(statusCode)
+        json.NewEncoder(w).Encode(response)
+    }
+}
+
+// currentSchemaVersion is the highest applied migration, or zero before any migration has run
+func currentSchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+    var exists bool
+    if err := db.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+        return 0, err
+    }
+    if !exists {
+        return 0, nil
+    }
+    var version int
+    err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+    return version, err
+}
+
+func checkDependencies(ctx context.Context, dependencies map[string]Pinger) map[string]dependencyStatus {
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    statuses := make(map[string]dependencyStatus, len(dependencies))
+    for name, dependency := range dependencies {
+        wg.Add(1)
+        go func(name string, dependency Pinger) {
+            defer wg.Done()
+            status := dependencyStatus{Status: "reachable"}
+            if err := dependency.Ping(ctx); err != nil {
+                status = dependencyStatus{Status: "unreachable", Error: err.Error()}
+            }
+            mu.Lock()
+            statuses[name] = status
+            mu.Unlock()
+        }(name, dependency)
+    }
+    wg.Wait()
+    return statuses
+}
\ No newline at end of file
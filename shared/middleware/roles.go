@@ -0,0 +1,42 @@
+// shared/middleware/roles.go
+package middleware
+
+import (
+    "fmt"
+    "net/http"
+)
+
+// roleLevels ranks user roles so permission checks can require a minimum role
+var roleLevels = map[string]int{
+    "user":       1,
+    "accountant": 2,
+    "manager":    3,
+    "admin":      4,
+}
+
+// HasRole reports whether role ranks at least minRole. Unknown roles never satisfy a check.
+func HasRole(role, minRole string) bool {
+    level, ok := roleLevels[role]
+    required, known := roleLevels[minRole]
+    return ok && known && level >= required
+}
+
+// RequireRole rejects requests whose authenticated role ranks below minRole. It must be chained
+// after the auth middleware, which stores the role from the validated token in the context.
+func RequireRole(minRole string) Middleware {
+    if _, ok := roleLevels[minRole]; !ok {
+        panic(fmt.Sprintf("middleware: unknown role %q", minRole))
+    }
+
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            role, _ := r.Context().Value("role").(string)
+            if !HasRole(role, minRole) {
+                respondWithErrorCode(w, http.StatusForbidden, "INSUFFICIENT_ROLE",
+                    fmt.Sprintf("Requires %s role or higher", minRole))
+                return
+            }
+            next(w, r)
+        }
+    }
+}
@@ -14,19 +14,27 @@ import (
     "github.com/rs/cors"
     
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/middleware"
 )
 
-func SetupServer(r *mux.Router, cfg *config.Config) {
-    c := cors.New(cors.Options{
-        AllowedOrigins:   cfg.CORS.AllowedOrigins,
-        AllowedMethods:   cfg.CORS.AllowedMethods,
-        AllowedHeaders:   cfg.CORS.AllowedHeaders,
-        AllowCredentials: true,
-        MaxAge:           300,
-        Debug:            false,
+// NewCORS builds the CORS handler shared by the gateway and services. Preflight requests are
+// answered here with 200 and never reach routing or auth.
+func NewCORS(cfg config.CORSConfig) *cors.Cors {
+    return cors.New(cors.Options{
+        AllowedOrigins:       cfg.AllowedOrigins,
+        AllowedMethods:       cfg.AllowedMethods,
+        AllowedHeaders:       cfg.AllowedHeaders,
+        ExposedHeaders:       cfg.ExposedHeaders,
+        AllowCredentials:     true,
+        MaxAge:               300,
+        OptionsSuccessStatus: http.StatusOK,
+        Debug:                false,
     })
+}
 
-    handler := c.Handler(r)
+func SetupServer(r *mux.Router, cfg *config.Config) {
+    // Every response declares its language, so errors raised before routing are localized too
+    handler := NewCORS(cfg.CORS).Handler(middleware.Localization(r.ServeHTTP))
     
     srv := &http.Server{
         Handler:           handler,
@@ -0,0 +1,68 @@
+package server
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/massehanto/accounting-system-go/shared/config"
+)
+
+func newTestCORS() http.Handler {
+    cfg := config.CORSConfig{
+        AllowedOrigins: []string{"https://app.example.co.id"},
+        AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+        AllowedHeaders: []string{"Authorization", "Content-Type", "X-CSRF-Token"},
+    }
+    // Stands in for routing and auth: anything that gets through is unauthenticated
+    return NewCORS(cfg).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusUnauthorized)
+    }))
+}
+
+func TestCORSReflectsOnlyAllowedOrigins(t *testing.T) {
+    handler := newTestCORS()
+    cases := map[string]string{
+        "https://app.example.co.id": "https://app.example.co.id",
+        "https://evil.example.com":  "",
+        "http://app.example.co.id":  "",
+    }
+    for origin, want := range cases {
+        req := httptest.NewRequest("GET", "/api/accounts", nil)
+        req.Header.Set("Origin", origin)
+        rec := httptest.NewRecorder()
+        handler.ServeHTTP(rec, req)
+
+        if got := rec.Header().Get("Access-Control-Allow-Origin"); got != want {
+            t.Errorf("origin %s: Access-Control-Allow-Origin = %q, want %q", origin, got, want)
+        }
+        if want != "" && rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+            t.Errorf("origin %s: credentials not allowed", origin)
+        }
+    }
+}
+
+func TestCORSPreflightSkipsAuth(t *testing.T) {
+    handler := newTestCORS()
+    req := httptest.NewRequest("OPTIONS", "/api/accounts", nil)
+    req.Header.Set("Origin", "https://app.example.co.id")
+    req.Header.Set("Access-Control-Request-Method", "POST")
+    req.Header.Set("Access-Control-Request-Headers", "Authorization, X-CSRF-Token")
+    rec := httptest.NewRecorder()
+    handler.ServeHTTP(rec, req)
+
+    if rec.Code != http.StatusOK {
+        t.Errorf("preflight status = %d, want 200", rec.Code)
+    }
+    if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.co.id" {
+        t.Errorf("preflight did not allow the origin: %v", rec.Header())
+    }
+
+    // A preflight from another origin is still answered, but without allowing it
+    req.Header.Set("Origin", "https://evil.example.com")
+    rec = httptest.NewRecorder()
+    handler.ServeHTTP(rec, req)
+    if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+        t.Errorf("preflight allowed a disallowed origin: %v", rec.Header())
+    }
+}
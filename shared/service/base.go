@@ -6,8 +6,9 @@ import (
     "database/sql"
     "encoding/json"
     "net/http"
-    "strconv"
     "time"
+    "github.com/massehanto/accounting-system-go/shared/i18n"
+    "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/validation"
 )
 
@@ -16,11 +17,17 @@ type BaseService struct {
 }
 
 type ErrorResponse struct {
-    Error     string    `json:"error"`
-    Code      string    `json:"code,omitempty"`
-    Timestamp time.Time `json:"timestamp"`
+    Error       string    `json:"error"`
+    Code        string    `json:"code,omitempty"`
+    TraceID     string    `json:"trace_id,omitempty"`
+    // UserMessage is safe to show end users, in the language Localization negotiated
+    UserMessage string    `json:"user_message,omitempty"`
+    Timestamp   time.Time `json:"timestamp"`
 }
 
+// RespondWithJSON wraps data in the standard envelope and encodes it as is. Values are never
+// rounded or reformatted here; a field is only encoded as whole Rupiah when it is typed as
+// Rupiah, and formatted strings are only added by RespondFormatted when the client asks.
 func (s *BaseService) RespondWithJSON(w http.ResponseWriter, statusCode int, data interface{}) {
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(statusCode)
@@ -37,10 +44,13 @@ func (s *BaseService) RespondWithError(w http.ResponseWriter, statusCode int, co
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(statusCode)
     
+    // LoggingMiddleware and Localization have already set the trace ID and language on the response
     response := ErrorResponse{
-        Error:     message,
-        Code:      code,
-        Timestamp: time.Now(),
+        Error:       message,
+        Code:        code,
+        TraceID:     w.Header().Get("X-Trace-ID"),
+        UserMessage: i18n.Message(w.Header().Get("Content-Language"), code, statusCode),
+        Timestamp:   time.Now(),
     }
     
     json.NewEncoder(w).Encode(response)
@@ -51,36 +61,67 @@ func (s *BaseService) RespondValidationError(w http.ResponseWriter, errors []val
     w.WriteHeader(http.StatusBadRequest)
     
     response := map[string]interface{}{
-        "error":   "Validation failed",
-        "details": errors,
-        "timestamp": time.Now(),
+        "error":        "Validation failed",
+        "code":         "VALIDATION_ERROR",
+        "details":      errors,
+        "user_message": i18n.Message(w.Header().Get("Content-Language"), "VALIDATION_ERROR", http.StatusBadRequest),
+        "timestamp":    time.Now(),
+    }
+    if traceID := w.Header().Get("X-Trace-ID"); traceID != "" {
+        response["trace_id"] = traceID
     }
     
     json.NewEncoder(w).Encode(response)
 }
 
+// The identity helpers read the request context set by the auth middleware from a validated
+// token, never the Company-ID/User-ID headers, which a client calling a service directly
+// could forge. They return zero values on routes without auth.
+
 func (s *BaseService) GetCompanyIDFromRequest(r *http.Request) int {
-    if companyIDStr := r.Header.Get("Company-ID"); companyIDStr != "" {
-        if companyID, err := strconv.Atoi(companyIDStr); err == nil {
-            return companyID
-        }
-    }
-    return 0
+    companyID, _ := r.Context().Value("company_id").(int)
+    return companyID
 }
 
 func (s *BaseService) GetUserIDFromRequest(r *http.Request) int {
-    if userIDStr := r.Header.Get("User-ID"); userIDStr != "" {
-        if userID, err := strconv.Atoi(userIDStr); err == nil {
-            return userID
-        }
+    userID, _ := r.Context().Value("user_id").(int)
+    return userID
+}
+
+func (s *BaseService) GetUserRoleFromRequest(r *http.Request) string {
+    role, _ := r.Context().Value("role").(string)
+    return role
+}
+
+// ValidateUserPermission reports whether the requesting user's role is at least requiredRole.
+// Unknown roles never satisfy a permission check.
+func (s *BaseService) ValidateUserPermission(r *http.Request, requiredRole string) bool {
+    return middleware.HasRole(s.GetUserRoleFromRequest(r), requiredRole)
+}
+
+// ValidateCompanyAccess reports whether the caller's token is for companyID, responding 403 when
+// it is not. Roles, admin included, only apply within the caller's own company, so a company
+// ID taken from the URL must always be checked against the token.
+func (s *BaseService) ValidateCompanyAccess(w http.ResponseWriter, r *http.Request, companyID int) bool {
+    if companyID != s.GetCompanyIDFromRequest(r) {
+        s.RespondWithError(w, http.StatusForbidden, "COMPANY_ACCESS_DENIED", "You do not have access to this company")
+        return false
     }
-    return 0
+    return true
 }
 
 func (s *BaseService) HandleDBError(w http.ResponseWriter, err error, message string) {
     s.RespondWithError(w, http.StatusInternalServerError, "DATABASE_ERROR", message)
 }
 
+// ExecuteWithTimeout runs fn with a context that is cancelled after timeout
+func (s *BaseService) ExecuteWithTimeout(timeout time.Duration, fn func(ctx context.Context) error) error {
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    
+    return fn(ctx)
+}
+
 func (s *BaseService) WithTransaction(ctx context.Context, fn func(*sql.Tx) error) error {
     tx, err := s.DB.BeginTx(ctx, nil)
     if err != nil {
@@ -0,0 +1,59 @@
+package service
+
+import (
+    "encoding/json"
+    "net/http/httptest"
+    "testing"
+)
+
+type pricedLine struct {
+    UnitPrice float64 `json:"unit_price"`
+    Total     Rupiah  `json:"total"`
+}
+
+func decodeLine(t *testing.T, body []byte) map[string]json.Number {
+    t.Helper()
+    var response struct {
+        Data map[string]json.Number `json:"data"`
+    }
+    if err := json.Unmarshal(body, &response); err != nil {
+        t.Fatalf("decode response: %v", err)
+    }
+    return response.Data
+}
+
+// A decimal price typed float64 is encoded as is; only fields typed Rupiah are rounded, to
+// whole Rupiah, as invoice line unit prices are
+func TestRespondWithJSONKeepsDecimalsOutsideRupiah(t *testing.T) {
+    s := &BaseService{}
+    line := pricedLine{UnitPrice: 1234.567, Total: Rupiah(1234.567)}
+
+    rec := httptest.NewRecorder()
+    s.RespondWithJSON(rec, 200, line)
+    data := decodeLine(t, rec.Body.Bytes())
+    if data["unit_price"] != "1234.567" {
+        t.Errorf("unit_price = %s, want 1234.567", data["unit_price"])
+    }
+    if data["total"] != "1235" {
+        t.Errorf("Rupiah total = %s, want 1235", data["total"])
+    }
+
+    // Asking for formatted currency adds strings next to Rupiah fields and changes nothing else
+    rec = httptest.NewRecorder()
+    s.RespondFormatted(rec, httptest.NewRequest("GET", "/?currency_format=formatted", nil), 200, line)
+    var formatted struct {
+        Data map[string]interface{} `json:"data"`
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &formatted); err != nil {
+        t.Fatalf("decode formatted response: %v", err)
+    }
+    if formatted.Data["unit_price"] != 1234.567 {
+        t.Errorf("formatted unit_price = %v, want 1234.567", formatted.Data["unit_price"])
+    }
+    if _, ok := formatted.Data["unit_price_formatted"]; ok {
+        t.Error("float64 unit_price gained a formatted sibling")
+    }
+    if formatted.Data["total_formatted"] != "Rp 1.235" {
+        t.Errorf("total_formatted = %v, want Rp 1.235", formatted.Data["total_formatted"])
+    }
+}
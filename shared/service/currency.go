@@ -0,0 +1,176 @@
+// shared/service/currency.go
+package service
+
+import (
+    "bytes"
+    "encoding/json"
+    "math"
+    "mime"
+    "net/http"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// IndonesianDateLayout is the DD/MM/YYYY form dates take on Indonesian documents
+const IndonesianDateLayout = "02/01/2006"
+
+// FormatRupiah renders an amount the way Indonesian documents show it, e.g. "Rp 1.250.000" or
+// "-Rp 1.250.000". Amounts are rounded to whole Rupiah; the largest stored amount,
+// DECIMAL(15,0) at just under 1,000 trillion, is well inside the range float64 holds exactly.
+func FormatRupiah(amount float64) string {
+    rounded := math.Round(amount)
+    digits := strconv.FormatFloat(math.Abs(rounded), 'f', 0, 64)
+
+    var grouped []byte
+    for i := range digits {
+        if i > 0 && (len(digits)-i)%3 == 0 {
+            grouped = append(grouped, '.')
+        }
+        grouped = append(grouped, digits[i])
+    }
+
+    if rounded < 0 {
+        return "-Rp " + string(grouped)
+    }
+    return "Rp " + string(grouped)
+}
+
+// FormatIndonesianDate renders a date as DD/MM/YYYY, e.g. "31/12/2024"
+func FormatIndonesianDate(t time.Time) string {
+    return t.Format(IndonesianDateLayout)
+}
+
+// WantsFormattedCurrency reports whether the client opted in to formatted currency strings,
+// either with ?currency_format=formatted or an Accept parameter such as
+// "application/json; currency=formatted".
+func WantsFormattedCurrency(r *http.Request) bool {
+    if r.URL.Query().Get("currency_format") == "formatted" {
+        return true
+    }
+    for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+        if _, params, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && params["currency"] == "formatted" {
+            return true
+        }
+    }
+    return false
+}
+
+// RespondFormatted is RespondWithJSON for payloads holding Rupiah amounts or JakartaTime dates.
+// When the client opts in, every such field, at any depth, gains a "<field>_formatted" sibling
+// with the FormatRupiah or FormatIndonesianDate string; the original values are left as is.
+// Structs, slices and maps are all handled; fields are found by type, named by their JSON tags.
+func (s *BaseService) RespondFormatted(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+    if !WantsFormattedCurrency(r) {
+        s.RespondWithJSON(w, statusCode, data)
+        return
+    }
+
+    encoded, err := json.Marshal(data)
+    if err != nil {
+        s.RespondWithJSON(w, statusCode, data)
+        return
+    }
+    var generic interface{}
+    decoder := json.NewDecoder(bytes.NewReader(encoded))
+    decoder.UseNumber()
+    if err := decoder.Decode(&generic); err != nil {
+        s.RespondWithJSON(w, statusCode, data)
+        return
+    }
+
+    addFormattedFields(reflect.ValueOf(data), generic)
+    s.RespondWithJSON(w, statusCode, generic)
+}
+
+// addFormattedFields walks value alongside generic, its decoded JSON form
+func addFormattedFields(value reflect.Value, generic interface{}) {
+    value = indirect(value)
+    switch value.Kind() {
+    case reflect.Struct:
+        if object, ok := generic.(map[string]interface{}); ok {
+            addFormattedStructFields(value, object)
+        }
+    case reflect.Slice, reflect.Array:
+        items, ok := generic.([]interface{})
+        if !ok {
+            return
+        }
+        for i := 0; i < value.Len() && i < len(items); i++ {
+            addFormattedFields(value.Index(i), items[i])
+        }
+    case reflect.Map:
+        object, ok := generic.(map[string]interface{})
+        if !ok || value.Type().Key().Kind() != reflect.String {
+            return
+        }
+        iter := value.MapRange()
+        for iter.Next() {
+            key := iter.Key().String()
+            if formatted, ok := formattedValue(iter.Value()); ok {
+                object[key+"_formatted"] = formatted
+                continue
+            }
+            addFormattedFields(iter.Value(), object[key])
+        }
+    }
+}
+
+func addFormattedStructFields(value reflect.Value, object map[string]interface{}) {
+    valueType := value.Type()
+    for i := 0; i < valueType.NumField(); i++ {
+        field := valueType.Field(i)
+        name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+        if name == "-" || (!field.IsExported() && !field.Anonymous) {
+            continue
+        }
+
+        fieldValue := value.Field(i)
+        if field.Anonymous && name == "" {
+            // Fields of an untagged embedded struct are promoted into the same object
+            if embedded := indirect(fieldValue); embedded.Kind() == reflect.Struct {
+                addFormattedStructFields(embedded, object)
+            }
+            continue
+        }
+        if name == "" {
+            name = field.Name
+        }
+
+        child, present := object[name]
+        if !present {
+            continue
+        }
+        if formatted, ok := formattedValue(fieldValue); ok {
+            object[name+"_formatted"] = formatted
+            continue
+        }
+        addFormattedFields(fieldValue, child)
+    }
+}
+
+func formattedValue(value reflect.Value) (string, bool) {
+    value = indirect(value)
+    if !value.IsValid() || !value.CanInterface() {
+        return "", false
+    }
+    switch v := value.Interface().(type) {
+    case Rupiah:
+        return FormatRupiah(float64(v)), true
+    case JakartaTime:
+        return FormatIndonesianDate(v.Time()), true
+    }
+    return "", false
+}
+
+// indirect follows pointers and interfaces, returning the zero Value for nil
+func indirect(value reflect.Value) reflect.Value {
+    for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+        if value.IsNil() {
+            return reflect.Value{}
+        }
+        value = value.Elem()
+    }
+    return value
+}
\ No newline at end of file
@@ -0,0 +1,146 @@
+package service
+
+import (
+    "encoding/json"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestFormatIndonesianDate(t *testing.T) {
+    cases := []struct {
+        date time.Time
+        want string
+    }{
+        {time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), "31/12/2024"},
+        {time.Date(2025, 3, 5, 23, 59, 0, 0, time.UTC), "05/03/2025"},
+        {time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), "29/02/2024"},
+    }
+    for _, tc := range cases {
+        if got := FormatIndonesianDate(tc.date); got != tc.want {
+            t.Errorf("FormatIndonesianDate(%s) = %q, want %q", tc.date, got, tc.want)
+        }
+    }
+}
+
+func TestJakartaTimeFormatsTheJakartaDate(t *testing.T) {
+    // 18:00 UTC on New Year's Eve is already 1 January in Jakarta
+    date := NewJakartaTime(time.Date(2024, 12, 31, 18, 0, 0, 0, time.UTC))
+    if got := date.String(); got != "01/01/2025" {
+        t.Errorf("String() = %q, want 01/01/2025", got)
+    }
+}
+
+func TestFormatRupiah(t *testing.T) {
+    cases := map[float64]string{
+        0:             "Rp 0",
+        999:           "Rp 999",
+        1000:          "Rp 1.000",
+        1250000:       "Rp 1.250.000",
+        1234.5:        "Rp 1.235",
+        -1250000:      "-Rp 1.250.000",
+        1000000000000: "Rp 1.000.000.000.000",
+    }
+    for amount, want := range cases {
+        if got := FormatRupiah(amount); got != want {
+            t.Errorf("FormatRupiah(%v) = %q, want %q", amount, got, want)
+        }
+    }
+}
+
+type formattedLine struct {
+    Description string `json:"description"`
+    Amount      Rupiah `json:"amount"`
+}
+
+type formattedInvoice struct {
+    Number  string          `json:"number"`
+    Date    JakartaTime     `json:"date"`
+    DueDate *JakartaTime    `json:"due_date,omitempty"`
+    Total   Rupiah          `json:"total"`
+    Lines   []formattedLine `json:"lines"`
+    Payment struct {
+        Amount Rupiah `json:"amount"`
+    } `json:"payment"`
+}
+
+func respondFormatted(t *testing.T, data interface{}) interface{} {
+    t.Helper()
+    rec := httptest.NewRecorder()
+    req := httptest.NewRequest("GET", "/", nil)
+    req.Header.Set("Accept", "application/json; currency=formatted")
+    (&BaseService{}).RespondFormatted(rec, req, 200, data)
+
+    var response struct {
+        Data interface{} `json:"data"`
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+        t.Fatalf("decode response: %v", err)
+    }
+    return response.Data
+}
+
+func testInvoice() formattedInvoice {
+    invoice := formattedInvoice{
+        Number: "INV-001",
+        Date:   NewJakartaTime(time.Date(2025, 1, 14, 17, 30, 0, 0, time.UTC)),
+        Total:  1250000,
+        Lines:  []formattedLine{{"Konsultasi", 1000000}, {"Transport", 250000}},
+    }
+    invoice.Payment.Amount = 500000
+    return invoice
+}
+
+func TestRespondFormattedTypedStruct(t *testing.T) {
+    data := respondFormatted(t, testInvoice()).(map[string]interface{})
+
+    if data["total_formatted"] != "Rp 1.250.000" {
+        t.Errorf("total_formatted = %v", data["total_formatted"])
+    }
+    // 17:30 UTC on the 14th is the 15th in Jakarta
+    if data["date_formatted"] != "15/01/2025" {
+        t.Errorf("date_formatted = %v, want 15/01/2025", data["date_formatted"])
+    }
+    if _, ok := data["due_date_formatted"]; ok {
+        t.Error("an omitted due_date gained a formatted sibling")
+    }
+    if _, ok := data["number_formatted"]; ok {
+        t.Error("a string field gained a formatted sibling")
+    }
+    if data["total"] != 1250000.0 {
+        t.Errorf("total = %v, want the number left as is", data["total"])
+    }
+}
+
+func TestRespondFormattedSliceOfStructs(t *testing.T) {
+    second := testInvoice()
+    dueDate := NewJakartaTime(time.Date(2025, 2, 14, 0, 0, 0, 0, time.UTC))
+    second.DueDate = &dueDate
+
+    items := respondFormatted(t, []formattedInvoice{testInvoice(), second}).([]interface{})
+    if len(items) != 2 {
+        t.Fatalf("got %d items, want 2", len(items))
+    }
+    for i, item := range items {
+        if item.(map[string]interface{})["total_formatted"] != "Rp 1.250.000" {
+            t.Errorf("item %d: total_formatted = %v", i, item.(map[string]interface{})["total_formatted"])
+        }
+    }
+    if got := items[1].(map[string]interface{})["due_date_formatted"]; got != "14/02/2025" {
+        t.Errorf("due_date_formatted = %v, want 14/02/2025", got)
+    }
+}
+
+func TestRespondFormattedNestedStruct(t *testing.T) {
+    data := respondFormatted(t, map[string]interface{}{"invoice": testInvoice()}).(map[string]interface{})
+    invoice := data["invoice"].(map[string]interface{})
+
+    lines := invoice["lines"].([]interface{})
+    if got := lines[1].(map[string]interface{})["amount_formatted"]; got != "Rp 250.000" {
+        t.Errorf("line amount_formatted = %v, want Rp 250.000", got)
+    }
+    payment := invoice["payment"].(map[string]interface{})
+    if payment["amount_formatted"] != "Rp 500.000" {
+        t.Errorf("payment amount_formatted = %v, want Rp 500.000", payment["amount_formatted"])
+    }
+}
@@ -0,0 +1,101 @@
+// shared/service/decode.go
+package service
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+)
+
+// DefaultMaxBodyBytes caps create and update payloads when a handler has no reason to pick
+// its own limit. The gateway applies its own, usually larger, limit in front of it.
+const DefaultMaxBodyBytes int64 = 1 << 20
+
+// BodyError is a request body DecodeJSONBody rejected, with the status and error code to
+// answer with. Message is meant for the API client and names the offending field or offset.
+type BodyError struct {
+    Status  int
+    Code    string
+    Message string
+}
+
+func (e *BodyError) Error() string {
+    return e.Message
+}
+
+// DecodeJSONBody decodes a single JSON object from the request body into dst. The body is
+// capped at maxBytes and fields dst does not declare are rejected, so a misspelt field fails
+// loudly instead of being dropped. Errors are *BodyError: PAYLOAD_TOO_LARGE (413) for an
+// oversized body, UNKNOWN_FIELD (400) for undeclared fields and INVALID_JSON (400) for empty
+// or malformed bodies and values of the wrong type.
+func DecodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) error {
+    if maxBytes <= 0 {
+        maxBytes = DefaultMaxBodyBytes
+    }
+    r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(dst); err != nil {
+        return bodyError(err)
+    }
+    if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+        var maxBytesErr *http.MaxBytesError
+        if errors.As(err, &maxBytesErr) {
+            return bodyError(err)
+        }
+        return &BodyError{http.StatusBadRequest, "INVALID_JSON", "Request body must contain a single JSON object"}
+    }
+    return nil
+}
+
+func bodyError(err error) *BodyError {
+    var syntaxErr *json.SyntaxError
+    var typeErr *json.UnmarshalTypeError
+    var maxBytesErr *http.MaxBytesError
+
+    switch {
+    case errors.As(err, &maxBytesErr):
+        return &BodyError{http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE",
+            fmt.Sprintf("Request body must not exceed %d bytes", maxBytesErr.Limit)}
+    case errors.As(err, &syntaxErr):
+        return &BodyError{http.StatusBadRequest, "INVALID_JSON",
+            fmt.Sprintf("Request body contains malformed JSON at offset %d", syntaxErr.Offset)}
+    case errors.Is(err, io.ErrUnexpectedEOF):
+        return &BodyError{http.StatusBadRequest, "INVALID_JSON", "Request body contains malformed JSON"}
+    case errors.As(err, &typeErr):
+        if typeErr.Field != "" {
+            return &BodyError{http.StatusBadRequest, "INVALID_JSON",
+                fmt.Sprintf("Field %q must be %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)}
+        }
+        return &BodyError{http.StatusBadRequest, "INVALID_JSON",
+            fmt.Sprintf("Request body must be %s, got %s", typeErr.Type, typeErr.Value)}
+    case errors.Is(err, io.EOF):
+        return &BodyError{http.StatusBadRequest, "INVALID_JSON", "Request body must not be empty"}
+    case strings.HasPrefix(err.Error(), "json: unknown field "):
+        // encoding/json has no error type for this, only the message
+        field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+        return &BodyError{http.StatusBadRequest, "UNKNOWN_FIELD",
+            fmt.Sprintf("Request body contains unknown field %s", field)}
+    default:
+        // Custom UnmarshalJSON methods, such as JakartaTime's, report bad values this way
+        return &BodyError{http.StatusBadRequest, "INVALID_JSON",
+            fmt.Sprintf("Request body is invalid: %v", err)}
+    }
+}
+
+// RespondWithBodyError answers with the error DecodeJSONBody returned
+func (s *BaseService) RespondWithBodyError(w http.ResponseWriter, err error) {
+    var bodyErr *BodyError
+    if !errors.As(err, &bodyErr) {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+    if bodyErr.Status == http.StatusRequestEntityTooLarge {
+        w.Header().Set("Connection", "close")
+    }
+    s.RespondWithError(w, bodyErr.Status, bodyErr.Code, bodyErr.Message)
+}
\ No newline at end of file
@@ -0,0 +1,66 @@
+// shared/service/pagination.go
+package service
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+const (
+    DefaultPageSize = 20
+    MaxPageSize     = 100
+)
+
+type Pagination struct {
+    Page       int `json:"page"`
+    PageSize   int `json:"page_size"`
+    TotalItems int `json:"total_items"`
+    TotalPages int `json:"total_pages"`
+}
+
+// GetPaginationParams reads page and page_size from the query string. Missing or
+// invalid values fall back to the first page of DefaultPageSize items, and page_size
+// is capped at MaxPageSize.
+func (s *BaseService) GetPaginationParams(r *http.Request) (page, pageSize int) {
+    page, err := strconv.Atoi(r.URL.Query().Get("page"))
+    if err != nil || page < 1 {
+        page = 1
+    }
+    
+    pageSize, err = strconv.Atoi(r.URL.Query().Get("page_size"))
+    if err != nil || pageSize < 1 {
+        pageSize = DefaultPageSize
+    }
+    if pageSize > MaxPageSize {
+        pageSize = MaxPageSize
+    }
+    
+    return page, pageSize
+}
+
+// RespondWithPagination writes one page of results in the standard envelope with
+// a pagination block describing the full result set.
+func (s *BaseService) RespondWithPagination(w http.ResponseWriter, statusCode int, data interface{}, page, pageSize, totalItems int) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(statusCode)
+    
+    totalPages := 0
+    if pageSize > 0 {
+        totalPages = (totalItems + pageSize - 1) / pageSize
+    }
+    
+    response := map[string]interface{}{
+        "data": data,
+        "pagination": Pagination{
+            Page:       page,
+            PageSize:   pageSize,
+            TotalItems: totalItems,
+            TotalPages: totalPages,
+        },
+        "timestamp": time.Now(),
+    }
+    
+    json.NewEncoder(w).Encode(response)
+}
\ No newline at end of file
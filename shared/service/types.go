@@ -0,0 +1,83 @@
+// shared/service/types.go
+package service
+
+import (
+    "database/sql/driver"
+    "fmt"
+    "math"
+    "strconv"
+    "time"
+)
+
+// Rupiah is an IDR amount. Amounts are stored as DECIMAL(15,0), so it always encodes as a
+// whole number; RespondFormatted adds the FormatRupiah string alongside it on request.
+type Rupiah float64
+
+func (r Rupiah) MarshalJSON() ([]byte, error) {
+    return []byte(strconv.FormatFloat(math.Round(float64(r)), 'f', 0, 64)), nil
+}
+
+func (r Rupiah) String() string {
+    return FormatRupiah(float64(r))
+}
+
+// jakarta is the zone business dates are recorded in. The fixed WIB offset stands in when the
+// image has no tzdata; Indonesia does not observe daylight saving, so they agree.
+var jakarta = loadJakarta()
+
+func loadJakarta() *time.Location {
+    if location, err := time.LoadLocation("Asia/Jakarta"); err == nil {
+        return location
+    }
+    return time.FixedZone("WIB", 7*60*60)
+}
+
+// JakartaTime is a business date or time, such as an invoice or journal entry date. It
+// encodes as RFC 3339 in Asia/Jakarta time so clients see the calendar date the company
+// recorded; RespondFormatted adds the DD/MM/YYYY form alongside it on request.
+type JakartaTime time.Time
+
+// NewJakartaTime converts t to Jakarta time
+func NewJakartaTime(t time.Time) JakartaTime {
+    return JakartaTime(t.In(jakarta))
+}
+
+// Time returns the value as a time.Time in Jakarta time
+func (t JakartaTime) Time() time.Time {
+    return time.Time(t).In(jakarta)
+}
+
+func (t JakartaTime) IsZero() bool {
+    return time.Time(t).IsZero()
+}
+
+func (t JakartaTime) MarshalJSON() ([]byte, error) {
+    return t.Time().MarshalJSON()
+}
+
+func (t *JakartaTime) UnmarshalJSON(data []byte) error {
+    var parsed time.Time
+    if err := parsed.UnmarshalJSON(data); err != nil {
+        return err
+    }
+    *t = NewJakartaTime(parsed)
+    return nil
+}
+
+// Scan reads DATE and TIMESTAMP columns
+func (t *JakartaTime) Scan(src interface{}) error {
+    value, ok := src.(time.Time)
+    if !ok {
+        return fmt.Errorf("cannot scan %T into JakartaTime", src)
+    }
+    *t = NewJakartaTime(value)
+    return nil
+}
+
+func (t JakartaTime) Value() (driver.Value, error) {
+    return time.Time(t), nil
+}
+
+func (t JakartaTime) String() string {
+    return FormatIndonesianDate(t.Time())
+}
\ No newline at end of file
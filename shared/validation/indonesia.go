@@ -0,0 +1,119 @@
+// shared/validation/indonesia.go
+package validation
+
+import (
+    "regexp"
+    "strconv"
+)
+
+// IDNumberError explains why an NPWP or NIK was rejected. Code is reported as the validation
+// error's code, so clients can tell a typo in the layout from a number that cannot exist.
+type IDNumberError struct {
+    Code    string
+    Message string
+}
+
+func (e *IDNumberError) Error() string {
+    return e.Message
+}
+
+var (
+    npwpRegex = regexp.MustCompile(`^(\d{2})\.(\d{3})\.(\d{3})\.(\d)-\d{3}\.\d{3}$`)
+    nikRegex  = regexp.MustCompile(`^\d{16}$`)
+)
+
+// Province codes that open a NIK
+var nikProvinces = map[string]bool{
+    "11": true, "12": true, "13": true, "14": true, "15": true, "16": true, "17": true, "18": true,
+    "19": true, "21": true, "31": true, "32": true, "33": true, "34": true, "35": true, "36": true,
+    "51": true, "52": true, "53": true, "61": true, "62": true, "63": true, "64": true, "65": true,
+    "71": true, "72": true, "73": true, "74": true, "75": true, "76": true, "81": true, "82": true,
+    "91": true, "92": true, "93": true, "94": true, "95": true, "96": true,
+}
+
+// ValidateNPWP checks a 15-digit NPWP written as 01.234.567.4-901.000. The ninth digit is a
+// check digit over the eight before it, computed with the Luhn algorithm.
+func ValidateNPWP(npwp string) error {
+    match := npwpRegex.FindStringSubmatch(npwp)
+    if match == nil {
+        return &IDNumberError{"INVALID_NPWP_FORMAT", "NPWP must look like 01.234.567.4-901.000"}
+    }
+    if !luhnValid(match[1] + match[2] + match[3] + match[4]) {
+        return &IDNumberError{"INVALID_NPWP_CHECKSUM", "NPWP check digit does not match; check the number for typos"}
+    }
+    return nil
+}
+
+// ValidateNIK checks a 16-digit NIK: a known province code, non-zero regency and district
+// codes, a real date of birth (women's birth day has 40 added) and a non-zero serial.
+func ValidateNIK(nik string) error {
+    if !nikRegex.MatchString(nik) {
+        return &IDNumberError{"INVALID_NIK_FORMAT", "NIK must be 16 digits"}
+    }
+    if !nikProvinces[nik[:2]] || nik[2:4] == "00" || nik[4:6] == "00" {
+        return &IDNumberError{"INVALID_NIK_REGION", "NIK region code is not valid"}
+    }
+    
+    day, _ := strconv.Atoi(nik[6:8])
+    month, _ := strconv.Atoi(nik[8:10])
+    if day > 40 {
+        day -= 40
+    }
+    // The year has no century, so 29 February is allowed in any year
+    daysInMonth := []int{31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+    if month < 1 || month > 12 || day < 1 || day > daysInMonth[month-1] {
+        return &IDNumberError{"INVALID_NIK_BIRTH_DATE", "NIK date of birth is not valid"}
+    }
+    
+    if nik[12:] == "0000" {
+        return &IDNumberError{"INVALID_NIK_FORMAT", "NIK serial number cannot be 0000"}
+    }
+    return nil
+}
+
+// NPWP validates an NPWP with its check digit, reporting the IDNumberError code
+func (v *Validator) NPWP(field, value string) {
+    if value == "" {
+        return
+    }
+    if err := ValidateNPWP(value); err != nil {
+        v.addIDNumberError(field, err)
+    }
+}
+
+// NIK validates an Indonesian resident identity number, reporting the IDNumberError code
+func (v *Validator) NIK(field, value string) {
+    if value == "" {
+        return
+    }
+    if err := ValidateNIK(value); err != nil {
+        v.addIDNumberError(field, err)
+    }
+}
+
+func (v *Validator) addIDNumberError(field string, err error) {
+    idErr := err.(*IDNumberError)
+    v.errors = append(v.errors, ValidationError{
+        Field:   field,
+        Message: idErr.Message,
+        Code:    idErr.Code,
+    })
+}
+
+// luhnValid reports whether the last digit is the Luhn check digit of the others
+func luhnValid(digits string) bool {
+    sum := 0
+    double := false
+    for i := len(digits) - 1; i >= 0; i-- {
+        d := int(digits[i] - '0')
+        if double {
+            d *= 2
+            if d > 9 {
+                d -= 9
+            }
+        }
+        sum += d
+        double = !double
+    }
+    return sum%10 == 0
+}
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
     "fmt"
     "regexp"
     "strings"
+    "unicode"
 )
 
 type ValidationError struct {
@@ -77,6 +78,72 @@ func (v *Validator) IndonesianTaxID(field, value string) {
     }
 }
 
+// IndonesianPhone accepts mobile and landline numbers written locally (0812..., 021...) or
+// with the country code (+62..., 62...). Spaces, dots, dashes and parentheses are ignored.
+func (v *Validator) IndonesianPhone(field, value string) {
+    if value == "" {
+        return
+    }
+    if NormalizeIndonesianPhone(value) == "" {
+        v.AddError(field, "Invalid Indonesian phone number")
+    }
+}
+
+// NormalizeIndonesianPhone returns a number IndonesianPhone accepts in E.164 form, e.g.
+// +6281234567890, or "" when it is not a valid Indonesian number.
+func NormalizeIndonesianPhone(value string) string {
+    number := strings.Map(func(r rune) rune {
+        if strings.ContainsRune(" .-()", r) {
+            return -1
+        }
+        return r
+    }, value)
+    
+    switch {
+    case strings.HasPrefix(number, "+62"):
+        number = number[3:]
+    case strings.HasPrefix(number, "62"):
+        number = number[2:]
+    case strings.HasPrefix(number, "0"):
+        number = number[1:]
+    default:
+        return ""
+    }
+    
+    // Without the trunk 0, area code and subscriber number run 8 to 12 digits
+    subscriberRegex := regexp.MustCompile(`^[1-9]\d{7,11}$`)
+    if !subscriberRegex.MatchString(number) {
+        return ""
+    }
+    return "+62" + number
+}
+
+// FakturPajakSerial checks the layout of a faktur pajak serial as DJP allocates it: a
+// three-digit code, the two-digit year and an eight-digit number, e.g. 000-24.00000001.
+func (v *Validator) FakturPajakSerial(field, value string) {
+    if value == "" {
+        return
+    }
+    serialRegex := regexp.MustCompile(`^\d{3}-\d{2}\.\d{8}$`)
+    if !serialRegex.MatchString(value) {
+        v.AddError(field, "Faktur pajak serial must look like 000-24.00000001")
+    }
+}
+
+// FakturPajakNumber checks a full faktur pajak number as stamped on an invoice: the
+// transaction code (01 to 10) and status digit (0 normal, 1 replacement) before the serial,
+// e.g. 010.000-24.00000001.
+func (v *Validator) FakturPajakNumber(field, value string) {
+    if value == "" {
+        return
+    }
+    numberRegex := regexp.MustCompile(`^(\d{2})[01]\.\d{3}-\d{2}\.\d{8}$`)
+    match := numberRegex.FindStringSubmatch(value)
+    if match == nil || match[1] < "01" || match[1] > "10" {
+        v.AddError(field, "Faktur pajak number must look like 010.000-24.00000001")
+    }
+}
+
 func (v *Validator) OneOf(field, value string, validOptions []string) {
     if value == "" {
         return
@@ -89,6 +156,30 @@ func (v *Validator) OneOf(field, value string, validOptions []string) {
     v.AddError(field, fmt.Sprintf("%s must be one of: %s", field, strings.Join(validOptions, ", ")))
 }
 
+// StrongPassword requires 8 to 72 characters (bcrypt ignores anything longer) mixing
+// upper and lower case letters with at least one digit.
+func (v *Validator) StrongPassword(field, value string) {
+    if len(value) < 8 || len(value) > 72 {
+        v.AddError(field, fmt.Sprintf("%s must be between 8 and 72 characters", field))
+        return
+    }
+
+    var hasUpper, hasLower, hasDigit bool
+    for _, r := range value {
+        switch {
+        case unicode.IsUpper(r):
+            hasUpper = true
+        case unicode.IsLower(r):
+            hasLower = true
+        case unicode.IsDigit(r):
+            hasDigit = true
+        }
+    }
+    if !hasUpper || !hasLower || !hasDigit {
+        v.AddError(field, fmt.Sprintf("%s must contain upper and lower case letters and a digit", field))
+    }
+}
+
 func (v *Validator) PositiveNumber(field string, value float64) {
     if value <= 0 {
         v.AddError(field, fmt.Sprintf("%s must be positive", field))
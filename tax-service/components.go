@@ -0,0 +1,258 @@
+// tax-service/components.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+    
+    "github.com/gorilla/mux"
+    "github.com/lib/pq"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// TaxComponent is one part of a tiered or compound tax. It taxes the part of its base between
+// LowerBound and UpperBound at Rate; the base is the amount plus the tax of the earlier
+// components in CompoundOn, so a component listing all earlier ones is tax on the running total.
+type TaxComponent struct {
+    Position   int      `json:"position"`
+    Name       string   `json:"name"`
+    Rate       float64  `json:"rate"`
+    LowerBound float64  `json:"lower_bound"`
+    UpperBound *float64 `json:"upper_bound,omitempty"`
+    CompoundOn []int    `json:"compound_on"`
+}
+
+// ComponentAmount is what one component came to in a calculation
+type ComponentAmount struct {
+    Position      int     `json:"position"`
+    Name          string  `json:"name"`
+    Rate          float64 `json:"rate"`
+    Base          float64 `json:"base"`
+    TaxableAmount float64 `json:"taxable_amount"`
+    TaxAmount     float64 `json:"tax_amount"`
+}
+
+// validateTaxComponents checks that positions identify the components uniquely, so they
+// always apply in the same order, and that each compounds only on earlier ones
+func validateTaxComponents(validator *validation.Validator, components []TaxComponent) {
+    positions := make(map[int]bool, len(components))
+    for i, component := range components {
+        prefix := fmt.Sprintf("components[%d]", i)
+        if component.Position <= 0 {
+            validator.AddError(prefix+".position", "Position must be positive")
+        } else if positions[component.Position] {
+            validator.AddError(prefix+".position", fmt.Sprintf("Position %d is used more than once", component.Position))
+        }
+        positions[component.Position] = true
+        
+        validator.Required(prefix+".name", component.Name)
+        validator.MaxLength(prefix+".name", component.Name, 100)
+        if component.Rate < 0 || component.Rate > 100 {
+            validator.AddError(prefix+".rate", "Rate must be between 0 and 100")
+        }
+        if component.LowerBound < 0 {
+            validator.AddError(prefix+".lower_bound", "Lower bound must not be negative")
+        }
+        if component.UpperBound != nil && *component.UpperBound <= component.LowerBound {
+            validator.AddError(prefix+".upper_bound", "Upper bound must be above the lower bound")
+        }
+    }
+    
+    for i, component := range components {
+        seen := make(map[int]bool, len(component.CompoundOn))
+        for _, position := range component.CompoundOn {
+            if position >= component.Position || !positions[position] || seen[position] {
+                validator.AddError(fmt.Sprintf("components[%d].compound_on", i),
+                    fmt.Sprintf("Position %d is not a distinct earlier component", position))
+            }
+            seen[position] = true
+        }
+    }
+}
+
+// calculateComponents applies components, which must be valid, to amount in position order.
+// Each component's tax is rounded to whole Rupiah before later components compound on it.
+func calculateComponents(amount float64, components []TaxComponent) ([]ComponentAmount, float64) {
+    ordered := make([]TaxComponent, len(components))
+    copy(ordered, components)
+    sort.Slice(ordered, func(i, j int) bool { return ordered[i].Position < ordered[j].Position })
+    
+    taxByPosition := make(map[int]float64, len(ordered))
+    amounts := make([]ComponentAmount, 0, len(ordered))
+    var totalTax float64
+    for _, component := range ordered {
+        base := amount
+        for _, position := range component.CompoundOn {
+            base += taxByPosition[position]
+        }
+        
+        taxable := math.Max(base-component.LowerBound, 0)
+        if component.UpperBound != nil {
+            taxable = math.Min(taxable, *component.UpperBound-component.LowerBound)
+        }
+        tax := math.Round(taxable * component.Rate / 100)
+        
+        taxByPosition[component.Position] = tax
+        totalTax += tax
+        amounts = append(amounts, ComponentAmount{
+            Position:      component.Position,
+            Name:          component.Name,
+            Rate:          component.Rate,
+            Base:          base,
+            TaxableAmount: taxable,
+            TaxAmount:     tax,
+        })
+    }
+    return amounts, totalTax
+}
+
+// loadTaxComponents returns a tax rate's components in position order
+func (s *TaxService) loadTaxComponents(ctx context.Context, taxRateID int) ([]TaxComponent, error) {
+    rows, err := s.DB.QueryContext(ctx, `
+        SELECT position, name, rate, lower_bound, upper_bound, compound_on
+        FROM tax_components WHERE tax_rate_id = $1 ORDER BY position`, taxRateID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    components := []TaxComponent{}
+    for rows.Next() {
+        var component TaxComponent
+        var upperBound sql.NullFloat64
+        var compoundOn pq.Int64Array
+        if err := rows.Scan(&component.Position, &component.Name, &component.Rate, &component.LowerBound,
+            &upperBound, &compoundOn); err != nil {
+            return nil, err
+        }
+        if upperBound.Valid {
+            component.UpperBound = &upperBound.Float64
+        }
+        component.CompoundOn = make([]int, len(compoundOn))
+        for i, position := range compoundOn {
+            component.CompoundOn[i] = int(position)
+        }
+        components = append(components, component)
+    }
+    return components, rows.Err()
+}
+
+// taxRateExists reports whether the company has the tax rate
+func (s *TaxService) taxRateExists(ctx context.Context, id, companyID int) (bool, error) {
+    var exists bool
+    err := s.DB.QueryRowContext(ctx,
+        "SELECT EXISTS(SELECT 1 FROM tax_rates WHERE id = $1 AND company_id = $2)", id, companyID).Scan(&exists)
+    return exists, err
+}
+
+func (s *TaxService) getTaxComponentsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid tax rate ID")
+        return
+    }
+    
+    exists, err := s.taxRateExists(ctx, id, s.GetCompanyIDFromRequest(r))
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching tax components")
+        return
+    }
+    if !exists {
+        s.RespondWithError(w, http.StatusNotFound, "TAX_RATE_NOT_FOUND", "Tax rate not found")
+        return
+    }
+    
+    components, err := s.loadTaxComponents(ctx, id)
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching tax components")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, components)
+}
+
+// updateTaxComponentsHandler replaces a tax rate's components. An empty list makes it a flat
+// tax at its tax_rate again.
+func (s *TaxService) updateTaxComponentsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid tax rate ID")
+        return
+    }
+    
+    var req struct {
+        Components []TaxComponent `json:"components"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validateTaxComponents(validator, req.Components)
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    err = s.WithTransaction(ctx, func(tx *sql.Tx) error {
+        // Locking the rate serialises concurrent replacements of its components
+        var locked int
+        err := tx.QueryRowContext(ctx,
+            "SELECT id FROM tax_rates WHERE id = $1 AND company_id = $2 FOR UPDATE", id, companyID).Scan(&locked)
+        if err != nil {
+            return err
+        }
+        
+        if _, err := tx.ExecContext(ctx, "DELETE FROM tax_components WHERE tax_rate_id = $1", id); err != nil {
+            return err
+        }
+        for _, component := range req.Components {
+            compoundOn := make([]int64, len(component.CompoundOn))
+            for i, position := range component.CompoundOn {
+                compoundOn[i] = int64(position)
+            }
+            _, err := tx.ExecContext(ctx, `
+                INSERT INTO tax_components (tax_rate_id, position, name, rate, lower_bound, upper_bound, compound_on)
+                VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+                id, component.Position, component.Name, component.Rate, component.LowerBound,
+                component.UpperBound, pq.Array(compoundOn))
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "TAX_RATE_NOT_FOUND", "Tax rate not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error saving tax components")
+        return
+    }
+    
+    components, err := s.loadTaxComponents(ctx, id)
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching tax components")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, components)
+}
\ No newline at end of file
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "testing"
+
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// A 10% tax followed by a 5% tax compounding on it: the second component's base is the amount
+// plus the first component's tax, whatever order the components were listed in
+func TestCalculateComponentsTwoComponentCompound(t *testing.T) {
+    components := []TaxComponent{
+        {Position: 2, Name: "Surcharge", Rate: 5, CompoundOn: []int{1}},
+        {Position: 1, Name: "Base tax", Rate: 10},
+    }
+
+    amounts, totalTax := calculateComponents(1000000, components)
+
+    want := []ComponentAmount{
+        {Position: 1, Name: "Base tax", Rate: 10, Base: 1000000, TaxableAmount: 1000000, TaxAmount: 100000},
+        {Position: 2, Name: "Surcharge", Rate: 5, Base: 1100000, TaxableAmount: 1100000, TaxAmount: 55000},
+    }
+    if len(amounts) != len(want) {
+        t.Fatalf("got %d component amounts, want %d", len(amounts), len(want))
+    }
+    for i := range want {
+        if amounts[i] != want[i] {
+            t.Errorf("component %d = %+v, want %+v", i, amounts[i], want[i])
+        }
+    }
+    if totalTax != 155000 {
+        t.Errorf("total tax = %v, want 155000", totalTax)
+    }
+
+    // Without compounding the second component only sees the original amount
+    components[0].CompoundOn = nil
+    if _, flat := calculateComponents(1000000, components); flat != 150000 {
+        t.Errorf("non-compound total tax = %v, want 150000", flat)
+    }
+}
+
+func TestValidateTaxComponentsRejectsLaterReferences(t *testing.T) {
+    cases := map[string][]TaxComponent{
+        "self reference":     {{Position: 1, Name: "A", Rate: 10, CompoundOn: []int{1}}},
+        "later component":    {{Position: 1, Name: "A", Rate: 10, CompoundOn: []int{2}}, {Position: 2, Name: "B", Rate: 5}},
+        "unknown component":  {{Position: 2, Name: "B", Rate: 5, CompoundOn: []int{1}}},
+        "duplicate position": {{Position: 1, Name: "A", Rate: 10}, {Position: 1, Name: "B", Rate: 5}},
+    }
+    for name, components := range cases {
+        validator := validation.New()
+        validateTaxComponents(validator, components)
+        if validator.IsValid() {
+            t.Errorf("%s: components accepted", name)
+        }
+    }
+
+    validator := validation.New()
+    validateTaxComponents(validator, []TaxComponent{
+        {Position: 1, Name: "A", Rate: 10},
+        {Position: 2, Name: "B", Rate: 5, CompoundOn: []int{1}},
+    })
+    if !validator.IsValid() {
+        t.Errorf("valid compound components rejected: %+v", validator.Errors())
+    }
+}
@@ -0,0 +1,368 @@
+// tax-service/faktur.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// fakturSeriesLock is the advisory lock namespace serialising range registration per company
+const fakturSeriesLock = 72657002
+
+// FakturSeries is a range of faktur pajak serials DJP allocated to the company
+type FakturSeries struct {
+    ID          int       `json:"id"`
+    CompanyID   int       `json:"company_id"`
+    StartSerial string    `json:"start_serial"`
+    EndSerial   string    `json:"end_serial"`
+    NextSerial  string    `json:"next_serial,omitempty"`
+    Remaining   int64     `json:"remaining"`
+    IsActive    bool      `json:"is_active"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// FakturSerial is a serial handed out for an invoice, with the full faktur number built from it
+type FakturSerial struct {
+    SeriesID        int       `json:"series_id"`
+    Serial          string    `json:"serial"`
+    FakturNumber    string    `json:"faktur_number"`
+    TransactionCode string    `json:"transaction_code"`
+    Reference       string    `json:"reference,omitempty"`
+    UsedAt          time.Time `json:"used_at"`
+}
+
+// parseFakturSerial splits a serial such as 000-24.00000001 into its code, year and number.
+// The format is assumed to have been validated.
+func parseFakturSerial(serial string) (prefix, year string, number int64) {
+    number, _ = strconv.ParseInt(serial[7:], 10, 64)
+    return serial[:3], serial[4:6], number
+}
+
+func formatFakturSerial(prefix, year string, number int64) string {
+    return fmt.Sprintf("%s-%s.%08d", prefix, year, number)
+}
+
+func (s *TaxService) getFakturSeriesHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    rows, err := s.DB.QueryContext(ctx, `
+        SELECT id, company_id, prefix, year, start_number, end_number, next_number, is_active, created_at
+        FROM faktur_pajak_series WHERE company_id = $1 ORDER BY year, prefix, start_number`,
+        s.GetCompanyIDFromRequest(r))
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching faktur pajak series")
+        return
+    }
+    defer rows.Close()
+    
+    series := []FakturSeries{}
+    for rows.Next() {
+        var item FakturSeries
+        var prefix, year string
+        var start, end, next int64
+        if err := rows.Scan(&item.ID, &item.CompanyID, &prefix, &year, &start, &end, &next,
+            &item.IsActive, &item.CreatedAt); err != nil {
+            s.HandleDBError(w, err, "Error fetching faktur pajak series")
+            return
+        }
+        item.StartSerial = formatFakturSerial(prefix, year, start)
+        item.EndSerial = formatFakturSerial(prefix, year, end)
+        if next <= end {
+            item.NextSerial = formatFakturSerial(prefix, year, next)
+        }
+        item.Remaining = end - next + 1
+        series = append(series, item)
+    }
+    if err := rows.Err(); err != nil {
+        s.HandleDBError(w, err, "Error fetching faktur pajak series")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, series)
+}
+
+// createFakturSeriesHandler registers a range of serials allocated by DJP. Both ends must
+// share the code and year, and the range may not overlap one already registered.
+func (s *TaxService) createFakturSeriesHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    var req struct {
+        StartSerial string `json:"start_serial"`
+        EndSerial   string `json:"end_serial"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validator.Required("start_serial", req.StartSerial)
+    validator.Required("end_serial", req.EndSerial)
+    validator.FakturPajakSerial("start_serial", req.StartSerial)
+    validator.FakturPajakSerial("end_serial", req.EndSerial)
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    prefix, year, start := parseFakturSerial(req.StartSerial)
+    endPrefix, endYear, end := parseFakturSerial(req.EndSerial)
+    if endPrefix != prefix || endYear != year {
+        validator.AddError("end_serial", "End serial must have the same code and year as the start serial")
+    }
+    if start == 0 {
+        validator.AddError("start_serial", "Serial number must be at least 00000001")
+    }
+    if end < start {
+        validator.AddError("end_serial", "End serial must not come before the start serial")
+    }
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.HandleDBError(w, err, "Error registering faktur pajak series")
+        return
+    }
+    defer tx.Rollback()
+    
+    if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, $2)", fakturSeriesLock, companyID); err != nil {
+        s.HandleDBError(w, err, "Error registering faktur pajak series")
+        return
+    }
+    
+    var overlaps bool
+    err = tx.QueryRowContext(ctx, `
+        SELECT EXISTS(
+            SELECT 1 FROM faktur_pajak_series
+            WHERE company_id = $1 AND prefix = $2 AND year = $3
+              AND start_number <= $5 AND end_number >= $4
+        )`, companyID, prefix, year, start, end).Scan(&overlaps)
+    if err != nil {
+        s.HandleDBError(w, err, "Error registering faktur pajak series")
+        return
+    }
+    if overlaps {
+        s.RespondWithError(w, http.StatusConflict, "FAKTUR_SERIES_OVERLAP", "Range overlaps a registered faktur pajak series")
+        return
+    }
+    
+    series := FakturSeries{
+        CompanyID:   companyID,
+        StartSerial: formatFakturSerial(prefix, year, start),
+        EndSerial:   formatFakturSerial(prefix, year, end),
+        NextSerial:  formatFakturSerial(prefix, year, start),
+        Remaining:   end - start + 1,
+        IsActive:    true,
+    }
+    err = tx.QueryRowContext(ctx, `
+        INSERT INTO faktur_pajak_series (company_id, prefix, year, start_number, end_number, next_number)
+        VALUES ($1, $2, $3, $4, $5, $4)
+        RETURNING id, created_at`, companyID, prefix, year, start, end).Scan(&series.ID, &series.CreatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error registering faktur pajak series")
+        return
+    }
+    
+    if err := tx.Commit(); err != nil {
+        s.HandleDBError(w, err, "Error registering faktur pajak series")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusCreated, series)
+}
+
+// allocateFakturHandler hands out a faktur pajak number and records what it was used for.
+// Without faktur_number it takes the next unused serial for the year of date, defaulting to
+// today, using up ranges oldest first; the row lock taken by the update means concurrent
+// callers never get the same serial. With faktur_number it claims that number, such as one
+// issued through e-Faktur directly, which must fall in a registered range and be unused.
+func (s *TaxService) allocateFakturHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    var req struct {
+        TransactionCode string              `json:"transaction_code"`
+        FakturNumber    string              `json:"faktur_number"`
+        Date            service.JakartaTime `json:"date"`
+        Reference       string              `json:"reference"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validator.FakturPajakNumber("faktur_number", req.FakturNumber)
+    if req.FakturNumber != "" && validator.IsValid() {
+        if req.FakturNumber[2] != '0' {
+            validator.AddError("faktur_number", "Replacement fakturs keep the original serial and are not allocated")
+        }
+        if req.TransactionCode != "" && req.TransactionCode != req.FakturNumber[:2] {
+            validator.AddError("transaction_code", "Transaction code does not match the faktur number")
+        }
+        req.TransactionCode = req.FakturNumber[:2]
+    }
+    if req.TransactionCode == "" {
+        req.TransactionCode = "01"
+    }
+    validator.OneOf("transaction_code", req.TransactionCode,
+        []string{"01", "02", "03", "04", "05", "06", "07", "08", "09", "10"})
+    validator.MaxLength("reference", req.Reference, 100)
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    if req.Date.IsZero() {
+        req.Date = service.NewJakartaTime(time.Now())
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.HandleDBError(w, err, "Error allocating faktur pajak number")
+        return
+    }
+    defer tx.Rollback()
+    
+    result := FakturSerial{TransactionCode: req.TransactionCode, Reference: req.Reference}
+    reference := sql.NullString{String: req.Reference, Valid: req.Reference != ""}
+    
+    // record stores the serial as used, reporting false if it already was
+    record := func() (bool, error) {
+        // Transaction code, then status 0 for a normal (not replacement) faktur
+        result.FakturNumber = fmt.Sprintf("%s0.%s", req.TransactionCode, result.Serial)
+        err := tx.QueryRowContext(ctx, `
+            INSERT INTO faktur_pajak_serials (company_id, series_id, serial, faktur_number, transaction_code, reference)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            ON CONFLICT (company_id, serial) DO NOTHING
+            RETURNING used_at`,
+            companyID, result.SeriesID, result.Serial, result.FakturNumber, req.TransactionCode, reference).Scan(&result.UsedAt)
+        if err == sql.ErrNoRows {
+            return false, nil
+        }
+        return err == nil, err
+    }
+    
+    if req.FakturNumber != "" {
+        result.Serial = req.FakturNumber[4:]
+        prefix, year, number := parseFakturSerial(result.Serial)
+        err = tx.QueryRowContext(ctx, `
+            SELECT id FROM faktur_pajak_series
+            WHERE company_id = $1 AND prefix = $2 AND year = $3 AND is_active = true
+              AND $4 BETWEEN start_number AND end_number
+            FOR UPDATE`, companyID, prefix, year, number).Scan(&result.SeriesID)
+        if err == sql.ErrNoRows {
+            s.RespondWithError(w, http.StatusBadRequest, "FAKTUR_OUT_OF_RANGE",
+                "Faktur number is not in a registered faktur pajak series")
+            return
+        }
+        if err != nil {
+            s.HandleDBError(w, err, "Error allocating faktur pajak number")
+            return
+        }
+        
+        recorded, err := record()
+        if err != nil {
+            s.HandleDBError(w, err, "Error allocating faktur pajak number")
+            return
+        }
+        if !recorded {
+            s.RespondWithError(w, http.StatusConflict, "FAKTUR_NUMBER_USED", "Faktur number has already been used")
+            return
+        }
+    } else {
+        year := fmt.Sprintf("%02d", req.Date.Time().Year()%100)
+        // Serials claimed out of turn are skipped
+        for recorded := false; !recorded; {
+            var prefix string
+            var number int64
+            err = tx.QueryRowContext(ctx, `
+                UPDATE faktur_pajak_series SET next_number = next_number + 1
+                WHERE id = (
+                    SELECT id FROM faktur_pajak_series
+                    WHERE company_id = $1 AND year = $2 AND is_active = true AND next_number <= end_number
+                    ORDER BY created_at, id
+                    LIMIT 1
+                    FOR UPDATE
+                )
+                RETURNING id, prefix, next_number - 1`, companyID, year).Scan(&result.SeriesID, &prefix, &number)
+            if err == sql.ErrNoRows {
+                s.RespondWithError(w, http.StatusConflict, "FAKTUR_SERIES_EXHAUSTED",
+                    fmt.Sprintf("No faktur pajak serials left for 20%s; register a new series", year))
+                return
+            }
+            if err != nil {
+                s.HandleDBError(w, err, "Error allocating faktur pajak number")
+                return
+            }
+            
+            result.Serial = formatFakturSerial(prefix, year, number)
+            if recorded, err = record(); err != nil {
+                s.HandleDBError(w, err, "Error allocating faktur pajak number")
+                return
+            }
+        }
+    }
+    
+    if err := tx.Commit(); err != nil {
+        s.HandleDBError(w, err, "Error allocating faktur pajak number")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusCreated, result)
+}
+
+// voidFakturHandler records an allocated faktur pajak number as unused, for a document that
+// was not saved after all. The serial stays taken, so it is never handed out again.
+func (s *TaxService) voidFakturHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    var req struct {
+        FakturNumber string `json:"faktur_number"`
+        Reason       string `json:"reason"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validator.Required("faktur_number", req.FakturNumber)
+    validator.FakturPajakNumber("faktur_number", req.FakturNumber)
+    validator.MaxLength("reason", req.Reason, 255)
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    result, err := s.DB.ExecContext(ctx, `
+        UPDATE faktur_pajak_serials SET voided_at = CURRENT_TIMESTAMP, void_reason = $3
+        WHERE company_id = $1 AND faktur_number = $2 AND voided_at IS NULL`,
+        s.GetCompanyIDFromRequest(r), req.FakturNumber, sql.NullString{String: req.Reason, Valid: req.Reason != ""})
+    if err != nil {
+        s.HandleDBError(w, err, "Error voiding faktur pajak number")
+        return
+    }
+    if voided, _ := result.RowsAffected(); voided == 0 {
+        s.RespondWithError(w, http.StatusNotFound, "FAKTUR_NOT_FOUND", "Faktur number was not allocated or is already void")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"faktur_number": req.FakturNumber, "voided": true})
+}
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
     "context"
     "database/sql"
     "encoding/json"
+    "math"
     "net/http"
     "strconv"
     "time"
@@ -12,6 +13,7 @@ import (
     _ "github.com/lib/pq"
     
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/database"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
@@ -37,14 +39,20 @@ type TaxCalculation struct {
     TaxRate    float64 `json:"tax_rate"`
     TaxAmount  float64 `json:"tax_amount"`
     Total      float64 `json:"total"`
+    Inclusive  bool    `json:"inclusive"`
+    // Components breaks down a tiered or compound tax; TaxRate is then the effective rate
+    Components []ComponentAmount `json:"components,omitempty"`
 }
 
 func main() {
+    logger.Init("tax-service")
+    
     cfg := config.Load()
     cfg.Database.Name = "tax_db"
     
     db := database.InitDatabase(cfg.Database)
     defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
     
     taxService := &TaxService{
         BaseService: &service.BaseService{DB: db},
@@ -52,11 +60,30 @@ func main() {
     
     r := mux.NewRouter()
     api := middleware.APIMiddleware(cfg.JWT.Secret)
+    manager := middleware.RoleMiddleware(cfg.JWT.Secret, "manager")
     
     r.Handle("/health", middleware.HealthCheck(db, "tax-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "tax-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+    })).Methods("GET")
     r.Handle("/tax-rates", api(taxService.getTaxRatesHandler)).Methods("GET")
-    r.Handle("/tax-rates", api(taxService.createTaxRateHandler)).Methods("POST")
+    r.Handle("/tax-rates", manager(taxService.createTaxRateHandler)).Methods("POST")
+    r.Handle("/tax-rates/{id}", api(taxService.getTaxRateHandler)).Methods("GET")
+    r.Handle("/tax-rates/{id}", manager(taxService.updateTaxRateHandler)).Methods("PUT")
+    r.Handle("/tax-rates/{id}", manager(taxService.deleteTaxRateHandler)).Methods("DELETE")
+    r.Handle("/tax-rates/{id}/components", api(taxService.getTaxComponentsHandler)).Methods("GET")
+    r.Handle("/tax-rates/{id}/components", manager(taxService.updateTaxComponentsHandler)).Methods("PUT")
     r.Handle("/calculate-tax", api(taxService.calculateTaxHandler)).Methods("POST")
+    r.Handle("/calculate-withholding", api(taxService.calculateWithholdingHandler)).Methods("POST")
+    r.Handle("/withholding-categories", api(taxService.getWithholdingCategoriesHandler)).Methods("GET")
+    r.Handle("/withholding-categories/seed", manager(taxService.seedWithholdingCategoriesHandler)).Methods("POST")
+    r.Handle("/withholding-categories/{code}", manager(taxService.updateWithholdingCategoryHandler)).Methods("PUT")
+    r.Handle("/faktur-pajak/series", api(taxService.getFakturSeriesHandler)).Methods("GET")
+    r.Handle("/faktur-pajak/series", manager(taxService.createFakturSeriesHandler)).Methods("POST")
+    r.Handle("/faktur-pajak/allocate", api(taxService.allocateFakturHandler)).Methods("POST")
+    r.Handle("/faktur-pajak/void", api(taxService.voidFakturHandler)).Methods("POST")
 
     server.SetupServer(r, cfg)
 }
@@ -65,7 +92,7 @@ func (s *TaxService) getTaxRatesHandler(w http.ResponseWriter, r *http.Request)
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
     query := `SELECT id, company_id, tax_name, tax_rate, is_active, created_at
               FROM tax_rates WHERE company_id = $1 ORDER BY tax_name`
@@ -91,6 +118,37 @@ func (s *TaxService) getTaxRatesHandler(w http.ResponseWriter, r *http.Request)
     s.RespondWithJSON(w, http.StatusOK, taxRates)
 }
 
+func (s *TaxService) getTaxRateHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    vars := mux.Vars(r)
+    id, err := strconv.Atoi(vars["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid tax rate ID")
+        return
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    var taxRate TaxRate
+    query := `SELECT id, company_id, tax_name, tax_rate, is_active, created_at
+              FROM tax_rates WHERE id = $1 AND company_id = $2`
+    
+    err = s.DB.QueryRowContext(ctx, query, id, companyID).Scan(&taxRate.ID, &taxRate.CompanyID,
+        &taxRate.TaxName, &taxRate.TaxRate, &taxRate.IsActive, &taxRate.CreatedAt)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "TAX_RATE_NOT_FOUND", "Tax rate not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching tax rate")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, taxRate)
+}
+
 func (s *TaxService) createTaxRateHandler(w http.ResponseWriter, r *http.Request) {
     ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
     defer cancel()
@@ -113,7 +171,7 @@ func (s *TaxService) createTaxRateHandler(w http.ResponseWriter, r *http.Request
         return
     }
 
-    taxRate.CompanyID, _ = strconv.Atoi(r.Header.Get("Company-ID"))
+    taxRate.CompanyID = s.GetCompanyIDFromRequest(r)
     taxRate.IsActive = true
 
     query := `INSERT INTO tax_rates (company_id, tax_name, tax_rate, is_active) 
@@ -130,6 +188,126 @@ func (s *TaxService) createTaxRateHandler(w http.ResponseWriter, r *http.Request
     s.RespondWithJSON(w, http.StatusCreated, taxRate)
 }
 
+// updateTaxRateHandler corrects a rate's name or percentage, or reactivates a retired rate.
+// Omitting is_active leaves it unchanged.
+func (s *TaxService) updateTaxRateHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid tax rate ID")
+        return
+    }
+    
+    var req struct {
+        TaxName  string  `json:"tax_name"`
+        TaxRate  float64 `json:"tax_rate"`
+        IsActive *bool   `json:"is_active"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+
+    validator := validation.New()
+    validator.Required("tax_name", req.TaxName)
+    
+    if req.TaxRate < 0 || req.TaxRate > 100 {
+        validator.AddError("tax_rate", "Tax rate must be between 0 and 100")
+    }
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    var taxRate TaxRate
+    query := `UPDATE tax_rates
+              SET tax_name = $3, tax_rate = $4, is_active = COALESCE($5, is_active)
+              WHERE id = $1 AND company_id = $2
+              RETURNING id, company_id, tax_name, tax_rate, is_active, created_at`
+    
+    err = s.DB.QueryRowContext(ctx, query, id, companyID, req.TaxName, req.TaxRate, req.IsActive).Scan(
+        &taxRate.ID, &taxRate.CompanyID, &taxRate.TaxName, &taxRate.TaxRate, &taxRate.IsActive, &taxRate.CreatedAt)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "TAX_RATE_NOT_FOUND", "Tax rate not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating tax rate")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, taxRate)
+}
+
+// deleteTaxRateHandler retires a rate by deactivating it, which keeps it for the calculations
+// that used it. Admins can remove one for good with ?permanent=true, but only if no tax
+// transaction refers to it.
+func (s *TaxService) deleteTaxRateHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid tax rate ID")
+        return
+    }
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    if r.URL.Query().Get("permanent") != "true" {
+        result, err := s.DB.ExecContext(ctx,
+            "UPDATE tax_rates SET is_active = false WHERE id = $1 AND company_id = $2", id, companyID)
+        if err != nil {
+            s.HandleDBError(w, err, "Error deactivating tax rate")
+            return
+        }
+        if rows, _ := result.RowsAffected(); rows == 0 {
+            s.RespondWithError(w, http.StatusNotFound, "TAX_RATE_NOT_FOUND", "Tax rate not found")
+            return
+        }
+        s.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"id": id, "is_active": false})
+        return
+    }
+    
+    if !s.ValidateUserPermission(r, "admin") {
+        s.RespondWithError(w, http.StatusForbidden, "INSUFFICIENT_ROLE", "Permanent deletion requires admin role")
+        return
+    }
+    
+    // The reference check and delete share a statement, so a calculation recorded in between
+    // cannot be orphaned
+    result, err := s.DB.ExecContext(ctx, `
+        DELETE FROM tax_rates
+        WHERE id = $1 AND company_id = $2
+          AND NOT EXISTS (SELECT 1 FROM tax_transactions WHERE tax_rate_id = $1)`, id, companyID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error deleting tax rate")
+        return
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        var exists bool
+        if err := s.DB.QueryRowContext(ctx,
+            "SELECT EXISTS(SELECT 1 FROM tax_rates WHERE id = $1 AND company_id = $2)", id, companyID).Scan(&exists); err != nil {
+            s.HandleDBError(w, err, "Error deleting tax rate")
+            return
+        }
+        if !exists {
+            s.RespondWithError(w, http.StatusNotFound, "TAX_RATE_NOT_FOUND", "Tax rate not found")
+            return
+        }
+        s.RespondWithError(w, http.StatusConflict, "TAX_RATE_IN_USE",
+            "Tax rate has been used in tax calculations; deactivate it instead")
+        return
+    }
+    
+    w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *TaxService) calculateTaxHandler(w http.ResponseWriter, r *http.Request) {
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
@@ -137,6 +315,8 @@ func (s *TaxService) calculateTaxHandler(w http.ResponseWriter, r *http.Request)
     var req struct {
         Amount    float64 `json:"amount"`
         TaxRateID int     `json:"tax_rate_id"`
+        // Inclusive treats amount as a price that already includes the tax
+        Inclusive bool `json:"inclusive"`
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -157,7 +337,7 @@ func (s *TaxService) calculateTaxHandler(w http.ResponseWriter, r *http.Request)
         return
     }
 
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
     var taxRate float64
     err := s.DB.QueryRowContext(ctx, 
@@ -171,13 +351,46 @@ func (s *TaxService) calculateTaxHandler(w http.ResponseWriter, r *http.Request)
         s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Database error")
         return
     }
+    
+    components, err := s.loadTaxComponents(ctx, req.TaxRateID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching tax components")
+        return
+    }
 
-    taxAmount := req.Amount * (taxRate / 100)
-    result := TaxCalculation{
-        BaseAmount: req.Amount,
-        TaxRate:    taxRate,
-        TaxAmount:  taxAmount,
-        Total:      req.Amount + taxAmount,
+    var result TaxCalculation
+    if len(components) > 0 {
+        if req.Inclusive {
+            validator.AddError("inclusive", "Inclusive amounts are not supported for taxes with components")
+            s.RespondValidationError(w, validator.Errors())
+            return
+        }
+        amounts, taxAmount := calculateComponents(req.Amount, components)
+        result = TaxCalculation{
+            BaseAmount: req.Amount,
+            TaxRate:    math.Round(taxAmount/req.Amount*10000) / 100,
+            TaxAmount:  taxAmount,
+            Total:      req.Amount + taxAmount,
+            Components: amounts,
+        }
+    } else if req.Inclusive {
+        // Back the tax out of the price in whole Rupiah, so base and tax still add up to it
+        base := math.Round(req.Amount / (1 + taxRate/100))
+        result = TaxCalculation{
+            BaseAmount: base,
+            TaxRate:    taxRate,
+            TaxAmount:  req.Amount - base,
+            Total:      req.Amount,
+            Inclusive:  true,
+        }
+    } else {
+        taxAmount := req.Amount * (taxRate / 100)
+        result = TaxCalculation{
+            BaseAmount: req.Amount,
+            TaxRate:    taxRate,
+            TaxAmount:  taxAmount,
+            Total:      req.Amount + taxAmount,
+        }
     }
 
     s.RespondWithJSON(w, http.StatusOK, result)
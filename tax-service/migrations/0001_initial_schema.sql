@@ -0,0 +1,40 @@
+-- tax-service/migrations/0001_initial_schema.sql
+-- Baseline schema, as database/init-db.sql creates it. Later schema changes are the numbered
+-- migrations that follow; each is also safe to run on a database that already has it.
+
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    tax_name VARCHAR(100) NOT NULL,
+    tax_rate DECIMAL(5,2) NOT NULL CHECK (tax_rate >= 0 AND tax_rate <= 100),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tax_transactions (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    transaction_id INTEGER NOT NULL,
+    transaction_type VARCHAR(20) NOT NULL CHECK (transaction_type IN ('INVOICE', 'PURCHASE', 'JOURNAL')),
+    tax_rate_id INTEGER REFERENCES tax_rates(id),
+    tax_base DECIMAL(15,0) NOT NULL CHECK (tax_base >= 0),
+    tax_amount DECIMAL(15,0) NOT NULL CHECK (tax_amount >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_idr_tax_amounts CHECK (
+        tax_base = ROUND(tax_base) AND tax_amount = ROUND(tax_amount)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_tax_rates_company_active ON tax_rates(company_id, is_active) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_tax_transactions_company_type ON tax_transactions(company_id, transaction_type);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER update_tax_rates_updated_at BEFORE UPDATE ON tax_rates FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,35 @@
+-- tax-service/migrations/0002_faktur_pajak.sql
+-- Faktur pajak serial ranges DJP has allocated to each company, and the serials handed out
+-- from them. A range shares the code and year of its serials; next_number is the next serial
+-- to hand out and passes end_number once the range is used up.
+CREATE TABLE IF NOT EXISTS faktur_pajak_series (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    prefix CHAR(3) NOT NULL,
+    year CHAR(2) NOT NULL,
+    start_number BIGINT NOT NULL CHECK (start_number BETWEEN 1 AND 99999999),
+    end_number BIGINT NOT NULL CHECK (end_number BETWEEN 1 AND 99999999),
+    next_number BIGINT NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_series_range CHECK (start_number <= end_number),
+    CONSTRAINT check_series_next CHECK (next_number BETWEEN start_number AND end_number + 1)
+);
+
+CREATE TABLE IF NOT EXISTS faktur_pajak_serials (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    series_id INTEGER NOT NULL REFERENCES faktur_pajak_series(id),
+    serial CHAR(15) NOT NULL,
+    faktur_number CHAR(19) NOT NULL,
+    transaction_code CHAR(2) NOT NULL,
+    reference VARCHAR(100),
+    used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, serial)
+);
+
+CREATE INDEX IF NOT EXISTS idx_faktur_pajak_series_available
+    ON faktur_pajak_series(company_id, year, start_number) WHERE is_active = true;
+
+CREATE OR REPLACE TRIGGER update_faktur_pajak_series_updated_at BEFORE UPDATE ON faktur_pajak_series FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,18 @@
+-- tax-service/migrations/0003_withholding_categories.sql
+-- PPh withholding categories and their rates per company. non_npwp_rate applies when the
+-- payee has no NPWP; PPh 26 and final PPh 4(2) have no surcharge, so it equals rate there.
+CREATE TABLE IF NOT EXISTS withholding_categories (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    code VARCHAR(30) NOT NULL,
+    article VARCHAR(5) NOT NULL CHECK (article IN ('21', '23', '26', '4(2)')),
+    name VARCHAR(100) NOT NULL,
+    rate DECIMAL(5,2) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+    non_npwp_rate DECIMAL(5,2) NOT NULL CHECK (non_npwp_rate >= 0 AND non_npwp_rate <= 100),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, code)
+);
+
+CREATE OR REPLACE TRIGGER update_withholding_categories_updated_at BEFORE UPDATE ON withholding_categories FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
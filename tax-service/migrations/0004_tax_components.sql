@@ -0,0 +1,18 @@
+-- tax-service/migrations/0004_tax_components.sql
+-- Components a tax is made of, applied in position order. Each taxes the part of its base
+-- between lower_bound and upper_bound (no upper bound when NULL); its base is the amount plus
+-- the tax of the earlier components listed in compound_on. A tax without components is the
+-- flat tax_rate.
+CREATE TABLE IF NOT EXISTS tax_components (
+    id SERIAL PRIMARY KEY,
+    tax_rate_id INTEGER NOT NULL REFERENCES tax_rates(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL CHECK (position > 0),
+    name VARCHAR(100) NOT NULL,
+    rate DECIMAL(5,2) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+    lower_bound DECIMAL(15,0) NOT NULL DEFAULT 0 CHECK (lower_bound >= 0),
+    upper_bound DECIMAL(15,0),
+    compound_on INTEGER[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tax_rate_id, position),
+    CONSTRAINT check_component_bounds CHECK (upper_bound IS NULL OR upper_bound > lower_bound)
+);
@@ -0,0 +1,5 @@
+-- tax-service/migrations/0005_faktur_void.sql
+-- Serials handed out for a document that was then not saved. They are not handed out again
+-- and are kept so they can be reported to DJP as unused.
+ALTER TABLE faktur_pajak_serials ADD COLUMN IF NOT EXISTS voided_at TIMESTAMP;
+ALTER TABLE faktur_pajak_serials ADD COLUMN IF NOT EXISTS void_reason VARCHAR(255);
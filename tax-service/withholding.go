@@ -0,0 +1,227 @@
+// tax-service/withholding.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "math"
+    "net/http"
+    "time"
+    
+    "github.com/gorilla/mux"
+    
+    "github.com/massehanto/accounting-system-go/shared/service"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// WithholdingCategory is a kind of payment PPh is withheld from, with the company's rates for it
+type WithholdingCategory struct {
+    ID          int       `json:"id"`
+    CompanyID   int       `json:"company_id"`
+    Code        string    `json:"code"`
+    Article     string    `json:"article"`
+    Name        string    `json:"name"`
+    Rate        float64   `json:"rate"`
+    NonNPWPRate float64   `json:"non_npwp_rate"`
+    IsActive    bool      `json:"is_active"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// WithholdingCalculation is the PPh withheld from a payment and what is left to pay the payee
+type WithholdingCalculation struct {
+    Category          string  `json:"category"`
+    Article           string  `json:"article"`
+    BaseAmount        float64 `json:"base_amount"`
+    Rate              float64 `json:"rate"`
+    HasNPWP           bool    `json:"has_npwp"`
+    WithholdingAmount float64 `json:"withholding_amount"`
+    NetPayable        float64 `json:"net_payable"`
+}
+
+// defaultWithholdingCategories are the common cases, seeded into a company on request. Payees
+// without an NPWP pay 20% more PPh 21 and double PPh 23; PPh 26 and final PPh 4(2) have no
+// such surcharge.
+var defaultWithholdingCategories = []WithholdingCategory{
+    {Code: "PPH21_NON_EMPLOYEE", Article: "21", Name: "PPh 21 Bukan Pegawai (tenaga ahli)", Rate: 2.5, NonNPWPRate: 3},
+    {Code: "PPH23_SERVICES", Article: "23", Name: "PPh 23 Jasa", Rate: 2, NonNPWPRate: 4},
+    {Code: "PPH23_ROYALTY", Article: "23", Name: "PPh 23 Dividen, Bunga, Royalti, Hadiah", Rate: 15, NonNPWPRate: 30},
+    {Code: "PPH26", Article: "26", Name: "PPh 26 Wajib Pajak Luar Negeri", Rate: 20, NonNPWPRate: 20},
+    {Code: "PPH4_2_RENT", Article: "4(2)", Name: "PPh 4(2) Sewa Tanah dan/atau Bangunan", Rate: 10, NonNPWPRate: 10},
+    {Code: "PPH4_2_CONSTRUCTION", Article: "4(2)", Name: "PPh 4(2) Jasa Konstruksi", Rate: 2.65, NonNPWPRate: 2.65},
+}
+
+func (s *TaxService) getWithholdingCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    rows, err := s.DB.QueryContext(ctx, `
+        SELECT id, company_id, code, article, name, rate, non_npwp_rate, is_active, created_at
+        FROM withholding_categories WHERE company_id = $1 ORDER BY article, code`,
+        s.GetCompanyIDFromRequest(r))
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching withholding categories")
+        return
+    }
+    defer rows.Close()
+    
+    categories := []WithholdingCategory{}
+    for rows.Next() {
+        var category WithholdingCategory
+        if err := rows.Scan(&category.ID, &category.CompanyID, &category.Code, &category.Article, &category.Name,
+            &category.Rate, &category.NonNPWPRate, &category.IsActive, &category.CreatedAt); err != nil {
+            s.HandleDBError(w, err, "Error fetching withholding categories")
+            return
+        }
+        categories = append(categories, category)
+    }
+    if err := rows.Err(); err != nil {
+        s.HandleDBError(w, err, "Error fetching withholding categories")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, categories)
+}
+
+// seedWithholdingCategoriesHandler adds the default categories the company doesn't have yet.
+// Categories it already has keep their rates, so seeding again is harmless.
+func (s *TaxService) seedWithholdingCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    companyID := s.GetCompanyIDFromRequest(r)
+    
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.HandleDBError(w, err, "Error seeding withholding categories")
+        return
+    }
+    defer tx.Rollback()
+    
+    added := 0
+    for _, category := range defaultWithholdingCategories {
+        result, err := tx.ExecContext(ctx, `
+            INSERT INTO withholding_categories (company_id, code, article, name, rate, non_npwp_rate)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            ON CONFLICT (company_id, code) DO NOTHING`,
+            companyID, category.Code, category.Article, category.Name, category.Rate, category.NonNPWPRate)
+        if err != nil {
+            s.HandleDBError(w, err, "Error seeding withholding categories")
+            return
+        }
+        if rows, _ := result.RowsAffected(); rows > 0 {
+            added++
+        }
+    }
+    
+    if err := tx.Commit(); err != nil {
+        s.HandleDBError(w, err, "Error seeding withholding categories")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"added": added})
+}
+
+// updateWithholdingCategoryHandler changes a category's rates, e.g. after a regulation change.
+// Omitting is_active leaves it unchanged.
+func (s *TaxService) updateWithholdingCategoryHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+    
+    var req struct {
+        Name        string  `json:"name"`
+        Rate        float64 `json:"rate"`
+        NonNPWPRate float64 `json:"non_npwp_rate"`
+        IsActive    *bool   `json:"is_active"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    validator.Required("name", req.Name)
+    validator.MaxLength("name", req.Name, 100)
+    if req.Rate < 0 || req.Rate > 100 {
+        validator.AddError("rate", "Rate must be between 0 and 100")
+    }
+    if req.NonNPWPRate < req.Rate || req.NonNPWPRate > 100 {
+        validator.AddError("non_npwp_rate", "Rate without NPWP must be between rate and 100")
+    }
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    var category WithholdingCategory
+    err := s.DB.QueryRowContext(ctx, `
+        UPDATE withholding_categories
+        SET name = $3, rate = $4, non_npwp_rate = $5, is_active = COALESCE($6, is_active)
+        WHERE code = $1 AND company_id = $2
+        RETURNING id, company_id, code, article, name, rate, non_npwp_rate, is_active, created_at`,
+        mux.Vars(r)["code"], s.GetCompanyIDFromRequest(r), req.Name, req.Rate, req.NonNPWPRate, req.IsActive).Scan(
+        &category.ID, &category.CompanyID, &category.Code, &category.Article, &category.Name,
+        &category.Rate, &category.NonNPWPRate, &category.IsActive, &category.CreatedAt)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "WITHHOLDING_CATEGORY_NOT_FOUND", "Withholding category not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating withholding category")
+        return
+    }
+    
+    s.RespondWithJSON(w, http.StatusOK, category)
+}
+
+// calculateWithholdingHandler works out the PPh to withhold from a payment of amount in the
+// given category. The payee's NPWP, if given, must be valid; without one the higher rate applies.
+func (s *TaxService) calculateWithholdingHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    var req struct {
+        Amount   float64 `json:"amount"`
+        Category string  `json:"category"`
+        NPWP     string  `json:"npwp"`
+    }
+    if err := service.DecodeJSONBody(w, r, &req, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
+        return
+    }
+    
+    validator := validation.New()
+    if req.Amount <= 0 {
+        validator.AddError("amount", "Amount must be positive")
+    }
+    validator.Required("category", req.Category)
+    validator.NPWP("npwp", req.NPWP)
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+    
+    result := WithholdingCalculation{Category: req.Category, BaseAmount: req.Amount, HasNPWP: req.NPWP != ""}
+    var rate, nonNPWPRate float64
+    err := s.DB.QueryRowContext(ctx, `
+        SELECT article, rate, non_npwp_rate FROM withholding_categories
+        WHERE code = $1 AND company_id = $2 AND is_active = true`,
+        req.Category, s.GetCompanyIDFromRequest(r)).Scan(&result.Article, &rate, &nonNPWPRate)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "WITHHOLDING_CATEGORY_NOT_FOUND", "Withholding category not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error calculating withholding tax")
+        return
+    }
+    
+    result.Rate = rate
+    if !result.HasNPWP {
+        result.Rate = nonNPWPRate
+    }
+    // PPh is withheld and reported in whole Rupiah
+    result.WithholdingAmount = math.Round(req.Amount * result.Rate / 100)
+    result.NetPayable = req.Amount - result.WithholdingAmount
+    
+    s.RespondWithJSON(w, http.StatusOK, result)
+}
\ No newline at end of file
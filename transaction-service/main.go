@@ -4,17 +4,18 @@ package main
 import (
     "context"
     "database/sql"
-    "encoding/json"
     "fmt"
+    "log"
     "net/http"
+    "os"
     "strconv"
-    "strings"
     "time"
     
     "github.com/gorilla/mux"
     _ "github.com/lib/pq"
     
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/database"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
@@ -30,9 +31,9 @@ type JournalEntry struct {
     ID          int                `json:"id"`
     CompanyID   int                `json:"company_id"`
     EntryNumber string             `json:"entry_number"`
-    EntryDate   time.Time          `json:"entry_date"`
+    EntryDate   service.JakartaTime `json:"entry_date"`
     Description string             `json:"description"`
-    TotalAmount float64            `json:"total_amount"`
+    TotalAmount service.Rupiah     `json:"total_amount"`
     Status      string             `json:"status"`
     CreatedBy   int                `json:"created_by"`
     PostedBy    *int               `json:"posted_by,omitempty"`
@@ -47,17 +48,25 @@ type JournalEntryLine struct {
     JournalEntryID  int     `json:"journal_entry_id"`
     AccountID       int     `json:"account_id"`
     Description     string  `json:"description"`
-    DebitAmount     float64 `json:"debit_amount"`
-    CreditAmount    float64 `json:"credit_amount"`
+    DebitAmount     service.Rupiah `json:"debit_amount"`
+    CreditAmount    service.Rupiah `json:"credit_amount"`
     CreatedAt       time.Time `json:"created_at"`
 }
 
 func main() {
+    logger.Init("transaction-service")
+    
     cfg := config.Load()
     cfg.Database.Name = "transaction_db"
     
     db := database.InitDatabase(cfg.Database)
     defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
+    
+    idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_KEY_TTL", "24h"))
+    if err != nil || idempotencyTTL <= 0 {
+        log.Fatalf("Invalid IDEMPOTENCY_KEY_TTL: %q", os.Getenv("IDEMPOTENCY_KEY_TTL"))
+    }
     
     transactionService := &TransactionService{
         BaseService: &service.BaseService{DB: db},
@@ -66,12 +75,20 @@ func main() {
     r := mux.NewRouter()
     
     r.Handle("/health", middleware.HealthCheck(db, "transaction-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "transaction-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+    })).Methods("GET")
     
     authMiddleware := middleware.NewAuthMiddleware(cfg.JWT.Secret)
+    accountantMiddleware := middleware.Chain(authMiddleware, middleware.RequireRole("accountant"))
     r.Handle("/transactions", authMiddleware(transactionService.getTransactionsHandler)).Methods("GET")
-    r.Handle("/transactions", authMiddleware(transactionService.createTransactionHandler)).Methods("POST")
+    // Retried creates with the same Idempotency-Key return the first response
+    idempotent := middleware.Chain(accountantMiddleware, middleware.Idempotency(db, idempotencyTTL))
+    r.Handle("/transactions", idempotent(transactionService.createTransactionHandler)).Methods("POST")
     r.Handle("/transactions/{id}", authMiddleware(transactionService.getTransactionHandler)).Methods("GET")
-    r.Handle("/transactions/{id}/post", authMiddleware(transactionService.postTransactionHandler)).Methods("POST")
+    r.Handle("/transactions/{id}/post", accountantMiddleware(transactionService.postTransactionHandler)).Methods("POST")
 
     server.SetupServer(r, cfg)
 }
@@ -133,13 +150,13 @@ func (s *TransactionService) getTransactionsHandler(w http.ResponseWriter, r *ht
         transactions = append(transactions, transaction)
     }
     
-    s.RespondWithJSON(w, http.StatusOK, transactions)
+    s.RespondFormatted(w, r, http.StatusOK, transactions)
 }
 
 func (s *TransactionService) createTransactionHandler(w http.ResponseWriter, r *http.Request) {
     var entry JournalEntry
-    if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
-        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+    if err := service.DecodeJSONBody(w, r, &entry, service.DefaultMaxBodyBytes); err != nil {
+        s.RespondWithBodyError(w, err)
         return
     }
 
@@ -151,7 +168,7 @@ func (s *TransactionService) createTransactionHandler(w http.ResponseWriter, r *
         validator.AddError("lines", "At least two journal lines required")
     }
 
-    var totalDebits, totalCredits float64
+    var totalDebits, totalCredits service.Rupiah
     for i, line := range entry.Lines {
         if line.AccountID == 0 {
             validator.AddError(fmt.Sprintf("lines[%d].account_id", i), "Account ID required")
@@ -171,7 +188,7 @@ func (s *TransactionService) createTransactionHandler(w http.ResponseWriter, r *
         totalCredits += line.CreditAmount
     }
 
-    if abs(totalDebits-totalCredits) > 0.01 {
+    if abs(float64(totalDebits-totalCredits)) > 0.01 {
         validator.AddError("balance", "Total debits must equal total credits")
     }
 
@@ -186,7 +203,7 @@ func (s *TransactionService) createTransactionHandler(w http.ResponseWriter, r *
     entry.TotalAmount = totalDebits
 
     if entry.EntryDate.IsZero() {
-        entry.EntryDate = time.Now()
+        entry.EntryDate = service.NewJakartaTime(time.Now())
     }
 
     err := s.WithTransaction(r.Context(), func(tx *sql.Tx) error {
@@ -367,7 +384,7 @@ func (s *TransactionService) getTransactionHandler(w http.ResponseWriter, r *htt
         entry.Lines = append(entry.Lines, line)
     }
     
-    s.RespondWithJSON(w, http.StatusOK, entry)
+    s.RespondFormatted(w, r, http.StatusOK, entry)
 }
 
 func abs(x float64) float64 {
@@ -375,4 +392,11 @@ func abs(x float64) float64 {
         return -x
     }
     return x
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
 }
\ No newline at end of file
@@ -0,0 +1,61 @@
+-- transaction-service/migrations/0001_initial_schema.sql
+-- Baseline schema, as database/init-db.sql creates it. Later schema changes are the numbered
+-- migrations that follow; each is also safe to run on a database that already has it.
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    entry_number VARCHAR(50) NOT NULL,
+    entry_date DATE NOT NULL,
+    description TEXT NOT NULL,
+    total_amount DECIMAL(15,0) NOT NULL CHECK (total_amount >= 0),
+    status VARCHAR(20) DEFAULT 'draft' CHECK (status IN ('draft', 'posted', 'cancelled', 'reversed')),
+    created_by INTEGER NOT NULL,
+    posted_by INTEGER,
+    posted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, entry_number),
+    CONSTRAINT check_idr_total_amount CHECK (total_amount = ROUND(total_amount))
+);
+
+CREATE TABLE IF NOT EXISTS journal_entry_lines (
+    id SERIAL PRIMARY KEY,
+    journal_entry_id INTEGER REFERENCES journal_entries(id) ON DELETE CASCADE,
+    account_id INTEGER NOT NULL,
+    description TEXT,
+    debit_amount DECIMAL(15,0) DEFAULT 0 CHECK (debit_amount >= 0),
+    credit_amount DECIMAL(15,0) DEFAULT 0 CHECK (credit_amount >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_debit_or_credit CHECK (
+        (debit_amount > 0 AND credit_amount = 0) OR 
+        (debit_amount = 0 AND credit_amount > 0)
+    ),
+    CONSTRAINT check_idr_line_amounts CHECK (
+        debit_amount = ROUND(debit_amount) AND credit_amount = ROUND(credit_amount)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_company_date ON journal_entries(company_id, entry_date);
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON journal_entries(company_id, status);
+CREATE INDEX IF NOT EXISTS idx_transaction_lines_entry ON journal_entry_lines(journal_entry_id);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION audit_log_changes()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Note: This is a simplified audit function for transaction_db
+    -- In a real implementation, you might want to log to a central audit service
+    RETURN COALESCE(NEW, OLD);
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER update_journal_entries_updated_at BEFORE UPDATE ON journal_entries FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE OR REPLACE TRIGGER audit_journal_entries AFTER INSERT OR UPDATE OR DELETE ON journal_entries FOR EACH ROW EXECUTE FUNCTION audit_log_changes();
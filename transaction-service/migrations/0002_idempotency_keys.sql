@@ -0,0 +1,18 @@
+-- transaction-service/migrations/0002_idempotency_keys.sql
+-- Stored responses for Idempotency-Key retries, see shared/middleware/idempotency.go
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    endpoint VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    response_status INTEGER,
+    response_body BYTEA,
+    content_type VARCHAR(100),
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, endpoint, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at);
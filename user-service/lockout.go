@@ -0,0 +1,91 @@
+// user-service/lockout.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// Failures older than this no longer count towards an account lockout
+const loginFailureWindow = 24 * time.Hour
+
+// maxLockout caps the backoff for accounts that keep failing
+const maxLockout = 24 * time.Hour
+
+// LoginThrottle holds the limits applied to failed logins
+type LoginThrottle struct {
+    MaxAttempts   int
+    Lockout       time.Duration
+    IPMaxAttempts int
+}
+
+// loginRetryAfter returns how long the caller must wait before trying to log in again, with the
+// error code to report, or zero when the attempt may proceed. An account is locked once it
+// reaches MaxAttempts consecutive failures, and each further failure doubles the lockout. An IP
+// address is throttled after IPMaxAttempts failures across any accounts within one Lockout.
+func (s *UserService) loginRetryAfter(ctx context.Context, email, ip string) (time.Duration, string, error) {
+    now := time.Now().UTC()
+
+    var failures int
+    var lastFailure sql.NullTime
+    err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*), MAX(attempted_at) FROM login_attempts
+                                      WHERE email = $1 AND succeeded = false AND attempted_at > $2
+                                        AND attempted_at > COALESCE((SELECT MAX(attempted_at) FROM login_attempts
+                                                                     WHERE email = $1 AND succeeded = true), $2)`,
+        email, now.Add(-loginFailureWindow)).Scan(&failures, &lastFailure)
+    if err != nil {
+        return 0, "", err
+    }
+    if failures >= s.loginThrottle.MaxAttempts && lastFailure.Valid {
+        extra := failures - s.loginThrottle.MaxAttempts
+        if extra > 10 {
+            extra = 10
+        }
+        lockout := s.loginThrottle.Lockout * time.Duration(1<<extra)
+        if lockout > maxLockout {
+            lockout = maxLockout
+        }
+        if wait := lastFailure.Time.Add(lockout).Sub(now); wait > 0 {
+            return wait, "ACCOUNT_LOCKED", nil
+        }
+    }
+
+    var ipFailures int
+    var firstFailure sql.NullTime
+    err = s.DB.QueryRowContext(ctx, `SELECT COUNT(*), MIN(attempted_at) FROM login_attempts
+                                     WHERE ip_address = $1 AND succeeded = false AND attempted_at > $2`,
+        ip, now.Add(-s.loginThrottle.Lockout)).Scan(&ipFailures, &firstFailure)
+    if err != nil {
+        return 0, "", err
+    }
+    if ipFailures >= s.loginThrottle.IPMaxAttempts && firstFailure.Valid {
+        if wait := firstFailure.Time.Add(s.loginThrottle.Lockout).Sub(now); wait > 0 {
+            return wait, "TOO_MANY_LOGIN_ATTEMPTS", nil
+        }
+    }
+    return 0, "", nil
+}
+
+// recordLoginAttempt logs an attempt; a success ends the account's run of consecutive failures
+func (s *UserService) recordLoginAttempt(ctx context.Context, email, ip string, succeeded bool) {
+    _, err := s.DB.ExecContext(ctx,
+        "INSERT INTO login_attempts (email, ip_address, succeeded, attempted_at) VALUES ($1, $2, $3, $4)",
+        email, ip, succeeded, time.Now().UTC())
+    if err != nil {
+        log.Printf("Recording login attempt for %s failed: %v", email, err)
+    }
+}
+
+func (s *UserService) respondLoginThrottled(w http.ResponseWriter, wait time.Duration, code string) {
+    w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+    message := "Too many failed login attempts, try again later"
+    if code == "ACCOUNT_LOCKED" {
+        message = "Account temporarily locked after repeated failed logins, try again later"
+    }
+    s.RespondWithError(w, http.StatusTooManyRequests, code, message)
+}
\ No newline at end of file
@@ -5,7 +5,10 @@ import (
     "context"
     "database/sql"
     "encoding/json"
+    "log"
     "net/http"
+    "os"
+    "strconv"
     "strings"
     "time"
     
@@ -14,7 +17,9 @@ import (
     "golang.org/x/crypto/bcrypt"
     "github.com/dgrijalva/jwt-go"
     
+    "github.com/massehanto/accounting-system-go/shared/client"
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/database"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
@@ -22,9 +27,17 @@ import (
     "github.com/massehanto/accounting-system-go/shared/validation"
 )
 
+var validRoles = []string{"admin", "manager", "accountant", "user"}
+
 type UserService struct {
     *service.BaseService
-    config *config.Config
+    config        *config.Config
+    notifyClient  *client.Client
+    resetURL      string
+    resetTokenTTL time.Duration
+    loginThrottle LoginThrottle
+    totpBox       *secretBox
+    totpIssuer    string
 }
 
 type User struct {
@@ -44,42 +57,170 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-    Token string `json:"token"`
-    User  User   `json:"user"`
+    Token        string `json:"token"`
+    RefreshToken string `json:"refresh_token"`
+    ExpiresIn    int    `json:"expires_in"`
+    User         User   `json:"user"`
 }
 
 func main() {
+    logger.Init("user-service")
+    
     cfg := config.Load()
     cfg.Database.Name = "user_db"
     
     db := database.InitDatabase(cfg.Database)
     defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
+    
+    resetTokenTTL, err := time.ParseDuration(getEnv("PASSWORD_RESET_TTL", "1h"))
+    if err != nil || resetTokenTTL <= 0 {
+        log.Fatalf("Invalid PASSWORD_RESET_TTL: %q", os.Getenv("PASSWORD_RESET_TTL"))
+    }
+    
+    loginThrottle := LoginThrottle{
+        MaxAttempts:   envInt("LOGIN_MAX_ATTEMPTS", "5"),
+        IPMaxAttempts: envInt("LOGIN_IP_MAX_ATTEMPTS", "20"),
+    }
+    loginThrottle.Lockout, err = time.ParseDuration(getEnv("LOGIN_LOCKOUT_DURATION", "15m"))
+    if err != nil || loginThrottle.Lockout <= 0 {
+        log.Fatalf("Invalid LOGIN_LOCKOUT_DURATION: %q", os.Getenv("LOGIN_LOCKOUT_DURATION"))
+    }
+    
+    totpKey := os.Getenv("TOTP_ENCRYPTION_KEY")
+    if len(totpKey) < 32 {
+        log.Fatalf("TOTP_ENCRYPTION_KEY must be at least 32 characters long")
+    }
+    totpBox, err := newSecretBox(totpKey)
+    if err != nil {
+        log.Fatalf("Failed to initialise TOTP encryption: %v", err)
+    }
     
     userService := &UserService{
-        BaseService: &service.BaseService{DB: db},
-        config:     cfg,
+        BaseService:   &service.BaseService{DB: db},
+        config:        cfg,
+        notifyClient:  client.New(getEnv("NOTIFICATION_SERVICE_URL", "http://localhost:8010")),
+        resetURL:      getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+        resetTokenTTL: resetTokenTTL,
+        loginThrottle: loginThrottle,
+        totpBox:       totpBox,
+        totpIssuer:    getEnv("TOTP_ISSUER", "Accounting System"),
+    }
+    
+    sessionSecret := os.Getenv("SESSION_SECRET")
+    if len(sessionSecret) < 32 {
+        log.Fatalf("SESSION_SECRET must be at least 32 characters long")
     }
+    csrf := middleware.NewCSRF(sessionSecret, time.Hour)
     
     r := mux.NewRouter()
     
     r.Handle("/health", middleware.HealthCheck(db, "user-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "user-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+        Dependencies:  map[string]middleware.Pinger{"notification-service": userService.notifyClient},
+    })).Methods("GET")
+    
+    // Browser clients using cookies fetch a token here and send it as X-CSRF-Token
+    r.Handle("/csrf-token", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
+        middleware.LoggingMiddleware,
+    )(csrf.TokenHandler)).Methods("GET")
     
-    // Public endpoints
+    // Public endpoints. They take no bearer token, so a browser could be made to call them
+    // from another site; csrf.Protect requires the X-CSRF-Token from /csrf-token instead.
     r.Handle("/auth/login", middleware.Chain(
         middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
         middleware.LoggingMiddleware,
+        csrf.Protect,
     )(userService.loginHandler)).Methods("POST")
     
-    r.Handle("/auth/register", middleware.Chain(
+    // Second step of a login challenged for two-factor authentication
+    r.Handle("/auth/2fa/login", middleware.Chain(
         middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
+        middleware.RateLimit(10),
         middleware.LoggingMiddleware,
-    )(userService.registerHandler)).Methods("POST")
+        csrf.Protect,
+    )(userService.twoFactorLoginHandler)).Methods("POST")
+    
+    r.Handle("/auth/refresh", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
+        middleware.LoggingMiddleware,
+        csrf.Protect,
+    )(userService.refreshTokenHandler)).Methods("POST")
+    
+    r.Handle("/auth/logout", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
+        middleware.LoggingMiddleware,
+        csrf.Protect,
+    )(userService.logoutHandler)).Methods("POST")
+    
+    r.Handle("/auth/forgot-password", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
+        middleware.RateLimit(5),
+        middleware.LoggingMiddleware,
+        csrf.Protect,
+    )(userService.forgotPasswordHandler)).Methods("POST")
+    
+    r.Handle("/auth/reset-password", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.StripIdentityHeaders,
+        middleware.RateLimit(10),
+        middleware.LoggingMiddleware,
+        csrf.Protect,
+    )(userService.resetPasswordHandler)).Methods("POST")
     
     // Protected endpoints
     authMiddleware := middleware.NewAuthMiddleware(cfg.JWT.Secret)
-    r.Handle("/users", authMiddleware(userService.getUsersHandler)).Methods("GET")
+    
+    // Only admins create accounts
+    r.Handle("/auth/register", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.LoggingMiddleware,
+        authMiddleware,
+        middleware.RequireRole("admin"),
+    )(userService.registerHandler)).Methods("POST")
+    
+    r.Handle("/auth/2fa/enroll", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.LoggingMiddleware,
+        authMiddleware,
+    )(userService.enrollTwoFactorHandler)).Methods("POST")
+    r.Handle("/auth/2fa/verify", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.LoggingMiddleware,
+        authMiddleware,
+        middleware.RateLimit(5),
+    )(userService.verifyTwoFactorHandler)).Methods("POST")
+    
+    r.Handle("/users", middleware.Chain(
+        authMiddleware,
+        middleware.RequireRole("manager"),
+    )(userService.getUsersHandler)).Methods("GET")
+    r.Handle("/users/{id}", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.LoggingMiddleware,
+        authMiddleware,
+        middleware.RequireRole("admin"),
+    )(userService.updateUserHandler)).Methods("PUT")
     r.Handle("/profile", authMiddleware(userService.getProfileHandler)).Methods("GET")
     r.Handle("/profile", authMiddleware(userService.updateProfileHandler)).Methods("PUT")
+    
+    // Few attempts per user so a stolen access token cannot brute force the current password
+    r.Handle("/profile/password", middleware.Chain(
+        middleware.SecurityHeaders,
+        middleware.LoggingMiddleware,
+        authMiddleware,
+        middleware.RateLimit(5),
+    )(userService.changePasswordHandler)).Methods("PUT")
 
     server.SetupServer(r, cfg)
 }
@@ -104,17 +245,32 @@ func (s *UserService) loginHandler(w http.ResponseWriter, r *http.Request) {
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
+    email := strings.ToLower(strings.TrimSpace(req.Email))
+    ip := middleware.ClientIP(r)
+    
+    wait, code, err := s.loginRetryAfter(ctx, email, ip)
+    if err != nil {
+        s.HandleDBError(w, err, "Database error during login")
+        return
+    }
+    if wait > 0 {
+        s.respondLoginThrottled(w, wait, code)
+        return
+    }
+    
     var user User
     var passwordHash string
+    var totpEnabled bool
     
-    query := `SELECT id, email, password_hash, name, role, company_id, is_active, created_at
+    query := `SELECT id, email, password_hash, name, role, company_id, is_active, created_at, totp_enabled
               FROM users WHERE LOWER(email) = LOWER($1) AND is_active = true`
     
-    err := s.DB.QueryRowContext(ctx, query, req.Email).Scan(
+    err = s.DB.QueryRowContext(ctx, query, email).Scan(
         &user.ID, &user.Email, &passwordHash, &user.Name, 
-        &user.Role, &user.CompanyID, &user.IsActive, &user.CreatedAt)
+        &user.Role, &user.CompanyID, &user.IsActive, &user.CreatedAt, &totpEnabled)
     
     if err == sql.ErrNoRows {
+        s.recordLoginAttempt(ctx, email, ip, false)
         s.RespondWithError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid email or password")
         return
     }
@@ -124,28 +280,60 @@ func (s *UserService) loginHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+        s.recordLoginAttempt(ctx, email, ip, false)
         s.RespondWithError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid email or password")
         return
     }
+    
+    // The attempt only counts as successful once the second factor is checked too
+    if totpEnabled {
+        challenge, err := s.startTwoFactorChallenge(ctx, user.ID)
+        if err != nil {
+            s.HandleDBError(w, err, "Error starting two-factor challenge")
+            return
+        }
+        s.RespondWithJSON(w, http.StatusOK, challenge)
+        return
+    }
+    
+    s.recordLoginAttempt(ctx, email, ip, true)
+    s.completeLogin(ctx, w, user)
+}
 
+// completeLogin issues the access and refresh tokens for an authenticated user
+func (s *UserService) completeLogin(ctx context.Context, w http.ResponseWriter, user User) {
     token, err := s.generateJWT(user)
     if err != nil {
         s.RespondWithError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Error generating token")
         return
     }
 
+    var refreshToken string
+    err = s.WithTransaction(ctx, func(tx *sql.Tx) error {
+        refreshToken, _, err = s.issueRefreshToken(ctx, tx, user.ID, "")
+        return err
+    })
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Error generating refresh token")
+        return
+    }
+
     // Update last login
     _, err = s.DB.ExecContext(ctx, "UPDATE users SET last_login = CURRENT_TIMESTAMP WHERE id = $1", user.ID)
     if err != nil {
         // Log but don't fail
     }
 
-    response := LoginResponse{
-        Token: token,
-        User:  user,
-    }
+    s.RespondWithJSON(w, http.StatusOK, s.loginResponse(token, refreshToken, user))
+}
 
-    s.RespondWithJSON(w, http.StatusOK, response)
+func (s *UserService) loginResponse(token, refreshToken string, user User) LoginResponse {
+    return LoginResponse{
+        Token:        token,
+        RefreshToken: refreshToken,
+        ExpiresIn:    int(s.config.JWT.Expiration.Seconds()),
+        User:         user,
+    }
 }
 
 func (s *UserService) registerHandler(w http.ResponseWriter, r *http.Request) {
@@ -171,18 +359,19 @@ func (s *UserService) registerHandler(w http.ResponseWriter, r *http.Request) {
     validator.MinLength("name", req.Name, 2)
     validator.Required("role", req.Role)
     
-    validRoles := []string{"admin", "manager", "accountant", "user"}
     validator.OneOf("role", req.Role, validRoles)
     
-    if req.CompanyID == 0 {
-        validator.AddError("company_id", "Company ID is required")
-    }
-    
     if !validator.IsValid() {
         s.RespondValidationError(w, validator.Errors())
         return
     }
 
+    // Admins only create users in their own company; company_id may be left out
+    if req.CompanyID != 0 && !s.ValidateCompanyAccess(w, r, req.CompanyID) {
+        return
+    }
+    req.CompanyID = s.GetCompanyIDFromRequest(r)
+
     err := s.WithTransaction(r.Context(), func(tx *sql.Tx) error {
         // Check if email exists
         var exists bool
@@ -196,7 +385,7 @@ func (s *UserService) registerHandler(w http.ResponseWriter, r *http.Request) {
         }
 
         // Hash password
-        hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), 12)
+        hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), s.config.Security.BCryptCost)
         if err != nil {
             return err
         }
@@ -266,6 +455,109 @@ func (s *UserService) getUsersHandler(w http.ResponseWriter, r *http.Request) {
     s.RespondWithJSON(w, http.StatusOK, users)
 }
 
+// updateUserHandler lets an admin change the role and active status of a user in their own
+// company. A change that would leave the company without an active admin is refused, and a
+// deactivated user's refresh tokens are revoked so their sessions end.
+func (s *UserService) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid user ID")
+        return
+    }
+
+    var req struct {
+        Role     *string `json:"role"`
+        IsActive *bool   `json:"is_active"`
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    if req.Role == nil && req.IsActive == nil {
+        validator.AddError("role", "At least one of role or is_active is required")
+    }
+    if req.Role != nil {
+        validator.OneOf("role", *req.Role, validRoles)
+    }
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    var user User
+    responded := false
+    err = s.WithTransaction(ctx, func(tx *sql.Tx) error {
+        // Lock the company's admins so two concurrent demotions cannot both pass the check below
+        var activeAdmins int
+        err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM (SELECT id FROM users
+                                        WHERE company_id = $1 AND role = 'admin' AND is_active = true
+                                        FOR UPDATE) admins`, companyID).Scan(&activeAdmins)
+        if err != nil {
+            return err
+        }
+
+        var lastLogin sql.NullTime
+        err = tx.QueryRowContext(ctx, `SELECT id, email, name, role, company_id, is_active, last_login, created_at
+                                       FROM users WHERE id = $1 AND company_id = $2 FOR UPDATE`, id, companyID).Scan(
+            &user.ID, &user.Email, &user.Name, &user.Role,
+            &user.CompanyID, &user.IsActive, &lastLogin, &user.CreatedAt)
+        if err == sql.ErrNoRows {
+            s.RespondWithError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+            responded = true
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if lastLogin.Valid {
+            user.LastLogin = &lastLogin.Time
+        }
+
+        wasActiveAdmin := user.Role == "admin" && user.IsActive
+        if req.Role != nil {
+            user.Role = *req.Role
+        }
+        if req.IsActive != nil {
+            user.IsActive = *req.IsActive
+        }
+        if wasActiveAdmin && !(user.Role == "admin" && user.IsActive) && activeAdmins <= 1 {
+            s.RespondWithError(w, http.StatusConflict, "LAST_ADMIN", "The company must keep at least one active admin")
+            responded = true
+            return nil
+        }
+
+        _, err = tx.ExecContext(ctx, "UPDATE users SET role = $1, is_active = $2 WHERE id = $3",
+            user.Role, user.IsActive, user.ID)
+        if err != nil {
+            return err
+        }
+        if !user.IsActive {
+            _, err = tx.ExecContext(ctx,
+                "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL",
+                user.ID)
+        }
+        return err
+    })
+    if responded {
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "UPDATE_ERROR", "User update failed")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, user)
+}
+
 func (s *UserService) getProfileHandler(w http.ResponseWriter, r *http.Request) {
     userID := s.GetUserIDFromRequest(r)
     
@@ -354,6 +646,78 @@ func (s *UserService) updateProfileHandler(w http.ResponseWriter, r *http.Reques
     }
 }
 
+// changePasswordHandler replaces the caller's password and revokes every refresh token so
+// other sessions must log in again. Access tokens already issued stay valid until they expire.
+func (s *UserService) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+    userID := s.GetUserIDFromRequest(r)
+    
+    var req struct {
+        CurrentPassword string `json:"current_password"`
+        NewPassword     string `json:"new_password"`
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    validator.Required("current_password", req.CurrentPassword)
+    validator.Required("new_password", req.NewPassword)
+    validator.StrongPassword("new_password", req.NewPassword)
+    if req.NewPassword != "" && req.NewPassword == req.CurrentPassword {
+        validator.AddError("new_password", "New password must be different from the current password")
+    }
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+    
+    var passwordHash string
+    err := s.DB.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = $1 AND is_active = true",
+        userID).Scan(&passwordHash)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching user")
+        return
+    }
+
+    if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)); err != nil {
+        s.RespondWithError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Current password is incorrect")
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), s.config.Security.BCryptCost)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "HASH_ERROR", "Error hashing password")
+        return
+    }
+
+    err = s.WithTransaction(ctx, func(tx *sql.Tx) error {
+        _, err := tx.ExecContext(ctx, "UPDATE users SET password_hash = $1 WHERE id = $2", string(hashedPassword), userID)
+        if err != nil {
+            return err
+        }
+        _, err = tx.ExecContext(ctx,
+            "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL",
+            userID)
+        return err
+    })
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "UPDATE_ERROR", "Password change failed")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Password changed, other sessions have been logged out"})
+}
+
 func (s *UserService) generateJWT(user User) (string, error) {
     expirationTime := time.Now().Add(s.config.JWT.Expiration)
     claims := &middleware.Claims{
@@ -369,4 +733,19 @@ func (s *UserService) generateJWT(user User) (string, error) {
 
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
     return token.SignedString([]byte(s.config.JWT.Secret))
+}
+
+func envInt(key, defaultValue string) int {
+    value, err := strconv.Atoi(getEnv(key, defaultValue))
+    if err != nil || value <= 0 {
+        log.Fatalf("Invalid %s: %q", key, os.Getenv(key))
+    }
+    return value
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
 }
\ No newline at end of file
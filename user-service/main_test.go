@@ -0,0 +1,25 @@
+package main
+
+import (
+    "context"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+func TestRegisterRejectsAnotherCompany(t *testing.T) {
+    s := &UserService{BaseService: &service.BaseService{}}
+
+    body := `{"email":"takeover@example.com","password":"password123","name":"Takeover","role":"admin","company_id":2}`
+    req := httptest.NewRequest("POST", "/auth/register", strings.NewReader(body))
+    ctx := context.WithValue(req.Context(), "company_id", 1)
+    ctx = context.WithValue(ctx, "role", "admin")
+    rec := httptest.NewRecorder()
+    s.registerHandler(rec, req.WithContext(ctx))
+
+    if rec.Code != 403 || !strings.Contains(rec.Body.String(), "COMPANY_ACCESS_DENIED") {
+        t.Errorf("status = %d, body = %s; want 403 COMPANY_ACCESS_DENIED", rec.Code, rec.Body.String())
+    }
+}
@@ -0,0 +1,27 @@
+-- user-service/migrations/0005_two_factor_auth.sql
+-- TOTP two-factor authentication. Existing users start with it disabled.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT; -- AES-GCM encrypted with TOTP_ENCRYPTION_KEY
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- Two-factor backup codes are stored hashed and can be used once
+CREATE TABLE IF NOT EXISTS two_factor_backup_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Pending second steps of logins for users with two-factor authentication
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_backup_codes_user ON two_factor_backup_codes(user_id, code_hash);
@@ -0,0 +1,178 @@
+// user-service/password_reset.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "log"
+    "net/http"
+    "net/url"
+    "time"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// forgotPasswordHandler emails a single-use reset link. The response is the same whether or not
+// the address belongs to an account, and the email is sent in the background so response time
+// does not reveal it either.
+func (s *UserService) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Email string `json:"email"`
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    validator.Required("email", req.Email)
+    validator.Email("email", req.Email)
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    go s.sendPasswordReset(req.Email)
+
+    s.RespondWithJSON(w, http.StatusOK, map[string]string{
+        "message": "If the email is registered, a password reset link has been sent",
+    })
+}
+
+func (s *UserService) sendPasswordReset(email string) {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    var userID int
+    var name string
+    err := s.DB.QueryRowContext(ctx,
+        "SELECT id, name FROM users WHERE LOWER(email) = LOWER($1) AND is_active = true",
+        email).Scan(&userID, &name)
+    if err == sql.ErrNoRows {
+        return
+    }
+    if err != nil {
+        log.Printf("Password reset lookup failed: %v", err)
+        return
+    }
+
+    token, hash, err := newOpaqueToken()
+    if err != nil {
+        log.Printf("Password reset token generation failed: %v", err)
+        return
+    }
+
+    // Only the newest link works, so earlier emails cannot be used after a second request
+    err = s.WithTransaction(ctx, func(tx *sql.Tx) error {
+        _, err := tx.ExecContext(ctx,
+            "UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL",
+            userID)
+        if err != nil {
+            return err
+        }
+        _, err = tx.ExecContext(ctx,
+            "INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+            userID, hash, time.Now().Add(s.resetTokenTTL))
+        return err
+    })
+    if err != nil {
+        log.Printf("Password reset token storage failed for user %d: %v", userID, err)
+        return
+    }
+
+    message := map[string]interface{}{
+        "to":       email,
+        "subject":  "Reset your password",
+        "template": "password_reset",
+        "data": map[string]interface{}{
+            "Name":      name,
+            "ResetURL":  s.resetURL + "?token=" + url.QueryEscape(token),
+            "ExpiresIn": s.resetTokenTTL.String(),
+        },
+    }
+    if err := s.notifyClient.Do(ctx, http.MethodPost, "/send-email", nil, message, nil); err != nil {
+        log.Printf("Password reset email failed for user %d: %v", userID, err)
+    }
+}
+
+// resetPasswordHandler sets a new password from a reset token, consuming the token and
+// revoking the user's refresh tokens.
+func (s *UserService) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Token       string `json:"token"`
+        NewPassword string `json:"new_password"`
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    validator.Required("token", req.Token)
+    validator.Required("new_password", req.NewPassword)
+    validator.StrongPassword("new_password", req.NewPassword)
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), s.config.Security.BCryptCost)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "HASH_ERROR", "Error hashing password")
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    var tokenID, userID int
+    err = tx.QueryRowContext(ctx, `SELECT t.id, t.user_id FROM password_reset_tokens t
+                                   JOIN users u ON u.id = t.user_id
+                                   WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > CURRENT_TIMESTAMP
+                                     AND u.is_active = true
+                                   FOR UPDATE OF t`, hashToken(req.Token)).Scan(&tokenID, &userID)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_RESET_TOKEN", "Reset link is invalid or has expired")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error verifying reset token")
+        return
+    }
+
+    statements := []struct {
+        query string
+        args  []interface{}
+    }{
+        {"UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1", []interface{}{tokenID}},
+        {"UPDATE users SET password_hash = $1 WHERE id = $2", []interface{}{string(hashedPassword), userID}},
+        {"UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", []interface{}{userID}},
+    }
+    for _, statement := range statements {
+        if _, err := tx.ExecContext(ctx, statement.query, statement.args...); err != nil {
+            s.HandleDBError(w, err, "Error resetting password")
+            return
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset, please log in"})
+}
\ No newline at end of file
@@ -0,0 +1,198 @@
+// user-service/tokens.go
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "time"
+)
+
+var (
+    errInvalidRefreshToken = errors.New("invalid refresh token")
+    errRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+type RefreshRequest struct {
+    RefreshToken string `json:"refresh_token"`
+}
+
+// newOpaqueToken returns a random URL-safe token and the SHA-256 hash that is stored in its place
+func newOpaqueToken() (string, string, error) {
+    buf := make([]byte, 32)
+    if _, err := rand.Read(buf); err != nil {
+        return "", "", err
+    }
+    token := base64.RawURLEncoding.EncodeToString(buf)
+    return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// issueRefreshToken stores a new refresh token in familyID, starting a new family when it is empty
+func (s *UserService) issueRefreshToken(ctx context.Context, tx *sql.Tx, userID int, familyID string) (string, int, error) {
+    token, hash, err := newOpaqueToken()
+    if err != nil {
+        return "", 0, err
+    }
+    if familyID == "" {
+        _, familyID, err = newOpaqueToken()
+        if err != nil {
+            return "", 0, err
+        }
+    }
+
+    var id int
+    err = tx.QueryRowContext(ctx, `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at)
+                                   VALUES ($1, $2, $3, $4) RETURNING id`,
+        userID, hash, familyID, time.Now().Add(s.config.JWT.RefreshExpiration)).Scan(&id)
+    if err != nil {
+        return "", 0, err
+    }
+    return token, id, nil
+}
+
+// rotateRefreshToken exchanges a live refresh token for a new one in the same family. Presenting
+// a token that was already rotated or revoked revokes the whole family, since either the client
+// or an attacker is holding a stolen copy.
+func (s *UserService) rotateRefreshToken(ctx context.Context, tx *sql.Tx, token string) (User, string, error) {
+    var user User
+    var tokenID int
+    var familyID string
+    var expiresAt time.Time
+    var revokedAt sql.NullTime
+
+    err := tx.QueryRowContext(ctx, `SELECT t.id, t.family_id, t.expires_at, t.revoked_at,
+                                           u.id, u.email, u.name, u.role, u.company_id, u.is_active, u.created_at
+                                    FROM refresh_tokens t JOIN users u ON u.id = t.user_id
+                                    WHERE t.token_hash = $1 FOR UPDATE OF t`, hashToken(token)).Scan(
+        &tokenID, &familyID, &expiresAt, &revokedAt,
+        &user.ID, &user.Email, &user.Name, &user.Role, &user.CompanyID, &user.IsActive, &user.CreatedAt)
+    if err == sql.ErrNoRows {
+        return user, "", errInvalidRefreshToken
+    }
+    if err != nil {
+        return user, "", err
+    }
+
+    if revokedAt.Valid {
+        if err := revokeTokenFamily(ctx, tx, familyID); err != nil {
+            return user, "", err
+        }
+        log.Printf("Refresh token reuse detected for user %d, revoked token family", user.ID)
+        return user, "", errRefreshTokenReused
+    }
+    if time.Now().After(expiresAt) || !user.IsActive {
+        return user, "", errInvalidRefreshToken
+    }
+
+    newToken, newID, err := s.issueRefreshToken(ctx, tx, user.ID, familyID)
+    if err != nil {
+        return user, "", err
+    }
+    _, err = tx.ExecContext(ctx,
+        "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $1 WHERE id = $2",
+        newID, tokenID)
+    if err != nil {
+        return user, "", err
+    }
+    return user, newToken, nil
+}
+
+func revokeTokenFamily(ctx context.Context, tx *sql.Tx, familyID string) error {
+    _, err := tx.ExecContext(ctx,
+        "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL",
+        familyID)
+    return err
+}
+
+func (s *UserService) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+    var req RefreshRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "refresh_token is required")
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    user, refreshToken, err := s.rotateRefreshToken(ctx, tx, req.RefreshToken)
+    switch {
+    case err == errRefreshTokenReused:
+        // Commit the family revocation before rejecting
+        if err := tx.Commit(); err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+            return
+        }
+        s.RespondWithError(w, http.StatusUnauthorized, "REFRESH_TOKEN_REUSED", "Refresh token has already been used")
+        return
+    case err == errInvalidRefreshToken:
+        s.RespondWithError(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid or expired refresh token")
+        return
+    case err != nil:
+        s.HandleDBError(w, err, "Error refreshing token")
+        return
+    }
+
+    token, err := s.generateJWT(user)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "TOKEN_ERROR", "Error generating token")
+        return
+    }
+
+    if err := tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, s.loginResponse(token, refreshToken, user))
+}
+
+// logoutHandler revokes the presented refresh token along with every token rotated from the same login
+func (s *UserService) logoutHandler(w http.ResponseWriter, r *http.Request) {
+    var req RefreshRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "refresh_token is required")
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    err := s.WithTransaction(ctx, func(tx *sql.Tx) error {
+        var familyID string
+        err := tx.QueryRowContext(ctx, "SELECT family_id FROM refresh_tokens WHERE token_hash = $1",
+            hashToken(req.RefreshToken)).Scan(&familyID)
+        if err == sql.ErrNoRows {
+            // Logging out with an unknown token is not an error worth reporting
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        return revokeTokenFamily(ctx, tx, familyID)
+    })
+    if err != nil {
+        s.HandleDBError(w, err, "Error logging out")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
\ No newline at end of file
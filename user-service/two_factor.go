@@ -0,0 +1,351 @@
+// user-service/two_factor.go
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/massehanto/accounting-system-go/shared/middleware"
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+const (
+    twoFactorChallengeTTL = 5 * time.Minute
+    // A challenge is burned after this many wrong codes and the user must log in again
+    twoFactorMaxAttempts = 5
+    backupCodeCount      = 10
+)
+
+type TwoFactorChallenge struct {
+    Status         string `json:"status"`
+    ChallengeToken string `json:"challenge_token"`
+    ExpiresIn      int    `json:"expires_in"`
+}
+
+// enrollTwoFactorHandler generates a new TOTP secret for the caller. It only takes effect once
+// a code from it is confirmed through verifyTwoFactorHandler, so enrolling again before then
+// simply replaces the pending secret.
+func (s *UserService) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+    userID := s.GetUserIDFromRequest(r)
+
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    var email string
+    var enabled bool
+    err := s.DB.QueryRowContext(ctx, "SELECT email, totp_enabled FROM users WHERE id = $1 AND is_active = true",
+        userID).Scan(&email, &enabled)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching user")
+        return
+    }
+    if enabled {
+        s.RespondWithError(w, http.StatusConflict, "2FA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+        return
+    }
+
+    secret, err := newTOTPSecret()
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "2FA_ERROR", "Error generating secret")
+        return
+    }
+    sealed, err := s.totpBox.Seal(secret)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "2FA_ERROR", "Error encrypting secret")
+        return
+    }
+
+    _, err = s.DB.ExecContext(ctx, "UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2",
+        sealed, userID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error saving secret")
+        return
+    }
+
+    label := url.PathEscape(s.totpIssuer + ":" + email)
+    params := url.Values{}
+    params.Set("secret", secret)
+    params.Set("issuer", s.totpIssuer)
+    params.Set("algorithm", "SHA1")
+    params.Set("digits", "6")
+    params.Set("period", "30")
+
+    s.RespondWithJSON(w, http.StatusOK, map[string]string{
+        "secret":      secret,
+        "otpauth_uri": "otpauth://totp/" + label + "?" + params.Encode(),
+    })
+}
+
+// verifyTwoFactorHandler activates the pending secret once the caller proves their app
+// produces matching codes, and returns single-use backup codes. They are shown only once.
+func (s *UserService) verifyTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+    userID := s.GetUserIDFromRequest(r)
+
+    var req struct {
+        Code string `json:"code"`
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    validator.Required("code", req.Code)
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    var sealed sql.NullString
+    var enabled bool
+    var lastStep int64
+    err = tx.QueryRowContext(ctx, `SELECT totp_secret, totp_enabled, totp_last_step FROM users
+                                   WHERE id = $1 AND is_active = true FOR UPDATE`, userID).Scan(&sealed, &enabled, &lastStep)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching user")
+        return
+    }
+    if enabled {
+        s.RespondWithError(w, http.StatusConflict, "2FA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+        return
+    }
+    if !sealed.Valid {
+        s.RespondWithError(w, http.StatusBadRequest, "2FA_NOT_ENROLLED", "Enroll in two-factor authentication first")
+        return
+    }
+
+    secret, err := s.totpBox.Open(sealed.String)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "2FA_ERROR", "Error decrypting secret")
+        return
+    }
+    step, ok := verifyTOTP(secret, strings.TrimSpace(req.Code), time.Now(), lastStep)
+    if !ok {
+        s.RespondWithError(w, http.StatusUnauthorized, "INVALID_2FA_CODE", "Invalid two-factor code")
+        return
+    }
+
+    codes, err := newBackupCodes()
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "2FA_ERROR", "Error generating backup codes")
+        return
+    }
+
+    _, err = tx.ExecContext(ctx, "UPDATE users SET totp_enabled = true, totp_last_step = $1 WHERE id = $2", step, userID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error enabling two-factor authentication")
+        return
+    }
+    _, err = tx.ExecContext(ctx, "DELETE FROM two_factor_backup_codes WHERE user_id = $1", userID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error storing backup codes")
+        return
+    }
+    for _, code := range codes {
+        _, err = tx.ExecContext(ctx, "INSERT INTO two_factor_backup_codes (user_id, code_hash) VALUES ($1, $2)",
+            userID, hashToken(normalizeBackupCode(code)))
+        if err != nil {
+            s.HandleDBError(w, err, "Error storing backup codes")
+            return
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+        "message":      "Two-factor authentication enabled",
+        "backup_codes": codes,
+    })
+}
+
+// startTwoFactorChallenge stores a short-lived challenge for a user whose password checked out
+func (s *UserService) startTwoFactorChallenge(ctx context.Context, userID int) (TwoFactorChallenge, error) {
+    token, hash, err := newOpaqueToken()
+    if err != nil {
+        return TwoFactorChallenge{}, err
+    }
+    _, err = s.DB.ExecContext(ctx,
+        "INSERT INTO two_factor_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+        userID, hash, time.Now().Add(twoFactorChallengeTTL))
+    if err != nil {
+        return TwoFactorChallenge{}, err
+    }
+    return TwoFactorChallenge{
+        Status:         "2FA_REQUIRED",
+        ChallengeToken: token,
+        ExpiresIn:      int(twoFactorChallengeTTL.Seconds()),
+    }, nil
+}
+
+// twoFactorLoginHandler completes a login challenged for a second factor, accepting either a
+// TOTP code or an unused backup code. Wrong codes count towards the account lockout.
+func (s *UserService) twoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        ChallengeToken string `json:"challenge_token"`
+        Code           string `json:"code"`
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    validator.Required("challenge_token", req.ChallengeToken)
+    validator.Required("code", req.Code)
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    var user User
+    var challengeID int
+    var sealed string
+    var lastStep int64
+    err = tx.QueryRowContext(ctx, `SELECT c.id, u.id, u.email, u.name, u.role, u.company_id, u.is_active, u.created_at,
+                                          u.totp_secret, u.totp_last_step
+                                   FROM two_factor_challenges c JOIN users u ON u.id = c.user_id
+                                   WHERE c.token_hash = $1 AND c.used_at IS NULL AND c.expires_at > CURRENT_TIMESTAMP
+                                     AND c.attempts < $2 AND u.is_active = true AND u.totp_enabled = true
+                                   FOR UPDATE`, hashToken(req.ChallengeToken), twoFactorMaxAttempts).Scan(
+        &challengeID, &user.ID, &user.Email, &user.Name, &user.Role, &user.CompanyID, &user.IsActive, &user.CreatedAt,
+        &sealed, &lastStep)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusUnauthorized, "INVALID_2FA_CHALLENGE", "Login challenge is invalid or has expired")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error verifying login challenge")
+        return
+    }
+
+    ip := middleware.ClientIP(r)
+    wait, code, err := s.loginRetryAfter(ctx, user.Email, ip)
+    if err != nil {
+        s.HandleDBError(w, err, "Database error during login")
+        return
+    }
+    if wait > 0 {
+        s.respondLoginThrottled(w, wait, code)
+        return
+    }
+
+    secret, err := s.totpBox.Open(sealed)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "2FA_ERROR", "Error decrypting secret")
+        return
+    }
+
+    submitted := strings.TrimSpace(req.Code)
+    step, ok := verifyTOTP(secret, submitted, time.Now(), lastStep)
+    if ok {
+        _, err = tx.ExecContext(ctx, "UPDATE users SET totp_last_step = $1 WHERE id = $2", step, user.ID)
+    } else {
+        ok, err = useBackupCode(ctx, tx, user.ID, submitted)
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error verifying two-factor code")
+        return
+    }
+
+    if !ok {
+        _, err = tx.ExecContext(ctx, "UPDATE two_factor_challenges SET attempts = attempts + 1 WHERE id = $1", challengeID)
+        if err == nil {
+            err = tx.Commit()
+        }
+        if err != nil {
+            s.HandleDBError(w, err, "Error recording failed attempt")
+            return
+        }
+        s.recordLoginAttempt(ctx, user.Email, ip, false)
+        s.RespondWithError(w, http.StatusUnauthorized, "INVALID_2FA_CODE", "Invalid two-factor code")
+        return
+    }
+
+    _, err = tx.ExecContext(ctx, "UPDATE two_factor_challenges SET used_at = CURRENT_TIMESTAMP WHERE id = $1", challengeID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error completing login challenge")
+        return
+    }
+    if err := tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.recordLoginAttempt(ctx, user.Email, ip, true)
+    s.completeLogin(ctx, w, user)
+}
+
+// useBackupCode consumes a matching unused backup code
+func useBackupCode(ctx context.Context, tx *sql.Tx, userID int, code string) (bool, error) {
+    result, err := tx.ExecContext(ctx, `UPDATE two_factor_backup_codes SET used_at = CURRENT_TIMESTAMP
+                                        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+        userID, hashToken(normalizeBackupCode(code)))
+    if err != nil {
+        return false, err
+    }
+    rows, err := result.RowsAffected()
+    return rows > 0, err
+}
+
+// newBackupCodes returns codes formatted as xxxxx-xxxxx for readability
+func newBackupCodes() ([]string, error) {
+    const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+    codes := make([]string, backupCodeCount)
+    buf := make([]byte, 10)
+    for i := range codes {
+        if _, err := rand.Read(buf); err != nil {
+            return nil, err
+        }
+        chars := make([]byte, len(buf))
+        for j, b := range buf {
+            chars[j] = alphabet[int(b)%len(alphabet)]
+        }
+        codes[i] = string(chars[:5]) + "-" + string(chars[5:])
+    }
+    return codes, nil
+}
+
+func normalizeBackupCode(code string) string {
+    return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
\ No newline at end of file
@@ -0,0 +1,557 @@
+// vendor-service/bills.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gorilla/mux"
+
+    "github.com/massehanto/accounting-system-go/shared/validation"
+)
+
+// VendorBill is an accounts payable invoice received from a vendor
+type VendorBill struct {
+    ID              int           `json:"id"`
+    CompanyID       int           `json:"company_id"`
+    VendorID        int           `json:"vendor_id"`
+    PurchaseOrderID *int          `json:"purchase_order_id,omitempty"`
+    BillNumber      string        `json:"bill_number"`
+    BillDate        time.Time     `json:"bill_date"`
+    DueDate         time.Time     `json:"due_date"`
+    Subtotal        float64       `json:"subtotal"`
+    TaxAmount       float64       `json:"tax_amount"`
+    TotalAmount     float64       `json:"total_amount"`
+    AmountPaid      float64       `json:"amount_paid"`
+    BalanceDue      float64       `json:"balance_due"`
+    Status          string        `json:"status"`
+    Notes           string        `json:"notes"`
+    CreatedBy       int           `json:"created_by"`
+    CreatedAt       time.Time     `json:"created_at"`
+    UpdatedAt       time.Time     `json:"updated_at"`
+    Payments        []BillPayment `json:"payments,omitempty"`
+}
+
+type BillPayment struct {
+    ID            int       `json:"id"`
+    BillID        int       `json:"bill_id"`
+    Amount        float64   `json:"amount"`
+    PaymentDate   time.Time `json:"payment_date"`
+    PaymentMethod string    `json:"payment_method"`
+    Reference     string    `json:"reference"`
+    Notes         string    `json:"notes"`
+    CreatedBy     int       `json:"created_by"`
+    CreatedAt     time.Time `json:"created_at"`
+}
+
+const vendorBillColumns = `id, company_id, vendor_id, purchase_order_id, bill_number, bill_date, due_date,
+                           subtotal, tax_amount, total_amount, amount_paid, status, COALESCE(notes, ''),
+                           COALESCE(created_by, 0), created_at, updated_at`
+
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+func scanVendorBill(row rowScanner) (*VendorBill, error) {
+    var bill VendorBill
+    var purchaseOrderID sql.NullInt64
+    err := row.Scan(&bill.ID, &bill.CompanyID, &bill.VendorID, &purchaseOrderID, &bill.BillNumber,
+        &bill.BillDate, &bill.DueDate, &bill.Subtotal, &bill.TaxAmount, &bill.TotalAmount, &bill.AmountPaid,
+        &bill.Status, &bill.Notes, &bill.CreatedBy, &bill.CreatedAt, &bill.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+    if purchaseOrderID.Valid {
+        id := int(purchaseOrderID.Int64)
+        bill.PurchaseOrderID = &id
+    }
+    bill.BalanceDue = bill.TotalAmount - bill.AmountPaid
+    return &bill, nil
+}
+
+func (s *VendorService) getVendorBillsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    params := r.URL.Query()
+
+    query := "SELECT " + vendorBillColumns + " FROM vendor_bills WHERE company_id = $1"
+    args := []interface{}{companyID}
+
+    if vendorID := params.Get("vendor_id"); vendorID != "" {
+        id, err := strconv.Atoi(vendorID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_VENDOR", "Invalid vendor ID")
+            return
+        }
+        args = append(args, id)
+        query += fmt.Sprintf(" AND vendor_id = $%d", len(args))
+    }
+    if status := params.Get("status"); status != "" {
+        args = append(args, status)
+        query += fmt.Sprintf(" AND status = $%d", len(args))
+    }
+    if params.Get("unpaid_only") == "true" {
+        query += " AND status IN ('open', 'partially_paid')"
+    }
+    query += " ORDER BY due_date, id"
+
+    rows, err := s.DB.QueryContext(ctx, query, args...)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching vendor bills")
+        return
+    }
+    defer rows.Close()
+
+    bills := []*VendorBill{}
+    for rows.Next() {
+        bill, err := scanVendorBill(rows)
+        if err != nil {
+            continue
+        }
+        bills = append(bills, bill)
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, bills)
+}
+
+func (s *VendorService) getVendorBillHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid bill ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    bill, err := scanVendorBill(s.DB.QueryRowContext(ctx,
+        "SELECT "+vendorBillColumns+" FROM vendor_bills WHERE id = $1 AND company_id = $2", id, companyID))
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Vendor bill not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching vendor bill")
+        return
+    }
+
+    rows, err := s.DB.QueryContext(ctx, `SELECT id, bill_id, amount, payment_date, payment_method,
+                                                COALESCE(reference, ''), COALESCE(notes, ''), COALESCE(created_by, 0), created_at
+                                         FROM vendor_bill_payments WHERE bill_id = $1 ORDER BY payment_date, id`, id)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching bill payments")
+        return
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var payment BillPayment
+        if err := rows.Scan(&payment.ID, &payment.BillID, &payment.Amount, &payment.PaymentDate,
+            &payment.PaymentMethod, &payment.Reference, &payment.Notes, &payment.CreatedBy,
+            &payment.CreatedAt); err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error reading bill payments")
+            return
+        }
+        bill.Payments = append(bill.Payments, payment)
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, bill)
+}
+
+func (s *VendorService) createVendorBillHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+
+    var bill VendorBill
+    if err := json.NewDecoder(r.Body).Decode(&bill); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    bill.CompanyID = companyID
+    bill.CreatedBy = s.GetUserIDFromRequest(r)
+    bill.AmountPaid = 0
+    bill.Status = "open"
+    if bill.BillDate.IsZero() {
+        bill.BillDate = time.Now()
+    }
+
+    validator := validation.New()
+    if bill.VendorID == 0 {
+        validator.AddError("vendor_id", "Vendor ID is required")
+    }
+
+    var paymentTerms int
+    if bill.VendorID != 0 {
+        err := s.DB.QueryRowContext(ctx,
+            "SELECT payment_terms FROM vendors WHERE id = $1 AND company_id = $2 AND is_active = true",
+            bill.VendorID, companyID).Scan(&paymentTerms)
+        if err == sql.ErrNoRows {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_VENDOR", "Vendor not found or inactive")
+            return
+        }
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching vendor")
+            return
+        }
+    }
+
+    if bill.PurchaseOrderID != nil {
+        var vendorID int
+        var subtotal, taxAmount float64
+        var status string
+        err := s.DB.QueryRowContext(ctx,
+            "SELECT vendor_id, subtotal, tax_amount, status FROM purchase_orders WHERE id = $1 AND company_id = $2",
+            *bill.PurchaseOrderID, companyID).Scan(&vendorID, &subtotal, &taxAmount, &status)
+        if err == sql.ErrNoRows {
+            s.RespondWithError(w, http.StatusBadRequest, "INVALID_PURCHASE_ORDER", "Purchase order not found")
+            return
+        }
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching purchase order")
+            return
+        }
+        if vendorID != bill.VendorID {
+            validator.AddError("purchase_order_id", "Purchase order belongs to a different vendor")
+        }
+        if status == "draft" || status == "pending_approval" || status == "cancelled" {
+            validator.AddError("purchase_order_id", fmt.Sprintf("Cannot bill a purchase order with status %s", status))
+        }
+        // Amounts default to the purchase order when the bill does not state them
+        if bill.Subtotal == 0 && bill.TaxAmount == 0 && bill.TotalAmount == 0 {
+            bill.Subtotal = subtotal
+            bill.TaxAmount = taxAmount
+        }
+    }
+
+    if bill.DueDate.IsZero() {
+        bill.DueDate = bill.BillDate.AddDate(0, 0, paymentTerms)
+    }
+    validateVendorBill(validator, &bill)
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    var exists bool
+    err := s.DB.QueryRowContext(ctx,
+        "SELECT EXISTS(SELECT 1 FROM vendor_bills WHERE company_id = $1 AND vendor_id = $2 AND bill_number = $3)",
+        companyID, bill.VendorID, bill.BillNumber).Scan(&exists)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error checking duplicate")
+        return
+    }
+    if exists {
+        s.RespondWithError(w, http.StatusConflict, "DUPLICATE_BILL", "This vendor bill has already been recorded")
+        return
+    }
+
+    query := `INSERT INTO vendor_bills (company_id, vendor_id, purchase_order_id, bill_number, bill_date, due_date,
+                                        subtotal, tax_amount, total_amount, amount_paid, status, notes, created_by)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+              RETURNING id, created_at, updated_at`
+
+    err = s.DB.QueryRowContext(ctx, query,
+        bill.CompanyID, bill.VendorID, bill.PurchaseOrderID, bill.BillNumber, bill.BillDate, bill.DueDate,
+        bill.Subtotal, bill.TaxAmount, bill.TotalAmount, bill.AmountPaid, bill.Status, bill.Notes,
+        bill.CreatedBy).Scan(&bill.ID, &bill.CreatedAt, &bill.UpdatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error creating vendor bill")
+        return
+    }
+
+    bill.BalanceDue = bill.TotalAmount
+    s.RespondWithJSON(w, http.StatusCreated, bill)
+}
+
+// updateVendorBillHandler corrects a bill's details; once payments exist only notes may change
+func (s *VendorService) updateVendorBillHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid bill ID")
+        return
+    }
+
+    var req VendorBill
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    bill, err := scanVendorBill(tx.QueryRowContext(ctx,
+        "SELECT "+vendorBillColumns+" FROM vendor_bills WHERE id = $1 AND company_id = $2 FOR UPDATE", id, companyID))
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Vendor bill not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching vendor bill")
+        return
+    }
+
+    if bill.Status == "cancelled" {
+        s.RespondWithError(w, http.StatusConflict, "INVALID_STATUS", "Cannot update a cancelled bill")
+        return
+    }
+
+    bill.Notes = req.Notes
+    if bill.AmountPaid == 0 {
+        bill.BillNumber = req.BillNumber
+        if !req.BillDate.IsZero() {
+            bill.BillDate = req.BillDate
+        }
+        if !req.DueDate.IsZero() {
+            bill.DueDate = req.DueDate
+        }
+        bill.Subtotal = req.Subtotal
+        bill.TaxAmount = req.TaxAmount
+        bill.TotalAmount = req.TotalAmount
+    } else if req.BillNumber != bill.BillNumber || req.Subtotal != bill.Subtotal ||
+        req.TaxAmount != bill.TaxAmount || req.TotalAmount != bill.TotalAmount {
+        s.RespondWithError(w, http.StatusConflict, "BILL_HAS_PAYMENTS", "Only notes can be changed once payments are recorded")
+        return
+    }
+
+    validator := validation.New()
+    validateVendorBill(validator, bill)
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    err = tx.QueryRowContext(ctx, `UPDATE vendor_bills
+                                   SET bill_number = $1, bill_date = $2, due_date = $3, subtotal = $4,
+                                       tax_amount = $5, total_amount = $6, notes = $7, updated_at = CURRENT_TIMESTAMP
+                                   WHERE id = $8 RETURNING updated_at`,
+        bill.BillNumber, bill.BillDate, bill.DueDate, bill.Subtotal, bill.TaxAmount, bill.TotalAmount,
+        bill.Notes, bill.ID).Scan(&bill.UpdatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating vendor bill")
+        return
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    bill.BalanceDue = bill.TotalAmount - bill.AmountPaid
+    s.RespondWithJSON(w, http.StatusOK, bill)
+}
+
+// deleteVendorBillHandler cancels a bill; bills with payments must keep their history
+func (s *VendorService) deleteVendorBillHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid bill ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    var amountPaid float64
+    err = s.DB.QueryRowContext(ctx,
+        "SELECT amount_paid FROM vendor_bills WHERE id = $1 AND company_id = $2", id, companyID).Scan(&amountPaid)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Vendor bill not found")
+        return
+    }
+    if err != nil {
+        s.HandleDBError(w, err, "Error fetching vendor bill")
+        return
+    }
+    if amountPaid > 0 {
+        s.RespondWithError(w, http.StatusConflict, "BILL_HAS_PAYMENTS", "Cannot cancel a bill with recorded payments")
+        return
+    }
+
+    _, err = s.DB.ExecContext(ctx, `UPDATE vendor_bills SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP
+                                    WHERE id = $1 AND company_id = $2 AND amount_paid = 0`, id, companyID)
+    if err != nil {
+        s.HandleDBError(w, err, "Error cancelling vendor bill")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
+}
+
+func (s *VendorService) recordBillPaymentHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid bill ID")
+        return
+    }
+
+    var payment BillPayment
+    if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    validator.PositiveNumber("amount", payment.Amount)
+    if payment.Amount != math.Round(payment.Amount) {
+        validator.AddError("amount", "Amount must be in whole Rupiah")
+    }
+    validator.Required("payment_method", payment.PaymentMethod)
+    validator.OneOf("payment_method", payment.PaymentMethod,
+        []string{"cash", "bank_transfer", "credit_card", "giro", "other"})
+    validator.MaxLength("reference", payment.Reference, 100)
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    payment.BillID = id
+    payment.CreatedBy = s.GetUserIDFromRequest(r)
+    if payment.PaymentDate.IsZero() {
+        payment.PaymentDate = time.Now()
+    }
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    var totalAmount, amountPaid float64
+    var status string
+    err = tx.QueryRowContext(ctx,
+        "SELECT total_amount, amount_paid, status FROM vendor_bills WHERE id = $1 AND company_id = $2 FOR UPDATE",
+        id, companyID).Scan(&totalAmount, &amountPaid, &status)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Vendor bill not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching vendor bill")
+        return
+    }
+
+    switch status {
+    case "cancelled":
+        s.RespondWithError(w, http.StatusConflict, "INVALID_STATUS", "Cannot record payment on a cancelled bill")
+        return
+    case "paid":
+        s.RespondWithError(w, http.StatusConflict, "INVALID_STATUS", "Bill is already fully paid")
+        return
+    }
+
+    remaining := totalAmount - amountPaid
+    if payment.Amount > remaining {
+        s.RespondWithError(w, http.StatusBadRequest, "PAYMENT_EXCEEDS_BALANCE",
+            fmt.Sprintf("Payment exceeds the remaining balance of %.0f", remaining))
+        return
+    }
+
+    query := `INSERT INTO vendor_bill_payments (bill_id, company_id, amount, payment_date, payment_method,
+                                                reference, notes, created_by)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+              RETURNING id, created_at`
+
+    err = tx.QueryRowContext(ctx, query,
+        payment.BillID, companyID, payment.Amount, payment.PaymentDate, payment.PaymentMethod,
+        payment.Reference, payment.Notes, payment.CreatedBy).Scan(&payment.ID, &payment.CreatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error recording payment")
+        return
+    }
+
+    amountPaid += payment.Amount
+    status = "partially_paid"
+    if amountPaid >= totalAmount {
+        status = "paid"
+    }
+
+    _, err = tx.ExecContext(ctx,
+        "UPDATE vendor_bills SET amount_paid = $1, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
+        amountPaid, status, id)
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating bill balance")
+        return
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{
+        "payment":     payment,
+        "amount_paid": amountPaid,
+        "balance_due": totalAmount - amountPaid,
+        "bill_status": status,
+    })
+}
+
+// validateVendorBill checks a bill's number, dates and amounts. A zero total is filled in from
+// subtotal plus tax; a supplied total must agree with them.
+func validateVendorBill(validator *validation.Validator, bill *VendorBill) {
+    validator.Required("bill_number", bill.BillNumber)
+    validator.MaxLength("bill_number", bill.BillNumber, 100)
+
+    if bill.DueDate.Before(bill.BillDate) {
+        validator.AddError("due_date", "Due date cannot be before the bill date")
+    }
+
+    amounts := []struct {
+        field string
+        value float64
+    }{
+        {"subtotal", bill.Subtotal},
+        {"tax_amount", bill.TaxAmount},
+        {"total_amount", bill.TotalAmount},
+    }
+    for _, amount := range amounts {
+        if amount.value < 0 {
+            validator.AddError(amount.field, "Amount cannot be negative")
+        } else if amount.value != math.Round(amount.value) {
+            validator.AddError(amount.field, "Amount must be in whole Rupiah")
+        }
+    }
+
+    if bill.TotalAmount == 0 {
+        bill.TotalAmount = bill.Subtotal + bill.TaxAmount
+    } else if bill.TotalAmount != bill.Subtotal+bill.TaxAmount {
+        validator.AddError("total_amount", "Total must equal subtotal plus tax")
+    }
+    if bill.TotalAmount <= 0 {
+        validator.AddError("total_amount", "Bill total must be positive")
+    }
+    if bill.TotalAmount < bill.AmountPaid {
+        validator.AddError("total_amount", "Total cannot be less than the amount already paid")
+    }
+}
\ No newline at end of file
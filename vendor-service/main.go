@@ -5,14 +5,21 @@ import (
     "context"
     "database/sql"
     "encoding/json"
+    "fmt"
+    "log"
+    "math"
     "net/http"
+    "os"
     "strconv"
+    "sync"
     "time"
     
     "github.com/gorilla/mux"
     _ "github.com/lib/pq"
     
+    "github.com/massehanto/accounting-system-go/shared/client"
     "github.com/massehanto/accounting-system-go/shared/config"
+    "github.com/massehanto/accounting-system-go/shared/logger"
     "github.com/massehanto/accounting-system-go/shared/database"
     "github.com/massehanto/accounting-system-go/shared/middleware"
     "github.com/massehanto/accounting-system-go/shared/server"
@@ -22,6 +29,46 @@ import (
 
 type VendorService struct {
     *service.BaseService
+    defaultTaxRate  float64
+    taxRates        *rateCache
+    inventoryClient *client.Client
+    companyClient   *client.Client
+}
+
+// rateCache keeps each company's PPN rate for a short time so purchase order
+// creation does not call company-service on every request.
+type rateCache struct {
+    mu    sync.Mutex
+    ttl   time.Duration
+    rates map[int]cachedRate
+}
+
+type cachedRate struct {
+    rate    float64
+    expires time.Time
+}
+
+func newRateCache(ttl time.Duration) *rateCache {
+    return &rateCache{ttl: ttl, rates: make(map[int]cachedRate)}
+}
+
+func (c *rateCache) get(companyID int) (float64, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    
+    cached, ok := c.rates[companyID]
+    if !ok || time.Now().After(cached.expires) {
+        delete(c.rates, companyID)
+        return 0, false
+    }
+    return cached.rate, true
+}
+
+func (c *rateCache) set(companyID int, rate float64) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    
+    c.rates[companyID] = cachedRate{rate: rate, expires: time.Now().Add(c.ttl)}
 }
 
 type Vendor struct {
@@ -33,6 +80,7 @@ type Vendor struct {
     Phone        string    `json:"phone"`
     Address      string    `json:"address"`
     TaxID        string    `json:"tax_id"`
+    NIK          string    `json:"nik,omitempty"`
     PaymentTerms int       `json:"payment_terms"`
     IsActive     bool      `json:"is_active"`
     CreatedAt    time.Time `json:"created_at"`
@@ -40,41 +88,156 @@ type Vendor struct {
 }
 
 type PurchaseOrder struct {
-    ID           int       `json:"id"`
-    CompanyID    int       `json:"company_id"`
-    VendorID     int       `json:"vendor_id"`
-    PONumber     string    `json:"po_number"`
-    OrderDate    time.Time `json:"order_date"`
-    ExpectedDate time.Time `json:"expected_date"`
-    Subtotal     float64   `json:"subtotal"`
-    TaxAmount    float64   `json:"tax_amount"`
-    TotalAmount  float64   `json:"total_amount"`
-    Status       string    `json:"status"`
-    CreatedAt    time.Time `json:"created_at"`
-    UpdatedAt    time.Time `json:"updated_at"`
+    ID           int                 `json:"id"`
+    CompanyID    int                 `json:"company_id"`
+    VendorID     int                 `json:"vendor_id"`
+    PONumber     string              `json:"po_number"`
+    OrderDate    time.Time           `json:"order_date"`
+    ExpectedDate time.Time           `json:"expected_date"`
+    Subtotal     float64             `json:"subtotal"`
+    TaxRate      float64             `json:"tax_rate"`
+    TaxExempt    bool                `json:"tax_exempt"`
+    TaxAmount    float64             `json:"tax_amount"`
+    TotalAmount  float64             `json:"total_amount"`
+    Status       string              `json:"status"`
+    CreatedBy    int                 `json:"created_by"`
+    ApprovedBy   *int                `json:"approved_by,omitempty"`
+    ApprovedAt   *time.Time          `json:"approved_at,omitempty"`
+    CreatedAt    time.Time           `json:"created_at"`
+    UpdatedAt    time.Time           `json:"updated_at"`
+    Lines        []PurchaseOrderLine `json:"lines,omitempty"`
+}
+
+type PurchaseOrderLine struct {
+    ID               int     `json:"id"`
+    PurchaseOrderID  int     `json:"purchase_order_id"`
+    ProductID        int     `json:"product_id"`
+    Description      string  `json:"description"`
+    Quantity         int     `json:"quantity"`
+    QuantityReceived int     `json:"quantity_received"`
+    UnitPrice        float64 `json:"unit_price"`
+    LineTotal        float64 `json:"line_total"`
+    TaxExempt        bool    `json:"tax_exempt"`
+    TaxAmount        float64 `json:"tax_amount"`
+}
+
+type GoodsReceipt struct {
+    ID              int                `json:"id"`
+    PurchaseOrderID int                `json:"purchase_order_id"`
+    ReceiptNumber   string             `json:"receipt_number"`
+    ReceivedDate    time.Time          `json:"received_date"`
+    Notes           string             `json:"notes"`
+    ReceivedBy      int                `json:"received_by"`
+    CreatedAt       time.Time          `json:"created_at"`
+    Lines           []GoodsReceiptLine `json:"lines"`
+}
+
+type GoodsReceiptLine struct {
+    ID                  int     `json:"id"`
+    GoodsReceiptID      int     `json:"goods_receipt_id"`
+    PurchaseOrderLineID int     `json:"purchase_order_line_id"`
+    ProductID           int     `json:"product_id"`
+    Quantity            int     `json:"quantity"`
+    UnitCost            float64 `json:"unit_cost"`
+    // StockPosted is false until inventory-service has booked the line's IN movement
+    StockPosted         bool    `json:"stock_posted"`
+}
+
+// purchaseOrderTransitions lists the statuses each purchase order status may move to.
+// Approval always goes through pending_approval. ordered and confirmed are older statuses that
+// behave like sent.
+var purchaseOrderTransitions = map[string][]string{
+    "draft":              {"pending_approval", "cancelled"},
+    "pending_approval":   {"approved", "cancelled"},
+    "approved":           {"sent", "partially_received", "received", "cancelled"},
+    "sent":               {"partially_received", "received", "cancelled"},
+    "ordered":            {"partially_received", "received", "cancelled"},
+    "confirmed":          {"partially_received", "received", "cancelled"},
+    "partially_received": {"partially_received", "received"},
+}
+
+func canTransitionPurchaseOrder(from, to string) bool {
+    for _, status := range purchaseOrderTransitions[from] {
+        if status == to {
+            return true
+        }
+    }
+    return false
+}
+
+type ReceiveRequest struct {
+    ReceivedDate time.Time     `json:"received_date"`
+    Notes        string        `json:"notes"`
+    Lines        []ReceiveLine `json:"lines"`
+}
+
+type ReceiveLine struct {
+    LineID   int `json:"line_id"`
+    Quantity int `json:"quantity"`
 }
 
 func main() {
+    logger.Init("vendor-service")
+    
     cfg := config.Load()
     cfg.Database.Name = "vendor_db"
     
     db := database.InitDatabase(cfg.Database)
     defer db.Close()
+    schemaVersion := database.MustMigrate(db, migrations)
+    
+    defaultTaxRate, err := strconv.ParseFloat(getEnv("TAX_RATE_PPN", "11.00"), 64)
+    if err != nil {
+        log.Fatalf("Invalid TAX_RATE_PPN: %v", err)
+    }
+    
+    rateTTL, err := time.ParseDuration(getEnv("TAX_RATE_CACHE_TTL", "5m"))
+    if err != nil {
+        log.Fatalf("Invalid TAX_RATE_CACHE_TTL: %v", err)
+    }
     
     vendorService := &VendorService{
-        BaseService: &service.BaseService{DB: db},
+        BaseService:     &service.BaseService{DB: db},
+        defaultTaxRate:  defaultTaxRate,
+        taxRates:        newRateCache(rateTTL),
+        inventoryClient: client.New(getEnv("INVENTORY_SERVICE_URL", "http://localhost:8006")),
+        companyClient:   client.New(getEnv("COMPANY_SERVICE_URL", "http://localhost:8011")),
     }
     
     r := mux.NewRouter()
     api := middleware.APIMiddleware(cfg.JWT.Secret)
+    accountant := middleware.RoleMiddleware(cfg.JWT.Secret, "accountant")
+    manager := middleware.RoleMiddleware(cfg.JWT.Secret, "manager")
     
     r.Handle("/health", middleware.HealthCheck(db, "vendor-service")).Methods("GET")
+    r.Handle("/health/ready", middleware.Readiness(middleware.ReadinessConfig{
+        ServiceName:   "vendor-service",
+        DB:            db,
+        SchemaVersion: schemaVersion,
+        Dependencies: map[string]middleware.Pinger{
+            "inventory-service": vendorService.inventoryClient,
+            "company-service":   vendorService.companyClient,
+        },
+    })).Methods("GET")
     r.Handle("/vendors", api(vendorService.getVendorsHandler)).Methods("GET")
-    r.Handle("/vendors", api(vendorService.createVendorHandler)).Methods("POST")
-    r.Handle("/vendors/{id}", api(vendorService.updateVendorHandler)).Methods("PUT")
-    r.Handle("/vendors/{id}", api(vendorService.deleteVendorHandler)).Methods("DELETE")
+    r.Handle("/vendors", accountant(vendorService.createVendorHandler)).Methods("POST")
+    r.Handle("/vendors/{id}", accountant(vendorService.updateVendorHandler)).Methods("PUT")
+    r.Handle("/vendors/{id}", manager(vendorService.deleteVendorHandler)).Methods("DELETE")
     r.Handle("/purchase-orders", api(vendorService.getPurchaseOrdersHandler)).Methods("GET")
     r.Handle("/purchase-orders", api(vendorService.createPurchaseOrderHandler)).Methods("POST")
+    r.Handle("/purchase-orders/{id}/submit", api(vendorService.submitPurchaseOrderHandler)).Methods("POST")
+    r.Handle("/purchase-orders/{id}/approve", manager(vendorService.approvePurchaseOrderHandler)).Methods("POST")
+    r.Handle("/purchase-orders/{id}/send", api(vendorService.sendPurchaseOrderHandler)).Methods("POST")
+    r.Handle("/purchase-orders/{id}/cancel", manager(vendorService.cancelPurchaseOrderHandler)).Methods("POST")
+    r.Handle("/purchase-orders/{id}/receive", api(vendorService.receivePurchaseOrderHandler)).Methods("POST")
+    r.Handle("/purchase-orders/{id}/receipts", api(vendorService.getGoodsReceiptsHandler)).Methods("GET")
+    r.Handle("/purchase-orders/{id}/receipts/{receiptId}/post-stock", api(vendorService.postReceiptStockHandler)).Methods("POST")
+    r.Handle("/vendor-bills", api(vendorService.getVendorBillsHandler)).Methods("GET")
+    r.Handle("/vendor-bills", accountant(vendorService.createVendorBillHandler)).Methods("POST")
+    r.Handle("/vendor-bills/{id}", api(vendorService.getVendorBillHandler)).Methods("GET")
+    r.Handle("/vendor-bills/{id}", accountant(vendorService.updateVendorBillHandler)).Methods("PUT")
+    r.Handle("/vendor-bills/{id}", manager(vendorService.deleteVendorBillHandler)).Methods("DELETE")
+    r.Handle("/vendor-bills/{id}/payments", accountant(vendorService.recordBillPaymentHandler)).Methods("POST")
 
     server.SetupServer(r, cfg)
 }
@@ -83,10 +246,11 @@ func (s *VendorService) getVendorsHandler(w http.ResponseWriter, r *http.Request
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     activeOnly := r.URL.Query().Get("active_only") == "true"
     
-    query := `SELECT id, company_id, vendor_code, name, email, phone, address, tax_id, payment_terms, is_active, created_at, updated_at
+    query := `SELECT id, company_id, vendor_code, name, email, phone, address, tax_id, COALESCE(nik, ''), 
+                     payment_terms, is_active, created_at, updated_at
               FROM vendors WHERE company_id = $1`
     
     args := []interface{}{companyID}
@@ -106,7 +270,7 @@ func (s *VendorService) getVendorsHandler(w http.ResponseWriter, r *http.Request
     for rows.Next() {
         var vendor Vendor
         err := rows.Scan(&vendor.ID, &vendor.CompanyID, &vendor.VendorCode, &vendor.Name,
-                        &vendor.Email, &vendor.Phone, &vendor.Address, &vendor.TaxID,
+                        &vendor.Email, &vendor.Phone, &vendor.Address, &vendor.TaxID, &vendor.NIK,
                         &vendor.PaymentTerms, &vendor.IsActive, &vendor.CreatedAt, &vendor.UpdatedAt)
         if err != nil {
             continue
@@ -131,7 +295,8 @@ func (s *VendorService) createVendorHandler(w http.ResponseWriter, r *http.Reque
     validator.Required("vendor_code", vendor.VendorCode)
     validator.Required("name", vendor.Name)
     validator.Email("email", vendor.Email)
-    validator.IndonesianTaxID("tax_id", vendor.TaxID)
+    validator.NPWP("tax_id", vendor.TaxID)
+    validator.NIK("nik", vendor.NIK)
     
     if vendor.PaymentTerms < 0 || vendor.PaymentTerms > 365 {
         validator.AddError("payment_terms", "Payment terms must be 0-365 days")
@@ -142,7 +307,7 @@ func (s *VendorService) createVendorHandler(w http.ResponseWriter, r *http.Reque
         return
     }
 
-    vendor.CompanyID, _ = strconv.Atoi(r.Header.Get("Company-ID"))
+    vendor.CompanyID = s.GetCompanyIDFromRequest(r)
     vendor.IsActive = true
 
     var exists bool
@@ -158,14 +323,14 @@ func (s *VendorService) createVendorHandler(w http.ResponseWriter, r *http.Reque
         return
     }
 
-    query := `INSERT INTO vendors (company_id, vendor_code, name, email, phone, address, tax_id, payment_terms, is_active) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+    query := `INSERT INTO vendors (company_id, vendor_code, name, email, phone, address, tax_id, nik, payment_terms, is_active) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10) 
               RETURNING id, created_at, updated_at`
     
     err = s.DB.QueryRowContext(ctx, query, 
         vendor.CompanyID, vendor.VendorCode, vendor.Name,
         vendor.Email, vendor.Phone, vendor.Address, 
-        vendor.TaxID, vendor.PaymentTerms, vendor.IsActive).Scan(&vendor.ID, &vendor.CreatedAt, &vendor.UpdatedAt)
+        vendor.TaxID, vendor.NIK, vendor.PaymentTerms, vendor.IsActive).Scan(&vendor.ID, &vendor.CreatedAt, &vendor.UpdatedAt)
     if err != nil {
         s.HandleDBError(w, err, "Error creating vendor")
         return
@@ -194,7 +359,8 @@ func (s *VendorService) updateVendorHandler(w http.ResponseWriter, r *http.Reque
     validator := validation.New()
     validator.Required("name", vendor.Name)
     validator.Email("email", vendor.Email)
-    validator.IndonesianTaxID("tax_id", vendor.TaxID)
+    validator.NPWP("tax_id", vendor.TaxID)
+    validator.NIK("nik", vendor.NIK)
     
     if vendor.PaymentTerms < 0 || vendor.PaymentTerms > 365 {
         validator.AddError("payment_terms", "Payment terms must be 0-365 days")
@@ -205,17 +371,17 @@ func (s *VendorService) updateVendorHandler(w http.ResponseWriter, r *http.Reque
         return
     }
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
     query := `UPDATE vendors 
-              SET name = $1, email = $2, phone = $3, address = $4, tax_id = $5, 
+              SET name = $1, email = $2, phone = $3, address = $4, tax_id = $5, nik = NULLIF($10, ''),
                   payment_terms = $6, is_active = $7, updated_at = CURRENT_TIMESTAMP 
               WHERE id = $8 AND company_id = $9 
               RETURNING updated_at`
     
     err = s.DB.QueryRowContext(ctx, query, vendor.Name, vendor.Email, vendor.Phone,
                               vendor.Address, vendor.TaxID, vendor.PaymentTerms, vendor.IsActive,
-                              id, companyID).Scan(&vendor.UpdatedAt)
+                              id, companyID, vendor.NIK).Scan(&vendor.UpdatedAt)
     if err == sql.ErrNoRows {
         s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Vendor not found")
         return
@@ -241,7 +407,7 @@ func (s *VendorService) deleteVendorHandler(w http.ResponseWriter, r *http.Reque
         return
     }
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
     query := `UPDATE vendors SET is_active = false, updated_at = CURRENT_TIMESTAMP 
               WHERE id = $1 AND company_id = $2`
@@ -265,10 +431,11 @@ func (s *VendorService) getPurchaseOrdersHandler(w http.ResponseWriter, r *http.
     ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
     defer cancel()
     
-    companyID, _ := strconv.Atoi(r.Header.Get("Company-ID"))
+    companyID := s.GetCompanyIDFromRequest(r)
     
     query := `SELECT id, company_id, vendor_id, po_number, order_date, expected_date,
-                     subtotal, tax_amount, total_amount, status, created_at, updated_at
+                     subtotal, tax_rate, tax_exempt, tax_amount, total_amount, status, COALESCE(created_by, 0), 
+                     approved_by, approved_at, created_at, updated_at
               FROM purchase_orders WHERE company_id = $1 ORDER BY created_at DESC`
     
     rows, err := s.DB.QueryContext(ctx, query, companyID)
@@ -282,8 +449,10 @@ func (s *VendorService) getPurchaseOrdersHandler(w http.ResponseWriter, r *http.
     for rows.Next() {
         var order PurchaseOrder
         err := rows.Scan(&order.ID, &order.CompanyID, &order.VendorID, &order.PONumber,
-                        &order.OrderDate, &order.ExpectedDate, &order.Subtotal, &order.TaxAmount,
-                        &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt)
+                        &order.OrderDate, &order.ExpectedDate, &order.Subtotal, &order.TaxRate,
+                        &order.TaxExempt, &order.TaxAmount, &order.TotalAmount, &order.Status,
+                        &order.CreatedBy, &order.ApprovedBy,
+                        &order.ApprovedAt, &order.CreatedAt, &order.UpdatedAt)
         if err != nil {
             continue
         }
@@ -308,6 +477,25 @@ func (s *VendorService) createPurchaseOrderHandler(w http.ResponseWriter, r *htt
     if order.VendorID == 0 {
         validator.AddError("vendor_id", "Vendor ID is required")
     }
+
+    // When lines are given they drive the subtotal, otherwise it is taken as supplied
+    if len(order.Lines) > 0 {
+        order.Subtotal = 0
+        for i, line := range order.Lines {
+            if line.ProductID == 0 {
+                validator.AddError(fmt.Sprintf("lines[%d].product_id", i), "Product ID is required")
+            }
+            if line.Quantity <= 0 {
+                validator.AddError(fmt.Sprintf("lines[%d].quantity", i), "Quantity must be positive")
+            }
+            if line.UnitPrice < 0 {
+                validator.AddError(fmt.Sprintf("lines[%d].unit_price", i), "Unit price cannot be negative")
+            }
+            order.Lines[i].QuantityReceived = 0
+            order.Lines[i].LineTotal = float64(line.Quantity) * line.UnitPrice
+            order.Subtotal += order.Lines[i].LineTotal
+        }
+    }
     validator.PositiveNumber("subtotal", order.Subtotal)
 
     if !validator.IsValid() {
@@ -315,28 +503,714 @@ func (s *VendorService) createPurchaseOrderHandler(w http.ResponseWriter, r *htt
         return
     }
 
-    order.CompanyID, _ = strconv.Atoi(r.Header.Get("Company-ID"))
+    order.CompanyID = s.GetCompanyIDFromRequest(r)
+    order.CreatedBy = s.GetUserIDFromRequest(r)
+    order.ApprovedBy = nil
+    order.ApprovedAt = nil
     order.Status = "draft"
-    order.TaxAmount = order.Subtotal * 0.11 // Indonesian PPN
+
+    order.TaxRate = 0
+    if !order.TaxExempt {
+        order.TaxRate = s.companyPPNRate(ctx, r, order.CompanyID)
+    }
+    order.TaxAmount = purchaseOrderTax(&order)
     order.TotalAmount = order.Subtotal + order.TaxAmount
 
     if order.OrderDate.IsZero() {
         order.OrderDate = time.Now()
     }
 
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
     query := `INSERT INTO purchase_orders (company_id, vendor_id, po_number, order_date, expected_date,
-                                          subtotal, tax_amount, total_amount, status) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+                                          subtotal, tax_rate, tax_exempt, tax_amount, total_amount, 
+                                          status, created_by) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) 
               RETURNING id, created_at, updated_at`
     
-    err := s.DB.QueryRowContext(ctx, query, 
+    err = tx.QueryRowContext(ctx, query, 
         order.CompanyID, order.VendorID, order.PONumber, order.OrderDate, order.ExpectedDate,
-        order.Subtotal, order.TaxAmount, order.TotalAmount, order.Status).Scan(
+        order.Subtotal, order.TaxRate, order.TaxExempt, order.TaxAmount, order.TotalAmount,
+        order.Status, order.CreatedBy).Scan(
         &order.ID, &order.CreatedAt, &order.UpdatedAt)
     if err != nil {
         s.HandleDBError(w, err, "Error creating purchase order")
         return
     }
 
+    for i := range order.Lines {
+        order.Lines[i].PurchaseOrderID = order.ID
+        lineQuery := `INSERT INTO purchase_order_lines (purchase_order_id, product_id, description, 
+                                                        quantity, unit_price, line_total, tax_exempt, tax_amount) 
+                      VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+        err = tx.QueryRowContext(ctx, lineQuery,
+            order.Lines[i].PurchaseOrderID, order.Lines[i].ProductID, order.Lines[i].Description,
+            order.Lines[i].Quantity, order.Lines[i].UnitPrice, order.Lines[i].LineTotal,
+            order.Lines[i].TaxExempt, order.Lines[i].TaxAmount).Scan(&order.Lines[i].ID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error creating purchase order lines")
+            return
+        }
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
     s.RespondWithJSON(w, http.StatusCreated, order)
+}
+
+func (s *VendorService) receivePurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+
+    vars := mux.Vars(r)
+    id, err := strconv.Atoi(vars["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid purchase order ID")
+        return
+    }
+    include := r.URL.Query().Get("include")
+    if include != "" && include != "receipt" {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_PARAMETER", "include supports only receipt")
+        return
+    }
+
+    var req ReceiveRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+        return
+    }
+
+    validator := validation.New()
+    if len(req.Lines) == 0 {
+        validator.AddError("lines", "At least one received line is required")
+    }
+
+    // Merge repeated line IDs so the over-receipt check sees the full quantity
+    received := make(map[int]int)
+    var lineOrder []int
+    for i, line := range req.Lines {
+        if line.LineID == 0 {
+            validator.AddError(fmt.Sprintf("lines[%d].line_id", i), "Line ID is required")
+        }
+        if line.Quantity <= 0 {
+            validator.AddError(fmt.Sprintf("lines[%d].quantity", i), "Received quantity must be positive")
+        }
+        if _, seen := received[line.LineID]; !seen {
+            lineOrder = append(lineOrder, line.LineID)
+        }
+        received[line.LineID] += line.Quantity
+    }
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    userID := s.GetUserIDFromRequest(r)
+    if req.ReceivedDate.IsZero() {
+        req.ReceivedDate = time.Now()
+    }
+    // received_date is a DATE, so drop the time of day now to post the same date that is stored
+    year, month, day := req.ReceivedDate.Date()
+    req.ReceivedDate = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    order, err := lockPurchaseOrder(ctx, tx, id, companyID)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Purchase order not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching purchase order")
+        return
+    }
+
+    if !canTransitionPurchaseOrder(order.Status, "partially_received") {
+        s.RespondWithError(w, http.StatusConflict, "INVALID_TRANSITION",
+            fmt.Sprintf("Cannot receive goods on a purchase order with status %s", order.Status))
+        return
+    }
+
+    var receivedLines []PurchaseOrderLine
+    for _, lineID := range lineOrder {
+        var line PurchaseOrderLine
+        err = tx.QueryRowContext(ctx, `SELECT id, purchase_order_id, product_id, description, quantity, 
+                                              quantity_received, unit_price, line_total, tax_exempt, tax_amount
+                                       FROM purchase_order_lines WHERE id = $1 AND purchase_order_id = $2 FOR UPDATE`,
+            lineID, order.ID).Scan(&line.ID, &line.PurchaseOrderID, &line.ProductID, &line.Description,
+            &line.Quantity, &line.QuantityReceived, &line.UnitPrice, &line.LineTotal,
+            &line.TaxExempt, &line.TaxAmount)
+        if err == sql.ErrNoRows {
+            validator.AddError(fmt.Sprintf("line_%d", lineID), "Line does not belong to this purchase order")
+            continue
+        }
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching purchase order lines")
+            return
+        }
+
+        if line.QuantityReceived+received[lineID] > line.Quantity {
+            validator.AddError(fmt.Sprintf("line_%d", lineID),
+                fmt.Sprintf("Cannot receive %d, only %d outstanding", received[lineID], line.Quantity-line.QuantityReceived))
+            continue
+        }
+        receivedLines = append(receivedLines, line)
+    }
+
+    if !validator.IsValid() {
+        s.RespondValidationError(w, validator.Errors())
+        return
+    }
+
+    // Receipts are numbered per purchase order; the order row lock keeps the count stable
+    var receiptCount int
+    err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM goods_receipts WHERE purchase_order_id = $1",
+        order.ID).Scan(&receiptCount)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error numbering goods receipt")
+        return
+    }
+
+    receipt := GoodsReceipt{
+        PurchaseOrderID: order.ID,
+        ReceiptNumber:   fmt.Sprintf("%s-GR%02d", order.PONumber, receiptCount+1),
+        ReceivedDate:    req.ReceivedDate,
+        Notes:           req.Notes,
+        ReceivedBy:      userID,
+    }
+    err = tx.QueryRowContext(ctx, `INSERT INTO goods_receipts (company_id, purchase_order_id, receipt_number,
+                                                               received_date, notes, received_by)
+                                   VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+        companyID, receipt.PurchaseOrderID, receipt.ReceiptNumber, receipt.ReceivedDate, receipt.Notes,
+        receipt.ReceivedBy).Scan(&receipt.ID, &receipt.CreatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error recording goods receipt")
+        return
+    }
+
+    for _, line := range receivedLines {
+        _, err = tx.ExecContext(ctx,
+            "UPDATE purchase_order_lines SET quantity_received = quantity_received + $1 WHERE id = $2",
+            received[line.ID], line.ID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error updating received quantities")
+            return
+        }
+
+        receiptLine := GoodsReceiptLine{
+            GoodsReceiptID:      receipt.ID,
+            PurchaseOrderLineID: line.ID,
+            ProductID:           line.ProductID,
+            Quantity:            received[line.ID],
+            UnitCost:            line.UnitPrice,
+        }
+        err = tx.QueryRowContext(ctx, `INSERT INTO goods_receipt_lines (goods_receipt_id, purchase_order_line_id,
+                                                                        product_id, quantity, unit_cost)
+                                       VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+            receiptLine.GoodsReceiptID, receiptLine.PurchaseOrderLineID, receiptLine.ProductID,
+            receiptLine.Quantity, receiptLine.UnitCost).Scan(&receiptLine.ID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error recording goods receipt lines")
+            return
+        }
+        receipt.Lines = append(receipt.Lines, receiptLine)
+    }
+
+    var fullyReceived bool
+    err = tx.QueryRowContext(ctx,
+        "SELECT COALESCE(BOOL_AND(quantity_received >= quantity), false) FROM purchase_order_lines WHERE purchase_order_id = $1",
+        order.ID).Scan(&fullyReceived)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error checking receipt status")
+        return
+    }
+
+    order.Status = "partially_received"
+    if fullyReceived {
+        order.Status = "received"
+    }
+
+    err = tx.QueryRowContext(ctx,
+        "UPDATE purchase_orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 RETURNING updated_at",
+        order.Status, order.ID).Scan(&order.UpdatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating purchase order status")
+        return
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    // Stock is booked only once the receipt is committed, so a failed commit books nothing
+    if err := s.postReceiptStock(ctx, client.ForwardHeaders(r), &receipt, order.PONumber); err != nil {
+        s.respondStockPending(w, order.ID, &receipt, err)
+        return
+    }
+
+    order.Lines, err = s.loadPurchaseOrderLines(ctx, order.ID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching purchase order lines")
+        return
+    }
+
+    // The response is the updated order, as it was before receipts were recorded;
+    // ?include=receipt adds the goods receipt this call created
+    if include == "" {
+        s.RespondWithJSON(w, http.StatusOK, order)
+        return
+    }
+    s.RespondWithJSON(w, http.StatusOK, struct {
+        *PurchaseOrder
+        Receipt GoodsReceipt `json:"receipt"`
+    }{order, receipt})
+}
+
+// postReceiptStock books an IN movement in inventory-service for every line of receipt whose
+// stock is not posted yet, marking each line once it is. Each movement carries an
+// Idempotency-Key derived from its receipt line, so posting a line again after a lost response
+// returns the first movement instead of booking the stock twice.
+func (s *VendorService) postReceiptStock(ctx context.Context, headers http.Header, receipt *GoodsReceipt, poNumber string) error {
+    notes := fmt.Sprintf("Goods receipt %s", receipt.ReceiptNumber)
+    if receipt.Notes != "" {
+        notes += ": " + receipt.Notes
+    }
+
+    for i := range receipt.Lines {
+        line := &receipt.Lines[i]
+        if line.StockPosted {
+            continue
+        }
+        movement := map[string]interface{}{
+            "product_id":       line.ProductID,
+            "movement_type":    "IN",
+            "quantity":         line.Quantity,
+            "unit_cost":        line.UnitCost,
+            "reference_number": poNumber,
+            "movement_date":    receipt.ReceivedDate,
+            "notes":            notes,
+        }
+        lineHeaders := headers.Clone()
+        lineHeaders.Set("Idempotency-Key", fmt.Sprintf("goods-receipt-line-%d", line.ID))
+        if err := s.inventoryClient.Do(ctx, http.MethodPost, "/stock-movements", lineHeaders, movement, nil); err != nil {
+            return fmt.Errorf("line %d: %w", line.PurchaseOrderLineID, err)
+        }
+
+        if _, err := s.DB.ExecContext(ctx, "UPDATE goods_receipt_lines SET stock_posted_at = CURRENT_TIMESTAMP WHERE id = $1",
+            line.ID); err != nil {
+            return fmt.Errorf("line %d: %w", line.PurchaseOrderLineID, err)
+        }
+        line.StockPosted = true
+    }
+    return nil
+}
+
+// respondStockPending reports a receipt that is recorded but whose stock is not fully posted.
+// Receiving again would record a second receipt, so the client is pointed at the retry route.
+func (s *VendorService) respondStockPending(w http.ResponseWriter, orderID int, receipt *GoodsReceipt, err error) {
+    log.Printf("Stock for goods receipt %s is not fully posted: %v", receipt.ReceiptNumber, err)
+    s.RespondWithError(w, http.StatusBadGateway, "STOCK_POSTING_PENDING",
+        fmt.Sprintf("Goods receipt %s was recorded but its stock could not be posted to inventory; "+
+            "retry with POST /purchase-orders/%d/receipts/%d/post-stock", receipt.ReceiptNumber, orderID, receipt.ID))
+}
+
+// postReceiptStockHandler retries the stock movements of a goods receipt that were not posted
+func (s *VendorService) postReceiptStockHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+    defer cancel()
+
+    vars := mux.Vars(r)
+    orderID, err := strconv.Atoi(vars["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid purchase order ID")
+        return
+    }
+    receiptID, err := strconv.Atoi(vars["receiptId"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid goods receipt ID")
+        return
+    }
+
+    var receipt GoodsReceipt
+    var poNumber string
+    err = s.DB.QueryRowContext(ctx, `SELECT g.id, g.purchase_order_id, g.receipt_number, g.received_date,
+                                            COALESCE(g.notes, ''), COALESCE(g.received_by, 0), g.created_at, p.po_number
+                                     FROM goods_receipts g
+                                     JOIN purchase_orders p ON p.id = g.purchase_order_id
+                                     WHERE g.id = $1 AND g.purchase_order_id = $2 AND g.company_id = $3`,
+        receiptID, orderID, s.GetCompanyIDFromRequest(r)).Scan(&receipt.ID, &receipt.PurchaseOrderID,
+        &receipt.ReceiptNumber, &receipt.ReceivedDate, &receipt.Notes, &receipt.ReceivedBy, &receipt.CreatedAt, &poNumber)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Goods receipt not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching goods receipt")
+        return
+    }
+
+    receipt.Lines, err = s.loadGoodsReceiptLines(ctx, receipt.ID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching goods receipt lines")
+        return
+    }
+
+    if err := s.postReceiptStock(ctx, client.ForwardHeaders(r), &receipt, poNumber); err != nil {
+        s.respondStockPending(w, orderID, &receipt, err)
+        return
+    }
+    s.RespondWithJSON(w, http.StatusOK, receipt)
+}
+
+func (s *VendorService) loadGoodsReceiptLines(ctx context.Context, receiptID int) ([]GoodsReceiptLine, error) {
+    rows, err := s.DB.QueryContext(ctx, `SELECT id, goods_receipt_id, purchase_order_line_id, product_id, quantity,
+                                                unit_cost, stock_posted_at IS NOT NULL
+                                         FROM goods_receipt_lines WHERE goods_receipt_id = $1 ORDER BY id`, receiptID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var lines []GoodsReceiptLine
+    for rows.Next() {
+        var line GoodsReceiptLine
+        if err := rows.Scan(&line.ID, &line.GoodsReceiptID, &line.PurchaseOrderLineID, &line.ProductID,
+            &line.Quantity, &line.UnitCost, &line.StockPosted); err != nil {
+            return nil, err
+        }
+        lines = append(lines, line)
+    }
+    return lines, rows.Err()
+}
+
+func (s *VendorService) getGoodsReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid purchase order ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    rows, err := s.DB.QueryContext(ctx, `SELECT id, purchase_order_id, receipt_number, received_date,
+                                                COALESCE(notes, ''), COALESCE(received_by, 0), created_at
+                                         FROM goods_receipts WHERE purchase_order_id = $1 AND company_id = $2
+                                         ORDER BY received_date, id`, id, companyID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching goods receipts")
+        return
+    }
+    defer rows.Close()
+
+    receipts := []GoodsReceipt{}
+    index := make(map[int]int)
+    for rows.Next() {
+        var receipt GoodsReceipt
+        if err := rows.Scan(&receipt.ID, &receipt.PurchaseOrderID, &receipt.ReceiptNumber, &receipt.ReceivedDate,
+            &receipt.Notes, &receipt.ReceivedBy, &receipt.CreatedAt); err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error reading goods receipts")
+            return
+        }
+        index[receipt.ID] = len(receipts)
+        receipts = append(receipts, receipt)
+    }
+    rows.Close()
+
+    lineRows, err := s.DB.QueryContext(ctx, `SELECT l.id, l.goods_receipt_id, l.purchase_order_line_id, l.product_id,
+                                                    l.quantity, l.unit_cost, l.stock_posted_at IS NOT NULL
+                                             FROM goods_receipt_lines l
+                                             JOIN goods_receipts g ON g.id = l.goods_receipt_id
+                                             WHERE g.purchase_order_id = $1 AND g.company_id = $2
+                                             ORDER BY l.id`, id, companyID)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching goods receipt lines")
+        return
+    }
+    defer lineRows.Close()
+
+    for lineRows.Next() {
+        var line GoodsReceiptLine
+        if err := lineRows.Scan(&line.ID, &line.GoodsReceiptID, &line.PurchaseOrderLineID, &line.ProductID,
+            &line.Quantity, &line.UnitCost, &line.StockPosted); err != nil {
+            s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error reading goods receipt lines")
+            return
+        }
+        if i, ok := index[line.GoodsReceiptID]; ok {
+            receipts[i].Lines = append(receipts[i].Lines, line)
+        }
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, receipts)
+}
+
+func (s *VendorService) submitPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+    s.changePurchaseOrderStatus(w, r, "pending_approval")
+}
+
+func (s *VendorService) sendPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+    s.changePurchaseOrderStatus(w, r, "sent")
+}
+
+func (s *VendorService) cancelPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+    s.changePurchaseOrderStatus(w, r, "cancelled")
+}
+
+// changePurchaseOrderStatus moves a purchase order to status when the state machine allows it
+func (s *VendorService) changePurchaseOrderStatus(w http.ResponseWriter, r *http.Request, status string) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid purchase order ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    order, err := lockPurchaseOrder(ctx, tx, id, companyID)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Purchase order not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching purchase order")
+        return
+    }
+
+    if !canTransitionPurchaseOrder(order.Status, status) {
+        s.RespondWithError(w, http.StatusConflict, "INVALID_TRANSITION",
+            fmt.Sprintf("Cannot move purchase order from %s to %s", order.Status, status))
+        return
+    }
+
+    order.Status = status
+    err = tx.QueryRowContext(ctx,
+        "UPDATE purchase_orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 RETURNING updated_at",
+        order.Status, order.ID).Scan(&order.UpdatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error updating purchase order status")
+        return
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, order)
+}
+
+func (s *VendorService) approvePurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+    defer cancel()
+
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        s.RespondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid purchase order ID")
+        return
+    }
+
+    companyID := s.GetCompanyIDFromRequest(r)
+    userID := s.GetUserIDFromRequest(r)
+
+    tx, err := s.DB.BeginTx(ctx, nil)
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Transaction failed")
+        return
+    }
+    defer tx.Rollback()
+
+    order, err := lockPurchaseOrder(ctx, tx, id, companyID)
+    if err == sql.ErrNoRows {
+        s.RespondWithError(w, http.StatusNotFound, "NOT_FOUND", "Purchase order not found")
+        return
+    }
+    if err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "DB_ERROR", "Error fetching purchase order")
+        return
+    }
+
+    if !canTransitionPurchaseOrder(order.Status, "approved") {
+        s.RespondWithError(w, http.StatusConflict, "INVALID_TRANSITION",
+            fmt.Sprintf("Cannot move purchase order from %s to approved", order.Status))
+        return
+    }
+
+    if order.CreatedBy == userID {
+        separate, err := s.requireSeparateApprover(ctx, r, companyID)
+        if err != nil {
+            s.RespondWithError(w, http.StatusBadGateway, "COMPANY_SERVICE_ERROR", "Error checking approval settings")
+            return
+        }
+        if separate {
+            s.RespondWithError(w, http.StatusForbidden, "SEPARATE_APPROVER_REQUIRED",
+                "Purchase orders must be approved by someone other than their creator")
+            return
+        }
+    }
+
+    order.Status = "approved"
+    order.ApprovedBy = &userID
+    err = tx.QueryRowContext(ctx, `UPDATE purchase_orders 
+                                   SET status = $1, approved_by = $2, approved_at = CURRENT_TIMESTAMP, 
+                                       updated_at = CURRENT_TIMESTAMP 
+                                   WHERE id = $3 RETURNING approved_at, updated_at`,
+        order.Status, userID, order.ID).Scan(&order.ApprovedAt, &order.UpdatedAt)
+    if err != nil {
+        s.HandleDBError(w, err, "Error approving purchase order")
+        return
+    }
+
+    if err = tx.Commit(); err != nil {
+        s.RespondWithError(w, http.StatusInternalServerError, "COMMIT_ERROR", "Failed to commit")
+        return
+    }
+
+    s.RespondWithJSON(w, http.StatusOK, order)
+}
+
+// requireSeparateApprover reads the company's require_separate_approver setting.
+// The setting defaults to false when the company has not configured it.
+func (s *VendorService) requireSeparateApprover(ctx context.Context, r *http.Request, companyID int) (bool, error) {
+    var settings []struct {
+        SettingKey   string `json:"setting_key"`
+        SettingValue string `json:"setting_value"`
+    }
+
+    path := fmt.Sprintf("/companies/%d/settings", companyID)
+    if err := s.companyClient.Do(ctx, http.MethodGet, path, client.ForwardHeaders(r), nil, &settings); err != nil {
+        return false, err
+    }
+
+    for _, setting := range settings {
+        if setting.SettingKey == "require_separate_approver" {
+            return strconv.ParseBool(setting.SettingValue)
+        }
+    }
+    return false, nil
+}
+
+// purchaseOrderTax applies the order's tax rate and returns the tax in whole Rupiah.
+// With lines, tax is rounded per line and exempt lines carry none; without lines it is
+// taken on the subtotal.
+func purchaseOrderTax(order *PurchaseOrder) float64 {
+    if len(order.Lines) == 0 {
+        return math.Round(order.Subtotal * order.TaxRate / 100)
+    }
+
+    var total float64
+    for i := range order.Lines {
+        line := &order.Lines[i]
+        line.TaxAmount = 0
+        if !line.TaxExempt {
+            line.TaxAmount = math.Round(line.LineTotal * order.TaxRate / 100)
+        }
+        total += line.TaxAmount
+    }
+    return total
+}
+
+// companyPPNRate reads the tax_rate_ppn company setting, falling back to
+// TAX_RATE_PPN when company-service is unreachable or the setting is missing.
+func (s *VendorService) companyPPNRate(ctx context.Context, r *http.Request, companyID int) float64 {
+    if rate, ok := s.taxRates.get(companyID); ok {
+        return rate
+    }
+
+    var settings []struct {
+        SettingKey   string `json:"setting_key"`
+        SettingValue string `json:"setting_value"`
+    }
+
+    path := fmt.Sprintf("/companies/%d/settings", companyID)
+    if err := s.companyClient.Do(ctx, http.MethodGet, path, client.ForwardHeaders(r), nil, &settings); err != nil {
+        log.Printf("Falling back to default PPN rate for company %d: %v", companyID, err)
+        return s.defaultTaxRate
+    }
+
+    for _, setting := range settings {
+        if setting.SettingKey != "tax_rate_ppn" {
+            continue
+        }
+        if rate, err := strconv.ParseFloat(setting.SettingValue, 64); err == nil {
+            s.taxRates.set(companyID, rate)
+            return rate
+        }
+    }
+    s.taxRates.set(companyID, s.defaultTaxRate)
+    return s.defaultTaxRate
+}
+
+// lockPurchaseOrder loads a purchase order and locks its row for the rest of the transaction.
+func lockPurchaseOrder(ctx context.Context, tx *sql.Tx, id, companyID int) (*PurchaseOrder, error) {
+    var order PurchaseOrder
+    err := tx.QueryRowContext(ctx, `SELECT id, company_id, vendor_id, po_number, order_date, expected_date,
+                                           subtotal, tax_rate, tax_exempt, tax_amount, total_amount, status, 
+                                           COALESCE(created_by, 0), approved_by, approved_at, created_at, updated_at
+                                    FROM purchase_orders WHERE id = $1 AND company_id = $2 FOR UPDATE`,
+        id, companyID).Scan(&order.ID, &order.CompanyID, &order.VendorID, &order.PONumber,
+        &order.OrderDate, &order.ExpectedDate, &order.Subtotal, &order.TaxRate, &order.TaxExempt,
+        &order.TaxAmount, &order.TotalAmount, &order.Status, &order.CreatedBy, &order.ApprovedBy,
+        &order.ApprovedAt, &order.CreatedAt, &order.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &order, nil
+}
+
+func (s *VendorService) loadPurchaseOrderLines(ctx context.Context, orderID int) ([]PurchaseOrderLine, error) {
+    rows, err := s.DB.QueryContext(ctx, `SELECT id, purchase_order_id, product_id, description, quantity, 
+                                                quantity_received, unit_price, line_total, tax_exempt, tax_amount
+                                         FROM purchase_order_lines WHERE purchase_order_id = $1 ORDER BY id`, orderID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var lines []PurchaseOrderLine
+    for rows.Next() {
+        var line PurchaseOrderLine
+        if err := rows.Scan(&line.ID, &line.PurchaseOrderID, &line.ProductID, &line.Description,
+            &line.Quantity, &line.QuantityReceived, &line.UnitPrice, &line.LineTotal,
+            &line.TaxExempt, &line.TaxAmount); err != nil {
+            return nil, err
+        }
+        lines = append(lines, line)
+    }
+    return lines, rows.Err()
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
 }
\ No newline at end of file
@@ -0,0 +1,105 @@
+package main
+
+import (
+    "context"
+    "database/sql/driver"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/massehanto/accounting-system-go/shared/client"
+    "github.com/massehanto/accounting-system-go/shared/database/dbtest"
+    "github.com/massehanto/accounting-system-go/shared/service"
+)
+
+func TestPurchaseOrderApprovalRequiresSubmission(t *testing.T) {
+    if canTransitionPurchaseOrder("draft", "approved") {
+        t.Error("a draft order can be approved without being submitted")
+    }
+    for _, step := range [][2]string{{"draft", "pending_approval"}, {"pending_approval", "approved"}, {"approved", "sent"}} {
+        if !canTransitionPurchaseOrder(step[0], step[1]) {
+            t.Errorf("%s -> %s should be allowed", step[0], step[1])
+        }
+    }
+}
+
+// receiptDB stands in for the database where only updates are issued, recording the
+// arguments of each
+type receiptDB struct {
+    mu    sync.Mutex
+    execs [][]driver.Value
+}
+
+func (d *receiptDB) exec(_ *dbtest.Tx, _ string, args []driver.Value) (driver.Result, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    d.execs = append(d.execs, args)
+    return driver.RowsAffected(1), nil
+}
+
+func TestPostReceiptStockUsesLineIdempotencyKeys(t *testing.T) {
+    var keys []string
+    failLine := 0
+    inventory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var movement map[string]interface{}
+        json.NewDecoder(r.Body).Decode(&movement)
+        key := r.Header.Get("Idempotency-Key")
+        keys = append(keys, key)
+        if failLine != 0 && key == "goods-receipt-line-12" {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        if movement["movement_type"] != "IN" || r.Header.Get("Authorization") != "Bearer user-token" {
+            t.Errorf("unexpected movement %v with auth %q", movement, r.Header.Get("Authorization"))
+        }
+        w.WriteHeader(http.StatusCreated)
+    }))
+    defer inventory.Close()
+
+    receipts := &receiptDB{}
+    db := dbtest.Open(&dbtest.Driver{Exec: receipts.exec})
+    defer db.Close()
+    s := &VendorService{BaseService: &service.BaseService{DB: db}, inventoryClient: client.New(inventory.URL)}
+
+    receipt := GoodsReceipt{
+        ID:            7,
+        ReceiptNumber: "PO-0001-GR01",
+        ReceivedDate:  time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+        Lines: []GoodsReceiptLine{
+            {ID: 11, PurchaseOrderLineID: 1, ProductID: 100, Quantity: 5, UnitCost: 1000},
+            {ID: 12, PurchaseOrderLineID: 2, ProductID: 101, Quantity: 3, UnitCost: 2000},
+        },
+    }
+    headers := http.Header{"Authorization": {"Bearer user-token"}}
+
+    // The second line fails: the first stays posted and the second is left for a retry
+    failLine = 12
+    if err := s.postReceiptStock(context.Background(), headers, &receipt, "PO-0001"); err == nil {
+        t.Fatal("expected an error when inventory-service rejects a line")
+    }
+    if !receipt.Lines[0].StockPosted || receipt.Lines[1].StockPosted {
+        t.Fatalf("stock_posted = %v, %v; want true, false", receipt.Lines[0].StockPosted, receipt.Lines[1].StockPosted)
+    }
+
+    // The retry only posts the outstanding line, with the same key as before
+    failLine = 0
+    keys = nil
+    if err := s.postReceiptStock(context.Background(), headers, &receipt, "PO-0001"); err != nil {
+        t.Fatalf("retry: %v", err)
+    }
+    if len(keys) != 1 || keys[0] != "goods-receipt-line-12" {
+        t.Errorf("retry posted with keys %v, want [goods-receipt-line-12]", keys)
+    }
+    if !receipt.Lines[1].StockPosted {
+        t.Error("retried line not marked as posted")
+    }
+
+    receipts.mu.Lock()
+    defer receipts.mu.Unlock()
+    if len(receipts.execs) != 2 || receipts.execs[0][0] != int64(11) || receipts.execs[1][0] != int64(12) {
+        t.Errorf("stock_posted_at updates = %v, want one each for lines 11 and 12", receipts.execs)
+    }
+}
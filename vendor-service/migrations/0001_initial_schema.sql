@@ -0,0 +1,56 @@
+-- vendor-service/migrations/0001_initial_schema.sql
+-- Baseline schema, as database/init-db.sql creates it. Later schema changes are the numbered
+-- migrations that follow; each is also safe to run on a database that already has it.
+
+CREATE TABLE IF NOT EXISTS vendors (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    vendor_code VARCHAR(20) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    phone VARCHAR(20),
+    address TEXT,
+    tax_id VARCHAR(50),
+    payment_terms INTEGER DEFAULT 30 CHECK (payment_terms >= 0 AND payment_terms <= 365),
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, vendor_code),
+    CONSTRAINT check_vendor_tax_id CHECK (tax_id IS NULL OR tax_id ~ '^\d{2}\.\d{3}\.\d{3}\.\d{1}-\d{3}\.\d{3}$')
+);
+
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    vendor_id INTEGER REFERENCES vendors(id),
+    po_number VARCHAR(50) NOT NULL,
+    order_date DATE NOT NULL,
+    expected_date DATE,
+    subtotal DECIMAL(15,0) NOT NULL CHECK (subtotal >= 0),
+    tax_amount DECIMAL(15,0) DEFAULT 0 CHECK (tax_amount >= 0),
+    total_amount DECIMAL(15,0) NOT NULL CHECK (total_amount >= 0),
+    status VARCHAR(20) DEFAULT 'draft' CHECK (status IN ('draft', 'sent', 'confirmed', 'delivered', 'cancelled')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, po_number),
+    CONSTRAINT check_idr_po_amounts CHECK (
+        subtotal = ROUND(subtotal) AND 
+        tax_amount = ROUND(tax_amount) AND 
+        total_amount = ROUND(total_amount)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_vendors_company_active ON vendors(company_id, is_active) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_company_status ON purchase_orders(company_id, status);
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_date ON purchase_orders(company_id, order_date);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER update_vendors_updated_at BEFORE UPDATE ON vendors FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE OR REPLACE TRIGGER update_purchase_orders_updated_at BEFORE UPDATE ON purchase_orders FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,23 @@
+-- vendor-service/migrations/0002_purchase_order_lines.sql
+-- Purchase order lines, received into inventory-service stock
+ALTER TABLE purchase_orders DROP CONSTRAINT IF EXISTS purchase_orders_status_check;
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_status_check
+    CHECK (status IN ('draft', 'sent', 'ordered', 'confirmed', 'partially_received', 'received', 'delivered', 'cancelled'));
+
+CREATE TABLE IF NOT EXISTS purchase_order_lines (
+    id SERIAL PRIMARY KEY,
+    purchase_order_id INTEGER REFERENCES purchase_orders(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL, -- Reference to inventory service (no FK constraint across services)
+    description VARCHAR(255),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    quantity_received INTEGER NOT NULL DEFAULT 0 CHECK (quantity_received >= 0),
+    unit_price DECIMAL(15,0) NOT NULL CHECK (unit_price >= 0),
+    line_total DECIMAL(15,0) NOT NULL CHECK (line_total >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_received_not_over_ordered CHECK (quantity_received <= quantity),
+    CONSTRAINT check_idr_po_line_amounts CHECK (
+        unit_price = ROUND(unit_price) AND line_total = ROUND(line_total)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_order ON purchase_order_lines(purchase_order_id);
@@ -0,0 +1,9 @@
+-- vendor-service/migrations/0003_purchase_order_approval.sql
+-- Submit and approval workflow for purchase orders
+ALTER TABLE purchase_orders DROP CONSTRAINT IF EXISTS purchase_orders_status_check;
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_status_check
+    CHECK (status IN ('draft', 'pending_approval', 'approved', 'sent', 'ordered', 'confirmed', 'partially_received', 'received', 'delivered', 'cancelled'));
+
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS created_by INTEGER;
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS approved_by INTEGER;
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS approved_at TIMESTAMP;
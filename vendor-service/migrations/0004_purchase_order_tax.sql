@@ -0,0 +1,14 @@
+-- vendor-service/migrations/0004_purchase_order_tax.sql
+-- The PPN rate a purchase order was raised at, and tax per line
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS tax_rate DECIMAL(5,2) NOT NULL DEFAULT 0 CHECK (tax_rate >= 0 AND tax_rate <= 100);
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS tax_exempt BOOLEAN DEFAULT FALSE;
+
+ALTER TABLE purchase_order_lines ADD COLUMN IF NOT EXISTS tax_exempt BOOLEAN DEFAULT FALSE;
+ALTER TABLE purchase_order_lines ADD COLUMN IF NOT EXISTS tax_amount DECIMAL(15,0) DEFAULT 0 CHECK (tax_amount >= 0);
+
+ALTER TABLE purchase_order_lines DROP CONSTRAINT IF EXISTS check_idr_po_line_amounts;
+ALTER TABLE purchase_order_lines ADD CONSTRAINT check_idr_po_line_amounts CHECK (
+    unit_price = ROUND(unit_price) AND 
+    line_total = ROUND(line_total) AND 
+    tax_amount = ROUND(tax_amount)
+);
@@ -0,0 +1,25 @@
+-- vendor-service/migrations/0005_goods_receipts.sql
+-- Goods receipts recorded when purchase orders are received
+CREATE TABLE IF NOT EXISTS goods_receipts (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    purchase_order_id INTEGER REFERENCES purchase_orders(id),
+    receipt_number VARCHAR(60) NOT NULL,
+    received_date DATE NOT NULL,
+    notes TEXT,
+    received_by INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, receipt_number)
+);
+
+CREATE TABLE IF NOT EXISTS goods_receipt_lines (
+    id SERIAL PRIMARY KEY,
+    goods_receipt_id INTEGER REFERENCES goods_receipts(id) ON DELETE CASCADE,
+    purchase_order_line_id INTEGER REFERENCES purchase_order_lines(id),
+    product_id INTEGER NOT NULL, -- Reference to inventory service (no FK constraint across services)
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_cost DECIMAL(15,0) NOT NULL CHECK (unit_cost >= 0 AND unit_cost = ROUND(unit_cost))
+);
+
+CREATE INDEX IF NOT EXISTS idx_goods_receipts_order ON goods_receipts(purchase_order_id);
+CREATE INDEX IF NOT EXISTS idx_goods_receipt_lines_receipt ON goods_receipt_lines(goods_receipt_id);
@@ -0,0 +1,47 @@
+-- vendor-service/migrations/0006_vendor_bills.sql
+-- Vendor bills and their payments, for accounts payable
+CREATE TABLE IF NOT EXISTS vendor_bills (
+    id SERIAL PRIMARY KEY,
+    company_id INTEGER NOT NULL,
+    vendor_id INTEGER NOT NULL REFERENCES vendors(id),
+    purchase_order_id INTEGER REFERENCES purchase_orders(id),
+    bill_number VARCHAR(100) NOT NULL, -- The vendor's own invoice number
+    bill_date DATE NOT NULL,
+    due_date DATE NOT NULL,
+    subtotal DECIMAL(15,0) NOT NULL CHECK (subtotal >= 0),
+    tax_amount DECIMAL(15,0) DEFAULT 0 CHECK (tax_amount >= 0),
+    total_amount DECIMAL(15,0) NOT NULL CHECK (total_amount > 0),
+    amount_paid DECIMAL(15,0) NOT NULL DEFAULT 0 CHECK (amount_paid >= 0),
+    status VARCHAR(20) DEFAULT 'open' CHECK (status IN ('open', 'partially_paid', 'paid', 'cancelled')),
+    notes TEXT,
+    created_by INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(company_id, vendor_id, bill_number),
+    CONSTRAINT check_bill_due_date CHECK (due_date >= bill_date),
+    CONSTRAINT check_bill_paid_not_over_total CHECK (amount_paid <= total_amount),
+    CONSTRAINT check_idr_bill_amounts CHECK (
+        subtotal = ROUND(subtotal) AND 
+        tax_amount = ROUND(tax_amount) AND 
+        total_amount = ROUND(total_amount) AND 
+        amount_paid = ROUND(amount_paid)
+    )
+);
+
+CREATE TABLE IF NOT EXISTS vendor_bill_payments (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER REFERENCES vendor_bills(id) ON DELETE CASCADE,
+    company_id INTEGER NOT NULL,
+    amount DECIMAL(15,0) NOT NULL CHECK (amount > 0 AND amount = ROUND(amount)),
+    payment_date DATE NOT NULL,
+    payment_method VARCHAR(20) NOT NULL CHECK (payment_method IN ('cash', 'bank_transfer', 'credit_card', 'giro', 'other')),
+    reference VARCHAR(100),
+    notes TEXT,
+    created_by INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_vendor_bills_company_due ON vendor_bills(company_id, due_date) WHERE status IN ('open', 'partially_paid');
+CREATE INDEX IF NOT EXISTS idx_vendor_bill_payments_bill ON vendor_bill_payments(bill_id);
+
+CREATE OR REPLACE TRIGGER update_vendor_bills_updated_at BEFORE UPDATE ON vendor_bills FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
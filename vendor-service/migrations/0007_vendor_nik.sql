@@ -0,0 +1,5 @@
+-- vendor-service/migrations/0007_vendor_nik.sql
+-- Identity number of vendors who are individuals, needed to withhold PPh 21 from their fees
+ALTER TABLE vendors ADD COLUMN IF NOT EXISTS nik CHAR(16);
+ALTER TABLE vendors DROP CONSTRAINT IF EXISTS check_vendor_nik;
+ALTER TABLE vendors ADD CONSTRAINT check_vendor_nik CHECK (nik IS NULL OR nik ~ '^\d{16}$');
@@ -0,0 +1,6 @@
+-- vendor-service/migrations/0008_goods_receipt_stock_posting.sql
+-- Stock for a receipt line is posted to inventory-service after the receipt commits; lines
+-- still NULL here are retried with POST /purchase-orders/{id}/receipts/{receiptId}/post-stock.
+-- Receipts recorded before this change posted their stock before committing.
+ALTER TABLE goods_receipt_lines ADD COLUMN IF NOT EXISTS stock_posted_at TIMESTAMP;
+UPDATE goods_receipt_lines SET stock_posted_at = CURRENT_TIMESTAMP WHERE stock_posted_at IS NULL;